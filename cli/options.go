@@ -3,6 +3,8 @@ package cli
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // Command represents the high-level action requested by the user.
@@ -13,6 +15,17 @@ const (
 	CommandStatus
 	CommandStop
 	CommandVersion
+	CommandConfig
+	CommandReload
+	CommandImport
+	CommandExport
+	CommandInit
+	CommandPort
+	CommandStartTunnels
+	CommandRestart
+	CommandLogs
+	CommandDaemon
+	CommandService
 )
 
 // Options captures parsed CLI arguments.
@@ -21,15 +34,64 @@ type Options struct {
 	Detach         bool
 	InternalDaemon bool
 	TunnelNames    []string
+	Tags           []string
+	Exclude        []string
+	Profile        string
+	ConfigAction   string
+	DaemonAction   string
+	ImportSource   string
+	HostPattern    string
+	DryRun         bool
+	ExportFormat   string
+	Host           string
+	Name           string
+	Ports          []string
+	Project        bool
+	JSON           bool
+	Watch          bool
+	Follow         bool
+	Since          time.Duration
+
+	// Supervise runs the detached daemon under a supervisor process, which
+	// is started with InternalSupervisor.
+	Supervise          bool
+	InternalSupervisor bool
+
+	// ServiceAction is the action of the service command: install,
+	// uninstall or status.
+	ServiceAction string
 }
 
 var (
 	errStatusWithDetach  = errors.New("status command cannot be used with --detach")
 	errStatusWithArgs    = errors.New("status command does not accept tunnel names")
 	errStopWithDetach    = errors.New("stop command cannot be used with --detach")
-	errStopWithArgs      = errors.New("stop command does not accept tunnel names")
+	errStopSelection     = errors.New("stop command only accepts tunnel or tunnel/port references")
 	errVersionWithDetach = errors.New("version command cannot be used with --detach")
 	errVersionWithArgs   = errors.New("version command does not accept additional arguments")
+	errConfigWithDetach  = errors.New("config command cannot be used with --detach")
+	errReloadWithDetach  = errors.New("reload command cannot be used with --detach")
+	errReloadWithArgs    = errors.New("reload command does not accept tunnel names")
+	errConfigAction      = errors.New("config command requires an action: validate, schema or show")
+	errImportWithDetach  = errors.New("import command cannot be used with --detach")
+	errImportSource      = errors.New("import command requires a source: ssh-config")
+	errExportWithDetach  = errors.New("export command cannot be used with --detach")
+	errInitWithDetach    = errors.New("init command cannot be used with --detach")
+	errInitWithArgs      = errors.New("init command does not accept tunnel names; use --host, --name and --port")
+	errPortWithDetach    = errors.New("port command cannot be used with --detach")
+	errPortArgs          = errors.New("port command requires a single tunnel or tunnel/port reference")
+	errStartWithDetach   = errors.New("start command cannot be used with --detach")
+	errStartArgs         = errors.New("start command requires tunnel or tunnel/port references")
+	errRestartWithDetach = errors.New("restart command cannot be used with --detach")
+	errRestartArgs       = errors.New("restart command requires tunnel or tunnel/port references")
+	errLogsWithDetach    = errors.New("logs command cannot be used with --detach")
+	errLogsArgs          = errors.New("logs command accepts at most one tunnel name")
+	errDaemonWithDetach  = errors.New("daemon command cannot be used with --detach")
+	errDaemonAction      = errors.New("daemon command requires an action: run or upgrade")
+	errServiceWithDetach = errors.New("service command cannot be used with --detach")
+	errServiceAction     = errors.New("service command requires an action: install, uninstall or status")
+	errProfileNotStart   = errors.New("--profile can only be used when starting or exporting tunnels")
+	errSuperviseDetach   = errors.New("--supervise can only be used with --detach")
 )
 
 // Parse inspects the provided arguments and produces structured options.
@@ -49,17 +111,150 @@ func Parse(args []string) (*Options, error) {
 			if opts.Command == CommandVersion {
 				return nil, errVersionWithDetach
 			}
+			if opts.Command == CommandConfig {
+				return nil, errConfigWithDetach
+			}
+			if opts.Command == CommandReload {
+				return nil, errReloadWithDetach
+			}
+			if opts.Command == CommandImport {
+				return nil, errImportWithDetach
+			}
+			if opts.Command == CommandExport {
+				return nil, errExportWithDetach
+			}
+			if opts.Command == CommandInit {
+				return nil, errInitWithDetach
+			}
+			if opts.Command == CommandPort {
+				return nil, errPortWithDetach
+			}
+			if opts.Command == CommandStartTunnels {
+				return nil, errStartWithDetach
+			}
+			if opts.Command == CommandRestart {
+				return nil, errRestartWithDetach
+			}
+			if opts.Command == CommandLogs {
+				return nil, errLogsWithDetach
+			}
+			if opts.Command == CommandDaemon {
+				return nil, errDaemonWithDetach
+			}
+			if opts.Command == CommandService {
+				return nil, errServiceWithDetach
+			}
 			opts.Detach = true
 		case "--internal-daemon":
 			opts.InternalDaemon = true
+		case "--internal-supervisor":
+			opts.InternalSupervisor = true
+		case "--supervise":
+			opts.Supervise = true
+		case "-p", "--profile":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("%s requires a profile name", arg)
+			}
+			i++
+			if err := opts.setProfile(args[i]); err != nil {
+				return nil, err
+			}
+		case "-x", "--exclude":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("%s requires a tunnel name or pattern", arg)
+			}
+			i++
+			if err := opts.addExclude(args[i]); err != nil {
+				return nil, err
+			}
+		case "-t", "--tag":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("%s requires a tag name", arg)
+			}
+			i++
+			if err := opts.addTag(args[i]); err != nil {
+				return nil, err
+			}
+		case "--host":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("%s requires a host", arg)
+			}
+			i++
+			if err := opts.setHost(args[i]); err != nil {
+				return nil, err
+			}
+		case "--name":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("%s requires a tunnel name", arg)
+			}
+			i++
+			if err := opts.setName(args[i]); err != nil {
+				return nil, err
+			}
+		case "--port":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("%s requires a port mapping", arg)
+			}
+			i++
+			if err := opts.addPort(args[i]); err != nil {
+				return nil, err
+			}
+		case "--project":
+			if opts.Command != CommandInit {
+				return nil, fmt.Errorf("%s can only be used with init", arg)
+			}
+			opts.Project = true
+		case "-f", "--format":
+			if arg == "-f" && opts.Command == CommandLogs {
+				opts.Follow = true
+				continue
+			}
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("%s requires a format", arg)
+			}
+			i++
+			if err := opts.setExportFormat(args[i]); err != nil {
+				return nil, err
+			}
+		case "--json":
+			if opts.Command != CommandConfig || opts.ConfigAction != "show" {
+				return nil, fmt.Errorf("%s can only be used with config show", arg)
+			}
+			opts.JSON = true
+		case "--follow":
+			if opts.Command != CommandLogs {
+				return nil, fmt.Errorf("%s can only be used with logs", arg)
+			}
+			opts.Follow = true
+		case "--since":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("%s requires a duration such as 10m", arg)
+			}
+			i++
+			if err := opts.setSince(args[i]); err != nil {
+				return nil, err
+			}
+		case "-w", "--watch":
+			if opts.Command != CommandStatus {
+				return nil, fmt.Errorf("%s can only be used with status", arg)
+			}
+			opts.Watch = true
+		case "-n", "--dry-run":
+			if opts.Command != CommandImport {
+				return nil, fmt.Errorf("%s can only be used with import", arg)
+			}
+			opts.DryRun = true
 		case "status":
 			if opts.Command != CommandStart {
 				return nil, fmt.Errorf("duplicate command")
 			}
+			if opts.Profile != "" {
+				return nil, errProfileNotStart
+			}
 			if opts.Detach {
 				return nil, errStatusWithDetach
 			}
-			if len(opts.TunnelNames) > 0 {
+			if opts.hasSelection() {
 				return nil, errStatusWithArgs
 			}
 			opts.Command = CommandStatus
@@ -67,42 +262,404 @@ func Parse(args []string) (*Options, error) {
 			if opts.Command != CommandStart {
 				return nil, fmt.Errorf("duplicate command")
 			}
+			if opts.Profile != "" {
+				return nil, errProfileNotStart
+			}
 			if opts.Detach {
 				return nil, errStopWithDetach
 			}
-			if len(opts.TunnelNames) > 0 {
-				return nil, errStopWithArgs
+			if len(opts.Tags) > 0 || len(opts.Exclude) > 0 {
+				return nil, errStopSelection
 			}
 			opts.Command = CommandStop
+		case "start", "restart":
+			if opts.Command != CommandStart {
+				return nil, fmt.Errorf("duplicate command")
+			}
+			if opts.Profile != "" {
+				return nil, errProfileNotStart
+			}
+			if arg == "start" {
+				if opts.Detach {
+					return nil, errStartWithDetach
+				}
+				if opts.hasSelection() {
+					return nil, errStartArgs
+				}
+				opts.Command = CommandStartTunnels
+				continue
+			}
+			if opts.Detach {
+				return nil, errRestartWithDetach
+			}
+			if opts.hasSelection() {
+				return nil, errRestartArgs
+			}
+			opts.Command = CommandRestart
+		case "reload":
+			if opts.Command != CommandStart {
+				return nil, fmt.Errorf("duplicate command")
+			}
+			if opts.Profile != "" {
+				return nil, errProfileNotStart
+			}
+			if opts.Detach {
+				return nil, errReloadWithDetach
+			}
+			if opts.hasSelection() {
+				return nil, errReloadWithArgs
+			}
+			opts.Command = CommandReload
 		case "version":
 			if opts.Command != CommandStart {
 				return nil, fmt.Errorf("duplicate command")
 			}
+			if opts.Profile != "" {
+				return nil, errProfileNotStart
+			}
 			if opts.Detach {
 				return nil, errVersionWithDetach
 			}
-			if len(opts.TunnelNames) > 0 {
+			if opts.hasSelection() {
 				return nil, errVersionWithArgs
 			}
 			opts.Command = CommandVersion
+		case "config":
+			if opts.Command != CommandStart {
+				return nil, fmt.Errorf("duplicate command")
+			}
+			if opts.Detach {
+				return nil, errConfigWithDetach
+			}
+			if opts.hasSelection() || i+1 >= len(args) {
+				return nil, errConfigAction
+			}
+			i++
+			switch args[i] {
+			case "validate", "schema", "show":
+				opts.ConfigAction = args[i]
+			default:
+				return nil, fmt.Errorf("unknown config action: %s", args[i])
+			}
+			if opts.Profile != "" && opts.ConfigAction != "show" {
+				return nil, errProfileNotStart
+			}
+			opts.Command = CommandConfig
+		case "import":
+			if opts.Command != CommandStart {
+				return nil, fmt.Errorf("duplicate command")
+			}
+			if opts.Profile != "" {
+				return nil, errProfileNotStart
+			}
+			if opts.Detach {
+				return nil, errImportWithDetach
+			}
+			if opts.hasSelection() || i+1 >= len(args) {
+				return nil, errImportSource
+			}
+			i++
+			switch args[i] {
+			case "ssh-config":
+				opts.ImportSource = args[i]
+			default:
+				return nil, fmt.Errorf("unknown import source: %s", args[i])
+			}
+			opts.Command = CommandImport
+		case "export":
+			if opts.Command != CommandStart {
+				return nil, fmt.Errorf("duplicate command")
+			}
+			if opts.Detach {
+				return nil, errExportWithDetach
+			}
+			opts.Command = CommandExport
+		case "init":
+			if opts.Command != CommandStart {
+				return nil, fmt.Errorf("duplicate command")
+			}
+			if opts.Profile != "" {
+				return nil, errProfileNotStart
+			}
+			if opts.Detach {
+				return nil, errInitWithDetach
+			}
+			if opts.hasSelection() {
+				return nil, errInitWithArgs
+			}
+			opts.Command = CommandInit
+		case "port":
+			if opts.Command != CommandStart {
+				return nil, fmt.Errorf("duplicate command")
+			}
+			if opts.Profile != "" {
+				return nil, errProfileNotStart
+			}
+			if opts.Detach {
+				return nil, errPortWithDetach
+			}
+			if opts.hasSelection() || i+1 >= len(args) || strings.HasPrefix(args[i+1], "-") {
+				return nil, errPortArgs
+			}
+			i++
+			opts.TunnelNames = []string{args[i]}
+			opts.Command = CommandPort
+		case "logs":
+			if opts.Command != CommandStart {
+				return nil, fmt.Errorf("duplicate command")
+			}
+			if opts.Profile != "" {
+				return nil, errProfileNotStart
+			}
+			if opts.Detach {
+				return nil, errLogsWithDetach
+			}
+			if opts.hasSelection() {
+				return nil, errLogsArgs
+			}
+			opts.Command = CommandLogs
+		case "daemon":
+			if opts.Command != CommandStart {
+				return nil, fmt.Errorf("duplicate command")
+			}
+			if opts.Detach {
+				return nil, errDaemonWithDetach
+			}
+			if opts.hasSelection() || i+1 >= len(args) {
+				return nil, errDaemonAction
+			}
+			i++
+			switch args[i] {
+			case "run", "upgrade":
+				opts.DaemonAction = args[i]
+			default:
+				return nil, fmt.Errorf("unknown daemon action: %s", args[i])
+			}
+			if opts.Profile != "" && opts.DaemonAction != "run" {
+				return nil, errProfileNotStart
+			}
+			opts.Command = CommandDaemon
+		case "service":
+			if opts.Command != CommandStart {
+				return nil, fmt.Errorf("duplicate command")
+			}
+			if opts.Detach {
+				return nil, errServiceWithDetach
+			}
+			if opts.hasSelection() || i+1 >= len(args) {
+				return nil, errServiceAction
+			}
+			i++
+			switch args[i] {
+			case "install", "uninstall", "status":
+				opts.ServiceAction = args[i]
+			default:
+				return nil, fmt.Errorf("unknown service action: %s", args[i])
+			}
+			opts.Command = CommandService
 		case "-h", "--help":
-			return nil, fmt.Errorf("usage: tunn [--detach|-d] [tunnel ...]\n       tunn status\n       tunn version")
+			return nil, fmt.Errorf("usage: tunn [--detach|-d [--supervise]] [--profile name] [--tag tag] [--exclude pattern] [tunnel|pattern|tunnel/port|@group ...]\n       tunn status [--watch]\n       tunn stop\n       tunn start|stop|restart tunnel[/port] ...\n       tunn reload\n       tunn port tunnel[/port]\n       tunn logs [tunnel] [-f] [--since 10m]\n       tunn daemon run [--profile name] [--tag tag] [--exclude pattern] [tunnel ...]\n       tunn daemon upgrade\n       tunn service install|uninstall|status [--profile name]\n       tunn config validate|schema\n       tunn config show [--json] [--profile name] [tunnel ...]\n       tunn import ssh-config [--host pattern] [--dry-run]\n       tunn export [--format ssh-config|shell|json] [--profile name] [tunnel ...]\n       tunn init [--project] [--host alias --port mapping ... [--name name]]\n       tunn version")
 		default:
+			if value, ok := strings.CutPrefix(arg, "--profile="); ok {
+				if err := opts.setProfile(value); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if value, ok := strings.CutPrefix(arg, "--exclude="); ok {
+				if err := opts.addExclude(value); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if value, ok := strings.CutPrefix(arg, "--format="); ok {
+				if err := opts.setExportFormat(value); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if value, ok := strings.CutPrefix(arg, "--host="); ok {
+				if err := opts.setHost(value); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if value, ok := strings.CutPrefix(arg, "--name="); ok {
+				if err := opts.setName(value); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if value, ok := strings.CutPrefix(arg, "--port="); ok {
+				if err := opts.addPort(value); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if value, ok := strings.CutPrefix(arg, "--since="); ok {
+				if err := opts.setSince(value); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if value, ok := strings.CutPrefix(arg, "--tag="); ok {
+				if err := opts.addTag(value); err != nil {
+					return nil, err
+				}
+				continue
+			}
 			if len(arg) > 0 && arg[0] == '-' {
 				return nil, fmt.Errorf("unknown flag: %s", arg)
 			}
 			if opts.Command == CommandStatus {
 				return nil, errStatusWithArgs
 			}
-			if opts.Command == CommandStop {
-				return nil, errStopWithArgs
-			}
 			if opts.Command == CommandVersion {
 				return nil, errVersionWithArgs
 			}
+			if opts.Command == CommandConfig && opts.ConfigAction != "show" {
+				return nil, fmt.Errorf("config %s does not accept additional arguments", opts.ConfigAction)
+			}
+			if opts.Command == CommandReload {
+				return nil, errReloadWithArgs
+			}
+			if opts.Command == CommandImport {
+				return nil, fmt.Errorf("import %s does not accept additional arguments", opts.ImportSource)
+			}
+			if opts.Command == CommandInit {
+				return nil, errInitWithArgs
+			}
+			if opts.Command == CommandPort {
+				return nil, errPortArgs
+			}
+			if opts.Command == CommandDaemon && opts.DaemonAction != "run" {
+				return nil, fmt.Errorf("daemon %s does not accept additional arguments", opts.DaemonAction)
+			}
+			if opts.Command == CommandService {
+				return nil, fmt.Errorf("service %s does not accept additional arguments", opts.ServiceAction)
+			}
+			if opts.Command == CommandLogs && len(opts.TunnelNames) > 0 {
+				return nil, errLogsArgs
+			}
 			opts.TunnelNames = append(opts.TunnelNames, arg)
 		}
 	}
 
+	if opts.Supervise && (opts.Command != CommandStart || !opts.Detach) {
+		return nil, errSuperviseDetach
+	}
+	if opts.Command == CommandStartTunnels && len(opts.TunnelNames) == 0 {
+		return nil, errStartArgs
+	}
+	if opts.Command == CommandRestart && len(opts.TunnelNames) == 0 {
+		return nil, errRestartArgs
+	}
 	return opts, nil
 }
+
+func (o *Options) hasSelection() bool {
+	return len(o.TunnelNames) > 0 || len(o.Tags) > 0 || len(o.Exclude) > 0
+}
+
+// selectsTunnels reports whether the command operates on a tunnel selection.
+func (o *Options) selectsTunnels() bool {
+	return o.Command == CommandStart || o.Command == CommandExport || o.Command == CommandConfig && o.ConfigAction == "show" ||
+		o.Command == CommandDaemon && o.DaemonAction == "run"
+}
+
+func (o *Options) addExclude(pattern string) error {
+	if !o.selectsTunnels() {
+		return fmt.Errorf("--exclude can only be used when starting or exporting tunnels")
+	}
+	if pattern == "" {
+		return fmt.Errorf("--exclude requires a tunnel name or pattern")
+	}
+	o.Exclude = append(o.Exclude, pattern)
+	return nil
+}
+
+func (o *Options) setProfile(profile string) error {
+	// A service runs the daemon with the profile it was installed for.
+	if !o.selectsTunnels() && o.Command != CommandService {
+		return errProfileNotStart
+	}
+	if profile == "" {
+		return fmt.Errorf("--profile requires a profile name")
+	}
+	o.Profile = profile
+	return nil
+}
+
+func (o *Options) setExportFormat(format string) error {
+	if o.Command != CommandExport {
+		return fmt.Errorf("--format can only be used with export")
+	}
+	if format == "" {
+		return fmt.Errorf("--format requires a format")
+	}
+	o.ExportFormat = format
+	return nil
+}
+
+// setSince records --since for logs, a duration before now.
+func (o *Options) setSince(value string) error {
+	if o.Command != CommandLogs {
+		return fmt.Errorf("--since can only be used with logs")
+	}
+	since, err := time.ParseDuration(value)
+	if err != nil || since <= 0 {
+		return fmt.Errorf("--since requires a duration such as 10m, got %q", value)
+	}
+	o.Since = since
+	return nil
+}
+
+// setHost records --host, which filters aliases for import and names the
+// SSH host of the new tunnel for init.
+func (o *Options) setHost(host string) error {
+	if host == "" {
+		return fmt.Errorf("--host requires a host")
+	}
+	switch o.Command {
+	case CommandImport:
+		o.HostPattern = host
+	case CommandInit:
+		o.Host = host
+	default:
+		return fmt.Errorf("--host can only be used with import or init")
+	}
+	return nil
+}
+
+func (o *Options) setName(name string) error {
+	if o.Command != CommandInit {
+		return fmt.Errorf("--name can only be used with init")
+	}
+	if name == "" {
+		return fmt.Errorf("--name requires a tunnel name")
+	}
+	o.Name = name
+	return nil
+}
+
+func (o *Options) addPort(mapping string) error {
+	if o.Command != CommandInit {
+		return fmt.Errorf("--port can only be used with init")
+	}
+	if mapping == "" {
+		return fmt.Errorf("--port requires a port mapping")
+	}
+	o.Ports = append(o.Ports, mapping)
+	return nil
+}
+
+func (o *Options) addTag(tag string) error {
+	if !o.selectsTunnels() {
+		return fmt.Errorf("--tag can only be used when starting or exporting tunnels")
+	}
+	if tag == "" {
+		return fmt.Errorf("--tag requires a tag name")
+	}
+	o.Tags = append(o.Tags, tag)
+	return nil
+}
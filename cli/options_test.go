@@ -1,6 +1,10 @@
 package cli
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestParse(t *testing.T) {
 	tests := []struct {
@@ -59,15 +63,180 @@ func TestParse(t *testing.T) {
 			input: []string{"stop"},
 			want:  Options{Command: CommandStop},
 		},
+		{
+			name:  "logs",
+			input: []string{"logs"},
+			want:  Options{Command: CommandLogs},
+		},
+		{
+			name:  "logs follow since",
+			input: []string{"logs", "db", "-f", "--since", "10m"},
+			want:  Options{Command: CommandLogs, TunnelNames: []string{"db"}, Follow: true, Since: 10 * time.Minute},
+		},
+		{
+			name:  "logs since equals",
+			input: []string{"logs", "--follow", "--since=1h30m"},
+			want:  Options{Command: CommandLogs, Follow: true, Since: 90 * time.Minute},
+		},
+		{
+			name:      "logs with two tunnels",
+			input:     []string{"logs", "db", "api"},
+			wantError: errLogsArgs.Error(),
+		},
+		{
+			name:      "logs bad since",
+			input:     []string{"logs", "--since", "yesterday"},
+			wantError: `--since requires a duration such as 10m, got "yesterday"`,
+		},
+		{
+			name:  "detach supervise",
+			input: []string{"--detach", "--supervise", "db"},
+			want:  Options{Command: CommandStart, Detach: true, Supervise: true, TunnelNames: []string{"db"}},
+		},
+		{
+			name:  "internal supervisor",
+			input: []string{"--internal-supervisor", "--tag", "prod"},
+			want:  Options{Command: CommandStart, InternalSupervisor: true, Tags: []string{"prod"}},
+		},
+		{
+			name:      "supervise without detach",
+			input:     []string{"--supervise"},
+			wantError: errSuperviseDetach.Error(),
+		},
+		{
+			name:      "supervise with status",
+			input:     []string{"status", "--supervise"},
+			wantError: errSuperviseDetach.Error(),
+		},
+		{
+			name:  "daemon upgrade",
+			input: []string{"daemon", "upgrade"},
+			want:  Options{Command: CommandDaemon, DaemonAction: "upgrade"},
+		},
+		{
+			name:      "daemon without action",
+			input:     []string{"daemon"},
+			wantError: errDaemonAction.Error(),
+		},
+		{
+			name:      "daemon unknown action",
+			input:     []string{"daemon", "reboot"},
+			wantError: "unknown daemon action: reboot",
+		},
+		{
+			name:      "daemon upgrade with detach",
+			input:     []string{"daemon", "upgrade", "-d"},
+			wantError: errDaemonWithDetach.Error(),
+		},
+		{
+			name:      "daemon upgrade with args",
+			input:     []string{"daemon", "upgrade", "db"},
+			wantError: "daemon upgrade does not accept additional arguments",
+		},
+		{
+			name:  "daemon run with selection",
+			input: []string{"daemon", "run", "--profile", "work", "--tag", "db", "api"},
+			want:  Options{Command: CommandDaemon, DaemonAction: "run", Profile: "work", Tags: []string{"db"}, TunnelNames: []string{"api"}},
+		},
+		{
+			name:  "profile before daemon run",
+			input: []string{"--profile", "work", "daemon", "run"},
+			want:  Options{Command: CommandDaemon, DaemonAction: "run", Profile: "work"},
+		},
+		{
+			name:      "profile with daemon upgrade",
+			input:     []string{"--profile", "work", "daemon", "upgrade"},
+			wantError: errProfileNotStart.Error(),
+		},
+		{
+			name:  "service install",
+			input: []string{"service", "install"},
+			want:  Options{Command: CommandService, ServiceAction: "install"},
+		},
+		{
+			name:  "service status with profile",
+			input: []string{"service", "status", "--profile", "work"},
+			want:  Options{Command: CommandService, ServiceAction: "status", Profile: "work"},
+		},
+		{
+			name:      "service without action",
+			input:     []string{"service"},
+			wantError: errServiceAction.Error(),
+		},
+		{
+			name:      "service unknown action",
+			input:     []string{"service", "enable"},
+			wantError: "unknown service action: enable",
+		},
+		{
+			name:      "service with args",
+			input:     []string{"service", "install", "db"},
+			wantError: "service install does not accept additional arguments",
+		},
+		{
+			name:      "service with detach",
+			input:     []string{"service", "install", "-d"},
+			wantError: errServiceWithDetach.Error(),
+		},
+		{
+			name:      "service with tag",
+			input:     []string{"service", "install", "--tag", "db"},
+			wantError: "--tag can only be used when starting or exporting tunnels",
+		},
+		{
+			name:      "since without logs",
+			input:     []string{"--since", "10m"},
+			wantError: "--since can only be used with logs",
+		},
+		{
+			name:  "status watch",
+			input: []string{"status", "--watch"},
+			want:  Options{Command: CommandStatus, Watch: true},
+		},
+		{
+			name:      "watch without status",
+			input:     []string{"--watch"},
+			wantError: "--watch can only be used with status",
+		},
 		{
 			name:      "stop with detach",
 			input:     []string{"stop", "-d"},
 			wantError: errStopWithDetach.Error(),
 		},
 		{
-			name:      "stop with args",
-			input:     []string{"stop", "db"},
-			wantError: errStopWithArgs.Error(),
+			name:  "stop tunnels",
+			input: []string{"stop", "db", "cache/redis"},
+			want:  Options{Command: CommandStop, TunnelNames: []string{"db", "cache/redis"}},
+		},
+		{
+			name:      "stop with tag",
+			input:     []string{"--tag", "data", "stop"},
+			wantError: errStopSelection.Error(),
+		},
+		{
+			name:  "start tunnels",
+			input: []string{"start", "db/postgres"},
+			want:  Options{Command: CommandStartTunnels, TunnelNames: []string{"db/postgres"}},
+		},
+		{
+			name:      "start without tunnels",
+			input:     []string{"start"},
+			wantError: errStartArgs.Error(),
+		},
+		{
+			name:      "start with detach",
+			input:     []string{"start", "db", "--detach"},
+			wantError: errStartWithDetach.Error(),
+		},
+		{
+			name:  "restart tunnels",
+			input: []string{"restart", "db", "api"},
+			want:  Options{Command: CommandRestart, TunnelNames: []string{"db", "api"}},
+		},
+		{
+			name:      "restart without tunnels",
+			input:     []string{"restart"},
+			wantError: errRestartArgs.Error(),
 		},
 		{
 			name:      "version with detach",
@@ -79,6 +248,191 @@ func TestParse(t *testing.T) {
 			input:     []string{"version", "extra"},
 			wantError: errVersionWithArgs.Error(),
 		},
+		{
+			name:  "tags and groups",
+			input: []string{"--tag", "data", "@backend", "--tag=payments"},
+			want:  Options{Command: CommandStart, TunnelNames: []string{"@backend"}, Tags: []string{"data", "payments"}},
+		},
+		{
+			name:  "exclusions",
+			input: []string{"db-*", "--exclude", "db-legacy", "-x", "*-old", "--exclude=@batch"},
+			want:  Options{Command: CommandStart, TunnelNames: []string{"db-*"}, Exclude: []string{"db-legacy", "*-old", "@batch"}},
+		},
+		{
+			name:      "tag without value",
+			input:     []string{"--tag"},
+			wantError: "--tag requires a tag name",
+		},
+		{
+			name:      "status with tag",
+			input:     []string{"--tag", "data", "status"},
+			wantError: errStatusWithArgs.Error(),
+		},
+		{
+			name:      "tag after status",
+			input:     []string{"status", "-t", "data"},
+			wantError: "--tag can only be used when starting or exporting tunnels",
+		},
+		{
+			name:  "profile",
+			input: []string{"--profile", "prod", "-d", "db"},
+			want:  Options{Command: CommandStart, Detach: true, Profile: "prod", TunnelNames: []string{"db"}},
+		},
+		{
+			name:  "profile with equals",
+			input: []string{"--profile=staging"},
+			want:  Options{Command: CommandStart, Profile: "staging"},
+		},
+		{
+			name:      "profile with status",
+			input:     []string{"-p", "prod", "status"},
+			wantError: errProfileNotStart.Error(),
+		},
+		{
+			name:  "reload",
+			input: []string{"reload"},
+			want:  Options{Command: CommandReload},
+		},
+		{
+			name:      "reload with args",
+			input:     []string{"reload", "db"},
+			wantError: errReloadWithArgs.Error(),
+		},
+		{
+			name:  "port",
+			input: []string{"port", "db/postgres"},
+			want:  Options{Command: CommandPort, TunnelNames: []string{"db/postgres"}},
+		},
+		{
+			name:      "port without reference",
+			input:     []string{"port"},
+			wantError: errPortArgs.Error(),
+		},
+		{
+			name:      "port with extra args",
+			input:     []string{"port", "db", "cache"},
+			wantError: errPortArgs.Error(),
+		},
+		{
+			name:      "port with detach",
+			input:     []string{"-d", "port", "db"},
+			wantError: errPortWithDetach.Error(),
+		},
+		{
+			name:  "import ssh config",
+			input: []string{"import", "ssh-config", "--host", "db-*", "--dry-run"},
+			want:  Options{Command: CommandImport, ImportSource: "ssh-config", HostPattern: "db-*", DryRun: true},
+		},
+		{
+			name:  "import with host equals",
+			input: []string{"import", "ssh-config", "--host=bastion"},
+			want:  Options{Command: CommandImport, ImportSource: "ssh-config", HostPattern: "bastion"},
+		},
+		{
+			name:      "import without source",
+			input:     []string{"import"},
+			wantError: errImportSource.Error(),
+		},
+		{
+			name:      "import unknown source",
+			input:     []string{"import", "putty"},
+			wantError: "unknown import source: putty",
+		},
+		{
+			name:      "host outside import",
+			input:     []string{"--host", "db"},
+			wantError: "--host can only be used with import or init",
+		},
+		{
+			name:      "dry run outside import",
+			input:     []string{"db", "--dry-run"},
+			wantError: "--dry-run can only be used with import",
+		},
+		{
+			name:      "import with detach",
+			input:     []string{"import", "ssh-config", "-d"},
+			wantError: errImportWithDetach.Error(),
+		},
+		{
+			name:  "export with selection",
+			input: []string{"--profile", "prod", "export", "--format", "shell", "db", "-t", "data"},
+			want:  Options{Command: CommandExport, Profile: "prod", ExportFormat: "shell", TunnelNames: []string{"db"}, Tags: []string{"data"}},
+		},
+		{
+			name:  "export format equals",
+			input: []string{"export", "--format=json"},
+			want:  Options{Command: CommandExport, ExportFormat: "json"},
+		},
+		{
+			name:      "format outside export",
+			input:     []string{"--format", "json"},
+			wantError: "--format can only be used with export",
+		},
+		{
+			name:      "export with detach",
+			input:     []string{"export", "-d"},
+			wantError: errExportWithDetach.Error(),
+		},
+		{
+			name:  "init interactive",
+			input: []string{"init", "--project"},
+			want:  Options{Command: CommandInit, Project: true},
+		},
+		{
+			name:  "init with flags",
+			input: []string{"init", "--host", "bastion", "--port", "5432", "--port=8080:80", "--name", "db"},
+			want:  Options{Command: CommandInit, Host: "bastion", Ports: []string{"5432", "8080:80"}, Name: "db"},
+		},
+		{
+			name:      "init with args",
+			input:     []string{"init", "db"},
+			wantError: errInitWithArgs.Error(),
+		},
+		{
+			name:      "port outside init",
+			input:     []string{"--port", "5432"},
+			wantError: "--port can only be used with init",
+		},
+		{
+			name:  "config validate",
+			input: []string{"config", "validate"},
+			want:  Options{Command: CommandConfig, ConfigAction: "validate"},
+		},
+		{
+			name:  "config schema",
+			input: []string{"config", "schema"},
+			want:  Options{Command: CommandConfig, ConfigAction: "schema"},
+		},
+		{
+			name:  "config show",
+			input: []string{"--profile", "prod", "config", "show", "db", "--json", "-t", "data"},
+			want:  Options{Command: CommandConfig, ConfigAction: "show", Profile: "prod", TunnelNames: []string{"db"}, Tags: []string{"data"}, JSON: true},
+		},
+		{
+			name:      "json outside config show",
+			input:     []string{"config", "validate", "--json"},
+			wantError: "--json can only be used with config show",
+		},
+		{
+			name:      "profile with config validate",
+			input:     []string{"-p", "prod", "config", "validate"},
+			wantError: errProfileNotStart.Error(),
+		},
+		{
+			name:      "config without action",
+			input:     []string{"config"},
+			wantError: errConfigAction.Error(),
+		},
+		{
+			name:      "config unknown action",
+			input:     []string{"config", "lint"},
+			wantError: "unknown config action: lint",
+		},
+		{
+			name:      "config with detach",
+			input:     []string{"config", "validate", "-d"},
+			wantError: errConfigWithDetach.Error(),
+		},
 		{
 			name:      "unknown flag",
 			input:     []string{"--unknown"},
@@ -107,12 +461,51 @@ func TestParse(t *testing.T) {
 			if got.Detach != tt.want.Detach {
 				t.Fatalf("detach mismatch: got %v want %v", got.Detach, tt.want.Detach)
 			}
+			if got.ConfigAction != tt.want.ConfigAction {
+				t.Fatalf("config action mismatch: got %q want %q", got.ConfigAction, tt.want.ConfigAction)
+			}
+			if got.Profile != tt.want.Profile {
+				t.Fatalf("profile mismatch: got %q want %q", got.Profile, tt.want.Profile)
+			}
 			if got.InternalDaemon != tt.want.InternalDaemon {
 				t.Fatalf("internal daemon mismatch: got %v want %v", got.InternalDaemon, tt.want.InternalDaemon)
 			}
+			if got.Supervise != tt.want.Supervise || got.InternalSupervisor != tt.want.InternalSupervisor {
+				t.Fatalf("supervise mismatch: got %v %v want %v %v", got.Supervise, got.InternalSupervisor, tt.want.Supervise, tt.want.InternalSupervisor)
+			}
+			if got.DaemonAction != tt.want.DaemonAction {
+				t.Fatalf("daemon action mismatch: got %q want %q", got.DaemonAction, tt.want.DaemonAction)
+			}
+			if got.ServiceAction != tt.want.ServiceAction {
+				t.Fatalf("service action mismatch: got %q want %q", got.ServiceAction, tt.want.ServiceAction)
+			}
 			if len(got.TunnelNames) != len(tt.want.TunnelNames) {
 				t.Fatalf("tunnel names length mismatch: got %d want %d", len(got.TunnelNames), len(tt.want.TunnelNames))
 			}
+			if strings.Join(got.Exclude, ",") != strings.Join(tt.want.Exclude, ",") {
+				t.Fatalf("exclude mismatch: got %v want %v", got.Exclude, tt.want.Exclude)
+			}
+			if strings.Join(got.Tags, ",") != strings.Join(tt.want.Tags, ",") {
+				t.Fatalf("tags mismatch: got %v want %v", got.Tags, tt.want.Tags)
+			}
+			if got.ImportSource != tt.want.ImportSource || got.HostPattern != tt.want.HostPattern || got.DryRun != tt.want.DryRun {
+				t.Fatalf("import options mismatch: got %q %q %v want %q %q %v", got.ImportSource, got.HostPattern, got.DryRun, tt.want.ImportSource, tt.want.HostPattern, tt.want.DryRun)
+			}
+			if got.Host != tt.want.Host || got.Name != tt.want.Name || got.Project != tt.want.Project || strings.Join(got.Ports, ",") != strings.Join(tt.want.Ports, ",") {
+				t.Fatalf("init options mismatch: got %q %q %v %v want %q %q %v %v", got.Host, got.Name, got.Ports, got.Project, tt.want.Host, tt.want.Name, tt.want.Ports, tt.want.Project)
+			}
+			if got.Follow != tt.want.Follow || got.Since != tt.want.Since {
+				t.Fatalf("logs options mismatch: got %v %v want %v %v", got.Follow, got.Since, tt.want.Follow, tt.want.Since)
+			}
+			if got.Watch != tt.want.Watch {
+				t.Fatalf("watch mismatch: got %v want %v", got.Watch, tt.want.Watch)
+			}
+			if got.JSON != tt.want.JSON {
+				t.Fatalf("json mismatch: got %v want %v", got.JSON, tt.want.JSON)
+			}
+			if got.ExportFormat != tt.want.ExportFormat {
+				t.Fatalf("export format mismatch: got %q want %q", got.ExportFormat, tt.want.ExportFormat)
+			}
 			for i, v := range got.TunnelNames {
 				if v != tt.want.TunnelNames[i] {
 					t.Fatalf("tunnel name %d mismatch: got %s want %s", i, v, tt.want.TunnelNames[i])
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrompterAsk(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrompter(strings.NewReader("\n  bastion  \nlast"), &out)
+
+	tests := []struct {
+		def  string
+		want string
+	}{
+		{"db", "db"},
+		{"db", "bastion"},
+		{"", "last"},
+	}
+	for _, tt := range tests {
+		got, err := p.Ask("Host", tt.def)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Fatalf("got %q want %q", got, tt.want)
+		}
+	}
+	if !strings.HasPrefix(out.String(), "Host [db]: ") {
+		t.Fatalf("expected default to be shown, got %q", out.String())
+	}
+
+	if _, err := p.Ask("Host", ""); err != ErrAborted {
+		t.Fatalf("expected ErrAborted at end of input, got %v", err)
+	}
+}
+
+func TestPrompterConfirm(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrompter(strings.NewReader("maybe\nYES\n\n"), &out)
+
+	got, err := p.Confirm("Continue?", false)
+	if err != nil || !got {
+		t.Fatalf("expected yes after re-prompt, got %v %v", got, err)
+	}
+	if !strings.Contains(out.String(), "Please answer yes or no.") {
+		t.Fatalf("expected re-prompt, got %q", out.String())
+	}
+	got, err = p.Confirm("Again?", true)
+	if err != nil || !got {
+		t.Fatalf("expected default yes, got %v %v", got, err)
+	}
+}
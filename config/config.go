@@ -1,58 +1,221 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-
-	"gopkg.in/yaml.v3"
+	"sort"
+	"time"
 )
 
 type Config struct {
-	Tunnels map[string]Tunnel `yaml:"tunnels"`
+	Tunnels  map[string]Tunnel   `yaml:"tunnels"`
+	Groups   map[string][]string `yaml:"groups,omitempty"`
+	Profiles map[string]Profile  `yaml:"profiles,omitempty"`
+	// AutoPorts is the "first-last" range automatic local ports are picked
+	// from, see AutoPortRange.
+	AutoPorts string `yaml:"auto_ports,omitempty"`
+
+	// Profile is the name of the applied profile, if any.
+	Profile string `yaml:"-"`
+
+	// Path is the file the configuration was loaded from.
+	Path string `yaml:"-"`
+	// Disabled lists the tunnels left out with enabled: false.
+	Disabled []string `yaml:"-"`
+	// Warnings holds non-fatal diagnostics reported while loading.
+	Warnings []Diagnostic `yaml:"-"`
 }
 
 type Tunnel struct {
 	Host         string   `yaml:"host"`
-	Ports        []string `yaml:"ports"`
+	Ports        []Port   `yaml:"ports"`
 	User         string   `yaml:"user,omitempty"`
 	IdentityFile string   `yaml:"identity_file,omitempty"`
+	Tags         []string `yaml:"tags,omitempty"`
+	// DependsOn lists the tunnels that must be active before this one starts.
+	DependsOn []string `yaml:"depends_on,omitempty"`
+	// Enabled set to false removes the tunnel from the configuration.
+	Enabled *bool `yaml:"enabled,omitempty"`
+	// Autostart set to false keeps the tunnel out of a bare `tunn`; it only
+	// starts when selected by name, group or tag.
+	Autostart *bool `yaml:"autostart,omitempty"`
+	// Lazy makes tunn listen on the local ports itself and only start ssh
+	// once a connection arrives, stopping it again after IdleTimeout
+	// without connections.
+	Lazy bool `yaml:"lazy,omitempty"`
+	// IdleTimeout is a duration such as "10m", see IdleAfter.
+	IdleTimeout string `yaml:"idle_timeout,omitempty"`
 }
 
-func Load() (*Config, error) {
+// DefaultIdleTimeout is how long a lazy tunnel keeps ssh running without
+// connections when it does not set idle_timeout.
+const DefaultIdleTimeout = 10 * time.Minute
+
+// IsEnabled reports whether the tunnel is enabled, the default.
+func (t Tunnel) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// Autostarts reports whether the tunnel starts when no tunnels are selected,
+// the default.
+func (t Tunnel) Autostarts() bool {
+	return t.Autostart == nil || *t.Autostart
+}
+
+// IdleAfter returns how long a lazy tunnel keeps ssh running without
+// connections: idle_timeout when set, otherwise DefaultIdleTimeout.
+func (t Tunnel) IdleAfter() time.Duration {
+	if timeout, err := time.ParseDuration(t.IdleTimeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return DefaultIdleTimeout
+}
+
+// HasTag reports whether the tunnel carries the given tag.
+func (t Tunnel) HasTag(tag string) bool {
+	for _, candidate := range t.Tags {
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AutoPortRange returns the range automatic local ports are picked from:
+// auto_ports when set, otherwise DefaultAutoPortFirst-DefaultAutoPortLast.
+func (c *Config) AutoPortRange() (int, int) {
+	if first, last, err := parsePortRange(c.AutoPorts); err == nil {
+		return first, last
+	}
+	return DefaultAutoPortFirst, DefaultAutoPortLast
+}
+
+// FileName is the name of both the global and project-local configuration files.
+const FileName = ".tunnrc"
+
+// DefaultPath returns the location of the user's configuration file.
+func DefaultPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, FileName), nil
+}
+
+// FindProjectFile looks for a project-local configuration in dir and its
+// parents, stopping before the home directory, whose file is the global one.
+func FindProjectFile(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	homeDir, _ := os.UserHomeDir()
+	for {
+		if dir == homeDir {
+			return "", false
+		}
+		candidate := filepath.Join(dir, FileName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// Path returns the configuration file in effect: the nearest project-local
+// file when there is one, otherwise the global file.
+func Path() (string, error) {
+	if wd, err := os.Getwd(); err == nil {
+		if path, ok := FindProjectFile(wd); ok {
+			return path, nil
+		}
+	}
+	return DefaultPath()
+}
+
+// Load reads and validates the configuration in effect, see Path.
+func Load() (*Config, error) {
+	configPath, err := Path()
+	if err != nil {
+		return nil, err
 	}
 
-	configPath := filepath.Join(homeDir, ".tunnrc")
+	cfg, err := LoadFile(configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("~/.tunnrc not found. Run 'tunn init' to create one")
+		}
+		return nil, err
+	}
+	return cfg, nil
+}
 
-	data, err := os.ReadFile(configPath)
+// LoadFile reads, validates and decodes the configuration stored at path, in
+// YAML, JSON or TOML as detected by DetectFormat.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("~/.tunnrc not found. Please create one!")
+			return nil, err
 		}
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	diagnostics := Validate(path, data)
+	if errs := Errors(diagnostics); len(errs) > 0 {
+		return nil, &ValidationError{Diagnostics: errs}
+	}
+
+	doc, err := parseDocument(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	if err := doc.Decode(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	for name, tunnel := range cfg.Tunnels {
+		if !tunnel.IsEnabled() {
+			delete(cfg.Tunnels, name)
+			cfg.Disabled = append(cfg.Disabled, name)
+			continue
+		}
+		ports, err := ExpandPorts(tunnel.Ports)
+		if err != nil {
+			return nil, fmt.Errorf("tunnel %q: %w", name, err)
+		}
+		tunnel.Ports = ports
+		cfg.Tunnels[name] = tunnel
+	}
+	for profileName, profile := range cfg.Profiles {
+		for name, override := range profile {
+			ports, err := ExpandPorts(override.Ports)
+			if err != nil {
+				return nil, fmt.Errorf("profile %q tunnel %q: %w", profileName, name, err)
+			}
+			override.Ports = ports
+			profile[name] = override
+		}
+	}
+	sort.Strings(cfg.Disabled)
+	cfg.Path = path
+	cfg.Warnings = diagnostics
 
 	return &cfg, nil
 }
 
-func (c *Config) FilterTunnels(names []string) map[string]Tunnel {
-	if len(names) == 0 {
-		return c.Tunnels
-	}
-
-	filtered := make(map[string]Tunnel)
-	for _, name := range names {
-		if tunnel, exists := c.Tunnels[name]; exists {
-			filtered[name] = tunnel
+// LookupPort finds a port by name, local port or mapping.
+func (t Tunnel) LookupPort(ref string) (Port, bool) {
+	for _, port := range t.Ports {
+		if port.Matches(ref) {
+			return port, true
 		}
 	}
-	return filtered
-}
\ No newline at end of file
+	return Port{}, false
+}
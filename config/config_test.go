@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -31,6 +32,12 @@ tunnels:
 	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
 		t.Fatalf("Failed to write test config: %v", err)
 	}
+	if err := os.MkdirAll(filepath.Join(tmpDir, ".ssh"), 0o700); err != nil {
+		t.Fatalf("Failed to create .ssh: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, ".ssh", "id_rsa"), []byte("key"), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
 
 	cfg, err := Load()
 	if err != nil {
@@ -87,44 +94,97 @@ func TestLoadConfigNotFound(t *testing.T) {
 		t.Fatal("Expected error for missing config file")
 	}
 
-	if err.Error() != "~/.tunnrc not found. Please create one!" {
+	if err.Error() != "~/.tunnrc not found. Run 'tunn init' to create one" {
 		t.Errorf("Unexpected error message: %v", err)
 	}
 }
 
+func TestLoadConfigDisabledTunnels(t *testing.T) {
+	content := `tunnels:
+  legacy:
+    host: old
+    enabled: false
+    ports: [5432]
+  db:
+    host: new
+    autostart: false
+    ports: [5432]
+groups:
+  data: [legacy, db]
+profiles:
+  prod:
+    legacy:
+      host: prod-old
+`
+	path := filepath.Join(t.TempDir(), ".tunnrc")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if _, ok := cfg.Tunnels["legacy"]; ok {
+		t.Error("disabled tunnel must not be loaded")
+	}
+	if len(cfg.Disabled) != 1 || cfg.Disabled[0] != "legacy" {
+		t.Errorf("Disabled = %v", cfg.Disabled)
+	}
+	if db := cfg.Tunnels["db"]; !db.IsEnabled() || db.Autostarts() {
+		t.Errorf("db enabled=%v autostarts=%v", db.IsEnabled(), db.Autostarts())
+	}
+	if err := cfg.ApplyProfile("prod"); err != nil {
+		t.Fatalf("ApplyProfile: %v", err)
+	}
+	if _, ok := cfg.Tunnels["legacy"]; ok {
+		t.Error("profile must not bring back a disabled tunnel")
+	}
+}
+
 func TestFilterTunnels(t *testing.T) {
 	cfg := &Config{
 		Tunnels: map[string]Tunnel{
 			"api": {
 				Host:  "server1",
-				Ports: []string{"3000:3000"},
+				Ports: []Port{{Local: "3000", Remote: "3000"}},
 			},
 			"db": {
 				Host:  "server2",
-				Ports: []string{"5432:5432"},
+				Ports: []Port{{Local: "5432", Remote: "5432"}},
 			},
 			"cache": {
 				Host:  "server3",
-				Ports: []string{"6379:6379"},
+				Ports: []Port{{Local: "6379", Remote: "6379"}},
 			},
 		},
 	}
 
 	tests := []struct {
-		name     string
-		filter   []string
-		expected int
+		name      string
+		filter    []string
+		expected  int
+		wantError string
 	}{
-		{"No filter", []string{}, 3},
-		{"Single filter", []string{"api"}, 1},
-		{"Multiple filters", []string{"api", "db"}, 2},
-		{"Non-existent filter", []string{"nonexistent"}, 0},
-		{"Mixed filters", []string{"api", "nonexistent", "cache"}, 2},
+		{"No filter", []string{}, 3, ""},
+		{"Single filter", []string{"api"}, 1, ""},
+		{"Multiple filters", []string{"api", "db"}, 2, ""},
+		{"Non-existent filter", []string{"nonexistent"}, 0, "no tunnels found matching: nonexistent"},
+		{"Mixed filters", []string{"api", "nonexistent", "cache", "other"}, 0, "no tunnels found matching: nonexistent, other"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			filtered := cfg.FilterTunnels(tt.filter)
+			filtered, err := cfg.FilterTunnels(tt.filter)
+			if tt.wantError != "" {
+				if err == nil || err.Error() != tt.wantError {
+					t.Fatalf("Expected error %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			if len(filtered) != tt.expected {
 				t.Errorf("Expected %d tunnels, got %d", tt.expected, len(filtered))
 			}
@@ -138,4 +198,51 @@ func TestFilterTunnels(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestTunnelIdleAfter(t *testing.T) {
+	tests := []struct {
+		timeout string
+		want    time.Duration
+	}{
+		{"", DefaultIdleTimeout},
+		{"90s", 90 * time.Second},
+		{"1h30m", 90 * time.Minute},
+		{"0s", DefaultIdleTimeout},
+		{"soon", DefaultIdleTimeout},
+	}
+	for _, tt := range tests {
+		if got := (Tunnel{Lazy: true, IdleTimeout: tt.timeout}).IdleAfter(); got != tt.want {
+			t.Errorf("IdleAfter(%q) = %v, want %v", tt.timeout, got, tt.want)
+		}
+	}
+}
+
+func TestFindProjectFile(t *testing.T) {
+	root := t.TempDir()
+	homeDir := os.Getenv("HOME")
+	os.Setenv("HOME", root)
+	defer os.Setenv("HOME", homeDir)
+
+	project := filepath.Join(root, "work", "app")
+	nested := filepath.Join(project, "cmd", "server")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatalf("failed to create directories: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, FileName), []byte("tunnels: {}\n"), 0o600); err != nil {
+		t.Fatalf("failed to write global config: %v", err)
+	}
+
+	if path, ok := FindProjectFile(nested); ok {
+		t.Fatalf("expected the global file not to count as a project file, got %s", path)
+	}
+
+	want := filepath.Join(project, FileName)
+	if err := os.WriteFile(want, []byte("tunnels: {}\n"), 0o600); err != nil {
+		t.Fatalf("failed to write project config: %v", err)
+	}
+	path, ok := FindProjectFile(nested)
+	if !ok || path != want {
+		t.Fatalf("expected %s, got %q (found=%v)", want, path, ok)
+	}
+}
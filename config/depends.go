@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// StartOrder sorts tunnel names so that every tunnel comes after the tunnels
+// it depends on. Dependencies outside the set are ignored, and ties are broken
+// by name so the order is stable.
+func StartOrder(tunnels map[string]Tunnel) []string {
+	names := make([]string, 0, len(tunnels))
+	for name := range tunnels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	order := make([]string, 0, len(names))
+	placed := make(map[string]bool, len(names))
+	var visit func(name string, chain map[string]bool)
+	visit = func(name string, chain map[string]bool) {
+		if placed[name] || chain[name] {
+			return
+		}
+		chain[name] = true
+		deps := append([]string(nil), tunnels[name].DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if _, ok := tunnels[dep]; ok {
+				visit(dep, chain)
+			}
+		}
+		delete(chain, name)
+		placed[name] = true
+		order = append(order, name)
+	}
+	for _, name := range names {
+		visit(name, make(map[string]bool))
+	}
+	return order
+}
+
+// Dependents returns the tunnels that depend on any of names, directly or
+// through other tunnels, sorted by name. The named tunnels themselves are
+// not included.
+func Dependents(tunnels map[string]Tunnel, names ...string) []string {
+	found := make(map[string]bool)
+	for _, name := range names {
+		found[name] = true
+	}
+	for grew := true; grew; {
+		grew = false
+		for name, tunnel := range tunnels {
+			if found[name] {
+				continue
+			}
+			for _, dep := range tunnel.DependsOn {
+				if found[dep] {
+					found[name] = true
+					grew = true
+					break
+				}
+			}
+		}
+	}
+
+	var dependents []string
+	for name := range found {
+		if _, ok := tunnels[name]; ok && !contains(names, name) {
+			dependents = append(dependents, name)
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// addDependencies adds the tunnels every selected tunnel depends on, directly
+// or indirectly, to filtered. Dependencies already selected are kept as they
+// are, even when narrowed to some of their ports.
+func (c *Config) addDependencies(filtered map[string]Tunnel) {
+	pending := make([]string, 0, len(filtered))
+	for name := range filtered {
+		pending = append(pending, name)
+	}
+	for len(pending) > 0 {
+		name := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, dep := range c.Tunnels[name].DependsOn {
+			if _, selected := filtered[dep]; selected {
+				continue
+			}
+			if tunnel, ok := c.Tunnels[dep]; ok {
+				filtered[dep] = tunnel
+				pending = append(pending, dep)
+			}
+		}
+	}
+}
+
+// checkDependencies reports a selected tunnel whose dependency was excluded.
+func checkDependencies(filtered map[string]Tunnel) error {
+	names := make([]string, 0, len(filtered))
+	for name := range filtered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, dep := range filtered[name].DependsOn {
+			if _, ok := filtered[dep]; !ok {
+				return fmt.Errorf("tunnel %q depends on %q, which is excluded", name, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// findDependencyCycle returns the chain of dependencies leading back to the
+// start tunnel, or nil when the tunnel does not depend on itself.
+func findDependencyCycle(tunnel string, deps map[string][]string, chain []string) []string {
+	chain = append(chain, tunnel)
+	for _, dep := range deps[tunnel] {
+		if dep == chain[0] {
+			return append(chain, dep)
+		}
+		if contains(chain, dep) {
+			continue
+		}
+		if cycle := findDependencyCycle(dep, deps, chain); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
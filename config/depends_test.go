@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStartOrder(t *testing.T) {
+	tunnels := map[string]Tunnel{
+		"app":    {DependsOn: []string{"hop2", "cache"}},
+		"hop2":   {DependsOn: []string{"hop1"}},
+		"hop1":   {},
+		"cache":  {},
+		"report": {DependsOn: []string{"elsewhere"}},
+	}
+
+	got := strings.Join(StartOrder(tunnels), ",")
+	if want := "cache,hop1,hop2,app,report"; got != want {
+		t.Fatalf("StartOrder = %s, want %s", got, want)
+	}
+
+	if got := strings.Join(Dependents(tunnels, "hop1"), ","); got != "app,hop2" {
+		t.Fatalf("Dependents(hop1) = %s", got)
+	}
+	if got := Dependents(tunnels, "app"); len(got) != 0 {
+		t.Fatalf("Dependents(app) = %v", got)
+	}
+}
+
+func TestSelectAddsDependencies(t *testing.T) {
+	manual := false
+	cfg := &Config{
+		Tunnels: map[string]Tunnel{
+			"hop1": {Host: "bastion", Ports: []Port{{Local: "2222", Remote: "22"}}, Autostart: &manual},
+			"hop2": {Host: "inner", Ports: []Port{{Local: "5432"}, {Local: "6379"}}, DependsOn: []string{"hop1"}},
+			"api":  {Host: "web", Ports: []Port{{Local: "3000"}}},
+		},
+	}
+
+	selected, err := cfg.Select(Selector{Names: []string{"hop2/5432"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(selected) != 2 || len(selected["hop1"].Ports) != 1 || len(selected["hop2"].Ports) != 1 {
+		t.Fatalf("unexpected selection: %+v", selected)
+	}
+
+	selected, err = cfg.Select(Selector{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := selected["hop1"]; !ok || len(selected) != 3 {
+		t.Fatalf("expected manual dependency to be pulled in, got %+v", selected)
+	}
+
+	_, err = cfg.Select(Selector{Names: []string{"hop2"}, Exclude: []string{"hop1"}})
+	if err == nil || err.Error() != `tunnel "hop2" depends on "hop1", which is excluded` {
+		t.Fatalf("expected excluded dependency error, got %v", err)
+	}
+}
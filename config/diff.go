@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diff summarises how a set of tunnels changed between two configurations.
+type Diff struct {
+	Added     []string `json:"added,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+	Changed   []string `json:"changed,omitempty"`
+	Unchanged []string `json:"unchanged,omitempty"`
+}
+
+// DiffTunnels compares the previous and next tunnel sets by name.
+func DiffTunnels(previous, next map[string]Tunnel) Diff {
+	var diff Diff
+	for name, tunnel := range next {
+		old, exists := previous[name]
+		switch {
+		case !exists:
+			diff.Added = append(diff.Added, name)
+		case reflect.DeepEqual(old, tunnel):
+			diff.Unchanged = append(diff.Unchanged, name)
+		default:
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range previous {
+		if _, exists := next[name]; !exists {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	sort.Strings(diff.Unchanged)
+	return diff
+}
+
+// Empty reports whether the diff contains no additions, removals or changes.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String renders the diff as a one-line summary.
+func (d Diff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+	var parts []string
+	if len(d.Added) > 0 {
+		parts = append(parts, fmt.Sprintf("started %s", strings.Join(d.Added, ", ")))
+	}
+	if len(d.Removed) > 0 {
+		parts = append(parts, fmt.Sprintf("stopped %s", strings.Join(d.Removed, ", ")))
+	}
+	if len(d.Changed) > 0 {
+		parts = append(parts, fmt.Sprintf("restarted %s", strings.Join(d.Changed, ", ")))
+	}
+	if len(d.Unchanged) > 0 {
+		parts = append(parts, fmt.Sprintf("%d unchanged", len(d.Unchanged)))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffTunnels(t *testing.T) {
+	previous := map[string]Tunnel{
+		"api":   {Host: "a", Ports: []Port{{Local: "3000"}}},
+		"db":    {Host: "b", Ports: []Port{{Local: "5432"}}},
+		"cache": {Host: "c", Ports: []Port{{Local: "6379"}}},
+	}
+	next := map[string]Tunnel{
+		"api":    {Host: "a", Ports: []Port{{Local: "3000"}}},
+		"db":     {Host: "b", Ports: []Port{{Local: "5433", Remote: "5432"}}},
+		"search": {Host: "d", Ports: []Port{{Local: "9200"}}},
+	}
+
+	diff := DiffTunnels(previous, next)
+	want := Diff{
+		Added:     []string{"search"},
+		Removed:   []string{"cache"},
+		Changed:   []string{"db"},
+		Unchanged: []string{"api"},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Fatalf("unexpected diff:\n got: %+v\nwant: %+v", diff, want)
+	}
+	if got := diff.String(); got != "started search; stopped cache; restarted db; 1 unchanged" {
+		t.Fatalf("unexpected summary %q", got)
+	}
+
+	same := DiffTunnels(previous, previous)
+	if !same.Empty() || same.String() != "no changes" {
+		t.Fatalf("expected empty diff, got %+v", same)
+	}
+}
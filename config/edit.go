@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TunnelEntry is a named tunnel to be written into a configuration file,
+// optionally preceded by a comment line.
+type TunnelEntry struct {
+	Name    string
+	Comment string
+	Tunnel  Tunnel
+}
+
+// FormatTunnels renders entries as YAML mapping items indented by indent
+// spaces, ready to be placed under the tunnels key.
+func FormatTunnels(entries []TunnelEntry, indent int) (string, error) {
+	prefix := strings.Repeat(" ", indent)
+	var out strings.Builder
+	for _, entry := range entries {
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(map[string]Tunnel{entry.Name: entry.Tunnel}); err != nil {
+			return "", fmt.Errorf("failed to render tunnel %q: %w", entry.Name, err)
+		}
+		if err := encoder.Close(); err != nil {
+			return "", fmt.Errorf("failed to render tunnel %q: %w", entry.Name, err)
+		}
+
+		if entry.Comment != "" {
+			out.WriteString(prefix + "# " + entry.Comment + "\n")
+		}
+		for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+			out.WriteString(prefix + line + "\n")
+		}
+	}
+	return out.String(), nil
+}
+
+// AppendTunnels adds entries to the tunnels mapping of an existing
+// configuration file. The original text, including comments and layout, is
+// kept as is; the new tunnels are inserted after the last existing one.
+func AppendTunnels(data []byte, entries []TunnelEntry) ([]byte, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		block, err := FormatTunnels(entries, 2)
+		if err != nil {
+			return nil, err
+		}
+		return []byte("tunnels:\n" + block), nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file must contain a mapping at the top level")
+	}
+	root := doc.Content[0]
+	if root.Style&yaml.FlowStyle != 0 {
+		return nil, fmt.Errorf("config file is written in flow style; add the tunnels by hand")
+	}
+
+	text := string(data)
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	tunnelsIndex := -1
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "tunnels" {
+			tunnelsIndex = i
+			break
+		}
+	}
+	if tunnelsIndex < 0 {
+		block, err := FormatTunnels(entries, 2)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(text + "\ntunnels:\n" + block), nil
+	}
+
+	key, value := root.Content[tunnelsIndex], root.Content[tunnelsIndex+1]
+	indent := 2
+	insertAt := key.Line
+	switch {
+	case isNull(value):
+		if value.Value != "" {
+			return nil, fmt.Errorf("line %d: replace 'tunnels: %s' with an empty 'tunnels:' before importing", key.Line, value.Value)
+		}
+	case value.Kind != yaml.MappingNode:
+		return nil, fmt.Errorf("line %d: 'tunnels' must be a mapping of tunnel names to definitions", value.Line)
+	case value.Style&yaml.FlowStyle != 0:
+		return nil, fmt.Errorf("line %d: 'tunnels' is written in flow style; add the tunnels by hand", value.Line)
+	default:
+		if len(value.Content) > 0 {
+			indent = value.Content[0].Column - 1
+		}
+		insertAt = len(lines)
+		if tunnelsIndex+2 < len(root.Content) {
+			insertAt = root.Content[tunnelsIndex+2].Line - 1
+		}
+		// Blank lines and top-level comments before the next key belong to
+		// that key, so keep them below the inserted tunnels.
+		for insertAt > key.Line {
+			line := lines[insertAt-1]
+			if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+				insertAt--
+				continue
+			}
+			break
+		}
+	}
+
+	block, err := FormatTunnels(entries, indent)
+	if err != nil {
+		return nil, err
+	}
+
+	var out strings.Builder
+	for _, line := range lines[:insertAt] {
+		out.WriteString(line + "\n")
+	}
+	out.WriteString(block)
+	for _, line := range lines[insertAt:] {
+		out.WriteString(line + "\n")
+	}
+	return []byte(out.String()), nil
+}
+
+// starterHeader introduces the format at the top of a generated file.
+const starterHeader = `# tunn configuration.
+#
+# Each tunnel connects to an SSH host (an alias from ~/.ssh/config works)
+# and forwards one or more ports:
+#   - 5432           the same port locally and on the server
+#   - 15432:5432     local:remote
+#   - 9092-9094      a range, one forward per port
+#
+# Tunnels also accept user, identity_file and tags. Run "tunn config validate"
+# after editing.
+
+`
+
+// starterFooter shows the optional sections, commented out.
+const starterFooter = `
+# Named groups of tunnels, started with "tunn @backend":
+# groups:
+#   backend: [db, cache]
+
+# Profiles override tunnels for another environment ("tunn --profile prod"):
+# profiles:
+#   prod:
+#     db:
+#       host: prod-bastion
+`
+
+// NewFile renders a commented configuration file holding entries.
+func NewFile(entries []TunnelEntry) ([]byte, error) {
+	block, err := FormatTunnels(entries, 2)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(starterHeader + "tunnels:\n" + block + starterFooter), nil
+}
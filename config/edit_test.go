@@ -0,0 +1,126 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAppendTunnels(t *testing.T) {
+	entries := []TunnelEntry{{
+		Name:    "bastion",
+		Comment: "imported from ~/.ssh/config:4",
+		Tunnel:  Tunnel{Host: "bastion", Ports: []Port{{Local: "5432", Remote: "5432"}}},
+	}}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "empty file",
+			input: "",
+			want: `tunnels:
+  # imported from ~/.ssh/config:4
+  bastion:
+    host: bastion
+    ports:
+      - 5432:5432
+`,
+		},
+		{
+			name: "keeps comments and following sections",
+			input: `# my tunnels
+tunnels:
+    api:
+        host: a
+        ports: ["3000"]
+
+# shared groups
+groups:
+  web: [api]
+`,
+			want: `# my tunnels
+tunnels:
+    api:
+        host: a
+        ports: ["3000"]
+    # imported from ~/.ssh/config:4
+    bastion:
+      host: bastion
+      ports:
+        - 5432:5432
+
+# shared groups
+groups:
+  web: [api]
+`,
+		},
+		{
+			name:  "empty tunnels key",
+			input: "tunnels:\ngroups: {}\n",
+			want: `tunnels:
+  # imported from ~/.ssh/config:4
+  bastion:
+    host: bastion
+    ports:
+      - 5432:5432
+groups: {}
+`,
+		},
+		{
+			name:  "missing tunnels key",
+			input: "groups: {}",
+			want: `groups: {}
+
+tunnels:
+  # imported from ~/.ssh/config:4
+  bastion:
+    host: bastion
+    ports:
+      - 5432:5432
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AppendTunnels([]byte(tt.input), entries)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if errs := Errors(Validate("cfg", got)); len(errs) > 0 {
+				t.Fatalf("appended config does not validate: %v", errs)
+			}
+		})
+	}
+}
+
+func TestAppendTunnelsRejectsFlowStyle(t *testing.T) {
+	_, err := AppendTunnels([]byte("tunnels: {api: {host: a, ports: [\"3000\"]}}\n"), []TunnelEntry{{Name: "b"}})
+	if err == nil || !strings.Contains(err.Error(), "flow style") {
+		t.Fatalf("expected flow style error, got %v", err)
+	}
+}
+
+func TestNewFile(t *testing.T) {
+	data, err := NewFile([]TunnelEntry{
+		{Name: "db", Tunnel: Tunnel{Host: "bastion", Ports: []Port{ParsePort("15432:5432")}}},
+		{Name: "kafka", Tunnel: Tunnel{Host: "kafka", Ports: []Port{ParsePort("9092-9094")}}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "# tunn configuration.") {
+		t.Fatalf("expected a commented header, got:\n%s", data)
+	}
+	if !strings.Contains(string(data), "tunnels:\n  db:\n    host: bastion\n    ports:\n      - 15432:5432\n") {
+		t.Fatalf("expected tunnels block, got:\n%s", data)
+	}
+	if diags := Validate("cfg", data); len(diags) > 0 {
+		t.Fatalf("generated file does not validate: %v", diags)
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a configuration file syntax.
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+)
+
+// SyntaxError is a parse error at a position in a JSON or TOML file.
+type SyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+var (
+	tomlTableHeader = regexp.MustCompile(`^\[\[?\s*[A-Za-z0-9_\-"'][A-Za-z0-9_\-."' ]*\]\]?\s*(#.*)?$`)
+	tomlKeyValue    = regexp.MustCompile(`^[A-Za-z0-9_\-"'][A-Za-z0-9_\-."' ]*=`)
+	jsonFirstKey    = regexp.MustCompile(`^(\s|#.*\n)*\{\s*"`)
+)
+
+// DetectFormat picks the syntax of a configuration file from its extension,
+// falling back to the content for files such as the extensionless .tunnrc.
+// Content starting with "{" may as well be a YAML flow mapping, so it is
+// only taken for JSON when it parses as JSON or quotes its first key as JSON
+// requires, which keeps the JSON error for a broken JSON file.
+func DetectFormat(path string, data []byte) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	}
+
+	text := bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	for _, line := range strings.Split(string(text), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "{"):
+			if _, err := parseJSON(data); err == nil || jsonFirstKey.MatchString(string(text)) {
+				return FormatJSON
+			}
+		case tomlTableHeader.MatchString(line), tomlKeyValue.MatchString(line):
+			return FormatTOML
+		}
+		return FormatYAML
+	}
+	return FormatYAML
+}
+
+// parseDocument parses data in the format of path into a YAML document node,
+// so every format is validated and decoded by the same code with the same
+// line and column positions.
+func parseDocument(path string, data []byte) (*yaml.Node, error) {
+	switch DetectFormat(path, data) {
+	case FormatJSON:
+		return parseJSON(data)
+	case FormatTOML:
+		return parseTOML(data)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func scalarNode(tag, value string, line, column int) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Line: line, Column: column}
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    Format
+	}{
+		{"yaml extension", "tunn.yml", "{}", FormatYAML},
+		{"json extension", "tunn.JSON", "tunnels: {}", FormatJSON},
+		{"toml extension", "tunn.toml", "", FormatTOML},
+		{"sniff yaml", ".tunnrc", "# tunnels\ntunnels:\n", FormatYAML},
+		{"sniff json", ".tunnrc", "\n  {\"tunnels\": {}}", FormatJSON},
+		{"sniff toml table", ".tunnrc", "# comment\n[tunnels.db]\nhost = \"x\"\n", FormatTOML},
+		{"sniff toml array of tables", ".tunnrc", "[[tunnels.db.ports]]\n", FormatTOML},
+		{"sniff toml key", ".tunnrc", "tunnels.db.host = \"x\"\n", FormatTOML},
+		{"sniff yaml flow mapping", ".tunnrc", "{tunnels: {db: {host: bastion, ports: [5432]}}}\n", FormatYAML},
+		{"sniff invalid json", ".tunnrc", "{\"tunnels\": {\"db\": {\"host\": \"x\",}}}", FormatJSON},
+		{"sniff yaml flow sequence", ".tunnrc", "[db, cache]\n", FormatYAML},
+		{"empty", ".tunnrc", "", FormatYAML},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.path, []byte(tt.content)); got != tt.want {
+				t.Fatalf("DetectFormat(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFileFormatsAgree(t *testing.T) {
+	files := map[string]string{
+		"tunn.yaml": `tunnels:
+  db:
+    host: bastion
+    user: deploy
+    tags: [data]
+    ports:
+      - 5432
+      - 9092-9093
+      - local: 6379
+        name: redis
+groups:
+  data: [db]
+profiles:
+  prod:
+    db:
+      host: prod-bastion
+`,
+		"tunn.json": `{
+  "tunnels": {
+    "db": {
+      "host": "bastion",
+      "user": "deploy",
+      "tags": ["data"],
+      "ports": [5432, "9092-9093", {"local": 6379, "name": "redis"}]
+    }
+  },
+  "groups": {"data": ["db"]},
+  "profiles": {"prod": {"db": {"host": "prod-bastion"}}}
+}
+`,
+		"tunn.toml": `[tunnels.db]
+host = "bastion"
+user = 'deploy'
+tags = ["data"]
+ports = [
+  5432,
+  "9092-9093", # a range
+  { local = 6379, name = "redis" },
+]
+
+[groups]
+data = ["db"]
+
+[profiles.prod]
+db.host = "prod-bastion"
+`,
+	}
+
+	dir := t.TempDir()
+	var want *Config
+	for _, name := range []string{"tunn.yaml", "tunn.json", "tunn.toml"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile(%s): %v", name, err)
+		}
+		cfg.Path = ""
+		if want == nil {
+			want = cfg
+			continue
+		}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Fatalf("%s decoded differently:\n got: %+v\nwant: %+v", name, cfg, want)
+		}
+	}
+}
+
+func TestValidateFormatsReportPositions(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    []string
+	}{
+		{
+			name: "json",
+			path: "tunn.json",
+			content: `{
+  "tunnels": {
+    "db": {"host": "bastion", "ports": [5432, "70000"]},
+    "api": {"host": "bastion", "hots": "x", "ports": ["5432"]}
+  }
+}`,
+			want: []string{
+				`tunn.json:3:47: error: invalid port mapping "70000": port 70000 out of range 1-65535`,
+				`tunn.json:4:32: error: unknown field "hots" in tunnel "api" (did you mean "host"?)`,
+				`tunn.json:4:55: error: local port 5432 is already claimed by tunnel "db" at line 3`,
+			},
+		},
+		{
+			name: "toml",
+			path: "tunn.toml",
+			content: `[tunnels.db]
+host = "bastion"
+ports = [5432, "70000"]
+
+[tunnels.api]
+host = "bastion"
+hots = "x"
+ports = ["5432"]
+`,
+			want: []string{
+				`tunn.toml:3:16: error: invalid port mapping "70000": port 70000 out of range 1-65535`,
+				`tunn.toml:7:1: error: unknown field "hots" in tunnel "api" (did you mean "host"?)`,
+				`tunn.toml:8:10: error: local port 5432 is already claimed by tunnel "db" at line 3`,
+			},
+		},
+		{
+			name:    "json syntax",
+			path:    ".tunnrc",
+			content: "{\n  \"tunnels\": {\n    \"db\": {\"host\": \"x\",}\n  }\n}\n",
+			want:    []string{`.tunnrc:3:24: error: expected a string key, found '}'`},
+		},
+		{
+			name:    "toml syntax",
+			path:    ".tunnrc",
+			content: "[tunnels.db]\nhost = \"x\"\nhost = \"y\"\n",
+			want:    []string{`.tunnrc:3:1: error: key "host" is already defined`},
+		},
+		{
+			name:    "toml missing host",
+			path:    "tunn.toml",
+			content: "[tunnels.db]\nports = [1]\n",
+			want:    []string{`tunn.toml:1:10: error: tunnel "db" is missing required field 'host'`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Errors(Validate(tt.path, []byte(tt.content)))
+			if len(errs) != len(tt.want) {
+				t.Fatalf("expected %d errors, got %d: %v", len(tt.want), len(errs), errs)
+			}
+			for i, diag := range errs {
+				if diag.String() != tt.want[i] {
+					t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	jsonNumber  = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+	jsonEscapes = map[byte]string{'"': `"`, '\\': `\`, '/': "/", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t"}
+)
+
+// jsonParser reads JSON into YAML nodes, keeping the position of every value
+// and every duplicate key, which encoding/json would silently merge.
+type jsonParser struct {
+	data   []byte
+	offset int
+	line   int
+	column int
+}
+
+func parseJSON(data []byte) (*yaml.Node, error) {
+	p := &jsonParser{data: data, line: 1, column: 1}
+	if strings.HasPrefix(string(data), "\xef\xbb\xbf") {
+		p.offset = 3
+	}
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Line: 1, Column: 1}
+	p.skipSpace()
+	if p.offset == len(p.data) {
+		return doc, nil
+	}
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.offset < len(p.data) {
+		return nil, p.errorf("unexpected %s after the top-level value", p.describe())
+	}
+	doc.Content = []*yaml.Node{value}
+	return doc, nil
+}
+
+func (p *jsonParser) value() (*yaml.Node, error) {
+	if p.offset == len(p.data) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	line, column := p.line, p.column
+	switch c := p.data[p.offset]; {
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"':
+		s, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		return scalarNode("!!str", s, line, column), nil
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number()
+	}
+	for _, literal := range []struct{ word, tag string }{{"true", "!!bool"}, {"false", "!!bool"}, {"null", "!!null"}} {
+		if strings.HasPrefix(string(p.data[p.offset:]), literal.word) {
+			p.advance(len(literal.word))
+			return scalarNode(literal.tag, literal.word, line, column), nil
+		}
+	}
+	return nil, p.errorf("unexpected %s", p.describe())
+}
+
+func (p *jsonParser) object() (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Style: yaml.FlowStyle, Line: p.line, Column: p.column}
+	p.advance(1)
+	p.skipSpace()
+	if p.peek('}') {
+		p.advance(1)
+		return node, nil
+	}
+	for {
+		if !p.peek('"') {
+			return nil, p.errorf("expected a string key, found %s", p.describe())
+		}
+		line, column := p.line, p.column
+		key, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.peek(':') {
+			return nil, p.errorf("expected ':' after object key, found %s", p.describe())
+		}
+		p.advance(1)
+		p.skipSpace()
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, scalarNode("!!str", key, line, column), value)
+		p.skipSpace()
+		switch {
+		case p.peek(','):
+			p.advance(1)
+			p.skipSpace()
+		case p.peek('}'):
+			p.advance(1)
+			return node, nil
+		default:
+			return nil, p.errorf("expected ',' or '}', found %s", p.describe())
+		}
+	}
+}
+
+func (p *jsonParser) array() (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle, Line: p.line, Column: p.column}
+	p.advance(1)
+	p.skipSpace()
+	if p.peek(']') {
+		p.advance(1)
+		return node, nil
+	}
+	for {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, value)
+		p.skipSpace()
+		switch {
+		case p.peek(','):
+			p.advance(1)
+			p.skipSpace()
+		case p.peek(']'):
+			p.advance(1)
+			return node, nil
+		default:
+			return nil, p.errorf("expected ',' or ']', found %s", p.describe())
+		}
+	}
+}
+
+func (p *jsonParser) str() (string, error) {
+	p.advance(1)
+	var b strings.Builder
+	for {
+		if p.offset == len(p.data) {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.data[p.offset]
+		switch {
+		case c == '"':
+			p.advance(1)
+			return b.String(), nil
+		case c < 0x20:
+			return "", p.errorf("control character in string")
+		case c == '\\':
+			if p.offset+1 == len(p.data) {
+				return "", p.errorf("unterminated string")
+			}
+			escape := p.data[p.offset+1]
+			if escape == 'u' {
+				r, ok := p.unicodeEscape(p.offset)
+				if !ok {
+					return "", p.errorf("invalid unicode escape")
+				}
+				p.advance(6)
+				// Characters beyond the BMP are escaped as a surrogate pair; a
+				// lone surrogate decodes to U+FFFD, as with encoding/json.
+				if utf16.IsSurrogate(r) {
+					if low, ok := p.unicodeEscape(p.offset); ok && utf16.DecodeRune(r, low) != utf8.RuneError {
+						r = utf16.DecodeRune(r, low)
+						p.advance(6)
+					} else {
+						r = utf8.RuneError
+					}
+				}
+				b.WriteRune(r)
+				continue
+			}
+			replacement, ok := jsonEscapes[escape]
+			if !ok {
+				return "", p.errorf("invalid escape '\\%c'", escape)
+			}
+			b.WriteString(replacement)
+			p.advance(2)
+		default:
+			r, size := utf8.DecodeRune(p.data[p.offset:])
+			b.WriteRune(r)
+			p.advance(size)
+		}
+	}
+}
+
+// unicodeEscape decodes the \uXXXX escape at offset.
+func (p *jsonParser) unicodeEscape(offset int) (rune, bool) {
+	if offset+6 > len(p.data) || p.data[offset] != '\\' || p.data[offset+1] != 'u' {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(string(p.data[offset+2:offset+6]), 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return rune(r), true
+}
+
+func (p *jsonParser) number() (*yaml.Node, error) {
+	line, column := p.line, p.column
+	end := p.offset
+	for end < len(p.data) && strings.IndexByte("+-0123456789.eE", p.data[end]) >= 0 {
+		end++
+	}
+	text := string(p.data[p.offset:end])
+	if !jsonNumber.MatchString(text) {
+		return nil, p.errorf("invalid number %q", text)
+	}
+	p.advance(end - p.offset)
+	tag := "!!float"
+	if !strings.ContainsAny(text, ".eE") {
+		tag = "!!int"
+	}
+	return scalarNode(tag, text, line, column), nil
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.offset < len(p.data) && strings.IndexByte(" \t\r\n", p.data[p.offset]) >= 0 {
+		p.advance(1)
+	}
+}
+
+func (p *jsonParser) peek(c byte) bool {
+	return p.offset < len(p.data) && p.data[p.offset] == c
+}
+
+// advance moves past n bytes, tracking the line and the column in runes.
+func (p *jsonParser) advance(n int) {
+	end := p.offset + n
+	for p.offset < end {
+		r, size := utf8.DecodeRune(p.data[p.offset:])
+		p.offset += size
+		if r == '\n' {
+			p.line++
+			p.column = 1
+		} else {
+			p.column++
+		}
+	}
+}
+
+func (p *jsonParser) describe() string {
+	if p.offset == len(p.data) {
+		return "end of input"
+	}
+	r, _ := utf8.DecodeRune(p.data[p.offset:])
+	return strconv.QuoteRune(r)
+}
+
+func (p *jsonParser) errorf(format string, args ...any) error {
+	return &SyntaxError{Line: p.line, Column: p.column, Message: fmt.Sprintf(format, args...)}
+}
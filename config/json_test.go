@@ -0,0 +1,87 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseJSON(t *testing.T) {
+	doc, err := parseJSON([]byte("{\n  \"a\": [1, -2.5, \"x\\u00e9\\n\", true, null],\n  \"a\": {}\n}\n"))
+	if err != nil {
+		t.Fatalf("parseJSON: %v", err)
+	}
+	root := doc.Content[0]
+	if len(root.Content) != 4 {
+		t.Fatalf("expected duplicate keys to be kept, got %d nodes", len(root.Content))
+	}
+	if key := root.Content[2]; key.Line != 3 || key.Column != 3 {
+		t.Errorf("second key at %d:%d, want 3:3", key.Line, key.Column)
+	}
+
+	items := root.Content[1].Content
+	want := []struct{ tag, value string }{
+		{"!!int", "1"}, {"!!float", "-2.5"}, {"!!str", "xé\n"}, {"!!bool", "true"}, {"!!null", "null"},
+	}
+	for i, w := range want {
+		if items[i].Tag != w.tag || items[i].Value != w.value {
+			t.Errorf("item %d = %s %q, want %s %q", i, items[i].Tag, items[i].Value, w.tag, w.value)
+		}
+	}
+	if items[2].Column != 18 {
+		t.Errorf("string column = %d, want 18", items[2].Column)
+	}
+}
+
+func TestParseJSONUnicodeEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"bmp", `"\u00e9\u4e2d"`, "é中"},
+		{"surrogate pair", `"\ud83d\ude80 go"`, "🚀 go"},
+		{"upper case pair", `"\uD834\uDD1E"`, "𝄞"},
+		{"lone high surrogate", `"\ud83dx"`, "\ufffdx"},
+		{"high surrogate before a bmp escape", `"\ud83d\u0041"`, "\ufffdA"},
+		{"lone low surrogate", `"\ude80"`, "\ufffd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseJSON([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("parseJSON: %v", err)
+			}
+			if got := doc.Content[0].Value; got != tt.want {
+				t.Fatalf("value = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"trailing comma", `{"a": 1,}`, `line 1, column 9: expected a string key, found '}'`},
+		{"missing colon", "{\n\"a\" 1}", `line 2, column 5: expected ':' after object key, found '1'`},
+		{"leading zero", `[01]`, `line 1, column 2: invalid number "01"`},
+		{"unterminated", `{"a": "x`, `line 1, column 9: unterminated string`},
+		{"trailing value", `{} {}`, `line 1, column 4: unexpected '{' after the top-level value`},
+		{"comment", "// x\n{}", `line 1, column 1: unexpected '/'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseJSON([]byte(tt.content))
+			if err == nil {
+				t.Fatalf("expected error %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
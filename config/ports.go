@@ -0,0 +1,389 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Forward types supported by a port entry, matching ssh -L, -R and -D.
+const (
+	ForwardLocal   = "local"
+	ForwardRemote  = "remote"
+	ForwardDynamic = "dynamic"
+)
+
+// AutoPort is the local port value, also written as 0, that lets tunn pick
+// a free local port when the tunnel starts.
+const AutoPort = "auto"
+
+// Default range automatic local ports are picked from when the configuration
+// does not set auto_ports.
+const (
+	DefaultAutoPortFirst = 20000
+	DefaultAutoPortLast  = 29999
+)
+
+// Port is a single entry of a tunnel's ports list. It can be written either
+// as a "local:remote" string or as a mapping with the fields below.
+//
+// For remote forwards, Remote is the port opened on the SSH server and Local
+// is the port connections are delivered to on this machine. Dynamic forwards
+// only use Local, which becomes a SOCKS proxy.
+type Port struct {
+	Local      string `yaml:"local"`
+	Remote     string `yaml:"remote,omitempty"`
+	TargetHost string `yaml:"target_host,omitempty"`
+	Bind       string `yaml:"bind,omitempty"`
+	Name       string `yaml:"name,omitempty"`
+	Protocol   string `yaml:"protocol,omitempty"`
+	Forward    string `yaml:"forward,omitempty"`
+
+	// Assigned is the local port picked for an automatic port once the
+	// tunnel starts. It is never read from the configuration.
+	Assigned string `yaml:"-"`
+	// Relay is the loopback port ssh listens on instead of the local port
+	// for a lazy tunnel, whose local port tunn listens on itself. It is
+	// never read from the configuration.
+	Relay string `yaml:"-"`
+}
+
+// ParsePort converts the "local:remote" shorthand into a Port.
+func ParsePort(spec string) Port {
+	spec = strings.TrimSpace(spec)
+	local, remote, _ := strings.Cut(spec, ":")
+	return Port{Local: normalizeLocal(local), Remote: strings.TrimSpace(remote)}
+}
+
+// isAutoPort reports whether a local port value asks for automatic
+// allocation: "auto" or any spelling of zero.
+func isAutoPort(value string) bool {
+	value = strings.TrimSpace(value)
+	return value == AutoPort || value != "" && strings.Trim(value, "0") == ""
+}
+
+// normalizeLocal trims a local port value and spells automatic ports "auto",
+// so that "0:5432" and "auto:5432" are the same forward.
+func normalizeLocal(value string) string {
+	if isAutoPort(value) {
+		return AutoPort
+	}
+	return strings.TrimSpace(value)
+}
+
+// IsAuto reports whether tunn picks the local port when the tunnel starts.
+func (p Port) IsAuto() bool {
+	return p.Local == AutoPort
+}
+
+// LocalPort returns the port the forward uses on this machine: the assigned
+// port for automatic ports, otherwise the configured one.
+func (p Port) LocalPort() string {
+	if p.IsAuto() && p.Assigned != "" {
+		return p.Assigned
+	}
+	return p.Local
+}
+
+// RemotePort returns the remote side of the forward, defaulting to the local port.
+func (p Port) RemotePort() string {
+	if p.Remote != "" {
+		return p.Remote
+	}
+	return p.Local
+}
+
+// Target returns the host the remote side connects to, relative to the SSH server.
+func (p Port) Target() string {
+	if p.TargetHost != "" {
+		return p.TargetHost
+	}
+	return "localhost"
+}
+
+// Spec renders the shorthand "local:remote" form of the entry.
+func (p Port) Spec() string {
+	if p.Remote == "" {
+		return p.Local
+	}
+	return p.Local + ":" + p.Remote
+}
+
+// ForwardType returns the kind of forward, defaulting to a local forward.
+func (p Port) ForwardType() string {
+	if p.Forward == "" {
+		return ForwardLocal
+	}
+	return p.Forward
+}
+
+// ListensLocally reports whether the forward binds a port on this machine.
+func (p Port) ListensLocally() bool {
+	return p.ForwardType() != ForwardRemote
+}
+
+// Mapping is the key identifying the forward in status reports, rendered as
+// local:remote, or local:target_host:remote when a target host is set.
+// Remote forwards are prefixed with "R" and list the server port first;
+// dynamic forwards render as local:socks.
+func (p Port) Mapping() string {
+	switch p.ForwardType() {
+	case ForwardDynamic:
+		return p.Local + ":socks"
+	case ForwardRemote:
+		if p.TargetHost != "" {
+			return "R" + p.RemotePort() + ":" + p.TargetHost + ":" + p.Local
+		}
+		return "R" + p.RemotePort() + ":" + p.Local
+	}
+	if p.TargetHost != "" {
+		return p.Local + ":" + p.TargetHost + ":" + p.RemotePort()
+	}
+	return p.Local + ":" + p.RemotePort()
+}
+
+// SSHFlag returns the ssh option that establishes this forward.
+func (p Port) SSHFlag() string {
+	switch p.ForwardType() {
+	case ForwardRemote:
+		return "-R"
+	case ForwardDynamic:
+		return "-D"
+	}
+	return "-L"
+}
+
+// ForwardSpec renders the argument passed alongside SSHFlag.
+func (p Port) ForwardSpec() string {
+	local, bind := p.LocalPort(), p.Bind
+	if p.Relay != "" {
+		local, bind = p.Relay, "127.0.0.1"
+	}
+	var spec string
+	switch p.ForwardType() {
+	case ForwardDynamic:
+		spec = local
+	case ForwardRemote:
+		spec = fmt.Sprintf("%s:%s:%s", p.RemotePort(), p.Target(), p.Local)
+	default:
+		spec = fmt.Sprintf("%s:%s:%s", local, p.Target(), p.RemotePort())
+	}
+	if bind != "" {
+		spec = bind + ":" + spec
+	}
+	return spec
+}
+
+// Matches reports whether ref names this port, either by name, by local
+// port, or by its mapping.
+func (p Port) Matches(ref string) bool {
+	if ref == "" {
+		return false
+	}
+	return ref == p.Name || ref == p.Local || ref == p.Mapping() || ref == p.Spec()
+}
+
+// isShorthand reports whether the entry can be written as a plain string.
+func (p Port) isShorthand() bool {
+	return p.TargetHost == "" && p.Bind == "" && p.Name == "" && p.Protocol == "" && p.Forward == ""
+}
+
+// UnmarshalYAML accepts both the string shorthand and the mapping form.
+func (p *Port) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = ParsePort(node.Value)
+		return nil
+	}
+	type plain Port
+	var decoded plain
+	if err := node.Decode(&decoded); err != nil {
+		return err
+	}
+	*p = Port(decoded)
+	p.Local = normalizeLocal(p.Local)
+	return nil
+}
+
+// MarshalYAML writes plain entries back in their string shorthand, and
+// leaves port numbers unquoted in the mapping form.
+func (p Port) MarshalYAML() (interface{}, error) {
+	if p.isShorthand() {
+		if _, err := strconv.Atoi(p.Spec()); err == nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: p.Spec()}, nil
+		}
+		return p.Spec(), nil
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, field := range []struct{ key, value string }{
+		{"local", p.Local},
+		{"remote", p.Remote},
+		{"target_host", p.TargetHost},
+		{"bind", p.Bind},
+		{"name", p.Name},
+		{"protocol", p.Protocol},
+		{"forward", p.Forward},
+	} {
+		if field.value == "" {
+			continue
+		}
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: field.value}
+		if _, err := strconv.Atoi(field.value); err == nil {
+			value.Tag = "!!int"
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: field.key}, value)
+	}
+	return node, nil
+}
+
+// PortMapping is a parsed local:remote port pair.
+type PortMapping struct {
+	Local  int
+	Remote int
+}
+
+// String renders the mapping in the canonical local:remote form.
+func (p PortMapping) String() string {
+	return fmt.Sprintf("%d:%d", p.Local, p.Remote)
+}
+
+// maxRangeSize bounds how many forwards a single range entry may expand to,
+// since every forward runs its own ssh process.
+const maxRangeSize = 128
+
+// ParsePortMapping parses a "local:remote" or single "port" entry.
+func ParsePortMapping(spec string) (PortMapping, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return PortMapping{}, fmt.Errorf("empty port mapping")
+	}
+
+	parts := strings.Split(spec, ":")
+	if len(parts) > 2 {
+		return PortMapping{}, fmt.Errorf("invalid port mapping %q: expected local:remote", spec)
+	}
+
+	local, err := parsePortNumber(parts[0])
+	if err != nil {
+		return PortMapping{}, fmt.Errorf("invalid port mapping %q: %w", spec, err)
+	}
+	remote := local
+	if len(parts) == 2 {
+		remote, err = parsePortNumber(parts[1])
+		if err != nil {
+			return PortMapping{}, fmt.Errorf("invalid port mapping %q: %w", spec, err)
+		}
+	}
+
+	return PortMapping{Local: local, Remote: remote}, nil
+}
+
+func parsePortNumber(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("missing port number")
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || strings.TrimLeft(value, "0123456789") != "" {
+		return 0, fmt.Errorf("%q is not a port number", value)
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port %d out of range 1-65535", port)
+	}
+	return port, nil
+}
+
+// ParsePortMappings parses a port entry that may use range syntax, such as
+// "9092-9097" or "9092-9097:19092-19097", into individual mappings.
+func ParsePortMappings(spec string) ([]PortMapping, error) {
+	spec = strings.TrimSpace(spec)
+	if !strings.Contains(spec, "-") {
+		mapping, err := ParsePortMapping(spec)
+		if err != nil {
+			return nil, err
+		}
+		return []PortMapping{mapping}, nil
+	}
+
+	parts := strings.Split(spec, ":")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("invalid port mapping %q: expected local:remote", spec)
+	}
+
+	localStart, localEnd, err := parsePortRange(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid port mapping %q: %w", spec, err)
+	}
+	remoteStart, remoteEnd := localStart, localEnd
+	if len(parts) == 2 {
+		remoteStart, remoteEnd, err = parsePortRange(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port mapping %q: %w", spec, err)
+		}
+	}
+
+	size := localEnd - localStart + 1
+	if remoteEnd-remoteStart+1 != size {
+		return nil, fmt.Errorf("invalid port mapping %q: local range has %d ports but remote range has %d", spec, size, remoteEnd-remoteStart+1)
+	}
+	if size > maxRangeSize {
+		return nil, fmt.Errorf("invalid port mapping %q: range of %d ports exceeds the limit of %d", spec, size, maxRangeSize)
+	}
+
+	mappings := make([]PortMapping, 0, size)
+	for offset := 0; offset < size; offset++ {
+		mappings = append(mappings, PortMapping{Local: localStart + offset, Remote: remoteStart + offset})
+	}
+	return mappings, nil
+}
+
+// ExpandPorts rewrites range entries into one entry per port, leaving single
+// mappings untouched. Names on a range entry are suffixed with the local port.
+func ExpandPorts(ports []Port) ([]Port, error) {
+	expanded := make([]Port, 0, len(ports))
+	for _, port := range ports {
+		if !strings.Contains(port.Spec(), "-") {
+			expanded = append(expanded, port)
+			continue
+		}
+		mappings, err := ParsePortMappings(port.Spec())
+		if err != nil {
+			return nil, err
+		}
+		for _, mapping := range mappings {
+			single := port
+			single.Local = strconv.Itoa(mapping.Local)
+			single.Remote = strconv.Itoa(mapping.Remote)
+			if port.Name != "" {
+				single.Name = fmt.Sprintf("%s-%d", port.Name, mapping.Local)
+			}
+			expanded = append(expanded, single)
+		}
+	}
+	return expanded, nil
+}
+
+func parsePortRange(value string) (int, int, error) {
+	bounds := strings.Split(value, "-")
+	switch len(bounds) {
+	case 1:
+		port, err := parsePortNumber(bounds[0])
+		return port, port, err
+	case 2:
+		start, err := parsePortNumber(bounds[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		end, err := parsePortNumber(bounds[1])
+		if err != nil {
+			return 0, 0, err
+		}
+		if end < start {
+			return 0, 0, fmt.Errorf("range %d-%d ends before it starts", start, end)
+		}
+		return start, end, nil
+	default:
+		return 0, 0, fmt.Errorf("%q is not a port range", strings.TrimSpace(value))
+	}
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParsePortMappings(t *testing.T) {
+	tests := []struct {
+		spec      string
+		want      []string
+		wantError string
+	}{
+		{spec: "5432", want: []string{"5432:5432"}},
+		{spec: "3000:3001", want: []string{"3000:3001"}},
+		{spec: "9092-9094", want: []string{"9092:9092", "9093:9093", "9094:9094"}},
+		{spec: "9092-9093:19092-19093", want: []string{"9092:19092", "9093:19093"}},
+		{spec: "5005-5005", want: []string{"5005:5005"}},
+		{spec: "9092-9097:19092-19093", wantError: "local range has 6 ports but remote range has 2"},
+		{spec: "9092-9094:19092", wantError: "local range has 3 ports but remote range has 1"},
+		{spec: "9097-9092", wantError: "range 9097-9092 ends before it starts"},
+		{spec: "1-2-3", wantError: `"1-2-3" is not a port range`},
+		{spec: "1000-2000", wantError: "exceeds the limit of 128"},
+		{spec: "abc-def", wantError: `"abc" is not a port number`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParsePortMappings(tt.spec)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d mappings, got %v", len(tt.want), got)
+			}
+			for i, mapping := range got {
+				if mapping.String() != tt.want[i] {
+					t.Fatalf("mapping %d: got %s want %s", i, mapping, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExpandPorts(t *testing.T) {
+	got, err := ExpandPorts([]Port{
+		{Local: "3000", Remote: "3000"},
+		{Local: "5005-5006", Name: "debug"},
+		{Local: "8080"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"3000:3000", "5005:5005", "5006:5006", "8080:8080"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d ports, got %v", len(want), got)
+	}
+	for i, port := range got {
+		if port.Mapping() != want[i] {
+			t.Fatalf("port %d: got %s want %s", i, port.Mapping(), want[i])
+		}
+	}
+	if got[1].Name != "debug-5005" || got[2].Name != "debug-5006" {
+		t.Fatalf("expected range names to be suffixed, got %q and %q", got[1].Name, got[2].Name)
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		input  string
+		local  string
+		remote string
+	}{
+		{"8080:8081", "8080", "8081"},
+		{"3000", "3000", "3000"},
+		{"5432:5433", "5432", "5433"},
+		{"auto:5432", "auto", "5432"},
+		{"00:5432", "auto", "5432"},
+	}
+
+	for _, tt := range tests {
+		port := ParsePort(tt.input)
+		if port.Local != tt.local || port.RemotePort() != tt.remote {
+			t.Errorf("For %s: expected %s:%s, got %s:%s", tt.input, tt.local, tt.remote, port.Local, port.RemotePort())
+		}
+	}
+}
+
+func TestPortForwardSpec(t *testing.T) {
+	tests := []struct {
+		port    Port
+		forward string
+		mapping string
+	}{
+		{Port{Local: "5432", Remote: "5432"}, "5432:localhost:5432", "5432:5432"},
+		{Port{Local: "5432"}, "5432:localhost:5432", "5432:5432"},
+		{Port{Local: "15432", Remote: "5432", TargetHost: "db.internal"}, "15432:db.internal:5432", "15432:db.internal:5432"},
+		{Port{Local: "8080", Remote: "80", Bind: "127.0.0.1"}, "127.0.0.1:8080:localhost:80", "8080:80"},
+		{Port{Local: "3000", Remote: "8080", Forward: ForwardRemote}, "8080:localhost:3000", "R8080:3000"},
+		{Port{Local: "1080", Bind: "*", Forward: ForwardDynamic}, "*:1080", "1080:socks"},
+		{Port{Local: "auto", Remote: "5432", Assigned: "20417"}, "20417:localhost:5432", "auto:5432"},
+		{Port{Local: "auto", Forward: ForwardDynamic, Assigned: "20001"}, "20001", "auto:socks"},
+		{Port{Local: "5432", Bind: "0.0.0.0", Relay: "41234"}, "127.0.0.1:41234:localhost:5432", "5432:5432"},
+		{Port{Local: "1080", Forward: ForwardDynamic, Relay: "41235"}, "127.0.0.1:41235", "1080:socks"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.port.ForwardSpec(); got != tt.forward {
+			t.Errorf("ForwardSpec: got %s want %s", got, tt.forward)
+		}
+		if got := tt.port.Mapping(); got != tt.mapping {
+			t.Errorf("Mapping: got %s want %s", got, tt.mapping)
+		}
+	}
+}
+
+func TestPortYAMLForms(t *testing.T) {
+	content := `
+- 3000:3001
+- 9092-9093
+- local: 5432
+  remote: 15432
+  target_host: db.internal
+  name: postgres
+  protocol: tcp
+`
+	var ports []Port
+	if err := yaml.Unmarshal([]byte(content), &ports); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ports) != 3 {
+		t.Fatalf("expected 3 ports, got %d", len(ports))
+	}
+	if ports[0].Spec() != "3000:3001" || ports[1].Spec() != "9092-9093" {
+		t.Fatalf("unexpected shorthand entries: %+v", ports[:2])
+	}
+	want := Port{Local: "5432", Remote: "15432", TargetHost: "db.internal", Name: "postgres", Protocol: "tcp"}
+	if ports[2] != want {
+		t.Fatalf("got %+v want %+v", ports[2], want)
+	}
+
+	out, err := yaml.Marshal(ports)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if !strings.HasPrefix(string(out), "- 3000:3001\n- 9092-9093\n- local: 5432\n") {
+		t.Fatalf("unexpected marshalled output:\n%s", out)
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ProfileEnv names the environment variable selecting the active profile.
+const ProfileEnv = "TUNN_PROFILE"
+
+// Profile overrides fields of base tunnels, keyed by tunnel name.
+type Profile map[string]TunnelOverride
+
+// TunnelOverride replaces the non-empty fields of a base tunnel.
+type TunnelOverride struct {
+	Host         string `yaml:"host,omitempty"`
+	Ports        []Port `yaml:"ports,omitempty"`
+	User         string `yaml:"user,omitempty"`
+	IdentityFile string `yaml:"identity_file,omitempty"`
+}
+
+// ProfileNames returns the configured profile names in sorted order.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyProfile merges the named profile into the base tunnels and records it
+// as the active profile. An empty name leaves the configuration untouched.
+func (c *Config) ApplyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return fmt.Errorf("profile %q not found: no profiles are defined", name)
+		}
+		return fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+
+	tunnels := make(map[string]Tunnel, len(c.Tunnels))
+	for tunnelName, tunnel := range c.Tunnels {
+		if override, ok := profile[tunnelName]; ok {
+			tunnel = override.apply(tunnel)
+		}
+		tunnels[tunnelName] = tunnel
+	}
+	c.Tunnels = tunnels
+	c.Profile = name
+	return nil
+}
+
+// ProfileFromEnv returns the profile requested through TUNN_PROFILE.
+func ProfileFromEnv() string {
+	return strings.TrimSpace(os.Getenv(ProfileEnv))
+}
+
+// IsProductionProfile reports whether a profile name looks like it targets
+// production, so callers can make it stand out.
+func IsProductionProfile(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.Contains(lower, "prod") || strings.Contains(lower, "live")
+}
+
+func (o TunnelOverride) apply(tunnel Tunnel) Tunnel {
+	if o.Host != "" {
+		tunnel.Host = o.Host
+	}
+	if len(o.Ports) > 0 {
+		tunnel.Ports = append([]Port(nil), o.Ports...)
+	}
+	if o.User != "" {
+		tunnel.User = o.User
+	}
+	if o.IdentityFile != "" {
+		tunnel.IdentityFile = o.IdentityFile
+	}
+	return tunnel
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profileConfig = `
+tunnels:
+  db:
+    host: staging-db
+    ports:
+      - 5432:5432
+    user: app
+  cache:
+    host: staging-cache
+    ports:
+      - 6379:6379
+profiles:
+  prod:
+    db:
+      host: prod-db
+      ports:
+        - 15432:5432
+    cache:
+      host: prod-cache
+`
+
+func TestApplyProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".tunnrc")
+	if err := os.WriteFile(path, []byte(profileConfig), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if err := cfg.ApplyProfile("prod"); err != nil {
+		t.Fatalf("ApplyProfile failed: %v", err)
+	}
+
+	if cfg.Profile != "prod" {
+		t.Fatalf("expected active profile prod, got %q", cfg.Profile)
+	}
+	db := cfg.Tunnels["db"]
+	if db.Host != "prod-db" || db.User != "app" {
+		t.Fatalf("unexpected db tunnel after override: %+v", db)
+	}
+	if len(db.Ports) != 1 || db.Ports[0].Mapping() != "15432:5432" {
+		t.Fatalf("expected ports to be replaced, got %+v", db.Ports)
+	}
+	cache := cfg.Tunnels["cache"]
+	if cache.Host != "prod-cache" || len(cache.Ports) != 1 || cache.Ports[0].Mapping() != "6379:6379" {
+		t.Fatalf("expected cache host override with base ports, got %+v", cache)
+	}
+}
+
+func TestApplyProfileUnknown(t *testing.T) {
+	cfg := &Config{Profiles: map[string]Profile{"prod": {}, "staging": {}}}
+	err := cfg.ApplyProfile("qa")
+	if err == nil || !strings.Contains(err.Error(), "available: prod, staging") {
+		t.Fatalf("expected unknown profile error listing profiles, got %v", err)
+	}
+	if err := cfg.ApplyProfile(""); err != nil || cfg.Profile != "" {
+		t.Fatalf("expected empty profile to be a no-op, got %v", err)
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	content := `tunnels:
+  db:
+    host: a
+    ports: ["5432"]
+  cache:
+    host: b
+    ports: ["6379"]
+profiles:
+  prod:
+    db:
+      ports: ["6379"]
+    search:
+      host: c
+  swap:
+    db:
+      ports: ["6379"]
+    cache:
+      ports: ["5432"]
+      tags: [x]
+`
+
+	errs := Errors(Validate("cfg", []byte(content)))
+	want := []string{
+		`cfg:11:15: error: local port 6379 is already claimed by tunnel "cache" at line 7`,
+		`cfg:12:5: error: profile "prod" overrides unknown tunnel "search"`,
+		`cfg:19:7: error: unknown field "tags" in profile "swap" override for "cache"`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, diag := range errs {
+		if diag.String() != want[i] {
+			t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), want[i])
+		}
+	}
+}
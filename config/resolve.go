@@ -0,0 +1,313 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Layer names the stage of configuration resolution a value comes from.
+type Layer string
+
+const (
+	// LayerFile is a value written in a tunnel definition.
+	LayerFile Layer = "file"
+	// LayerDefaults is a value tunn fills in when the field is left out.
+	LayerDefaults Layer = "defaults"
+	// LayerProfile is a value replaced by the active profile.
+	LayerProfile Layer = "profile"
+	// LayerEnv is a value taken from, or expanded with, environment variables.
+	LayerEnv Layer = "env"
+)
+
+// Origin tells where a resolved value came from.
+type Origin struct {
+	Layer  Layer  `json:"layer"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	// Note explains the layer, such as the profile name or the expanded
+	// environment variables.
+	Note string `json:"note,omitempty"`
+}
+
+// String renders the origin as layer, note and file:line:column.
+func (o Origin) String() string {
+	parts := []string{string(o.Layer)}
+	if o.Note != "" {
+		parts = append(parts, "("+o.Note+")")
+	}
+	if o.File != "" {
+		location := o.File
+		if o.Line > 0 {
+			location += fmt.Sprintf(":%d:%d", o.Line, o.Column)
+		}
+		parts = append(parts, location)
+	}
+	return strings.Join(parts, " ")
+}
+
+// ResolvedField is the final value of one field and its origin.
+type ResolvedField struct {
+	Field  string `json:"field"`
+	Value  any    `json:"value"`
+	Origin Origin `json:"origin"`
+}
+
+// ResolvedPort is a single forward after range expansion.
+type ResolvedPort struct {
+	Mapping string          `json:"mapping"`
+	Fields  []ResolvedField `json:"fields"`
+}
+
+// ResolvedTunnel is a tunnel as tunn will run it.
+type ResolvedTunnel struct {
+	Name   string          `json:"name"`
+	Origin Origin          `json:"origin"`
+	Fields []ResolvedField `json:"fields"`
+	Ports  []ResolvedPort  `json:"ports"`
+}
+
+// Resolution is the fully resolved configuration with provenance.
+type Resolution struct {
+	File           string           `json:"file"`
+	Profile        string           `json:"profile,omitempty"`
+	ProfileFromEnv bool             `json:"profile_from_env,omitempty"`
+	Tunnels        []ResolvedTunnel `json:"tunnels"`
+}
+
+// Resolve explains where every field of the selected tunnels comes from. The
+// configuration file is parsed again for positions; cfg must be the result of
+// LoadFile with the profile already applied, and selected a subset of its
+// tunnels as returned by Select.
+func Resolve(cfg *Config, selected map[string]Tunnel, profileFromEnv bool) (*Resolution, error) {
+	data, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	doc, err := parseDocument(cfg.Path, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	var root *yaml.Node
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+
+	r := &resolver{file: cfg.Path, profile: cfg.Profile, fromEnv: profileFromEnv}
+	resolution := &Resolution{File: cfg.Path, Profile: cfg.Profile, ProfileFromEnv: profileFromEnv}
+	tunnels := mappingValue(root, "tunnels")
+	var overrides *yaml.Node
+	if cfg.Profile != "" {
+		overrides = mappingValue(mappingValue(root, "profiles"), cfg.Profile)
+	}
+
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key, base := mappingEntry(tunnels, name)
+		_, override := mappingEntry(overrides, name)
+		resolution.Tunnels = append(resolution.Tunnels, r.tunnel(name, cfg.Tunnels[name], selected[name], key, base, override))
+	}
+	return resolution, nil
+}
+
+type resolver struct {
+	file    string
+	profile string
+	fromEnv bool
+}
+
+func (r *resolver) tunnel(name string, full, selected Tunnel, key, base, override *yaml.Node) ResolvedTunnel {
+	resolved := ResolvedTunnel{Name: name, Origin: r.at(LayerFile, key)}
+
+	add := func(field string, value any) {
+		if origin, ok := r.fieldOrigin(field, base, override); ok {
+			resolved.Fields = append(resolved.Fields, ResolvedField{Field: field, Value: value, Origin: origin})
+		}
+	}
+	add("host", full.Host)
+	add("user", full.User)
+	if full.IdentityFile != "" {
+		origin, _ := r.fieldOrigin("identity_file", base, override)
+		value := full.IdentityFile
+		if expanded := os.ExpandEnv(value); expanded != value {
+			origin.Layer = LayerEnv
+			origin.Note = "expanded from " + value
+			value = expanded
+		}
+		resolved.Fields = append(resolved.Fields, ResolvedField{Field: "identity_file", Value: value, Origin: origin})
+	}
+	if len(full.Tags) > 0 {
+		add("tags", full.Tags)
+	}
+	if len(full.DependsOn) > 0 {
+		add("depends_on", full.DependsOn)
+	}
+	if full.Autostart != nil {
+		add("autostart", *full.Autostart)
+	}
+	if full.Lazy {
+		add("lazy", full.Lazy)
+	}
+	if full.IdleTimeout != "" {
+		add("idle_timeout", full.IdleTimeout)
+	}
+
+	portsOwner := base
+	layer := LayerFile
+	if mappingValue(override, "ports") != nil {
+		portsOwner, layer = override, LayerProfile
+	}
+	entries := r.portEntries(mappingValue(portsOwner, "ports"), layer)
+
+	keep := make(map[string]bool, len(selected.Ports))
+	for _, port := range selected.Ports {
+		keep[port.Mapping()] = true
+	}
+	for i, port := range full.Ports {
+		if !keep[port.Mapping()] {
+			continue
+		}
+		var entry portEntry
+		if i < len(entries) {
+			entry = entries[i]
+		}
+		resolved.Ports = append(resolved.Ports, r.port(port, entry))
+	}
+	return resolved
+}
+
+// fieldOrigin locates a tunnel field in the profile override or the base
+// definition. It reports false when the field is set in neither.
+func (r *resolver) fieldOrigin(field string, base, override *yaml.Node) (Origin, bool) {
+	if node := mappingValue(override, field); node != nil {
+		return r.at(LayerProfile, node), true
+	}
+	if node := mappingValue(base, field); node != nil {
+		return r.at(LayerFile, node), true
+	}
+	return Origin{}, false
+}
+
+// portEntry holds the nodes of the fields set in the configuration entry a
+// resolved port was written in.
+type portEntry struct {
+	layer    Layer
+	fields   map[string]*yaml.Node
+	expanded string
+}
+
+// portEntries lists the entry behind every port after range expansion, in
+// the same order as the decoded ports.
+func (r *resolver) portEntries(ports *yaml.Node, layer Layer) []portEntry {
+	if ports == nil || ports.Kind != yaml.SequenceNode {
+		return nil
+	}
+	var entries []portEntry
+	for _, node := range ports.Content {
+		var port Port
+		if err := node.Decode(&port); err != nil {
+			continue
+		}
+		entry := portEntry{layer: layer, fields: make(map[string]*yaml.Node)}
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				entry.fields[node.Content[i].Value] = node.Content[i+1]
+			}
+		} else {
+			entry.fields["local"] = node
+			if strings.Contains(node.Value, ":") {
+				entry.fields["remote"] = node
+			}
+		}
+		count := 1
+		if strings.Contains(port.Spec(), "-") {
+			entry.expanded = port.Spec()
+			if mappings, err := ParsePortMappings(port.Spec()); err == nil {
+				count = len(mappings)
+			}
+		}
+		for i := 0; i < count; i++ {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (r *resolver) port(port Port, entry portEntry) ResolvedPort {
+	resolved := ResolvedPort{Mapping: port.Mapping()}
+	add := func(field, value, fallback string) {
+		if node, ok := entry.fields[field]; ok {
+			origin := r.at(entry.layer, node)
+			if entry.expanded != "" && (field == "local" || field == "remote" || field == "name") {
+				origin.Note = joinNotes(origin.Note, "expanded from "+entry.expanded)
+			}
+			resolved.Fields = append(resolved.Fields, ResolvedField{Field: field, Value: value, Origin: origin})
+			return
+		}
+		if fallback != "" {
+			resolved.Fields = append(resolved.Fields, ResolvedField{Field: field, Value: fallback, Origin: Origin{Layer: LayerDefaults}})
+		}
+	}
+
+	add("local", port.Local, "")
+	switch port.ForwardType() {
+	case ForwardDynamic:
+		add("bind", port.Bind, "localhost")
+	default:
+		add("remote", port.RemotePort(), port.RemotePort())
+		add("target_host", port.TargetHost, port.Target())
+		add("bind", port.Bind, "localhost")
+	}
+	add("name", port.Name, "")
+	add("protocol", port.Protocol, "tcp")
+	add("forward", port.Forward, port.ForwardType())
+	return resolved
+}
+
+// at builds an origin pointing at node in the configuration file.
+func (r *resolver) at(layer Layer, node *yaml.Node) Origin {
+	origin := Origin{Layer: layer, File: r.file}
+	if node != nil {
+		origin.Line, origin.Column = node.Line, node.Column
+	}
+	if layer == LayerProfile {
+		origin.Note = r.profile
+		if r.fromEnv {
+			origin.Note += " from " + ProfileEnv
+		}
+	}
+	return origin
+}
+
+func joinNotes(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + ", " + b
+}
+
+// mappingEntry returns the key and value nodes stored under key in a mapping.
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	_, value := mappingEntry(node, key)
+	return value
+}
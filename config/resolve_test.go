@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	content := `tunnels:
+  db:
+    host: bastion
+    identity_file: $TUNN_TEST_KEYS/id_db
+    ports:
+      - 9092-9093
+      - local: 6379
+        name: redis
+  api:
+    host: web
+    ports: [3000]
+profiles:
+  prod:
+    db:
+      host: prod-bastion
+      ports: ["15432:5432"]
+`
+	path := filepath.Join(t.TempDir(), ".tunnrc")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	keys := t.TempDir()
+	if err := os.WriteFile(filepath.Join(keys, "id_db"), []byte("key"), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	t.Setenv("TUNN_TEST_KEYS", keys)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+
+	resolution, err := Resolve(cfg, cfg.Tunnels, false)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(resolution.Tunnels) != 2 || resolution.Tunnels[0].Name != "api" {
+		t.Fatalf("unexpected tunnels: %+v", resolution.Tunnels)
+	}
+	db := resolution.Tunnels[1]
+	if db.Origin.Line != 2 || db.Origin.Column != 3 {
+		t.Errorf("db origin = %+v, want 2:3", db.Origin)
+	}
+
+	identity := field(t, db.Fields, "identity_file")
+	if identity.Value != filepath.Join(keys, "id_db") || identity.Origin.Layer != LayerEnv || identity.Origin.Line != 4 {
+		t.Errorf("identity_file = %+v", identity)
+	}
+	if len(db.Ports) != 3 {
+		t.Fatalf("expected 3 ports after expansion, got %d", len(db.Ports))
+	}
+	local := field(t, db.Ports[1].Fields, "local")
+	if local.Value != "9093" || local.Origin.Line != 6 || local.Origin.Note != "expanded from 9092-9093" {
+		t.Errorf("expanded local = %+v", local)
+	}
+	if target := field(t, db.Ports[2].Fields, "target_host"); target.Value != "localhost" || target.Origin.Layer != LayerDefaults {
+		t.Errorf("target_host = %+v", target)
+	}
+	if name := field(t, db.Ports[2].Fields, "name"); name.Value != "redis" || name.Origin.Line != 8 {
+		t.Errorf("name = %+v", name)
+	}
+
+	if err := cfg.ApplyProfile("prod"); err != nil {
+		t.Fatalf("ApplyProfile: %v", err)
+	}
+	selected, err := cfg.Select(Selector{Names: []string{"db"}})
+	if err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	resolution, err = Resolve(cfg, selected, true)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	db = resolution.Tunnels[0]
+	host := field(t, db.Fields, "host")
+	if host.Value != "prod-bastion" || host.Origin.Layer != LayerProfile || host.Origin.Line != 15 || host.Origin.Note != "prod from TUNN_PROFILE" {
+		t.Errorf("host = %+v", host)
+	}
+	if len(db.Ports) != 1 {
+		t.Fatalf("expected the profile ports, got %+v", db.Ports)
+	}
+	if remote := field(t, db.Ports[0].Fields, "remote"); remote.Value != "5432" || remote.Origin.Layer != LayerProfile || remote.Origin.Line != 16 {
+		t.Errorf("remote = %+v", remote)
+	}
+}
+
+func field(t *testing.T, fields []ResolvedField, name string) ResolvedField {
+	t.Helper()
+	for _, f := range fields {
+		if f.Field == name {
+			return f
+		}
+	}
+	t.Fatalf("field %q not found in %+v", name, fields)
+	return ResolvedField{}
+}
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SchemaID is the canonical location of the published schema.
+const SchemaID = "https://raw.githubusercontent.com/strandnerd/tunn/main/tunnrc.schema.json"
+
+// schemaField is a configuration field as seen through its yaml tag.
+type schemaField struct {
+	name     string
+	required bool
+}
+
+// structFields lists the yaml fields of a configuration type. Fields tagged
+// "-" are internal; fields without omitempty are required.
+func structFields(t reflect.Type) []schemaField {
+	var fields []schemaField
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("yaml")
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "-" || name == "" {
+			continue
+		}
+		fields = append(fields, schemaField{name: name, required: !strings.Contains(options, "omitempty")})
+	}
+	return fields
+}
+
+// fieldNames returns the yaml field names of a configuration type.
+func fieldNames(t reflect.Type) []string {
+	fields := structFields(t)
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, field.name)
+	}
+	return names
+}
+
+// portNumber matches 1-65535, allowing leading zeros as the parser does.
+const portNumber = `0*([1-9][0-9]{0,3}|[1-5][0-9]{4}|6[0-4][0-9]{3}|65[0-4][0-9]{2}|655[0-2][0-9]|6553[0-5])`
+
+var (
+	portRangePattern = `\s*` + portNumber + `\s*(-\s*` + portNumber + `\s*)?`
+	portSpecPattern  = `^` + portRangePattern + `(:` + portRangePattern + `)?$`
+	autoPattern      = `^\s*(auto|0+)\s*`
+	autoSpecPattern  = autoPattern + `:\s*` + portNumber + `\s*$`
+	// durationPattern matches the durations time.ParseDuration accepts,
+	// without a sign.
+	durationPattern = `^(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+$`
+	zeroDuration    = `^((0+(\.0*)?|\.0+)(ns|us|µs|μs|ms|s|m|h))+$`
+)
+
+// fieldSchemas holds the constraints and descriptions of each field, keyed by
+// "<definition>.<field>". The set of fields itself comes from the types.
+var fieldSchemas = map[string]map[string]any{
+	"config.tunnels": {
+		"description":          "Tunnels by name.",
+		"type":                 []string{"object", "null"},
+		"propertyNames":        ref("name"),
+		"additionalProperties": ref("tunnel"),
+	},
+	"config.groups": {
+		"description":   "Named lists of tunnels, tunnel/port references or other @groups.",
+		"type":          []string{"object", "null"},
+		"propertyNames": ref("name"),
+		"additionalProperties": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		},
+	},
+	"config.auto_ports": {
+		"description": "Range automatic local ports are picked from (default: 20000-29999).",
+		"$ref":        "#/definitions/portRange",
+	},
+	"config.profiles": {
+		"description":   "Profiles overriding tunnels for another environment, selected with --profile or TUNN_PROFILE.",
+		"type":          []string{"object", "null"},
+		"propertyNames": ref("name"),
+		"additionalProperties": map[string]any{
+			"type":                 []string{"object", "null"},
+			"additionalProperties": ref("override"),
+		},
+	},
+	"tunnel.host":          hostSchema("SSH host, usually an alias from ~/.ssh/config."),
+	"tunnel.ports":         portsSchema(),
+	"tunnel.user":          stringSchema("SSH user, overriding ~/.ssh/config."),
+	"tunnel.identity_file": stringSchema("Path to the SSH private key."),
+	"tunnel.tags": {
+		"description": "Labels used to select tunnels with --tag.",
+		"type":        "array",
+		"items": map[string]any{
+			"type":  "string",
+			"allOf": []any{pattern(`\S`), pattern(`^[^, ]*$`)},
+		},
+	},
+	"tunnel.depends_on": {
+		"description": "Tunnels that must be active before this one starts; they are started along with it.",
+		"type":        "array",
+		"items":       ref("name"),
+	},
+	"tunnel.enabled": {
+		"description": "Set to false to ignore the tunnel entirely.",
+		"type":        "boolean",
+	},
+	"tunnel.autostart": {
+		"description": "Set to false to start the tunnel only when selected by name, group or tag.",
+		"type":        "boolean",
+	},
+	"tunnel.lazy": {
+		"description": "Set to true to listen on the local ports and only start ssh when a connection arrives; cannot be combined with remote forwards or depends_on.",
+		"type":        "boolean",
+	},
+	"tunnel.idle_timeout": {
+		"description": "How long a lazy tunnel keeps ssh running without connections, such as 10m (default: 10m).",
+		"type":        "string",
+		"pattern":     durationPattern,
+		"not":         pattern(zeroDuration),
+	},
+	"override.host":          hostSchema("SSH host used by this profile."),
+	"override.ports":         portsSchema(),
+	"override.user":          stringSchema("SSH user used by this profile."),
+	"override.identity_file": stringSchema("SSH private key used by this profile."),
+	"port.local": {
+		"description": "Local port, local:remote mapping or range, or auto (or 0) to pick a free port. For remote forwards, the port reached on this machine.",
+		"oneOf":       []any{ref("portSpec"), ref("autoPort")},
+	},
+	"port.remote": {
+		"description": "Remote port or range. For remote forwards, the port opened on the SSH server.",
+		"$ref":        "#/definitions/portRange",
+	},
+	"port.target_host": addressSchema("Host reached from the SSH server (default: localhost)."),
+	"port.bind":        addressSchema("Local bind address."),
+	"port.name": {
+		"description": "Name shown in the display and used in tunnel/port references.",
+		"type":        "string",
+		"allOf":       []any{pattern(`\S`), pattern(`^[^/: ]*$`)},
+		"not":         pattern(`^[+-]?[0-9]+$`),
+	},
+	"port.protocol": {
+		"description": "Informational label; ssh only forwards TCP.",
+		"type":        "string",
+		"not":         pattern(`^[uU][dD][pP]$`),
+	},
+	"port.forward": {
+		"description": "Kind of forward: local (ssh -L, the default), remote (ssh -R) or dynamic (ssh -D).",
+		"enum":        []string{ForwardLocal, ForwardRemote, ForwardDynamic},
+	},
+}
+
+// Schema returns the JSON Schema describing the configuration file. The
+// validator used by Load enforces the same rules, plus the checks that span
+// several fields, such as duplicate local ports and group references.
+func Schema() ([]byte, error) {
+	port := object(reflect.TypeOf(Port{}), "port")
+	port["if"] = map[string]any{
+		"properties": map[string]any{"forward": map[string]any{"const": ForwardDynamic}},
+		"required":   []string{"forward"},
+	}
+	port["then"] = map[string]any{
+		"not": map[string]any{"anyOf": []any{
+			map[string]any{"required": []string{"remote"}},
+			map[string]any{"required": []string{"target_host"}},
+		}},
+	}
+	// An automatic local port needs a remote port to forward to, unless it
+	// is a SOCKS proxy, and cannot receive remote forwards.
+	port["allOf"] = []any{map[string]any{
+		"if": map[string]any{
+			"properties": map[string]any{"local": ref("autoPort")},
+			"required":   []string{"local"},
+		},
+		"then": map[string]any{
+			"not": map[string]any{
+				"properties": map[string]any{"forward": map[string]any{"const": ForwardRemote}},
+				"required":   []string{"forward"},
+			},
+			"anyOf": []any{
+				map[string]any{"required": []string{"remote"}},
+				map[string]any{
+					"properties": map[string]any{"forward": map[string]any{"const": ForwardDynamic}},
+					"required":   []string{"forward"},
+				},
+			},
+		},
+	}}
+
+	schema := object(reflect.TypeOf(Config{}), "config")
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = SchemaID
+	schema["title"] = "tunn configuration"
+	schema["definitions"] = map[string]any{
+		"name": map[string]any{
+			"type":  "string",
+			"allOf": []any{pattern(`\S`), pattern(`^[^/@ ]*$`)},
+		},
+		"tunnel":   object(reflect.TypeOf(Tunnel{}), "tunnel"),
+		"override": object(reflect.TypeOf(TunnelOverride{}), "override"),
+		"port":     port,
+		"portRange": map[string]any{
+			"oneOf": []any{
+				map[string]any{"type": "string", "pattern": `^` + portRangePattern + `$`},
+				map[string]any{"type": "integer", "minimum": 1, "maximum": 65535},
+			},
+		},
+		"portSpec": map[string]any{
+			"oneOf": []any{
+				map[string]any{"type": "string", "pattern": portSpecPattern},
+				map[string]any{"type": "string", "pattern": autoSpecPattern},
+				map[string]any{"type": "integer", "minimum": 1, "maximum": 65535},
+			},
+		},
+		"autoPort": map[string]any{
+			"oneOf": []any{
+				map[string]any{"type": "string", "pattern": autoPattern + `$`},
+				map[string]any{"type": "integer", "minimum": 0, "maximum": 0},
+			},
+		},
+	}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// object builds a closed object schema from the yaml fields of t.
+func object(t reflect.Type, definition string) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for _, field := range structFields(t) {
+		properties[field.name] = fieldSchemas[definition+"."+field.name]
+		if field.required {
+			required = append(required, field.name)
+		}
+	}
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func ref(definition string) map[string]any {
+	return map[string]any{"$ref": "#/definitions/" + definition}
+}
+
+func pattern(expr string) map[string]any {
+	return map[string]any{"pattern": expr}
+}
+
+func stringSchema(description string) map[string]any {
+	return map[string]any{"description": description, "type": "string"}
+}
+
+func hostSchema(description string) map[string]any {
+	return map[string]any{"description": description, "type": "string", "pattern": `\S`}
+}
+
+func addressSchema(description string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"type":        "string",
+		"allOf":       []any{pattern(`\S`), pattern(`^[^ /]*$`)},
+	}
+}
+
+func portsSchema() map[string]any {
+	return map[string]any{
+		"description": "Forwards: a port, local:remote mapping or range such as 9092-9094, or a mapping with 'local'.",
+		"type":        "array",
+		"minItems":    1,
+		"items": map[string]any{
+			"oneOf": []any{ref("portSpec"), ref("port")},
+		},
+	}
+}
@@ -0,0 +1,417 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSchemaFileIsCurrent(t *testing.T) {
+	want, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	got, err := os.ReadFile("../tunnrc.schema.json")
+	if err != nil {
+		t.Fatalf("read schema file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("tunnrc.schema.json is out of date; regenerate it with 'go run . config schema > tunnrc.schema.json'")
+	}
+}
+
+func TestSchemaFieldsMatchTypes(t *testing.T) {
+	var schema map[string]any
+	data, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	definitions := schema["definitions"].(map[string]any)
+
+	tests := []struct {
+		name   string
+		schema map[string]any
+		fields []string
+	}{
+		{"config", schema, rootFields},
+		{"tunnel", definitions["tunnel"].(map[string]any), tunnelFields},
+		{"override", definitions["override"].(map[string]any), overrideFields},
+		{"port", definitions["port"].(map[string]any), portFields},
+	}
+	for _, tt := range tests {
+		properties := tt.schema["properties"].(map[string]any)
+		var names []string
+		for name, property := range properties {
+			if property == nil {
+				t.Errorf("%s.%s has no schema", tt.name, name)
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		want := append([]string(nil), tt.fields...)
+		sort.Strings(want)
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("%s properties = %v, want %v", tt.name, names, want)
+		}
+	}
+}
+
+// TestSchemaAgreesWithValidator checks every document against both the
+// validator and the schema. Rules that span several fields, such as
+// duplicate local ports or group references, are only enforced by the
+// validator and are not part of this corpus.
+func TestSchemaAgreesWithValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"minimal", "tunnels:\n  db:\n    host: bastion\n    ports: [5432]\n", true},
+		{"all fields", `tunnels:
+  db:
+    host: bastion
+    user: deploy
+    identity_file: /dev/null
+    tags: [data, sql]
+    enabled: true
+    autostart: false
+    depends_on: [cache]
+    ports:
+      - 5432:5432
+      - " 9092-9094 : 19092-19094 "
+      - "0080"
+      - local: 6379
+        remote: "6379"
+        target_host: cache.internal
+        bind: 127.0.0.1
+        name: redis
+        protocol: tcp
+        forward: local
+      - local: 1080
+        forward: dynamic
+        bind: 0.0.0.0
+      - local: 3000
+        remote: 8080
+        forward: remote
+  cache:
+    host: bastion
+    ports: [6380]
+groups:
+  backend: [db, db/redis]
+  all: ["@backend"]
+profiles:
+  prod:
+    db:
+      host: prod-bastion
+      ports: [15432:5432]
+  empty:
+`, true},
+		{"empty tunnels", "tunnels:\n", true},
+		{"missing tunnels", "groups: {}\n", false},
+		{"top level list", "- db\n", false},
+		{"unknown root field", "tunnels: {}\ntunnel: {}\n", false},
+		{"tunnels list", "tunnels: [db]\n", false},
+		{"tunnel scalar", "tunnels:\n  db: bastion\n", false},
+		{"tunnel name with slash", "tunnels:\n  db/x:\n    host: h\n    ports: [1]\n", false},
+		{"tunnel name with space", "tunnels:\n  \"db x\":\n    host: h\n    ports: [1]\n", false},
+		{"empty tunnel name", "tunnels:\n  \"\":\n    host: h\n    ports: [1]\n", false},
+		{"missing host", "tunnels:\n  db:\n    ports: [1]\n", false},
+		{"missing ports", "tunnels:\n  db:\n    host: h\n", false},
+		{"blank host", "tunnels:\n  db:\n    host: \" \"\n    ports: [1]\n", false},
+		{"null host", "tunnels:\n  db:\n    host:\n    ports: [1]\n", false},
+		{"numeric host", "tunnels:\n  db:\n    host: 10\n    ports: [1]\n", false},
+		{"numeric user", "tunnels:\n  db:\n    host: h\n    user: 1000\n    ports: [1]\n", false},
+		{"unknown tunnel field", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    hots: x\n", false},
+		{"empty ports", "tunnels:\n  db:\n    host: h\n    ports: []\n", false},
+		{"ports string", "tunnels:\n  db:\n    host: h\n    ports: \"5432\"\n", false},
+		{"port zero", "tunnels:\n  db:\n    host: h\n    ports: [0]\n", false},
+		{"port out of range", "tunnels:\n  db:\n    host: h\n    ports: [\"65536:1\"]\n", false},
+		{"port signed", "tunnels:\n  db:\n    host: h\n    ports: [\"+5432\"]\n", false},
+		{"port three parts", "tunnels:\n  db:\n    host: h\n    ports: [\"1:2:3\"]\n", false},
+		{"port float", "tunnels:\n  db:\n    host: h\n    ports: [54.32]\n", false},
+		{"port bool", "tunnels:\n  db:\n    host: h\n    ports: [true]\n", false},
+		{"port list", "tunnels:\n  db:\n    host: h\n    ports: [[1]]\n", false},
+		{"port object without local", "tunnels:\n  db:\n    host: h\n    ports:\n      - remote: 1\n", false},
+		{"port object bad local", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: abc\n", false},
+		{"port object local mapping", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: \"15432:5432\"\n", true},
+		{"port object remote mapping", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        remote: \"2:3\"\n", false},
+		{"port object unknown field", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        lcoal: 2\n", false},
+		{"port object blank target", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        target_host: \"\"\n", false},
+		{"port object bind with slash", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        bind: 10.0.0.0/8\n", false},
+		{"port object numeric name", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        name: \"42\"\n", false},
+		{"port object name with colon", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        name: a:b\n", false},
+		{"port object udp", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        protocol: UDP\n", false},
+		{"port object forward case", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        forward: Remote\n", false},
+		{"port object unknown forward", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        forward: socks\n", false},
+		{"dynamic with remote", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        remote: 2\n        forward: dynamic\n", false},
+		{"dynamic with target", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: 1\n        target_host: x\n        forward: dynamic\n", false},
+		{"tags scalar", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    tags: data\n", false},
+		{"tag with comma", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    tags: [\"a,b\"]\n", false},
+		{"numeric tag", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    tags: [1]\n", false},
+		{"enabled string", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    enabled: \"false\"\n", false},
+		{"autostart number", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    autostart: 0\n", false},
+		{"disabled tunnel", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    enabled: false\n", true},
+		{"depends_on string", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    depends_on: db2\n", false},
+		{"depends_on port reference", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    depends_on: [\"db2/1\"]\n", false},
+		{"auto shorthand", "tunnels:\n  db:\n    host: h\n    ports: [\"auto:5432\", \"0:6379\", \" auto : 80 \"]\n", true},
+		{"auto without remote", "tunnels:\n  db:\n    host: h\n    ports: [auto]\n", false},
+		{"auto range", "tunnels:\n  db:\n    host: h\n    ports: [\"auto:5432-5433\"]\n", false},
+		{"auto object", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: auto\n        remote: 5432\n      - local: 0\n        remote: 6379\n", true},
+		{"auto object without remote", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: auto\n", false},
+		{"auto dynamic", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: auto\n        forward: dynamic\n", true},
+		{"auto remote forward", "tunnels:\n  db:\n    host: h\n    ports:\n      - local: auto\n        remote: 80\n        forward: remote\n", false},
+		{"lazy", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    lazy: true\n    idle_timeout: 1h30m\n", true},
+		{"lazy string", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    lazy: \"true\"\n", false},
+		{"idle_timeout fraction", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    lazy: true\n    idle_timeout: 1.5h\n", true},
+		{"idle_timeout number", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    lazy: true\n    idle_timeout: 600\n", false},
+		{"idle_timeout without unit", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    lazy: true\n    idle_timeout: \"600\"\n", false},
+		{"idle_timeout zero", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    lazy: true\n    idle_timeout: 0m\n", false},
+		{"idle_timeout negative", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    lazy: true\n    idle_timeout: -5m\n", false},
+		{"idle_timeout words", "tunnels:\n  db:\n    host: h\n    ports: [1]\n    lazy: true\n    idle_timeout: ten minutes\n", false},
+		{"auto_ports", "auto_ports: 30000-30100\ntunnels: {}\n", true},
+		{"auto_ports word", "auto_ports: many\ntunnels: {}\n", false},
+		{"auto_ports list", "auto_ports: [30000]\ntunnels: {}\n", false},
+		{"groups list", "tunnels: {}\ngroups: [db]\n", false},
+		{"group scalar", "tunnels: {}\ngroups:\n  g: db\n", false},
+		{"group name with at", "tunnels: {}\ngroups:\n  \"@g\": []\n", false},
+		{"profile list", "tunnels: {}\nprofiles:\n  prod: [db]\n", false},
+		{"profile override unknown field", "tunnels:\n  db:\n    host: h\n    ports: [1]\nprofiles:\n  prod:\n    db:\n      tags: [x]\n", false},
+		{"profile override scalar", "tunnels:\n  db:\n    host: h\n    ports: [1]\nprofiles:\n  prod:\n    db: h\n", false},
+		{"profile override blank host", "tunnels:\n  db:\n    host: h\n    ports: [1]\nprofiles:\n  prod:\n    db:\n      host: \"\"\n", false},
+	}
+
+	data, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Errors(Validate("cfg", []byte(tt.content)))
+			if valid := len(errs) == 0; valid != tt.valid {
+				t.Fatalf("validator: valid = %v, want %v: %v", valid, tt.valid, errs)
+			}
+
+			var doc any
+			if err := yaml.Unmarshal([]byte(tt.content), &doc); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			problems := (&schemaChecker{root: schema}).check(schema, toJSON(doc), "")
+			if valid := len(problems) == 0; valid != tt.valid {
+				t.Fatalf("schema: valid = %v, want %v: %v", valid, tt.valid, problems)
+			}
+		})
+	}
+}
+
+// toJSON converts a decoded YAML document into the shapes encoding/json
+// produces, so the schema sees what an editor would.
+func toJSON(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, item := range v {
+			out[key] = toJSON(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = toJSON(item)
+		}
+		return out
+	case int:
+		return float64(v)
+	}
+	return value
+}
+
+// schemaChecker evaluates the subset of JSON Schema draft-07 used by Schema.
+type schemaChecker struct {
+	root map[string]any
+}
+
+func (c *schemaChecker) check(schema map[string]any, value any, path string) []string {
+	var problems []string
+	fail := func(format string, args ...any) {
+		problems = append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if target, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(target, "#/definitions/")
+		definition := c.root["definitions"].(map[string]any)[name].(map[string]any)
+		problems = append(problems, c.check(definition, value, path)...)
+	}
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		fail("expected type %v", types)
+		return problems
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, candidate := range enum {
+			if candidate == value {
+				found = true
+			}
+		}
+		if !found {
+			fail("%v is not one of %v", value, enum)
+		}
+	}
+	if constant, ok := schema["const"]; ok && constant != value {
+		fail("%v is not %v", value, constant)
+	}
+	if expr, ok := schema["pattern"].(string); ok {
+		if s, isString := value.(string); isString && !regexp.MustCompile(expr).MatchString(s) {
+			fail("%q does not match %s", s, expr)
+		}
+	}
+	if n, ok := value.(float64); ok {
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			fail("%v is below %v", n, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && n > maximum {
+			fail("%v is above %v", n, maximum)
+		}
+	}
+
+	if object, ok := value.(map[string]any); ok {
+		for _, name := range asStrings(schema["required"]) {
+			if _, exists := object[name]; !exists {
+				fail("missing %q", name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for key, item := range object {
+			if names, ok := schema["propertyNames"].(map[string]any); ok {
+				problems = append(problems, c.check(names, key, path+"/"+key)...)
+			}
+			if property, ok := properties[key].(map[string]any); ok {
+				problems = append(problems, c.check(property, item, path+"/"+key)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("unexpected property %q", key)
+				}
+			case map[string]any:
+				problems = append(problems, c.check(additional, item, path+"/"+key)...)
+			}
+		}
+	}
+	if array, ok := value.([]any); ok {
+		if minItems, ok := schema["minItems"].(float64); ok && float64(len(array)) < minItems {
+			fail("expected at least %v items", minItems)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range array {
+				problems = append(problems, c.check(items, item, fmt.Sprintf("%s/%d", path, i))...)
+			}
+		}
+	}
+
+	for _, sub := range asSchemas(schema["allOf"]) {
+		problems = append(problems, c.check(sub, value, path)...)
+	}
+	if anyOf := asSchemas(schema["anyOf"]); anyOf != nil && c.matching(anyOf, value) == 0 {
+		fail("matches none of anyOf")
+	}
+	if oneOf := asSchemas(schema["oneOf"]); oneOf != nil && c.matching(oneOf, value) != 1 {
+		fail("does not match exactly one of oneOf")
+	}
+	if not, ok := schema["not"].(map[string]any); ok && len(c.check(not, value, path)) == 0 {
+		fail("matches a forbidden schema")
+	}
+	if cond, ok := schema["if"].(map[string]any); ok && len(c.check(cond, value, path)) == 0 {
+		if then, ok := schema["then"].(map[string]any); ok {
+			problems = append(problems, c.check(then, value, path)...)
+		}
+	}
+	return problems
+}
+
+func (c *schemaChecker) matching(schemas []map[string]any, value any) int {
+	count := 0
+	for _, sub := range schemas {
+		if len(c.check(sub, value, "")) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func matchesType(types any, value any) bool {
+	names := asStrings(types)
+	if name, ok := types.(string); ok {
+		names = []string{name}
+	}
+	for _, name := range names {
+		switch v := value.(type) {
+		case map[string]any:
+			if name == "object" {
+				return true
+			}
+		case []any:
+			if name == "array" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case float64:
+			if name == "number" || name == "integer" && v == float64(int64(v)) {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case nil:
+			if name == "null" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func asStrings(value any) []string {
+	items, _ := value.([]any)
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func asSchemas(value any) []map[string]any {
+	items, ok := value.([]any)
+	if !ok {
+		return nil
+	}
+	out := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		if schema, ok := item.(map[string]any); ok {
+			out = append(out, schema)
+		}
+	}
+	return out
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Selector describes which tunnels to run. An empty selector matches every
+// tunnel that autostarts.
+type Selector struct {
+	// Names holds tunnel names or glob patterns, "tunnel/port" references and
+	// "@group" references.
+	Names []string
+	// Tags selects every tunnel carrying at least one of the tags.
+	Tags []string
+	// Exclude removes tunnels matching a name, glob pattern, "@group" or
+	// "tunnel/port" reference from the result.
+	Exclude []string
+}
+
+// SelectionError lists the selector entries that did not match anything.
+type SelectionError struct {
+	Misses []string
+}
+
+func (e *SelectionError) Error() string {
+	return fmt.Sprintf("no tunnels found matching: %s", strings.Join(e.Misses, ", "))
+}
+
+// FilterTunnels selects tunnels by name. A "tunnel/port" reference selects a
+// single port of a tunnel, where port is a port name or local port, and an
+// "@group" reference selects every member of a configured group. Names may
+// be glob patterns such as "db-*". No names selects every tunnel that
+// autostarts.
+func (c *Config) FilterTunnels(names []string) (map[string]Tunnel, error) {
+	return c.Select(Selector{Names: names})
+}
+
+// Select resolves a selector into the matching tunnels, along with the
+// tunnels they depend on. Every name, group and tag must match at least one
+// tunnel; the misses are reported together in a *SelectionError.
+func (c *Config) Select(sel Selector) (map[string]Tunnel, error) {
+	filtered := make(map[string]Tunnel)
+	var misses []string
+
+	if len(sel.Names) == 0 && len(sel.Tags) == 0 {
+		for name, tunnel := range c.Tunnels {
+			if tunnel.Autostarts() {
+				filtered[name] = tunnel
+			}
+		}
+	}
+
+	whole := make(map[string]bool)
+	for _, ref := range sel.Names {
+		names, ok := c.expandGroups([]string{ref}, nil)
+		if !ok {
+			misses = append(misses, ref)
+			continue
+		}
+		matched := false
+		for _, name := range names {
+			hit, err := c.selectName(name, filtered, whole)
+			if err != nil {
+				return nil, err
+			}
+			matched = matched || hit
+		}
+		if !matched {
+			misses = append(misses, c.describeMiss(ref))
+		}
+	}
+
+	for _, tag := range sel.Tags {
+		matched := false
+		for name, tunnel := range c.Tunnels {
+			if tunnel.HasTag(tag) {
+				filtered[name] = tunnel
+				whole[name] = true
+				matched = true
+			}
+		}
+		if !matched {
+			misses = append(misses, "--tag "+tag)
+		}
+	}
+
+	if len(misses) > 0 {
+		return nil, &SelectionError{Misses: misses}
+	}
+
+	c.addDependencies(filtered)
+	for _, ref := range sel.Exclude {
+		if err := c.exclude(ref, filtered); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkDependencies(filtered); err != nil {
+		return nil, err
+	}
+	return filtered, nil
+}
+
+// describeMiss points out when an unmatched reference names a disabled tunnel.
+func (c *Config) describeMiss(ref string) string {
+	name, _, _ := strings.Cut(ref, "/")
+	for _, disabled := range c.Disabled {
+		if disabled == name {
+			return ref + " (disabled)"
+		}
+	}
+	return ref
+}
+
+// selectName adds the tunnels or ports matched by a single name to filtered
+// and reports whether anything matched.
+func (c *Config) selectName(name string, filtered map[string]Tunnel, whole map[string]bool) (bool, error) {
+	pattern, portRef, hasPort := strings.Cut(name, "/")
+	tunnelNames, err := c.matchTunnels(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	matched := false
+	for _, tunnelName := range tunnelNames {
+		tunnel := c.Tunnels[tunnelName]
+		if !hasPort {
+			filtered[tunnelName] = tunnel
+			whole[tunnelName] = true
+			matched = true
+			continue
+		}
+		port, ok := tunnel.LookupPort(portRef)
+		if !ok {
+			continue
+		}
+		matched = true
+		if whole[tunnelName] {
+			continue
+		}
+		narrowed, seen := filtered[tunnelName]
+		if !seen {
+			narrowed = tunnel
+			narrowed.Ports = nil
+		}
+		if _, dup := narrowed.LookupPort(port.Mapping()); !dup {
+			narrowed.Ports = append(narrowed.Ports, port)
+		}
+		filtered[tunnelName] = narrowed
+	}
+	return matched, nil
+}
+
+// exclude removes the tunnels or ports matched by ref from filtered.
+func (c *Config) exclude(ref string, filtered map[string]Tunnel) error {
+	names, ok := c.expandGroups([]string{ref}, nil)
+	if !ok {
+		return fmt.Errorf("unknown group in --exclude: %s", ref)
+	}
+	for _, name := range names {
+		pattern, portRef, hasPort := strings.Cut(name, "/")
+		tunnelNames, err := c.matchTunnels(pattern)
+		if err != nil {
+			return err
+		}
+		for _, tunnelName := range tunnelNames {
+			tunnel, selected := filtered[tunnelName]
+			if !selected {
+				continue
+			}
+			if !hasPort {
+				delete(filtered, tunnelName)
+				continue
+			}
+			remaining := make([]Port, 0, len(tunnel.Ports))
+			for _, port := range tunnel.Ports {
+				if !port.Matches(portRef) {
+					remaining = append(remaining, port)
+				}
+			}
+			if len(remaining) == 0 {
+				delete(filtered, tunnelName)
+				continue
+			}
+			tunnel.Ports = remaining
+			filtered[tunnelName] = tunnel
+		}
+	}
+	return nil
+}
+
+// matchTunnels returns the sorted tunnel names matching a name or glob pattern.
+func (c *Config) matchTunnels(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		if _, ok := c.Tunnels[pattern]; ok {
+			return []string{pattern}, nil
+		}
+		return nil, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid tunnel pattern %q: %w", pattern, err)
+	}
+
+	var names []string
+	for name := range c.Tunnels {
+		if ok, _ := path.Match(pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// expandGroups replaces "@group" references with the group's members,
+// following nested groups once each. It reports false when a referenced
+// group does not exist.
+func (c *Config) expandGroups(names []string, visited map[string]bool) ([]string, bool) {
+	expanded := make([]string, 0, len(names))
+	for _, name := range names {
+		group, isGroup := strings.CutPrefix(name, "@")
+		if !isGroup {
+			expanded = append(expanded, name)
+			continue
+		}
+		members, exists := c.Groups[group]
+		if !exists {
+			return nil, false
+		}
+		if visited == nil {
+			visited = make(map[string]bool)
+		}
+		if visited[group] {
+			continue
+		}
+		visited[group] = true
+		nested, ok := c.expandGroups(members, visited)
+		if !ok {
+			return nil, false
+		}
+		expanded = append(expanded, nested...)
+	}
+	return expanded, true
+}
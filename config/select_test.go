@@ -0,0 +1,173 @@
+package config
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFilterTunnelsPortReference(t *testing.T) {
+	cfg := &Config{
+		Tunnels: map[string]Tunnel{
+			"db": {
+				Host: "server",
+				Ports: []Port{
+					{Local: "5432", Name: "postgres"},
+					{Local: "6379", Name: "redis"},
+					{Local: "3306"},
+				},
+			},
+		},
+	}
+
+	filtered, err := cfg.FilterTunnels([]string{"db/postgres", "db/3306"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	db, ok := filtered["db"]
+	if !ok {
+		t.Fatal("expected db tunnel to be selected")
+	}
+	if len(db.Ports) != 2 || db.Ports[0].Name != "postgres" || db.Ports[1].Local != "3306" {
+		t.Fatalf("unexpected ports: %+v", db.Ports)
+	}
+	if len(cfg.Tunnels["db"].Ports) != 3 {
+		t.Fatal("narrowing must not modify the configuration")
+	}
+
+	filtered, err = cfg.FilterTunnels([]string{"db/redis", "db"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered["db"].Ports) != 3 {
+		t.Fatalf("expected whole tunnel when also selected by name, got %+v", filtered["db"].Ports)
+	}
+}
+
+func TestSelectGroupsAndTags(t *testing.T) {
+	cfg := &Config{
+		Tunnels: map[string]Tunnel{
+			"api":    {Host: "a", Ports: []Port{{Local: "3000"}}, Tags: []string{"backend"}},
+			"db":     {Host: "b", Ports: []Port{{Local: "5432", Name: "postgres"}, {Local: "6379"}}, Tags: []string{"data"}},
+			"kafka":  {Host: "c", Ports: []Port{{Local: "9092"}}, Tags: []string{"data", "backend"}},
+			"search": {Host: "d", Ports: []Port{{Local: "9200"}}},
+		},
+		Groups: map[string][]string{
+			"payments":  {"api", "db/postgres", "@streaming"},
+			"streaming": {"kafka", "@payments"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		selector Selector
+		expected []string
+	}{
+		{"group with nested group", Selector{Names: []string{"@payments"}}, []string{"api", "db", "kafka"}},
+		{"tag", Selector{Tags: []string{"data"}}, []string{"db", "kafka"}},
+		{"tag and name", Selector{Names: []string{"search"}, Tags: []string{"backend"}}, []string{"api", "kafka", "search"}},
+		{"glob", Selector{Names: []string{"s*"}}, []string{"search"}},
+		{"glob with port", Selector{Names: []string{"d?/postgres"}}, []string{"db"}},
+		{"exclude", Selector{Tags: []string{"data"}, Exclude: []string{"k*"}}, []string{"db"}},
+		{"exclude group", Selector{Exclude: []string{"@streaming"}}, []string{"db", "search"}},
+		{"exclude port", Selector{Names: []string{"db"}, Exclude: []string{"db/postgres"}}, []string{"db"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := cfg.Select(tt.selector)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(selected) != len(tt.expected) {
+				t.Fatalf("expected %v, got %d tunnels", tt.expected, len(selected))
+			}
+			for _, name := range tt.expected {
+				if _, ok := selected[name]; !ok {
+					t.Fatalf("expected %s to be selected", name)
+				}
+			}
+		})
+	}
+
+	selected, _ := cfg.Select(Selector{Names: []string{"@payments"}})
+	if ports := selected["db"].Ports; len(ports) != 1 || ports[0].Name != "postgres" {
+		t.Fatalf("expected group member db/postgres to narrow ports, got %+v", ports)
+	}
+	selected, _ = cfg.Select(Selector{Names: []string{"db"}, Exclude: []string{"db/postgres"}})
+	if ports := selected["db"].Ports; len(ports) != 1 || ports[0].Local != "6379" {
+		t.Fatalf("expected excluded port to be dropped, got %+v", ports)
+	}
+}
+
+func TestSelectReportsMisses(t *testing.T) {
+	cfg := &Config{
+		Tunnels: map[string]Tunnel{
+			"db": {Host: "b", Ports: []Port{{Local: "5432", Name: "postgres"}}},
+		},
+		Groups: map[string][]string{"data": {"db"}},
+	}
+
+	_, err := cfg.Select(Selector{
+		Names: []string{"db", "cache-*", "db/redis", "@missing", "@data"},
+		Tags:  []string{"unused"},
+	})
+	var selErr *SelectionError
+	if !errors.As(err, &selErr) {
+		t.Fatalf("expected *SelectionError, got %v", err)
+	}
+	want := []string{"cache-*", "db/redis", "@missing", "--tag unused"}
+	if strings.Join(selErr.Misses, ",") != strings.Join(want, ",") {
+		t.Fatalf("got misses %v want %v", selErr.Misses, want)
+	}
+
+	if _, err := cfg.Select(Selector{Names: []string{"db["}}); err == nil || !strings.Contains(err.Error(), "invalid tunnel pattern") {
+		t.Fatalf("expected invalid pattern error, got %v", err)
+	}
+}
+
+func TestSelectManualTunnels(t *testing.T) {
+	manual := false
+	cfg := &Config{
+		Tunnels: map[string]Tunnel{
+			"db":      {Host: "b", Ports: []Port{{Local: "5432"}}, Tags: []string{"data"}},
+			"reports": {Host: "r", Ports: []Port{{Local: "8080"}}, Tags: []string{"data"}, Autostart: &manual},
+		},
+		Groups:   map[string][]string{"all": {"db", "reports"}},
+		Disabled: []string{"legacy"},
+	}
+
+	tests := []struct {
+		name string
+		sel  Selector
+		want []string
+	}{
+		{"bare", Selector{}, []string{"db"}},
+		{"by name", Selector{Names: []string{"reports"}}, []string{"reports"}},
+		{"by pattern", Selector{Names: []string{"rep*"}}, []string{"reports"}},
+		{"by group", Selector{Names: []string{"@all"}}, []string{"db", "reports"}},
+		{"by tag", Selector{Tags: []string{"data"}}, []string{"db", "reports"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := cfg.Select(tt.sel)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for name := range selected {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("selected %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := cfg.Select(Selector{Names: []string{"legacy/5432"}})
+	if err == nil || err.Error() != "no tunnels found matching: legacy/5432 (disabled)" {
+		t.Fatalf("expected disabled miss, got %v", err)
+	}
+}
@@ -0,0 +1,632 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tomlTable records how a TOML table came to exist, which decides whether a
+// later header or dotted key may still add to it.
+type tomlTable int
+
+const (
+	tomlImplicit tomlTable = iota // created as the parent of another table
+	tomlExplicit                  // opened by its own [header]
+	tomlDotted                    // created by a dotted key such as a.b = 1
+	tomlInline                    // an inline { } table, closed once written
+)
+
+// tomlParser reads the TOML subset that describes configuration files into
+// YAML nodes with the position of every key and value: tables, arrays of
+// tables, dotted keys, strings, numbers, booleans, dates, arrays and inline
+// tables.
+type tomlParser struct {
+	src    []rune
+	pos    int
+	line   int
+	column int
+
+	tables      map[*yaml.Node]tomlTable
+	tableArrays map[*yaml.Node]bool
+}
+
+type tomlKey struct {
+	name   string
+	line   int
+	column int
+}
+
+func parseTOML(data []byte) (*yaml.Node, error) {
+	if !utf8.Valid(data) {
+		return nil, &SyntaxError{Line: 1, Column: 1, Message: "file is not valid UTF-8"}
+	}
+	p := &tomlParser{
+		src:         []rune(strings.TrimPrefix(string(data), "\ufeff")),
+		line:        1,
+		column:      1,
+		tables:      make(map[*yaml.Node]tomlTable),
+		tableArrays: make(map[*yaml.Node]bool),
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	p.tables[root] = tomlExplicit
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Line: 1, Column: 1}
+
+	current := root
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			break
+		}
+		var err error
+		if p.peek() == '[' {
+			current, err = p.header(root)
+		} else {
+			err = p.keyValue(current)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(root.Content) > 0 {
+		doc.Content = []*yaml.Node{root}
+	}
+	return doc, nil
+}
+
+// header parses a [table] or [[array of tables]] line and returns the table
+// that the following keys belong to.
+func (p *tomlParser) header(root *yaml.Node) (*yaml.Node, error) {
+	p.next()
+	array := false
+	if p.peek() == '[' {
+		p.next()
+		array = true
+	}
+	p.skipBlank(false)
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank(false)
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	for _, r := range closing {
+		if p.peek() != r {
+			return nil, p.errorf("expected '%s' to close the table header, found %s", closing, p.describe())
+		}
+		p.next()
+	}
+
+	table := root
+	for _, key := range keys[:len(keys)-1] {
+		if table, err = p.descend(table, key); err != nil {
+			return nil, err
+		}
+	}
+	last := keys[len(keys)-1]
+	existing := mappingValue(table, last.name)
+
+	if array {
+		if existing == nil {
+			existing = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: last.line, Column: last.column}
+			p.tableArrays[existing] = true
+			table.Content = append(table.Content, p.keyNode(last), existing)
+		} else if !p.tableArrays[existing] {
+			return nil, p.errorAt(last, "cannot define %q as an array of tables; it is already defined", last.name)
+		}
+		element := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: last.line, Column: last.column}
+		p.tables[element] = tomlExplicit
+		existing.Content = append(existing.Content, element)
+		return element, nil
+	}
+
+	if existing == nil {
+		element := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: last.line, Column: last.column}
+		p.tables[element] = tomlExplicit
+		table.Content = append(table.Content, p.keyNode(last), element)
+		return element, nil
+	}
+	if existing.Kind == yaml.MappingNode && p.tables[existing] == tomlImplicit {
+		p.tables[existing] = tomlExplicit
+		return existing, nil
+	}
+	return nil, p.errorAt(last, "table %q is already defined", last.name)
+}
+
+// descend returns the child table named key, creating it implicitly. For an
+// array of tables, the last element is used.
+func (p *tomlParser) descend(table *yaml.Node, key tomlKey) (*yaml.Node, error) {
+	existing := mappingValue(table, key.name)
+	switch {
+	case existing == nil:
+		child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.line, Column: key.column}
+		p.tables[child] = tomlImplicit
+		table.Content = append(table.Content, p.keyNode(key), child)
+		return child, nil
+	case p.tableArrays[existing]:
+		return existing.Content[len(existing.Content)-1], nil
+	case existing.Kind == yaml.MappingNode && p.tables[existing] != tomlInline:
+		return existing, nil
+	}
+	return nil, p.errorAt(key, "key %q is already defined as a value", key.name)
+}
+
+func (p *tomlParser) keyValue(table *yaml.Node) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if p.peek() != '=' {
+		return p.errorf("expected '=' after key, found %s", p.describe())
+	}
+	p.next()
+	p.skipBlank(false)
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys[:len(keys)-1] {
+		existing := mappingValue(table, key.name)
+		switch {
+		case existing == nil:
+			child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.line, Column: key.column}
+			p.tables[child] = tomlDotted
+			table.Content = append(table.Content, p.keyNode(key), child)
+			table = child
+		case existing.Kind == yaml.MappingNode && p.tables[existing] == tomlDotted:
+			table = existing
+		default:
+			return p.errorAt(key, "key %q is already defined", key.name)
+		}
+	}
+	last := keys[len(keys)-1]
+	if mappingValue(table, last.name) != nil {
+		return p.errorAt(last, "key %q is already defined", last.name)
+	}
+	table.Content = append(table.Content, p.keyNode(last), value)
+	return nil
+}
+
+// key parses a possibly dotted key of bare or quoted parts.
+func (p *tomlParser) key() ([]tomlKey, error) {
+	var keys []tomlKey
+	for {
+		key := tomlKey{line: p.line, column: p.column}
+		switch r := p.peek(); {
+		case r == '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			key.name = s
+		case r == '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			key.name = s
+		case isBareKeyRune(r):
+			start := p.pos
+			for !p.eof() && isBareKeyRune(p.peek()) {
+				p.next()
+			}
+			key.name = string(p.src[start:p.pos])
+		default:
+			return nil, p.errorf("expected a key, found %s", p.describe())
+		}
+		keys = append(keys, key)
+
+		p.skipBlank(false)
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.next()
+		p.skipBlank(false)
+	}
+}
+
+func (p *tomlParser) value() (*yaml.Node, error) {
+	line, column := p.line, p.column
+	switch r := p.peek(); {
+	case p.eof():
+		return nil, p.errorf("expected a value, found end of input")
+	case r == '"':
+		s, err := p.basicString()
+		if err != nil {
+			return nil, err
+		}
+		return scalarNode("!!str", s, line, column), nil
+	case r == '\'':
+		s, err := p.literalString()
+		if err != nil {
+			return nil, err
+		}
+		return scalarNode("!!str", s, line, column), nil
+	case r == '[':
+		return p.array()
+	case r == '{':
+		return p.inlineTable()
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", p.peek()) {
+		p.next()
+	}
+	// Local date-times may separate the date and time with a space.
+	if p.pos-start == 10 && p.peek() == ' ' && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1]) {
+		p.next()
+		for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", p.peek()) {
+			p.next()
+		}
+	}
+	text := string(p.src[start:p.pos])
+	node, ok := tomlScalar(text, line, column)
+	if !ok {
+		return nil, &SyntaxError{Line: line, Column: column, Message: fmt.Sprintf("invalid value %q", text)}
+	}
+	return node, nil
+}
+
+// tomlScalar converts a bare value: a boolean, number or date.
+func tomlScalar(text string, line, column int) (*yaml.Node, bool) {
+	switch text {
+	case "true", "false":
+		return scalarNode("!!bool", text, line, column), true
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		return scalarNode("!!float", text, line, column), true
+	}
+	if text == "" {
+		return nil, false
+	}
+	if len(text) >= 10 && text[4] == '-' || len(text) >= 8 && text[2] == ':' {
+		for _, r := range text {
+			if !isDigit(r) && !strings.ContainsRune("-:.+TtZz ", r) {
+				return nil, false
+			}
+		}
+		return scalarNode("!!timestamp", text, line, column), true
+	}
+
+	digits := text
+	if strings.Contains(digits, "__") || strings.HasPrefix(strings.TrimLeft(digits, "+-"), "_") || strings.HasSuffix(digits, "_") {
+		return nil, false
+	}
+	digits = strings.ReplaceAll(digits, "_", "")
+	unsigned := strings.TrimLeft(digits, "+-")
+	if len(unsigned) > 2 && unsigned[0] == '0' && strings.ContainsRune("xob", rune(unsigned[1])) {
+		if digits != unsigned {
+			return nil, false
+		}
+		n, err := strconv.ParseInt(unsigned, 0, 64)
+		if err != nil {
+			return nil, false
+		}
+		return scalarNode("!!int", strconv.FormatInt(n, 10), line, column), true
+	}
+	if len(unsigned) > 1 && unsigned[0] == '0' && isDigit(rune(unsigned[1])) {
+		return nil, false
+	}
+	if n, err := strconv.ParseInt(digits, 10, 64); err == nil {
+		return scalarNode("!!int", strconv.FormatInt(n, 10), line, column), true
+	}
+	if _, err := strconv.ParseFloat(digits, 64); err == nil && !strings.HasSuffix(digits, ".") && !strings.HasPrefix(unsigned, ".") {
+		return scalarNode("!!float", digits, line, column), true
+	}
+	return nil, false
+}
+
+func (p *tomlParser) array() (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle, Line: p.line, Column: p.column}
+	p.next()
+	for {
+		p.skipBlank(true)
+		if p.peek() == ']' {
+			p.next()
+			return node, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, value)
+		p.skipBlank(true)
+		switch p.peek() {
+		case ',':
+			p.next()
+		case ']':
+			p.next()
+			return node, nil
+		default:
+			return nil, p.errorf("expected ',' or ']' in array, found %s", p.describe())
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Style: yaml.FlowStyle, Line: p.line, Column: p.column}
+	p.next()
+	p.skipBlank(false)
+	if p.peek() == '}' {
+		p.next()
+		p.tables[node] = tomlInline
+		return node, nil
+	}
+	for {
+		p.skipBlank(false)
+		if err := p.keyValue(node); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		switch p.peek() {
+		case ',':
+			p.next()
+		case '}':
+			p.next()
+			p.tables[node] = tomlInline
+			for child, state := range p.tables {
+				if state == tomlDotted && isDescendant(node, child) {
+					p.tables[child] = tomlInline
+				}
+			}
+			return node, nil
+		default:
+			return nil, p.errorf("expected ',' or '}' in inline table, found %s", p.describe())
+		}
+	}
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	multiline := p.hasPrefix(`"""`)
+	if multiline {
+		p.advance(3)
+		p.trimLeadingNewline()
+	} else {
+		p.next()
+	}
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		r := p.peek()
+		switch {
+		case multiline && p.hasPrefix(`"""`):
+			p.advance(3)
+			// Up to two quotes may directly precede the closing delimiter.
+			for i := 0; i < 2 && p.peek() == '"'; i++ {
+				b.WriteRune('"')
+				p.next()
+			}
+			return b.String(), nil
+		case !multiline && r == '"':
+			p.next()
+			return b.String(), nil
+		case r == '\n' && !multiline:
+			return "", p.errorf("unterminated string")
+		case r == '\\':
+			p.next()
+			if multiline && p.skipLineContinuation() {
+				continue
+			}
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteRune(r)
+			p.next()
+		}
+	}
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	multiline := p.hasPrefix(`'''`)
+	if multiline {
+		p.advance(3)
+		p.trimLeadingNewline()
+	} else {
+		p.next()
+	}
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		r := p.peek()
+		switch {
+		case multiline && p.hasPrefix(`'''`):
+			p.advance(3)
+			for i := 0; i < 2 && p.peek() == '\''; i++ {
+				b.WriteRune('\'')
+				p.next()
+			}
+			return b.String(), nil
+		case !multiline && r == '\'':
+			p.next()
+			return b.String(), nil
+		case r == '\n' && !multiline:
+			return "", p.errorf("unterminated string")
+		default:
+			b.WriteRune(r)
+			p.next()
+		}
+	}
+}
+
+func (p *tomlParser) escape(b *strings.Builder) error {
+	if p.eof() {
+		return p.errorf("unterminated string")
+	}
+	r := p.peek()
+	if !strings.ContainsRune("btnfr\"\\uU", r) {
+		return p.errorf("invalid escape '\\%c'", r)
+	}
+	p.next()
+	switch r {
+	case 'b':
+		b.WriteRune('\b')
+	case 't':
+		b.WriteRune('\t')
+	case 'n':
+		b.WriteRune('\n')
+	case 'f':
+		b.WriteRune('\f')
+	case 'r':
+		b.WriteRune('\r')
+	case '"':
+		b.WriteRune('"')
+	case '\\':
+		b.WriteRune('\\')
+	case 'u', 'U':
+		size := 4
+		if r == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			return p.errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(string(p.src[p.pos:p.pos+size]), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("invalid unicode escape")
+		}
+		b.WriteRune(rune(code))
+		p.advance(size)
+	}
+	return nil
+}
+
+// skipLineContinuation handles a backslash at the end of a line inside a
+// multi-line basic string, which trims the newline and leading whitespace.
+func (p *tomlParser) skipLineContinuation() bool {
+	i := p.pos
+	for i < len(p.src) && (p.src[i] == ' ' || p.src[i] == '\t' || p.src[i] == '\r') {
+		i++
+	}
+	if i >= len(p.src) || p.src[i] != '\n' {
+		return false
+	}
+	for !p.eof() && strings.ContainsRune(" \t\r\n", p.peek()) {
+		p.next()
+	}
+	return true
+}
+
+func (p *tomlParser) trimLeadingNewline() {
+	if p.hasPrefix("\r\n") {
+		p.advance(2)
+	} else if p.peek() == '\n' {
+		p.next()
+	}
+}
+
+// skipBlank skips spaces, tabs and comments, and newlines when newlines is set.
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch r := p.peek(); {
+		case r == ' ' || r == '\t' || r == '\r':
+			p.next()
+		case r == '\n' && newlines:
+			p.next()
+		case r == '#' && newlines:
+			for !p.eof() && p.peek() != '\n' {
+				p.next()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine requires the rest of the line to be blank or a comment.
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+	if p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.next()
+		}
+	}
+	if p.eof() || p.peek() == '\n' {
+		return nil
+	}
+	return p.errorf("expected a new line, found %s", p.describe())
+}
+
+func (p *tomlParser) keyNode(key tomlKey) *yaml.Node {
+	return scalarNode("!!str", key.name, key.line, key.column)
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *tomlParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(string(p.src[p.pos:min(p.pos+len(prefix), len(p.src))]), prefix)
+}
+
+func (p *tomlParser) next() rune {
+	r := p.src[p.pos]
+	p.pos++
+	if r == '\n' {
+		p.line++
+		p.column = 1
+	} else {
+		p.column++
+	}
+	return r
+}
+
+func (p *tomlParser) advance(n int) {
+	for i := 0; i < n && !p.eof(); i++ {
+		p.next()
+	}
+}
+
+func (p *tomlParser) describe() string {
+	if p.eof() {
+		return "end of input"
+	}
+	return strconv.QuoteRune(p.peek())
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return &SyntaxError{Line: p.line, Column: p.column, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *tomlParser) errorAt(key tomlKey, format string, args ...any) error {
+	return &SyntaxError{Line: key.line, Column: key.column, Message: fmt.Sprintf(format, args...)}
+}
+
+func isDescendant(ancestor, node *yaml.Node) bool {
+	for _, child := range ancestor.Content {
+		if child == node || isDescendant(child, node) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBareKeyRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || isDigit(r) || r == '_' || r == '-'
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
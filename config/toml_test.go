@@ -0,0 +1,217 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseTOML(t *testing.T) {
+	content := `# tunn configuration
+title = "example"
+literal = 'C:\path'
+multi = """
+first \
+  second"""
+raw = '''
+keep \n'''
+escaped = "tab\there \u00e9"
+numbers = [1_000, 0x1F, 0o17, 0b11, -2, +3, 1.5, 1e3]
+flags = [true, false]
+when = 1979-05-27 07:32:00
+"quoted key" = 1
+a.b.c = "dotted"
+inline = { x = 1, y.z = 2 }
+
+[servers.alpha]
+ip = "10.0.0.1"
+
+[[items]]
+name = "one"
+
+[[items]]
+name = "two"
+`
+
+	doc, err := parseTOML([]byte(content))
+	if err != nil {
+		t.Fatalf("parseTOML: %v", err)
+	}
+	var got map[string]any
+	if err := doc.Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	checks := map[string]any{
+		"title":      "example",
+		"literal":    `C:\path`,
+		"multi":      "first second",
+		"raw":        `keep \n`,
+		"escaped":    "tab\there é",
+		"quoted key": 1,
+	}
+	for key, want := range checks {
+		if got[key] != want {
+			t.Errorf("%s = %#v, want %#v", key, got[key], want)
+		}
+	}
+	numbers := got["numbers"].([]any)
+	for i, want := range []any{1000, 31, 15, 3, -2, 3, 1.5, 1000.0} {
+		if numbers[i] != want {
+			t.Errorf("numbers[%d] = %#v, want %#v", i, numbers[i], want)
+		}
+	}
+	if c := got["a"].(map[string]any)["b"].(map[string]any)["c"]; c != "dotted" {
+		t.Errorf("a.b.c = %#v", c)
+	}
+	if z := got["inline"].(map[string]any)["y"].(map[string]any)["z"]; z != 2 {
+		t.Errorf("inline.y.z = %#v", z)
+	}
+	if ip := got["servers"].(map[string]any)["alpha"].(map[string]any)["ip"]; ip != "10.0.0.1" {
+		t.Errorf("servers.alpha.ip = %#v", ip)
+	}
+	if items := got["items"].([]any); len(items) != 2 || items[1].(map[string]any)["name"] != "two" {
+		t.Errorf("items = %#v", items)
+	}
+
+	when := doc.Content[0].Content
+	for i := 0; i+1 < len(when); i += 2 {
+		if when[i].Value == "when" && when[i+1].Tag != "!!timestamp" {
+			t.Errorf("when tag = %s, want !!timestamp", when[i+1].Tag)
+		}
+	}
+}
+
+func TestParseTOMLTables(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]any
+	}{
+		{
+			name:    "array of tables with sub-table",
+			content: "[[a]]\nx = 1\n[a.b]\ny = 2\n[[a]]\nx = 3\n",
+			want: map[string]any{"a": []any{
+				map[string]any{"x": 1, "b": map[string]any{"y": 2}},
+				map[string]any{"x": 3},
+			}},
+		},
+		{
+			name:    "nested arrays of tables",
+			content: "[[a]]\n[[a.b]]\nn = 1\n[[a.b]]\nn = 2\n[[a]]\n",
+			want: map[string]any{"a": []any{
+				map[string]any{"b": []any{map[string]any{"n": 1}, map[string]any{"n": 2}}},
+				map[string]any{},
+			}},
+		},
+		{
+			name:    "dotted keys",
+			content: "a.b.c = 1\na.b.d = 2\na.\"e f\" = 3\n",
+			want:    map[string]any{"a": map[string]any{"b": map[string]any{"c": 1, "d": 2}, "e f": 3}},
+		},
+		{
+			name:    "sub-table of a dotted key",
+			content: "[fruit]\napple.color = \"red\"\n[fruit.apple.texture]\nsmooth = true\n",
+			want: map[string]any{"fruit": map[string]any{"apple": map[string]any{
+				"color": "red", "texture": map[string]any{"smooth": true},
+			}}},
+		},
+		{
+			name:    "super-table after sub-table",
+			content: "[a.b]\nx = 1\n[a]\ny = 2\n",
+			want:    map[string]any{"a": map[string]any{"b": map[string]any{"x": 1}, "y": 2}},
+		},
+		{
+			name:    "multi-line basic string",
+			content: "s = \"\"\"\nline1\nline2 \"\" quote\\\n    cont\"\"\"\"\"\n",
+			want:    map[string]any{"s": "line1\nline2 \"\" quotecont\"\""},
+		},
+		{
+			name:    "multi-line literal string",
+			content: "s = '''\n  indent \\n\nend'''''\n",
+			want:    map[string]any{"s": "  indent \\n\nend''"},
+		},
+		{
+			name:    "multi-line string with CRLF",
+			content: "s = \"\"\"\r\nwin\r\n\"\"\"\r\n",
+			want:    map[string]any{"s": "win\r\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseTOML([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("parseTOML: %v", err)
+			}
+			var got map[string]any
+			if err := doc.Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLPositions(t *testing.T) {
+	doc, err := parseTOML([]byte("[tunnels.db]\nhost = \"bastion\"\nports = [\n  5432,\n]\n"))
+	if err != nil {
+		t.Fatalf("parseTOML: %v", err)
+	}
+	tunnels := mappingValue(doc.Content[0], "tunnels")
+	db := mappingValue(tunnels, "db")
+	if db.Line != 1 || db.Column != 10 {
+		t.Errorf("db at %d:%d, want 1:10", db.Line, db.Column)
+	}
+	port := mappingValue(db, "ports").Content[0]
+	if port.Line != 4 || port.Column != 3 || port.Tag != "!!int" {
+		t.Errorf("port at %d:%d (%s), want 4:3 !!int", port.Line, port.Column, port.Tag)
+	}
+	if kind := mappingValue(db, "host").Kind; kind != yaml.ScalarNode {
+		t.Errorf("host kind = %v", kind)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"duplicate key", "a = 1\na = 2\n", `line 2, column 1: key "a" is already defined`},
+		{"duplicate table", "[a]\n[a]\n", `line 2, column 2: table "a" is already defined`},
+		{"table over value", "a = 1\n[a.b]\n", `line 2, column 2: key "a" is already defined as a value`},
+		{"extend inline table", "a = {x = 1}\n[a.b]\n", `line 2, column 2: key "a" is already defined as a value`},
+		{"table after array of tables", "[[a]]\n[a]\n", `line 2, column 2: table "a" is already defined`},
+		{"array of tables after table", "[a]\n[[a]]\n", `line 2, column 3: cannot define "a" as an array of tables; it is already defined`},
+		{"array of tables over array", "a = []\n[[a]]\n", `line 2, column 3: cannot define "a" as an array of tables; it is already defined`},
+		{"array of tables over value", "[[a]]\nb = 1\n[[a.b]]\n", `line 3, column 5: cannot define "b" as an array of tables; it is already defined`},
+		{"table over dotted key", "a.b = 1\n[a]\n", `line 2, column 2: table "a" is already defined`},
+		{"table over dotted table", "[fruit]\napple.color = 1\n[fruit.apple]\n", `line 3, column 8: table "apple" is already defined`},
+		{"dotted key over value", "a.b = 1\na.b.c = 2\n", `line 2, column 3: key "b" is already defined`},
+		{"dotted key into inline table", "a = {x = 1}\na.y = 2\n", `line 2, column 1: key "a" is already defined`},
+		{"unterminated multi-line string", "s = \"\"\"\nno end\n", `line 3, column 1: unterminated string`},
+		{"missing equals", "a 1\n", `line 1, column 3: expected '=' after key, found '1'`},
+		{"trailing text", "a = 1 b\n", `line 1, column 7: expected a new line, found 'b'`},
+		{"unterminated string", "a = \"x\n", `line 1, column 7: unterminated string`},
+		{"bad number", "a = 0123\n", `line 1, column 5: invalid value "0123"`},
+		{"bad escape", `a = "\q"`, `line 1, column 7: invalid escape '\q'`},
+		{"unclosed header", "[a\n", `line 1, column 3: expected ']' to close the table header, found '\n'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML([]byte(tt.content))
+			if err == nil {
+				t.Fatalf("expected error %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,858 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity classifies a validation diagnostic.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic describes a single configuration problem and where it was found.
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Severity Severity
+	Message  string
+}
+
+// String renders the diagnostic as file:line:column: severity: message.
+func (d Diagnostic) String() string {
+	location := d.File
+	if d.Line > 0 {
+		location += ":" + strconv.Itoa(d.Line)
+		if d.Column > 0 {
+			location += ":" + strconv.Itoa(d.Column)
+		}
+	}
+	return fmt.Sprintf("%s: %s: %s", location, d.Severity, d.Message)
+}
+
+// ValidationError aggregates every error-level diagnostic found in a config file.
+type ValidationError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Diagnostics)+1)
+	if len(e.Diagnostics) == 1 {
+		lines = append(lines, "invalid configuration:")
+	} else {
+		lines = append(lines, fmt.Sprintf("invalid configuration (%d problems):", len(e.Diagnostics)))
+	}
+	for _, diag := range e.Diagnostics {
+		lines = append(lines, "  "+diag.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The accepted fields come from the yaml tags of the configuration types, the
+// same source the JSON Schema is derived from.
+var (
+	rootFields     = fieldNames(reflect.TypeOf(Config{}))
+	overrideFields = fieldNames(reflect.TypeOf(TunnelOverride{}))
+	tunnelFields   = fieldNames(reflect.TypeOf(Tunnel{}))
+	portFields     = fieldNames(reflect.TypeOf(Port{}))
+)
+
+var (
+	yamlLineError = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+	durationValue = regexp.MustCompile(durationPattern)
+)
+
+type validator struct {
+	file        string
+	diagnostics []Diagnostic
+	localPorts  map[int][]portClaim
+	tunnels     map[string]*yaml.Node
+	claims      map[string][]portClaim
+	// disabled holds the tunnels with enabled: false, whose local ports stay
+	// free for other tunnels.
+	disabled map[string]bool
+	// dependsOn holds the depends_on entries of every tunnel, checked once
+	// all tunnels are known.
+	dependsOn map[string][]*yaml.Node
+	// lazy holds the tunnels with lazy: true, which cannot take part in
+	// depends_on.
+	lazy map[string]bool
+}
+
+type portClaim struct {
+	tunnel string
+	port   int
+	// bind is the listen address as normalised by claimAddress.
+	bind string
+	node *yaml.Node
+}
+
+// Validate checks raw configuration data and reports every problem found,
+// ordered by position in the file. The syntax is chosen by DetectFormat.
+func Validate(file string, data []byte) []Diagnostic {
+	v := &validator{file: file, localPorts: make(map[int][]portClaim), tunnels: make(map[string]*yaml.Node), claims: make(map[string][]portClaim), disabled: make(map[string]bool), dependsOn: make(map[string][]*yaml.Node), lazy: make(map[string]bool)}
+
+	doc, err := parseDocument(file, data)
+	if err != nil {
+		v.syntaxError(err)
+		return v.diagnostics
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		v.addAt(nil, SeverityError, "configuration is empty; expected a 'tunnels' mapping")
+		return v.diagnostics
+	}
+
+	v.validateRoot(doc.Content[0])
+	sort.SliceStable(v.diagnostics, func(i, j int) bool {
+		if v.diagnostics[i].Line != v.diagnostics[j].Line {
+			return v.diagnostics[i].Line < v.diagnostics[j].Line
+		}
+		return v.diagnostics[i].Column < v.diagnostics[j].Column
+	})
+	return v.diagnostics
+}
+
+func (v *validator) validateRoot(root *yaml.Node) {
+	if root.Kind != yaml.MappingNode {
+		v.addAt(root, SeverityError, "expected a mapping at the top level")
+		return
+	}
+
+	var tunnels, groups, profiles *yaml.Node
+	v.eachField(root, rootFields, "top-level", func(key, value *yaml.Node) {
+		switch key.Value {
+		case "tunnels":
+			tunnels = value
+		case "groups":
+			groups = value
+		case "profiles":
+			profiles = value
+		case "auto_ports":
+			v.validateAutoPorts(value)
+		}
+	})
+	if tunnels == nil {
+		v.addAt(root, SeverityError, "missing required field 'tunnels'")
+		return
+	}
+	v.validateTunnels(tunnels)
+	v.validateDependencies()
+	if groups != nil {
+		v.validateGroups(groups)
+	}
+	if profiles != nil {
+		v.validateProfiles(profiles)
+	}
+}
+
+func (v *validator) validateAutoPorts(node *yaml.Node) {
+	if !isPortValue(node) {
+		v.addAt(node, SeverityError, "'auto_ports' must be a port range such as \"20000-29999\"")
+		return
+	}
+	if _, _, err := parsePortRange(node.Value); err != nil {
+		v.addAt(node, SeverityError, fmt.Sprintf("invalid auto_ports %q: %v", node.Value, err))
+	}
+}
+
+func (v *validator) validateProfiles(profiles *yaml.Node) {
+	if profiles.Kind != yaml.MappingNode {
+		if !isNull(profiles) {
+			v.addAt(profiles, SeverityError, "'profiles' must be a mapping of profile names to tunnel overrides")
+		}
+		return
+	}
+
+	seen := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		key, value := profiles.Content[i], profiles.Content[i+1]
+		if prev, ok := seen[key.Value]; ok {
+			v.addAt(key, SeverityError, fmt.Sprintf("profile %q is already defined at line %d", key.Value, prev.Line))
+			continue
+		}
+		seen[key.Value] = key
+		if strings.TrimSpace(key.Value) == "" || strings.ContainsAny(key.Value, "/@ ") {
+			v.addAt(key, SeverityError, fmt.Sprintf("profile name %q must be non-empty and must not contain '/', '@' or spaces", key.Value))
+			continue
+		}
+		v.validateProfile(key.Value, value)
+	}
+}
+
+func (v *validator) validateProfile(profile string, node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		if !isNull(node) {
+			v.addAt(node, SeverityError, fmt.Sprintf("profile %q must be a mapping of tunnel names to overrides", profile))
+		}
+		return
+	}
+
+	overrides := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if _, exists := v.tunnels[key.Value]; !exists {
+			v.addAt(key, SeverityError, fmt.Sprintf("profile %q overrides unknown tunnel %q", profile, key.Value))
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			v.addAt(value, SeverityError, fmt.Sprintf("profile %q override for %q must be a mapping", profile, key.Value))
+			continue
+		}
+		overrides[key.Value] = value
+	}
+
+	// Local ports are checked against the tunnels as they look with the
+	// profile applied, so overridden ports replace the base claims.
+	basePorts, baseClaims := v.localPorts, v.claims
+	v.localPorts, v.claims = make(map[int][]portClaim), make(map[string][]portClaim)
+	defer func() { v.localPorts, v.claims = basePorts, baseClaims }()
+	for tunnel, claims := range baseClaims {
+		if override, ok := overrides[tunnel]; ok && mappingHasKey(override, "ports") {
+			continue
+		}
+		for _, claim := range claims {
+			v.localPorts[claim.port] = append(v.localPorts[claim.port], claim)
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		tunnel := node.Content[i].Value
+		override, ok := overrides[tunnel]
+		if !ok {
+			continue
+		}
+		context := fmt.Sprintf("profile %q override for %q", profile, tunnel)
+		v.eachField(override, overrideFields, context, func(key, value *yaml.Node) {
+			switch key.Value {
+			case "host":
+				if v.expectString(value, "host") && strings.TrimSpace(value.Value) == "" {
+					v.addAt(value, SeverityError, fmt.Sprintf("%s has an empty 'host'", context))
+				}
+			case "ports":
+				v.validatePorts(tunnel, value)
+			case "user":
+				v.expectString(value, "user")
+			case "identity_file":
+				if v.expectString(value, "identity_file") {
+					v.checkIdentityFile(tunnel, value)
+				}
+			}
+		})
+	}
+}
+
+func mappingHasKey(node *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) validateTunnels(tunnels *yaml.Node) {
+	if tunnels.Kind != yaml.MappingNode {
+		if isNull(tunnels) {
+			return
+		}
+		v.addAt(tunnels, SeverityError, "'tunnels' must be a mapping of tunnel names to definitions")
+		return
+	}
+
+	for i := 0; i+1 < len(tunnels.Content); i += 2 {
+		key, value := tunnels.Content[i], tunnels.Content[i+1]
+		if prev, ok := v.tunnels[key.Value]; ok {
+			v.addAt(key, SeverityError, fmt.Sprintf("tunnel %q is already defined at line %d", key.Value, prev.Line))
+			continue
+		}
+		v.tunnels[key.Value] = key
+		if strings.TrimSpace(key.Value) == "" {
+			v.addAt(key, SeverityError, "tunnel name must not be empty")
+			continue
+		}
+		if strings.ContainsAny(key.Value, "/@ ") {
+			v.addAt(key, SeverityError, fmt.Sprintf("tunnel name %q must not contain '/', '@' or spaces", key.Value))
+			continue
+		}
+		v.validateTunnel(key.Value, key, value)
+	}
+}
+
+func (v *validator) validateGroups(groups *yaml.Node) {
+	if groups.Kind != yaml.MappingNode {
+		if !isNull(groups) {
+			v.addAt(groups, SeverityError, "'groups' must be a mapping of group names to member lists")
+		}
+		return
+	}
+
+	members := make(map[string][]string)
+	keys := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(groups.Content); i += 2 {
+		key, value := groups.Content[i], groups.Content[i+1]
+		if prev, ok := keys[key.Value]; ok {
+			v.addAt(key, SeverityError, fmt.Sprintf("group %q is already defined at line %d", key.Value, prev.Line))
+			continue
+		}
+		keys[key.Value] = key
+		if strings.TrimSpace(key.Value) == "" || strings.ContainsAny(key.Value, "/@ ") {
+			v.addAt(key, SeverityError, fmt.Sprintf("group name %q must be non-empty and must not contain '/', '@' or spaces", key.Value))
+			continue
+		}
+		if value.Kind != yaml.SequenceNode {
+			v.addAt(value, SeverityError, fmt.Sprintf("group %q must be a list of tunnel names", key.Value))
+			continue
+		}
+		for _, member := range value.Content {
+			if !v.expectString(member, "group member") {
+				continue
+			}
+			members[key.Value] = append(members[key.Value], member.Value)
+		}
+	}
+
+	for i := 0; i+1 < len(groups.Content); i += 2 {
+		key, value := groups.Content[i], groups.Content[i+1]
+		if value.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, member := range value.Content {
+			if member.Kind != yaml.ScalarNode {
+				continue
+			}
+			if group, ok := strings.CutPrefix(member.Value, "@"); ok {
+				if _, exists := keys[group]; !exists {
+					v.addAt(member, SeverityError, fmt.Sprintf("group %q references unknown group %q", key.Value, group))
+				}
+				continue
+			}
+			tunnelName, _, _ := strings.Cut(member.Value, "/")
+			if _, exists := v.tunnels[tunnelName]; !exists {
+				v.addAt(member, SeverityError, fmt.Sprintf("group %q references unknown tunnel %q", key.Value, tunnelName))
+			}
+		}
+		if cycle := findGroupCycle(key.Value, members, nil); cycle != nil {
+			v.addAt(key, SeverityError, fmt.Sprintf("group %q includes itself: %s", key.Value, strings.Join(cycle, " -> ")))
+		}
+	}
+}
+
+// findGroupCycle returns the chain of group references leading back to the
+// start group, or nil when the group does not include itself.
+func findGroupCycle(group string, members map[string][]string, chain []string) []string {
+	chain = append(chain, "@"+group)
+	for _, member := range members[group] {
+		next, ok := strings.CutPrefix(member, "@")
+		if !ok {
+			continue
+		}
+		if "@"+next == chain[0] {
+			return append(chain, member)
+		}
+		if contains(chain, "@"+next) {
+			continue
+		}
+		if cycle := findGroupCycle(next, members, chain); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+func (v *validator) validateTunnel(name string, key, node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		v.addAt(node, SeverityError, fmt.Sprintf("tunnel %q must be a mapping", name))
+		return
+	}
+
+	if enabled := mappingValue(node, "enabled"); enabled != nil && enabled.Tag == "!!bool" && enabled.Value == "false" {
+		v.disabled[name] = true
+	}
+
+	var host, ports, idleTimeout *yaml.Node
+	v.eachField(node, tunnelFields, fmt.Sprintf("tunnel %q", name), func(k, value *yaml.Node) {
+		switch k.Value {
+		case "host":
+			host = value
+			v.expectString(value, "host")
+		case "ports":
+			ports = value
+		case "user":
+			v.expectString(value, "user")
+		case "enabled", "autostart":
+			v.expectBool(value, k.Value)
+		case "lazy":
+			if v.expectBool(value, "lazy") && value.Value == "true" {
+				v.lazy[name] = true
+			}
+		case "idle_timeout":
+			idleTimeout = value
+			if v.expectString(value, "idle_timeout") {
+				v.validateDuration(value, "idle_timeout")
+			}
+		case "tags":
+			v.validateTags(value)
+		case "depends_on":
+			v.collectDependencies(name, value)
+		case "identity_file":
+			if v.expectString(value, "identity_file") {
+				v.checkIdentityFile(name, value)
+			}
+		}
+	})
+
+	if host == nil {
+		v.addAt(key, SeverityError, fmt.Sprintf("tunnel %q is missing required field 'host'", name))
+	} else if host.Kind == yaml.ScalarNode && strings.TrimSpace(host.Value) == "" {
+		v.addAt(host, SeverityError, fmt.Sprintf("tunnel %q has an empty 'host'", name))
+	}
+
+	if idleTimeout != nil && !v.lazy[name] {
+		v.addAt(idleTimeout, SeverityWarning, fmt.Sprintf("tunnel %q sets 'idle_timeout' but is not lazy", name))
+	}
+
+	if ports == nil {
+		v.addAt(key, SeverityError, fmt.Sprintf("tunnel %q is missing required field 'ports'", name))
+		return
+	}
+	v.validatePorts(name, ports)
+	if v.lazy[name] && ports.Kind == yaml.SequenceNode {
+		for _, entry := range ports.Content {
+			if forward := mappingValue(entry, "forward"); forward != nil && forward.Value == ForwardRemote {
+				v.addAt(forward, SeverityError, fmt.Sprintf("lazy tunnel %q cannot have remote forwards; tunn can only listen for local and dynamic forwards", name))
+			}
+		}
+	}
+}
+
+// validateDuration checks a duration such as "10m" or "1h30m", which must be
+// positive.
+func (v *validator) validateDuration(node *yaml.Node, field string) {
+	duration, err := time.ParseDuration(node.Value)
+	if !durationValue.MatchString(node.Value) || err != nil || duration <= 0 {
+		v.addAt(node, SeverityError, fmt.Sprintf("'%s' must be a positive duration such as 10m or 1h30m, got %q", field, node.Value))
+	}
+}
+
+func (v *validator) collectDependencies(tunnel string, node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.addAt(node, SeverityError, "'depends_on' must be a list of tunnel names")
+		return
+	}
+	for _, dep := range node.Content {
+		if v.expectString(dep, "depends_on entry") {
+			v.dependsOn[tunnel] = append(v.dependsOn[tunnel], dep)
+		}
+	}
+}
+
+// validateDependencies checks that depends_on names enabled tunnels and that
+// no tunnel depends on itself, directly or through others.
+func (v *validator) validateDependencies() {
+	deps := make(map[string][]string, len(v.dependsOn))
+	for tunnel, nodes := range v.dependsOn {
+		for _, node := range nodes {
+			deps[tunnel] = append(deps[tunnel], node.Value)
+		}
+	}
+
+	for tunnel, nodes := range v.dependsOn {
+		if v.disabled[tunnel] {
+			continue
+		}
+		if v.lazy[tunnel] && len(nodes) > 0 {
+			v.addAt(nodes[0], SeverityError, fmt.Sprintf("lazy tunnel %q cannot depend on other tunnels", tunnel))
+		}
+		for _, node := range nodes {
+			switch _, exists := v.tunnels[node.Value]; {
+			case !exists:
+				v.addAt(node, SeverityError, fmt.Sprintf("tunnel %q depends on unknown tunnel %q", tunnel, node.Value))
+			case v.disabled[node.Value]:
+				v.addAt(node, SeverityError, fmt.Sprintf("tunnel %q depends on disabled tunnel %q", tunnel, node.Value))
+			case v.lazy[node.Value]:
+				v.addAt(node, SeverityError, fmt.Sprintf("tunnel %q depends on lazy tunnel %q, which only connects on demand", tunnel, node.Value))
+			}
+		}
+		if cycle := findDependencyCycle(tunnel, deps, nil); cycle != nil {
+			v.addAt(v.tunnels[tunnel], SeverityError, fmt.Sprintf("tunnel %q depends on itself: %s", tunnel, strings.Join(cycle, " -> ")))
+		}
+	}
+}
+
+func (v *validator) validateTags(node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.addAt(node, SeverityError, "'tags' must be a list of strings")
+		return
+	}
+	for _, tag := range node.Content {
+		if !v.expectString(tag, "tag") {
+			continue
+		}
+		if strings.TrimSpace(tag.Value) == "" || strings.ContainsAny(tag.Value, ", ") {
+			v.addAt(tag, SeverityError, fmt.Sprintf("tag %q must be non-empty and must not contain commas or spaces", tag.Value))
+		}
+	}
+}
+
+func (v *validator) validatePorts(tunnel string, node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.addAt(node, SeverityError, "'ports' must be a list of local:remote mappings or ranges")
+		return
+	}
+	if len(node.Content) == 0 {
+		v.addAt(node, SeverityError, fmt.Sprintf("tunnel %q does not define any ports", tunnel))
+		return
+	}
+
+	names := make(map[string]*yaml.Node)
+	for _, entry := range node.Content {
+		switch {
+		case isPortValue(entry):
+			v.validatePortSpec(tunnel, entry.Value, "", entry)
+		case entry.Kind == yaml.MappingNode:
+			v.validatePortObject(tunnel, entry, names)
+		default:
+			v.addAt(entry, SeverityError, "port entry must be a string such as \"5432:5432\" or a mapping with 'local' and 'remote'")
+		}
+	}
+}
+
+func (v *validator) validatePortObject(tunnel string, node *yaml.Node, names map[string]*yaml.Node) {
+	var local, remote, target, bind, forward *yaml.Node
+	v.eachField(node, portFields, "port entry", func(key, value *yaml.Node) {
+		switch key.Value {
+		case "local", "remote":
+			if !isPortValue(value) {
+				v.addAt(value, SeverityError, fmt.Sprintf("'%s' must be a port number or range", key.Value))
+				return
+			}
+		default:
+			if !v.expectString(value, key.Value) {
+				return
+			}
+		}
+		switch key.Value {
+		case "local":
+			local = value
+		case "remote":
+			remote = value
+		case "name":
+			v.validatePortName(value, names)
+		case "protocol":
+			if strings.EqualFold(value.Value, "udp") {
+				v.addAt(value, SeverityError, "protocol udp is not supported; ssh only forwards TCP")
+			}
+		case "forward":
+			switch value.Value {
+			case ForwardLocal, ForwardRemote, ForwardDynamic:
+				forward = value
+			default:
+				v.addAt(value, SeverityError, fmt.Sprintf("forward %q must be one of local, remote or dynamic", value.Value))
+			}
+		case "target_host", "bind":
+			if key.Value == "target_host" {
+				target = value
+			} else {
+				bind = value
+			}
+			if strings.TrimSpace(value.Value) == "" || strings.ContainsAny(value.Value, " /") {
+				v.addAt(value, SeverityError, fmt.Sprintf("'%s' must be a host name or address", key.Value))
+			}
+		}
+	})
+
+	if local == nil {
+		v.addAt(node, SeverityError, "port entry is missing required field 'local'")
+		return
+	}
+	spec := local.Value
+	if remote != nil {
+		spec += ":" + remote.Value
+	}
+	kind := ForwardLocal
+	if forward != nil {
+		kind = forward.Value
+	}
+	switch kind {
+	case ForwardDynamic:
+		if remote != nil || target != nil {
+			v.addAt(forward, SeverityError, "dynamic forwards only take 'local' and 'bind'")
+			return
+		}
+		if isAutoPort(local.Value) {
+			return
+		}
+	case ForwardRemote:
+		if isAutoPort(local.Value) {
+			v.addAt(local, SeverityError, "remote forwards deliver to a fixed local port; 'local' cannot be automatic")
+			return
+		}
+		// Remote forwards listen on the server, so they cannot clash with
+		// local ports; only check that the numbers are valid.
+		if _, err := ParsePortMappings(spec); err != nil {
+			v.addAt(local, SeverityError, err.Error())
+		}
+		return
+	}
+	address := ""
+	if bind != nil {
+		address = bind.Value
+	}
+	v.validatePortSpec(tunnel, spec, address, local)
+}
+
+func (v *validator) validatePortName(node *yaml.Node, names map[string]*yaml.Node) {
+	name := node.Value
+	switch {
+	case strings.TrimSpace(name) == "":
+		v.addAt(node, SeverityError, "port name must not be empty")
+		return
+	case strings.ContainsAny(name, "/: "):
+		v.addAt(node, SeverityError, fmt.Sprintf("port name %q must not contain '/', ':' or spaces", name))
+		return
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		v.addAt(node, SeverityError, fmt.Sprintf("port name %q must not be a number", name))
+		return
+	}
+	if prev, ok := names[name]; ok {
+		v.addAt(node, SeverityError, fmt.Sprintf("port name %q is already used at line %d", name, prev.Line))
+		return
+	}
+	names[name] = node
+}
+
+func (v *validator) validatePortSpec(tunnel, spec, bind string, node *yaml.Node) {
+	if local, remote, found := strings.Cut(spec, ":"); isAutoPort(local) {
+		// Automatic ports are picked when the tunnel starts and never clash.
+		if !found {
+			v.addAt(node, SeverityError, fmt.Sprintf("automatic local port %q needs a remote port, such as \"auto:5432\"", strings.TrimSpace(spec)))
+			return
+		}
+		if _, err := parsePortNumber(remote); err != nil {
+			v.addAt(node, SeverityError, fmt.Sprintf("invalid port mapping %q: %v", strings.TrimSpace(spec), err))
+		}
+		return
+	}
+	mappings, err := ParsePortMappings(spec)
+	if err != nil {
+		v.addAt(node, SeverityError, err.Error())
+		return
+	}
+	for _, mapping := range mappings {
+		v.claimLocalPort(tunnel, mapping.Local, bind, node)
+	}
+}
+
+// claimLocalPort records the local port a tunnel listens on, reporting an
+// earlier claim of the same port on an overlapping address.
+func (v *validator) claimLocalPort(tunnel string, port int, bind string, node *yaml.Node) {
+	if v.disabled[tunnel] {
+		return
+	}
+	bind = claimAddress(bind)
+	for _, prev := range v.localPorts[port] {
+		if prev.bind != bind && prev.bind != "*" && bind != "*" {
+			continue
+		}
+		owner := fmt.Sprintf("tunnel %q", prev.tunnel)
+		if prev.tunnel == tunnel {
+			owner = "this tunnel"
+		}
+		v.addAt(node, SeverityError, fmt.Sprintf("local port %d is already claimed by %s at line %d", port, owner, prev.node.Line))
+		return
+	}
+	claim := portClaim{tunnel: tunnel, port: port, bind: bind, node: node}
+	v.localPorts[port] = append(v.localPorts[port], claim)
+	v.claims[tunnel] = append(v.claims[tunnel], claim)
+}
+
+// claimAddress normalises a bind address for comparing port claims. An empty
+// address, "*" and the unspecified addresses all become "*", since ssh may
+// listen on every interface for them, depending on GatewayPorts.
+func claimAddress(bind string) string {
+	bind = strings.ToLower(strings.Trim(strings.TrimSpace(bind), "[]"))
+	switch bind {
+	case "", "*", "0.0.0.0", "::":
+		return "*"
+	case "localhost":
+		return "127.0.0.1"
+	}
+	return bind
+}
+
+// checkIdentityFile reports an identity file that ssh cannot use. ssh would
+// only warn and fall back to other keys, failing later with a less helpful
+// message, so it is an error unless the tunnel is disabled and never runs.
+func (v *validator) checkIdentityFile(tunnel string, node *yaml.Node) {
+	severity := SeverityError
+	if v.disabled[tunnel] {
+		severity = SeverityWarning
+	}
+	path := expandPath(node.Value)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			v.addAt(node, severity, fmt.Sprintf("identity file %s does not exist", node.Value))
+			return
+		}
+		v.addAt(node, severity, fmt.Sprintf("identity file %s is not readable: %v", node.Value, err))
+		return
+	}
+	if info.IsDir() {
+		v.addAt(node, severity, fmt.Sprintf("identity file %s is a directory", node.Value))
+	}
+}
+
+// eachField walks a mapping, reporting unknown and duplicate keys, and
+// invokes fn for every known field.
+func (v *validator) eachField(node *yaml.Node, known []string, context string, fn func(key, value *yaml.Node)) {
+	seen := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if prev, ok := seen[key.Value]; ok {
+			v.addAt(key, SeverityError, fmt.Sprintf("field %q is already set at line %d", key.Value, prev.Line))
+			continue
+		}
+		seen[key.Value] = key
+		if !contains(known, key.Value) {
+			message := fmt.Sprintf("unknown field %q in %s", key.Value, context)
+			if suggestion := closestMatch(key.Value, known); suggestion != "" {
+				message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+			}
+			v.addAt(key, SeverityError, message)
+			continue
+		}
+		fn(key, value)
+	}
+}
+
+func (v *validator) expectString(node *yaml.Node, field string) bool {
+	if node.Kind != yaml.ScalarNode || node.Tag != "!!str" {
+		v.addAt(node, SeverityError, fmt.Sprintf("'%s' must be a string", field))
+		return false
+	}
+	return true
+}
+
+func (v *validator) expectBool(node *yaml.Node, field string) bool {
+	if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+		v.addAt(node, SeverityError, fmt.Sprintf("'%s' must be true or false", field))
+		return false
+	}
+	return true
+}
+
+func (v *validator) addAt(node *yaml.Node, severity Severity, message string) {
+	diag := Diagnostic{File: v.file, Severity: severity, Message: message}
+	if node != nil {
+		diag.Line = node.Line
+		diag.Column = node.Column
+	}
+	v.diagnostics = append(v.diagnostics, diag)
+}
+
+func (v *validator) syntaxError(err error) {
+	var syntax *SyntaxError
+	if errors.As(err, &syntax) {
+		v.diagnostics = append(v.diagnostics, Diagnostic{File: v.file, Line: syntax.Line, Column: syntax.Column, Severity: SeverityError, Message: syntax.Message})
+		return
+	}
+	message := strings.TrimSpace(err.Error())
+	diag := Diagnostic{File: v.file, Severity: SeverityError, Message: message}
+	if m := yamlLineError.FindStringSubmatch(message); m != nil {
+		diag.Line, _ = strconv.Atoi(m[1])
+		diag.Message = m[2]
+	} else {
+		diag.Message = strings.TrimPrefix(message, "yaml: ")
+	}
+	v.diagnostics = append(v.diagnostics, diag)
+}
+
+// Errors returns the error-level diagnostics from the list.
+func Errors(diagnostics []Diagnostic) []Diagnostic {
+	var errs []Diagnostic
+	for _, diag := range diagnostics {
+		if diag.Severity == SeverityError {
+			errs = append(errs, diag)
+		}
+	}
+	return errs
+}
+
+// isPortValue reports whether node is a scalar that may hold a port number,
+// mapping or range: either a string or a plain integer.
+func isPortValue(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && (node.Tag == "!!str" || node.Tag == "!!int")
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+func contains(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// closestMatch suggests the known field closest to a misspelled key.
+func closestMatch(value string, known []string) string {
+	best := ""
+	bestDistance := 3
+	for _, candidate := range known {
+		if d := editDistance(value, candidate); d < bestDistance {
+			best = candidate
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// expandPath resolves a leading ~ and environment variables in a path.
+func expandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
@@ -0,0 +1,438 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateReportsPositions(t *testing.T) {
+	content := `tunnels:
+  api:
+    host: myserver
+    identiy_file: ~/.ssh/id_rsa
+    ports:
+      - 3000:3000
+      - 3000-3000
+  db:
+    host: database
+    ports:
+      - 3000:5432
+      - 70000
+`
+
+	diagnostics := Validate(".tunnrc", []byte(content))
+	errs := Errors(diagnostics)
+
+	want := []string{
+		`.tunnrc:4:5: error: unknown field "identiy_file" in tunnel "api" (did you mean "identity_file"?)`,
+		`.tunnrc:7:9: error: local port 3000 is already claimed by this tunnel at line 6`,
+		`.tunnrc:11:9: error: local port 3000 is already claimed by tunnel "api" at line 6`,
+		`.tunnrc:12:9: error: invalid port mapping "70000": port 70000 out of range 1-65535`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, diag := range errs {
+		if diag.String() != want[i] {
+			t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), want[i])
+		}
+	}
+}
+
+func TestValidateBindAddresses(t *testing.T) {
+	content := `tunnels:
+  first:
+    host: one
+    ports:
+      - {local: 8080, remote: 80, bind: 127.0.0.2}
+      - {local: 9000, remote: 90}
+  second:
+    host: two
+    ports:
+      - {local: 8080, remote: 80, bind: 127.0.0.3}
+      - {local: 8080, remote: 81, bind: 127.0.0.2}
+      - {local: 9000, remote: 90, bind: 127.0.0.4}
+  third:
+    host: three
+    ports:
+      - {local: 8080, remote: 80, bind: "*"}
+      - {local: 7000, remote: 70, bind: localhost}
+      - {local: 7000, remote: 71, bind: 127.0.0.1}
+`
+
+	errs := Errors(Validate("cfg", []byte(content)))
+	want := []string{
+		`cfg:11:17: error: local port 8080 is already claimed by tunnel "first" at line 5`,
+		`cfg:12:17: error: local port 9000 is already claimed by tunnel "first" at line 6`,
+		`cfg:16:17: error: local port 8080 is already claimed by tunnel "first" at line 5`,
+		`cfg:18:17: error: local port 7000 is already claimed by this tunnel at line 17`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, diag := range errs {
+		if diag.String() != want[i] {
+			t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), want[i])
+		}
+	}
+}
+
+func TestValidateMissingFields(t *testing.T) {
+	content := `tunnels:
+  api:
+    user: deploy
+`
+
+	errs := Errors(Validate("cfg", []byte(content)))
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(errs), errs)
+	}
+	if !strings.Contains(errs[0].Message, "'host'") || !strings.Contains(errs[1].Message, "'ports'") {
+		t.Fatalf("unexpected diagnostics: %v", errs)
+	}
+	if errs[0].Line != 2 || errs[0].Column != 3 {
+		t.Fatalf("expected position 2:3, got %d:%d", errs[0].Line, errs[0].Column)
+	}
+}
+
+func TestValidateSyntaxError(t *testing.T) {
+	content := "tunnels:\n  api:\n    host: [unterminated\n"
+
+	errs := Errors(Validate("cfg", []byte(content)))
+	if len(errs) != 1 {
+		t.Fatalf("expected a single syntax error, got %v", errs)
+	}
+	if errs[0].Line == 0 {
+		t.Fatalf("expected syntax error to carry a line number, got %+v", errs[0])
+	}
+}
+
+func TestValidateIdentityFile(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "id_test")
+	if err := os.WriteFile(keyPath, []byte("key"), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	content := `tunnels:
+  present:
+    host: a
+    ports: ["1000"]
+    identity_file: ` + keyPath + `
+  missing:
+    host: b
+    ports: ["1001"]
+    identity_file: ` + filepath.Join(dir, "absent") + `
+  off:
+    host: c
+    enabled: false
+    ports: ["1002"]
+    identity_file: ` + filepath.Join(dir, "absent") + `
+`
+
+	diagnostics := Validate("cfg", []byte(content))
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected two diagnostics for the missing identity files, got %v", diagnostics)
+	}
+	if diagnostics[0].Severity != SeverityError || diagnostics[0].Line != 9 {
+		t.Fatalf("expected an error for the missing identity file, got %v", diagnostics[0])
+	}
+	if diagnostics[1].Severity != SeverityWarning || diagnostics[1].Line != 14 {
+		t.Fatalf("expected a warning for the disabled tunnel, got %v", diagnostics[1])
+	}
+}
+
+func TestLoadFileRejectsInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".tunnrc")
+	if err := os.WriteFile(path, []byte("tunnels:\n  api:\n    host: a\n    ports: [\"abc\"]\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	_, err := LoadFile(path)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected *ValidationError, got %T", err)
+	}
+	if len(validationErr.Diagnostics) != 1 || validationErr.Diagnostics[0].Line != 4 {
+		t.Fatalf("unexpected diagnostics: %v", validationErr.Diagnostics)
+	}
+	if !strings.Contains(err.Error(), path+":4:13") {
+		t.Fatalf("expected error to include position, got %q", err.Error())
+	}
+}
+
+func TestValidatePortObjects(t *testing.T) {
+	content := `tunnels:
+  db:
+    host: database
+    ports:
+      - local: 5432
+        remote: 5432
+        name: postgres
+      - local: 6379
+        name: postgres
+      - remote: 3306
+      - local: 5000
+        protocol: udp
+        colour: blue
+      - [1, 2]
+`
+
+	errs := Errors(Validate("cfg", []byte(content)))
+	want := []string{
+		`cfg:9:15: error: port name "postgres" is already used at line 7`,
+		`cfg:10:9: error: port entry is missing required field 'local'`,
+		`cfg:12:19: error: protocol udp is not supported; ssh only forwards TCP`,
+		`cfg:13:9: error: unknown field "colour" in port entry`,
+		`cfg:14:9: error: port entry must be a string such as "5432:5432" or a mapping with 'local' and 'remote'`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, diag := range errs {
+		if diag.String() != want[i] {
+			t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), want[i])
+		}
+	}
+}
+
+func TestValidateGroupsAndTags(t *testing.T) {
+	content := `tunnels:
+  api:
+    host: a
+    ports: ["3000"]
+    tags: [backend, "two words"]
+groups:
+  payments: [api, missing, "@streaming"]
+  streaming: ["@payments"]
+  web: ["@nowhere"]
+`
+
+	errs := Errors(Validate("cfg", []byte(content)))
+	want := []string{
+		`cfg:5:21: error: tag "two words" must be non-empty and must not contain commas or spaces`,
+		`cfg:7:3: error: group "payments" includes itself: @payments -> @streaming -> @payments`,
+		`cfg:7:19: error: group "payments" references unknown tunnel "missing"`,
+		`cfg:8:3: error: group "streaming" includes itself: @streaming -> @payments -> @streaming`,
+		`cfg:9:9: error: group "web" references unknown group "nowhere"`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, diag := range errs {
+		if diag.String() != want[i] {
+			t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), want[i])
+		}
+	}
+}
+
+func TestValidateForwardTypes(t *testing.T) {
+	content := `tunnels:
+  bastion:
+    host: bastion
+    ports:
+      - local: 3000
+        remote: 8080
+        forward: remote
+      - local: 3000
+        forward: local
+      - local: 1080
+        remote: 1081
+        forward: dynamic
+      - local: 2000
+        forward: reverse
+`
+
+	errs := Errors(Validate("cfg", []byte(content)))
+	want := []string{
+		`cfg:12:18: error: dynamic forwards only take 'local' and 'bind'`,
+		`cfg:14:18: error: forward "reverse" must be one of local, remote or dynamic`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, diag := range errs {
+		if diag.String() != want[i] {
+			t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), want[i])
+		}
+	}
+}
+
+func TestValidateDisabledTunnels(t *testing.T) {
+	content := `tunnels:
+  legacy:
+    host: old
+    enabled: false
+    ports: ["5432"]
+  db:
+    host: new
+    autostart: "no"
+    ports: ["5432"]
+  cache:
+    host: c
+    enabled: 0
+    ports: ["5432"]
+`
+
+	errs := Errors(Validate("cfg", []byte(content)))
+	want := []string{
+		`cfg:8:16: error: 'autostart' must be true or false`,
+		`cfg:12:14: error: 'enabled' must be true or false`,
+		`cfg:13:13: error: local port 5432 is already claimed by tunnel "db" at line 9`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, diag := range errs {
+		if diag.String() != want[i] {
+			t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), want[i])
+		}
+	}
+}
+
+func TestValidateDependencies(t *testing.T) {
+	content := `tunnels:
+  hop1:
+    host: bastion
+    ports: ["2222:22"]
+    depends_on: [hop3]
+  hop2:
+    host: inner
+    ports: ["5432"]
+    depends_on: [hop1, missing, legacy]
+  hop3:
+    host: third
+    ports: ["6379"]
+    depends_on: [hop2]
+  legacy:
+    host: old
+    enabled: false
+    ports: ["6380"]
+    depends_on: [nowhere]
+  api:
+    host: web
+    ports: ["3000"]
+    depends_on: hop1
+`
+
+	errs := Errors(Validate("cfg", []byte(content)))
+	want := []string{
+		`cfg:2:3: error: tunnel "hop1" depends on itself: hop1 -> hop3 -> hop2 -> hop1`,
+		`cfg:6:3: error: tunnel "hop2" depends on itself: hop2 -> hop1 -> hop3 -> hop2`,
+		`cfg:9:24: error: tunnel "hop2" depends on unknown tunnel "missing"`,
+		`cfg:9:33: error: tunnel "hop2" depends on disabled tunnel "legacy"`,
+		`cfg:10:3: error: tunnel "hop3" depends on itself: hop3 -> hop2 -> hop1 -> hop3`,
+		`cfg:22:17: error: 'depends_on' must be a list of tunnel names`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, diag := range errs {
+		if diag.String() != want[i] {
+			t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), want[i])
+		}
+	}
+}
+
+func TestValidateAutoPorts(t *testing.T) {
+	content := `auto_ports: 30100-30000
+tunnels:
+  db:
+    host: bastion
+    ports:
+      - auto:5432
+      - 0:6379
+      - auto
+  api:
+    host: web
+    ports:
+      - auto:5432
+      - local: auto
+        remote: 8080
+        forward: remote
+`
+
+	errs := Errors(Validate("cfg", []byte(content)))
+	want := []string{
+		`cfg:1:13: error: invalid auto_ports "30100-30000": range 30100-30000 ends before it starts`,
+		`cfg:8:9: error: automatic local port "auto" needs a remote port, such as "auto:5432"`,
+		`cfg:13:16: error: remote forwards deliver to a fixed local port; 'local' cannot be automatic`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, diag := range errs {
+		if diag.String() != want[i] {
+			t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), want[i])
+		}
+	}
+}
+
+func TestValidateLazyTunnels(t *testing.T) {
+	content := `tunnels:
+  db:
+    host: bastion
+    lazy: true
+    idle_timeout: 15m
+    ports:
+      - 5432
+      - local: 1080
+        forward: dynamic
+  callback:
+    host: web
+    lazy: true
+    idle_timeout: 0s
+    ports:
+      - local: 3000
+        remote: 8080
+        forward: remote
+  app:
+    host: app
+    lazy: yes
+    depends_on: [db]
+    ports: ["8080"]
+  jump:
+    host: jump
+    lazy: true
+    depends_on: [app]
+    ports: ["2222:22"]
+  eager:
+    host: eager
+    idle_timeout: 5m
+    ports: ["9000"]
+`
+
+	diagnostics := Validate("cfg", []byte(content))
+	errs := Errors(diagnostics)
+	want := []string{
+		`cfg:13:19: error: 'idle_timeout' must be a positive duration such as 10m or 1h30m, got "0s"`,
+		`cfg:17:18: error: lazy tunnel "callback" cannot have remote forwards; tunn can only listen for local and dynamic forwards`,
+		`cfg:20:11: error: 'lazy' must be true or false`,
+		`cfg:21:18: error: tunnel "app" depends on lazy tunnel "db", which only connects on demand`,
+		`cfg:26:18: error: lazy tunnel "jump" cannot depend on other tunnels`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, diag := range errs {
+		if diag.String() != want[i] {
+			t.Errorf("diagnostic %d mismatch:\n got: %s\nwant: %s", i, diag.String(), want[i])
+		}
+	}
+
+	var warnings []string
+	for _, diag := range diagnostics {
+		if diag.Severity == SeverityWarning {
+			warnings = append(warnings, diag.String())
+		}
+	}
+	if len(warnings) != 1 || warnings[0] != `cfg:30:19: warning: tunnel "eager" sets 'idle_timeout' but is not lazy` {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Watch polls path and calls onChange whenever its size or modification time
+// changes. Polling keeps the module free of platform-specific notification
+// dependencies; it returns when ctx is cancelled.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	last, _ := fileStamp(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stamp, err := fileStamp(path)
+		if err != nil || stamp == last {
+			continue
+		}
+		last = stamp
+		onChange()
+	}
+}
+
+type stamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func fileStamp(path string) (stamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return stamp{}, err
+	}
+	return stamp{size: info.Size(), modTime: info.ModTime()}, nil
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/status"
+	"github.com/strandnerd/tunn/tunnel"
+)
+
+// daemonController implements daemon.Controller on top of the tunnel manager,
+// keeping the status store in sync with the tunnels it runs.
+type daemonController struct {
+	opts    *cli.Options
+	path    string
+	manager *tunnel.Manager
+	store   *status.Store
+	logger  *log.Logger
+	mu      sync.Mutex
+
+	// started lists the references started by hand on top of the daemon's
+	// selection, and stopped and stoppedPorts the tunnels and port mappings
+	// stopped by hand, so that reloads keep both.
+	started      []string
+	stopped      map[string]bool
+	stoppedPorts map[string]map[string]bool
+}
+
+// Reload re-reads the configuration file with the daemon's original selection
+// and profile, then starts, stops or restarts tunnels to match it.
+func (c *daemonController) Reload() (config.Diff, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	diff, err := c.reload()
+	if err != nil {
+		c.logger.Printf("configuration reload failed: %v", err)
+		return config.Diff{}, err
+	}
+	c.logger.Printf("configuration reloaded: %s", diff)
+	return diff, nil
+}
+
+// Start starts tunnels or single ports from the configuration file next to
+// the running ones. Tunnels already running are left alone, except to add
+// the requested ports, and tunnels that stopped after a failure are started
+// again.
+func (c *daemonController) Start(refs []string) (config.Diff, error) {
+	return c.change("start", refs, c.start)
+}
+
+// Stop stops running tunnels or single ports, along with the tunnels that
+// depend on a stopped tunnel. Stopping a single port leaves the other ports
+// of its tunnel and the tunnels depending on it alone. Stopped tunnels and
+// ports stay stopped across reloads until they are started again.
+func (c *daemonController) Stop(refs []string) (config.Diff, error) {
+	return c.change("stop", refs, c.stop)
+}
+
+// Restart restarts running tunnels, along with the tunnels that depend on
+// them. A tunnel/port reference only restarts that port.
+func (c *daemonController) Restart(refs []string) (config.Diff, error) {
+	return c.change("restart", refs, c.restart)
+}
+
+// change runs a start, stop or restart under the controller lock and logs
+// its outcome.
+func (c *daemonController) change(action string, refs []string, apply func([]string) (config.Diff, error)) (config.Diff, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(refs) == 0 {
+		return config.Diff{}, fmt.Errorf("%s requires tunnel names", action)
+	}
+	diff, err := apply(refs)
+	if err != nil {
+		c.logger.Printf("%s %s failed: %v", action, strings.Join(refs, " "), err)
+		return config.Diff{}, err
+	}
+	c.logger.Printf("%s %s: %s", action, strings.Join(refs, " "), diff)
+	return diff, nil
+}
+
+func (c *daemonController) reload() (config.Diff, error) {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return config.Diff{}, err
+	}
+	selected, err := selectTunnels(cfg, c.opts)
+	if err != nil {
+		return config.Diff{}, err
+	}
+	for _, ref := range c.started {
+		extra, err := cfg.Select(config.Selector{Names: []string{ref}})
+		if err != nil {
+			c.logger.Printf("no longer starting %s: %v", ref, err)
+			continue
+		}
+		selected = mergeTunnels(cfg, selected, extra)
+	}
+	c.withoutStopped(selected)
+
+	diff, err := c.manager.Apply(selected)
+	if err != nil {
+		return config.Diff{}, err
+	}
+	c.syncStore(diff)
+	return diff, nil
+}
+
+func (c *daemonController) start(refs []string) (config.Diff, error) {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return config.Diff{}, err
+	}
+	selected, err := cfg.Select(config.Selector{Names: refs})
+	if err != nil {
+		return config.Diff{}, err
+	}
+
+	// Ports added to a running tunnel whose definition is otherwise the
+	// same are started on their own; other tunnels are (re)started whole.
+	running := c.manager.Tunnels()
+	whole := make(map[string]config.Tunnel)
+	next := make(map[string]config.Tunnel)
+	ports := make(map[string][]string)
+	for name, tun := range selected {
+		current, ok := running[name]
+		if !ok {
+			whole[name] = tun
+			continue
+		}
+		merged := mergeTunnels(cfg, map[string]config.Tunnel{name: current}, map[string]config.Tunnel{name: tun})[name]
+		added := addedPorts(current, merged)
+		if !c.manager.Running(name) || !reflect.DeepEqual(current, withoutPorts(merged, added)) {
+			whole[name] = merged
+			continue
+		}
+		next[name] = merged
+		if len(added) > 0 {
+			ports[name] = added
+		}
+	}
+
+	var diff config.Diff
+	if len(whole) > 0 {
+		if diff, err = c.manager.Start(whole); err != nil {
+			return config.Diff{}, err
+		}
+	}
+	for _, name := range sortedKeys(ports) {
+		for _, mapping := range ports[name] {
+			if err := c.manager.StartPort(name, next[name], mapping); err != nil {
+				return config.Diff{}, err
+			}
+		}
+	}
+	for _, ref := range refs {
+		if !contains(c.started, ref) {
+			c.started = append(c.started, ref)
+		}
+	}
+	c.release(cfg, selected)
+	c.syncStore(diff)
+	c.syncPorts(ports)
+	diff, portRefs := c.withPorts(diff, ports)
+	diff.Added = append(diff.Added, portRefs...)
+	return diff, nil
+}
+
+func (c *daemonController) stop(refs []string) (config.Diff, error) {
+	running := c.manager.Tunnels()
+	whole, ports, err := splitRefs(running, refs)
+	if err != nil {
+		return config.Diff{}, err
+	}
+	for name, mappings := range ports {
+		if len(mappings) == len(running[name].Ports) {
+			whole = append(whole, name)
+			delete(ports, name)
+		}
+	}
+	// Tunnels depending on a stopped tunnel would only fail without it.
+	dependents := config.Dependents(running, whole...)
+	for _, name := range dependents {
+		delete(ports, name)
+	}
+
+	for _, name := range sortedKeys(ports) {
+		for _, mapping := range ports[name] {
+			if err := c.manager.StopPort(name, mapping); err != nil {
+				return config.Diff{}, err
+			}
+		}
+	}
+	var diff config.Diff
+	if len(whole) > 0 {
+		next := c.manager.Tunnels()
+		for _, name := range append(whole, dependents...) {
+			delete(next, name)
+		}
+		if diff, err = c.manager.Apply(next); err != nil {
+			return config.Diff{}, err
+		}
+	}
+
+	if c.stopped == nil {
+		c.stopped = make(map[string]bool)
+		c.stoppedPorts = make(map[string]map[string]bool)
+	}
+	for _, name := range append(whole, dependents...) {
+		c.stopped[name] = true
+		delete(c.stoppedPorts, name)
+	}
+	for name, mappings := range ports {
+		if c.stoppedPorts[name] == nil {
+			c.stoppedPorts[name] = make(map[string]bool)
+		}
+		for _, mapping := range mappings {
+			c.stoppedPorts[name][mapping] = true
+		}
+	}
+	c.syncStore(diff)
+	c.syncPorts(ports)
+	diff, portRefs := c.withPorts(diff, ports)
+	diff.Removed = append(diff.Removed, portRefs...)
+	return diff, nil
+}
+
+func (c *daemonController) restart(refs []string) (config.Diff, error) {
+	running := c.manager.Tunnels()
+	whole, ports, err := splitRefs(running, refs)
+	if err != nil {
+		return config.Diff{}, err
+	}
+	// Tunnels depending on a restarted tunnel are restarted whole anyway.
+	for _, name := range config.Dependents(running, whole...) {
+		delete(ports, name)
+	}
+
+	var diff config.Diff
+	if len(whole) > 0 {
+		if diff, err = c.manager.Restart(whole...); err != nil {
+			return config.Diff{}, err
+		}
+	}
+	for _, name := range sortedKeys(ports) {
+		for _, mapping := range ports[name] {
+			if err := c.manager.RestartPort(name, mapping); err != nil {
+				return config.Diff{}, err
+			}
+		}
+	}
+	c.syncStore(diff)
+	diff, portRefs := c.withPorts(diff, ports)
+	diff.Changed = append(diff.Changed, portRefs...)
+	return diff, nil
+}
+
+// splitRefs splits tunnel and tunnel/port references to running tunnels
+// into whole tunnels and the port mappings of the others, by tunnel.
+func splitRefs(running map[string]config.Tunnel, refs []string) ([]string, map[string][]string, error) {
+	var whole []string
+	ports := make(map[string][]string)
+	for _, ref := range refs {
+		name, portRef, hasPort := strings.Cut(ref, "/")
+		tun, ok := running[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("tunnel %q is not running", name)
+		}
+		if !hasPort {
+			if !contains(whole, name) {
+				whole = append(whole, name)
+			}
+			continue
+		}
+		port, ok := tun.LookupPort(portRef)
+		if !ok {
+			return nil, nil, fmt.Errorf("tunnel %q has no running port %q", name, portRef)
+		}
+		if !contains(ports[name], port.Mapping()) {
+			ports[name] = append(ports[name], port.Mapping())
+		}
+	}
+	for _, name := range whole {
+		delete(ports, name)
+	}
+	return whole, ports, nil
+}
+
+// withPorts completes diff with the ports changed on their own: the managed
+// tunnels neither in diff nor changed port by port are unchanged, and the
+// ports are returned as tunnel/mapping references.
+func (c *daemonController) withPorts(diff config.Diff, ports map[string][]string) (config.Diff, []string) {
+	changed := make(map[string]bool)
+	for _, names := range [][]string{diff.Added, diff.Removed, diff.Changed} {
+		for _, name := range names {
+			changed[name] = true
+		}
+	}
+	var refs []string
+	for _, name := range sortedKeys(ports) {
+		changed[name] = true
+		for _, mapping := range ports[name] {
+			refs = append(refs, name+"/"+mapping)
+		}
+	}
+	diff.Unchanged = nil
+	for _, name := range sortedKeys(c.manager.Tunnels()) {
+		if !changed[name] {
+			diff.Unchanged = append(diff.Unchanged, name)
+		}
+	}
+	return diff, refs
+}
+
+// syncPorts updates the status store after ports of the given tunnels were
+// started or stopped on their own.
+func (c *daemonController) syncPorts(ports map[string][]string) {
+	tunnels := c.manager.Tunnels()
+	for name := range ports {
+		c.store.Retain(name, portMappings(tunnels[name]))
+		registerTunnel(c.store, name, tunnels[name])
+	}
+}
+
+// addedPorts returns the mappings of the ports of next missing in current.
+func addedPorts(current, next config.Tunnel) []string {
+	var added []string
+	for _, port := range next.Ports {
+		if _, ok := current.LookupPort(port.Mapping()); !ok {
+			added = append(added, port.Mapping())
+		}
+	}
+	return added
+}
+
+// withoutPorts returns tun without the ports with the given mappings.
+func withoutPorts(tun config.Tunnel, mappings []string) config.Tunnel {
+	ports := make([]config.Port, 0, len(tun.Ports))
+	for _, port := range tun.Ports {
+		if !contains(mappings, port.Mapping()) {
+			ports = append(ports, port)
+		}
+	}
+	tun.Ports = ports
+	return tun
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// loadConfig re-reads the daemon's configuration file with its profile.
+func (c *daemonController) loadConfig() (*config.Config, error) {
+	cfg, err := config.LoadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range cfg.Warnings {
+		c.logger.Print(warning.String())
+	}
+	if err := applyProfile(cfg, c.opts); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// withoutStopped removes the tunnels and ports stopped by hand from selected.
+func (c *daemonController) withoutStopped(selected map[string]config.Tunnel) {
+	for name, tun := range selected {
+		if c.stopped[name] {
+			delete(selected, name)
+			continue
+		}
+		held := c.stoppedPorts[name]
+		if len(held) == 0 {
+			continue
+		}
+		remaining := make([]config.Port, 0, len(tun.Ports))
+		for _, port := range tun.Ports {
+			if !held[port.Mapping()] {
+				remaining = append(remaining, port)
+			}
+		}
+		if len(remaining) == 0 {
+			delete(selected, name)
+			continue
+		}
+		tun.Ports = remaining
+		selected[name] = tun
+	}
+}
+
+// release forgets that the started tunnels and ports were stopped by hand.
+// Starting some ports of a stopped tunnel keeps its other ports stopped.
+func (c *daemonController) release(cfg *config.Config, started map[string]config.Tunnel) {
+	for name, tun := range started {
+		if c.stopped[name] {
+			delete(c.stopped, name)
+			held := make(map[string]bool)
+			for _, port := range cfg.Tunnels[name].Ports {
+				held[port.Mapping()] = true
+			}
+			c.stoppedPorts[name] = held
+		}
+		for _, port := range tun.Ports {
+			delete(c.stoppedPorts[name], port.Mapping())
+		}
+		if len(c.stoppedPorts[name]) == 0 {
+			delete(c.stoppedPorts, name)
+		}
+	}
+}
+
+// syncStore updates the status store after the manager applied diff.
+func (c *daemonController) syncStore(diff config.Diff) {
+	tunnels := c.manager.Tunnels()
+	for _, name := range diff.Removed {
+		c.store.Remove(name)
+	}
+	for _, name := range diff.Changed {
+		c.store.Retain(name, portMappings(tunnels[name]))
+		registerTunnel(c.store, name, tunnels[name])
+	}
+	for _, name := range diff.Added {
+		registerTunnel(c.store, name, tunnels[name])
+	}
+}
+
+// mergeTunnels combines two selections from cfg. A tunnel in both keeps the
+// ports of either, in configuration order.
+func mergeTunnels(cfg *config.Config, a, b map[string]config.Tunnel) map[string]config.Tunnel {
+	merged := make(map[string]config.Tunnel, len(a)+len(b))
+	for name, tun := range a {
+		merged[name] = tun
+	}
+	for name, tun := range b {
+		existing, ok := merged[name]
+		if !ok {
+			merged[name] = tun
+			continue
+		}
+		var ports []config.Port
+		for _, port := range cfg.Tunnels[name].Ports {
+			mapping := port.Mapping()
+			if _, inA := existing.LookupPort(mapping); inA {
+				ports = append(ports, port)
+			} else if _, inB := tun.LookupPort(mapping); inB {
+				ports = append(ports, port)
+			}
+		}
+		tun.Ports = ports
+		merged[name] = tun
+	}
+	return merged
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/status"
+	"github.com/strandnerd/tunn/tunnel"
+)
+
+// The tunnels use remote forwards, which open no local port to check.
+const controllerConfig = `tunnels:
+  db:
+    host: server1
+    ports:
+      - {local: "5432", remote: "15432", forward: remote, name: pg}
+      - {local: "6379", remote: "16379", forward: remote, name: redis}
+  app:
+    host: server2
+    depends_on: [db]
+    ports:
+      - {local: "8080", remote: "18080", forward: remote}
+`
+
+// forwardExecutor stands in for ssh, counting the starts of each forward as
+// tunnel/mapping.
+type forwardExecutor struct {
+	manager *tunnel.Manager
+	mu      sync.Mutex
+	starts  map[string]int
+	running map[string]bool
+}
+
+func (f *forwardExecutor) Execute(ctx context.Context, name string, tun config.Tunnel) error {
+	f.mu.Lock()
+	for _, port := range tun.Ports {
+		f.starts[name+"/"+port.Mapping()]++
+		f.running[name+"/"+port.Mapping()] = true
+	}
+	f.mu.Unlock()
+	for _, port := range tun.Ports {
+		f.manager.UpdateStatus(name, port.Mapping(), "active")
+	}
+
+	<-ctx.Done()
+
+	f.mu.Lock()
+	for _, port := range tun.Ports {
+		delete(f.running, name+"/"+port.Mapping())
+	}
+	f.mu.Unlock()
+	for _, port := range tun.Ports {
+		f.manager.UpdateStatus(name, port.Mapping(), "stopped")
+	}
+	return ctx.Err()
+}
+
+// snapshot returns the start counts and whether each forward runs.
+func (f *forwardExecutor) snapshot() (map[string]int, map[string]bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	starts := make(map[string]int, len(f.starts))
+	for key, n := range f.starts {
+		starts[key] = n
+	}
+	running := make(map[string]bool, len(f.running))
+	for key := range f.running {
+		running[key] = true
+	}
+	return starts, running
+}
+
+const (
+	pgForward    = "db/R15432:5432"
+	redisForward = "db/R16379:6379"
+	appForward   = "app/R18080:8080"
+)
+
+// startController runs the tunnels of controllerConfig under a controller
+// until the test ends.
+func startController(t *testing.T) (*daemonController, *forwardExecutor) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".tunnrc")
+	if err := os.WriteFile(path, []byte(controllerConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec := &forwardExecutor{starts: make(map[string]int), running: make(map[string]bool)}
+	manager := tunnel.NewManager(exec, nil, nil)
+	manager.KeepRunning()
+	exec.manager = manager
+	controller := &daemonController{
+		opts:    &cli.Options{},
+		path:    path,
+		manager: manager,
+		store:   status.NewStore(),
+		logger:  log.New(io.Discard, "", 0),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- manager.RunTunnels(ctx, cfg.Tunnels)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	waitForForwards(t, exec, map[string]int{pgForward: 1, redisForward: 1, appForward: 1},
+		map[string]bool{pgForward: true, redisForward: true, appForward: true})
+	return controller, exec
+}
+
+// waitForForwards waits until the executor saw the given starts and runs
+// exactly the given forwards.
+func waitForForwards(t *testing.T, exec *forwardExecutor, starts map[string]int, running map[string]bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		gotStarts, gotRunning := exec.snapshot()
+		if reflect.DeepEqual(gotStarts, starts) && reflect.DeepEqual(gotRunning, running) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected starts %v and running %v, got %v and %v", starts, running, gotStarts, gotRunning)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestControllerPortRefs(t *testing.T) {
+	controller, exec := startController(t)
+
+	diff, err := controller.Restart([]string{"db/pg"})
+	if err != nil {
+		t.Fatalf("restart db/pg: %v", err)
+	}
+	if got := diff.String(); got != "restarted db/R15432:5432; 1 unchanged" {
+		t.Errorf("unexpected restart diff %q", got)
+	}
+	waitForForwards(t, exec, map[string]int{pgForward: 2, redisForward: 1, appForward: 1},
+		map[string]bool{pgForward: true, redisForward: true, appForward: true})
+
+	diff, err = controller.Stop([]string{"db/redis"})
+	if err != nil {
+		t.Fatalf("stop db/redis: %v", err)
+	}
+	if got := diff.String(); got != "stopped db/R16379:6379; 1 unchanged" {
+		t.Errorf("unexpected stop diff %q", got)
+	}
+	waitForForwards(t, exec, map[string]int{pgForward: 2, redisForward: 1, appForward: 1},
+		map[string]bool{pgForward: true, appForward: true})
+	if !controller.stoppedPorts["db"]["R16379:6379"] {
+		t.Errorf("expected db/redis to stay stopped across reloads, got %v", controller.stoppedPorts)
+	}
+	if ports := storePorts(controller.store, "db"); !reflect.DeepEqual(ports, []string{"R15432:5432"}) {
+		t.Errorf("expected the status store to drop db/redis, got %v", ports)
+	}
+
+	diff, err = controller.Start([]string{"db/redis"})
+	if err != nil {
+		t.Fatalf("start db/redis: %v", err)
+	}
+	if got := diff.String(); got != "started db/R16379:6379; 1 unchanged" {
+		t.Errorf("unexpected start diff %q", got)
+	}
+	waitForForwards(t, exec, map[string]int{pgForward: 2, redisForward: 2, appForward: 1},
+		map[string]bool{pgForward: true, redisForward: true, appForward: true})
+	if len(controller.stoppedPorts) != 0 {
+		t.Errorf("expected db/redis to be released, got %v", controller.stoppedPorts)
+	}
+	if ports := storePorts(controller.store, "db"); !reflect.DeepEqual(ports, []string{"R15432:5432", "R16379:6379"}) {
+		t.Errorf("expected the status store to list db/redis again, got %v", ports)
+	}
+
+	// Reloading keeps the tunnels as they are.
+	if _, err := controller.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	waitForForwards(t, exec, map[string]int{pgForward: 2, redisForward: 2, appForward: 1},
+		map[string]bool{pgForward: true, redisForward: true, appForward: true})
+}
+
+func TestControllerWholeTunnelRefs(t *testing.T) {
+	controller, exec := startController(t)
+
+	diff, err := controller.Restart([]string{"db"})
+	if err != nil {
+		t.Fatalf("restart db: %v", err)
+	}
+	if got := diff.String(); got != "restarted app, db" {
+		t.Errorf("unexpected restart diff %q", got)
+	}
+	waitForForwards(t, exec, map[string]int{pgForward: 2, redisForward: 2, appForward: 2},
+		map[string]bool{pgForward: true, redisForward: true, appForward: true})
+
+	// Stopping every port of a tunnel stops it, along with its dependents.
+	diff, err = controller.Stop([]string{"db/pg", "db/redis"})
+	if err != nil {
+		t.Fatalf("stop db/pg db/redis: %v", err)
+	}
+	if got := diff.String(); got != "stopped app, db" {
+		t.Errorf("unexpected stop diff %q", got)
+	}
+	waitForForwards(t, exec, map[string]int{pgForward: 2, redisForward: 2, appForward: 2}, map[string]bool{})
+	if !controller.stopped["db"] || !controller.stopped["app"] {
+		t.Errorf("expected db and app to stay stopped across reloads, got %v", controller.stopped)
+	}
+}
+
+func TestControllerStopEveryTunnel(t *testing.T) {
+	controller, exec := startController(t)
+
+	diff, err := controller.Stop([]string{"db", "app"})
+	if err != nil {
+		t.Fatalf("stop db app: %v", err)
+	}
+	if got := diff.String(); got != "stopped app, db" {
+		t.Errorf("unexpected stop diff %q", got)
+	}
+	waitForForwards(t, exec, map[string]int{pgForward: 1, redisForward: 1, appForward: 1}, map[string]bool{})
+	if tunnels := controller.manager.Tunnels(); len(tunnels) != 0 {
+		t.Fatalf("expected no tunnels left, got %v", tunnels)
+	}
+
+	// The daemon outlives its last tunnel, which can be started again once
+	// the manager would have returned otherwise.
+	time.Sleep(100 * time.Millisecond)
+	diff, err = controller.Start([]string{"db"})
+	if err != nil {
+		t.Fatalf("start db: %v", err)
+	}
+	if got := diff.String(); got != "started db" {
+		t.Errorf("unexpected start diff %q", got)
+	}
+	waitForForwards(t, exec, map[string]int{pgForward: 2, redisForward: 2, appForward: 1},
+		map[string]bool{pgForward: true, redisForward: true})
+	if controller.stopped["db"] || !controller.stopped["app"] {
+		t.Errorf("expected only app to stay stopped, got %v", controller.stopped)
+	}
+
+	// A reload that leaves no tunnels keeps the daemon running too.
+	if _, err := controller.Stop([]string{"db"}); err != nil {
+		t.Fatalf("stop db: %v", err)
+	}
+	if _, err := controller.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := controller.Start([]string{"app"}); err != nil {
+		t.Fatalf("start app: %v", err)
+	}
+	waitForForwards(t, exec, map[string]int{pgForward: 3, redisForward: 3, appForward: 2},
+		map[string]bool{pgForward: true, redisForward: true, appForward: true})
+}
+
+func TestControllerRefErrors(t *testing.T) {
+	controller, _ := startController(t)
+
+	tests := []struct {
+		name string
+		run  func([]string) (config.Diff, error)
+		refs []string
+		want string
+	}{
+		{"stop unknown tunnel", controller.Stop, []string{"cache"}, `tunnel "cache" is not running`},
+		{"stop unknown port", controller.Stop, []string{"db/mysql"}, `tunnel "db" has no running port "mysql"`},
+		{"restart unknown port", controller.Restart, []string{"db/3306"}, `tunnel "db" has no running port "3306"`},
+		{"no refs", controller.Start, nil, "start requires tunnel names"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.run(tt.refs)
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// storePorts returns the port mappings the status store lists for a tunnel.
+func storePorts(store *status.Store, name string) []string {
+	for _, tun := range store.Snapshot() {
+		if tun.Name == name {
+			return sortedKeys(tun.Ports)
+		}
+	}
+	return nil
+}
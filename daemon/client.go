@@ -3,27 +3,141 @@ package daemon
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"time"
+
+	"github.com/strandnerd/tunn/logs"
+	"github.com/strandnerd/tunn/version"
 )
 
-func sendRequest(ctx context.Context, paths Paths, command string) (*StatusResponse, error) {
+// errNoHandshake reports a daemon from before the handshake, which closes
+// the connection on it.
+var errNoHandshake = errors.New("daemon does not support the handshake")
+
+func dial(ctx context.Context, paths Paths) (net.Conn, error) {
 	dialer := net.Dialer{}
 	conn, err := dialer.DialContext(ctx, "unix", paths.SocketFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to daemon socket: %w", err)
 	}
-	defer conn.Close()
+	return conn, nil
+}
 
-	encoder := json.NewEncoder(conn)
+// handshake introduces the client on conn and returns the daemon's answer
+// along with the decoder for the rest of the connection.
+func handshake(conn net.Conn) (*Hello, *json.Decoder, error) {
+	req := StatusRequest{Command: helloCommand, Protocol: ProtocolVersion, Version: version.String()}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, nil, fmt.Errorf("failed to send handshake: %w", err)
+	}
 	decoder := json.NewDecoder(conn)
+	var hello Hello
+	if err := decoder.Decode(&hello); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, errNoHandshake
+		}
+		return nil, nil, fmt.Errorf("failed to decode daemon handshake: %w", err)
+	}
+	return &hello, decoder, nil
+}
+
+// Handshake asks the daemon for its version and capabilities.
+func Handshake(ctx context.Context, paths Paths) (*Hello, error) {
+	conn, err := dial(ctx, paths)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	hello, _, err := handshake(conn)
+	if errors.Is(err, errNoHandshake) {
+		return nil, &VersionError{CLI: version.String()}
+	}
+	return hello, err
+}
+
+// connect dials the daemon and sends req after the handshake. It fails with
+// a VersionError when the daemon does not understand req. Daemons from before
+// the handshake close the connection on it; they are still sent the commands
+// they know without one, so that an old daemon can be queried and stopped.
+func connect(ctx context.Context, paths Paths, req StatusRequest) (net.Conn, *json.Decoder, error) {
+	conn, err := dial(ctx, paths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hello, decoder, err := handshake(conn)
+	if err != nil {
+		conn.Close()
+		if !errors.Is(err, errNoHandshake) {
+			return nil, nil, err
+		}
+		if !legacyCommands[req.Command] {
+			return nil, nil, &VersionError{CLI: version.String()}
+		}
+		return connectLegacy(ctx, paths, req)
+	}
+	// Every daemon understands stop, so a mismatched one can still be
+	// stopped and restarted.
+	if (hello.Protocol != ProtocolVersion && req.Command != "stop") || !hello.Supports(req.Command) {
+		conn.Close()
+		return nil, nil, &VersionError{Daemon: hello.Version, CLI: version.String()}
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to send %s request: %w", req.Command, err)
+	}
+	return conn, decoder, nil
+}
+
+func connectLegacy(ctx context.Context, paths Paths, req StatusRequest) (net.Conn, *json.Decoder, error) {
+	conn, err := dial(ctx, paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to send %s request: %w", req.Command, err)
+	}
+	return conn, json.NewDecoder(&legacyReader{conn: conn}), nil
+}
+
+// legacyReader reads the answer of a daemon from before the handshake. Such
+// a daemon closes the connection without answering a command it does not
+// know, which is reported as a VersionError.
+type legacyReader struct {
+	conn     net.Conn
+	answered bool
+}
+
+func (r *legacyReader) Read(p []byte) (int, error) {
+	n, err := r.conn.Read(p)
+	if n > 0 {
+		r.answered = true
+	}
+	if errors.Is(err, io.EOF) && !r.answered {
+		return n, &VersionError{CLI: version.String()}
+	}
+	return n, err
+}
 
-	if err := encoder.Encode(StatusRequest{Command: command}); err != nil {
-		return nil, fmt.Errorf("failed to send %s request: %w", command, err)
+func sendRequest(ctx context.Context, paths Paths, req StatusRequest) (*StatusResponse, error) {
+	conn, decoder, err := connect(ctx, paths, req)
+	if err != nil {
+		return nil, err
 	}
+	defer conn.Close()
 
 	var resp StatusResponse
 	if err := decoder.Decode(&resp); err != nil {
+		var versionErr *VersionError
+		if errors.As(err, &versionErr) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to decode daemon response: %w", err)
 	}
 	return &resp, nil
@@ -31,10 +145,118 @@ func sendRequest(ctx context.Context, paths Paths, command string) (*StatusRespo
 
 // QueryStatus contacts the daemon control socket for a status snapshot.
 func QueryStatus(ctx context.Context, paths Paths) (*StatusResponse, error) {
-	return sendRequest(ctx, paths, "status")
+	return sendRequest(ctx, paths, StatusRequest{Command: "status"})
 }
 
 // SendStop requests the daemon to initiate shutdown.
 func SendStop(ctx context.Context, paths Paths) (*StatusResponse, error) {
-	return sendRequest(ctx, paths, "stop")
+	return sendRequest(ctx, paths, StatusRequest{Command: "stop"})
+}
+
+// SendUpgrade asks the daemon to re-execute its binary, keeping its tunnels.
+// The response carries the version being upgraded to in Message.
+func SendUpgrade(ctx context.Context, paths Paths) (*StatusResponse, error) {
+	return sendRequest(ctx, paths, StatusRequest{Command: "upgrade"})
+}
+
+// SendReload asks the daemon to re-read its configuration and apply the changes.
+func SendReload(ctx context.Context, paths Paths) (*StatusResponse, error) {
+	return sendRequest(ctx, paths, StatusRequest{Command: "reload"})
+}
+
+// SendStartTunnels asks the daemon to start tunnels or single ports from its
+// configuration alongside the running ones.
+func SendStartTunnels(ctx context.Context, paths Paths, refs []string) (*StatusResponse, error) {
+	return sendRequest(ctx, paths, StatusRequest{Command: "start-tunnels", Tunnels: refs})
+}
+
+// SendStopTunnels asks the daemon to stop tunnels or single ports while it
+// keeps running the others.
+func SendStopTunnels(ctx context.Context, paths Paths, refs []string) (*StatusResponse, error) {
+	return sendRequest(ctx, paths, StatusRequest{Command: "stop-tunnels", Tunnels: refs})
+}
+
+// SendRestartTunnels asks the daemon to restart tunnels.
+func SendRestartTunnels(ctx context.Context, paths Paths, refs []string) (*StatusResponse, error) {
+	return sendRequest(ctx, paths, StatusRequest{Command: "restart-tunnels", Tunnels: refs})
+}
+
+// Watch subscribes to the daemon's status and calls fn with the initial
+// snapshot and then every port transition as it happens. It returns when ctx
+// is cancelled, when fn returns an error, or with io.EOF when the daemon
+// closes the stream.
+func Watch(ctx context.Context, paths Paths, fn func(WatchEvent) error) error {
+	conn, decoder, err := connect(ctx, paths, StatusRequest{Command: "watch"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	for {
+		var event WatchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return io.EOF
+			}
+			var versionErr *VersionError
+			if errors.As(err, &versionErr) {
+				return err
+			}
+			return fmt.Errorf("failed to decode watch event: %w", err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
+
+// Logs requests the ssh output the daemon captured for a tunnel, or for every
+// tunnel when tunnel is empty, starting at since, and calls fn with every
+// line. With follow set it keeps streaming new lines until ctx is cancelled
+// or the daemon closes the stream, which is reported as io.EOF.
+func Logs(ctx context.Context, paths Paths, tunnel string, since time.Time, follow bool, fn func(logs.Line) error) error {
+	req := StatusRequest{Command: "logs", Since: since, Follow: follow}
+	if tunnel != "" {
+		req.Tunnels = []string{tunnel}
+	}
+	conn, decoder, err := connect(ctx, paths, req)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	for {
+		var entry LogEntry
+		if err := decoder.Decode(&entry); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				if follow {
+					return io.EOF
+				}
+				return nil
+			}
+			return fmt.Errorf("failed to decode log line: %w", err)
+		}
+		if entry.Error != "" {
+			return &Error{Code: entry.Code, Message: entry.Error}
+		}
+		if err := fn(entry.Line); err != nil {
+			return err
+		}
+	}
 }
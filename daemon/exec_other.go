@@ -0,0 +1,13 @@
+//go:build !unix
+
+package daemon
+
+import (
+	"errors"
+	"os"
+)
+
+// Exec is not supported on this platform.
+func Exec(executable string, args, env []string, files []*os.File) error {
+	return errors.New("upgrading the daemon in place is not supported on this platform")
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Exec replaces the current process with executable, keeping its pid and
+// children. The files stay open in the new process under the same
+// descriptors; every other descriptor opened by Go is closed. On failure the
+// files are closed on exec again, so that they do not leak into children.
+func Exec(executable string, args, env []string, files []*os.File) error {
+	inherit := func(closeOnExec bool) error {
+		flag := uintptr(0)
+		if closeOnExec {
+			flag = syscall.FD_CLOEXEC
+		}
+		for _, f := range files {
+			conn, err := f.SyscallConn()
+			if err != nil {
+				return fmt.Errorf("failed to access %s: %w", f.Name(), err)
+			}
+			var fcntlErr error
+			if err := conn.Control(func(fd uintptr) {
+				if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, flag); errno != 0 {
+					fcntlErr = errno
+				}
+			}); err != nil {
+				return fmt.Errorf("failed to access %s: %w", f.Name(), err)
+			}
+			if fcntlErr != nil {
+				return fmt.Errorf("failed to pass %s on: %w", f.Name(), fcntlErr)
+			}
+		}
+		return nil
+	}
+
+	if err := inherit(false); err != nil {
+		_ = inherit(true)
+		return err
+	}
+	err := syscall.Exec(executable, args, env)
+	_ = inherit(true)
+	return fmt.Errorf("failed to execute %s: %w", executable, err)
+}
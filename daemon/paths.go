@@ -6,12 +6,24 @@ import (
 	"path/filepath"
 )
 
+// HandoverEnv names the environment variable through which a daemon tells
+// the binary it upgrades to where to find its state.
+const HandoverEnv = "TUNN_HANDOVER"
+
 // Paths represents the filesystem anchor for daemon metadata.
 type Paths struct {
 	RuntimeDir string
 	PIDFile    string
 	SocketFile string
 	LogFile    string
+	// OutputDir holds the captured ssh output of every tunnel port.
+	OutputDir string
+	// HandoverFile holds the state a daemon passes to the binary it
+	// upgrades to.
+	HandoverFile string
+	// SupervisorFile holds the restarts and crashes recorded by the
+	// supervisor of the daemon.
+	SupervisorFile string
 }
 
 // ResolvePaths determines the directory for daemon runtime artifacts and ensures it exists.
@@ -35,9 +47,12 @@ func ResolvePaths() (Paths, error) {
 	}
 
 	return Paths{
-		RuntimeDir: runtimeDir,
-		PIDFile:    filepath.Join(runtimeDir, "daemon.pid"),
-		SocketFile: filepath.Join(runtimeDir, "daemon.sock"),
-		LogFile:    filepath.Join(runtimeDir, "daemon.log"),
+		RuntimeDir:     runtimeDir,
+		PIDFile:        filepath.Join(runtimeDir, "daemon.pid"),
+		SocketFile:     filepath.Join(runtimeDir, "daemon.sock"),
+		LogFile:        filepath.Join(runtimeDir, "daemon.log"),
+		OutputDir:      filepath.Join(runtimeDir, "ssh"),
+		HandoverFile:   filepath.Join(runtimeDir, "handover.json"),
+		SupervisorFile: filepath.Join(runtimeDir, "supervisor.json"),
 	}, nil
 }
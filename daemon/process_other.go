@@ -2,6 +2,16 @@
 
 package daemon
 
+import "os/exec"
+
 func isProcessRunning(pid int) bool {
 	return false
 }
+
+// NewProcessGroup does nothing on this platform.
+func NewProcessGroup(cmd *exec.Cmd) {}
+
+// TerminateProcessGroup does nothing on this platform.
+func TerminateProcessGroup(pid int) error {
+	return nil
+}
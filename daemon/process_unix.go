@@ -2,7 +2,10 @@
 
 package daemon
 
-import "syscall"
+import (
+	"os/exec"
+	"syscall"
+)
 
 func isProcessRunning(pid int) bool {
 	if pid <= 0 {
@@ -14,3 +17,19 @@ func isProcessRunning(pid int) bool {
 	}
 	return err == syscall.EPERM
 }
+
+// NewProcessGroup makes cmd start in a process group of its own, which the
+// processes it starts join.
+func NewProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// TerminateProcessGroup sends SIGTERM to the processes left in the group
+// led by pid, such as the ssh processes of a daemon that crashed.
+func TerminateProcessGroup(pid int) error {
+	err := syscall.Kill(-pid, syscall.SIGTERM)
+	if err == syscall.ESRCH {
+		return nil
+	}
+	return err
+}
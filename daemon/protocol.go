@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/strandnerd/tunn/version"
+)
+
+// ProtocolVersion is the version of the control socket protocol. It changes
+// when requests or responses change in a way older peers cannot follow;
+// commands added later are announced as capabilities instead. Daemons from
+// before the handshake speak version 1.
+const ProtocolVersion = 2
+
+// helloCommand opens a connection with a handshake. The daemon answers with
+// a Hello, then reads the actual request from the same connection.
+const helloCommand = "hello"
+
+// Commands lists every command this build of the daemon understands, which
+// it announces as its capabilities.
+var Commands = []string{
+	"status",
+	"watch",
+	"logs",
+	"stop",
+	"upgrade",
+	"reload",
+	"start-tunnels",
+	"stop-tunnels",
+	"restart-tunnels",
+}
+
+// legacyCommands are the commands of the daemon released before the
+// handshake, which are sent to it without one. Anything else needs a newer
+// daemon and is reported as a VersionError.
+var legacyCommands = map[string]bool{
+	"status": true,
+	"stop":   true,
+}
+
+// Error codes reported alongside error messages.
+const (
+	// CodeUnknownCommand reports a command the daemon does not know.
+	CodeUnknownCommand = "unknown_command"
+	// CodeBadRequest reports a request the daemon cannot act on as sent.
+	CodeBadRequest = "bad_request"
+	// CodeUnsupported reports a command this daemon was started without.
+	CodeUnsupported = "unsupported"
+	// CodeFailed reports a command that was attempted and failed.
+	CodeFailed = "failed"
+	// CodeVersionMismatch reports a client speaking another protocol
+	// version, which the daemon only serves stop.
+	CodeVersionMismatch = "version_mismatch"
+)
+
+// Hello is the daemon's answer to the handshake.
+type Hello struct {
+	Protocol     int      `json:"protocol"`
+	Version      string   `json:"version"`
+	PID          int      `json:"pid"`
+	Capabilities []string `json:"capabilities"`
+	// Started is when the daemon began running its current binary, which
+	// changes when it upgrades in place.
+	Started time.Time `json:"started"`
+}
+
+// Supports reports whether the daemon announced command.
+func (h Hello) Supports(command string) bool {
+	for _, capability := range h.Capabilities {
+		if capability == command {
+			return true
+		}
+	}
+	return false
+}
+
+// Error is a failure reported by the daemon.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// VersionError reports a daemon that cannot serve a request because it was
+// started from a different build than the CLI.
+type VersionError struct {
+	// Daemon is the daemon's version, or empty when it predates the
+	// handshake.
+	Daemon string
+	CLI    string
+}
+
+func (e *VersionError) Error() string {
+	daemon := e.Daemon
+	if daemon == "" {
+		daemon = "an older version"
+	} else {
+		daemon = "version " + daemon
+	}
+	return fmt.Sprintf("daemon is %s, CLI is %s; restart the daemon", daemon, e.CLI)
+}
+
+func (s *Server) hello() Hello {
+	return Hello{
+		Protocol:     ProtocolVersion,
+		Version:      version.String(),
+		PID:          s.pid,
+		Capabilities: Commands,
+		Started:      s.started,
+	}
+}
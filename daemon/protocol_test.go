@@ -0,0 +1,199 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/strandnerd/tunn/status"
+)
+
+func TestServerHello(t *testing.T) {
+	s := NewServer(Paths{}, status.NewStore(), 55, nil)
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+	})
+	go s.handleConnection(serverConn)
+
+	enc := json.NewEncoder(clientConn)
+	dec := json.NewDecoder(clientConn)
+	if err := enc.Encode(StatusRequest{Command: helloCommand, Protocol: ProtocolVersion, Version: "test"}); err != nil {
+		t.Fatalf("failed to encode handshake: %v", err)
+	}
+	var hello Hello
+	if err := dec.Decode(&hello); err != nil {
+		t.Fatalf("failed to decode handshake: %v", err)
+	}
+	if hello.Protocol != ProtocolVersion || hello.PID != 55 || hello.Version == "" {
+		t.Fatalf("unexpected hello %+v", hello)
+	}
+	for _, command := range []string{"status", "watch", "logs", "start-tunnels"} {
+		if !hello.Supports(command) {
+			t.Fatalf("expected capability %q in %v", command, hello.Capabilities)
+		}
+	}
+
+	if err := enc.Encode(StatusRequest{Command: "status"}); err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	var resp StatusResponse
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !resp.Running || resp.PID != 55 {
+		t.Fatalf("unexpected response after handshake %+v", resp)
+	}
+}
+
+func TestServerUnknownCommand(t *testing.T) {
+	s := NewServer(Paths{}, status.NewStore(), 7, nil)
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+	})
+	go s.handleConnection(serverConn)
+
+	if err := json.NewEncoder(clientConn).Encode(StatusRequest{Command: "frobnicate"}); err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	var resp StatusResponse
+	if err := json.NewDecoder(clientConn).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	var daemonErr *Error
+	if !errors.As(resp.Err(), &daemonErr) || daemonErr.Code != CodeUnknownCommand || daemonErr.Message != `unknown command "frobnicate"` {
+		t.Fatalf("unexpected error %v", resp.Err())
+	}
+}
+
+func TestServerProtocolMismatch(t *testing.T) {
+	s := NewServer(Paths{}, status.NewStore(), 7, nil)
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+	})
+	go s.handleConnection(serverConn)
+
+	enc := json.NewEncoder(clientConn)
+	dec := json.NewDecoder(clientConn)
+	if err := enc.Encode(StatusRequest{Command: helloCommand, Protocol: ProtocolVersion + 1, Version: "9.0.0"}); err != nil {
+		t.Fatalf("failed to encode handshake: %v", err)
+	}
+	var hello Hello
+	if err := dec.Decode(&hello); err != nil || hello.Protocol != ProtocolVersion {
+		t.Fatalf("expected the daemon to answer the handshake, got %+v, %v", hello, err)
+	}
+	if err := enc.Encode(StatusRequest{Command: "status"}); err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	var resp StatusResponse
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	var daemonErr *Error
+	if !errors.As(resp.Err(), &daemonErr) || daemonErr.Code != CodeVersionMismatch {
+		t.Fatalf("expected a version mismatch, got %v", resp.Err())
+	}
+	if want := "daemon is version " + hello.Version + ", CLI is 9.0.0; restart the daemon"; daemonErr.Message != want {
+		t.Fatalf("expected %q, got %q", want, daemonErr.Message)
+	}
+	if len(resp.Tunnels) != 0 {
+		t.Fatalf("expected no status for a mismatched client, got %+v", resp.Tunnels)
+	}
+}
+
+// serveFake stands in for a daemon of another build, answering every
+// connection with reply.
+func serveFake(t *testing.T, reply func(*json.Decoder, *json.Encoder)) Paths {
+	t.Helper()
+	paths := Paths{SocketFile: filepath.Join(t.TempDir(), "tunn.sock")}
+	listener, err := net.Listen("unix", paths.SocketFile)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reply(json.NewDecoder(conn), json.NewEncoder(conn))
+			conn.Close()
+		}
+	}()
+	return paths
+}
+
+func TestClientOlderDaemon(t *testing.T) {
+	// Daemons from before the handshake close the connection on the
+	// handshake and on commands they do not know.
+	paths := serveFake(t, func(dec *json.Decoder, enc *json.Encoder) {
+		var req StatusRequest
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		switch req.Command {
+		case "status":
+			_ = enc.Encode(StatusResponse{Running: true, Mode: "daemon", PID: 9})
+		case "stop":
+			_ = enc.Encode(StatusResponse{Running: true, Mode: "daemon", PID: 9, Message: "stopping"})
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := QueryStatus(ctx, paths)
+	if err != nil || resp.PID != 9 {
+		t.Fatalf("expected status from an older daemon, got %+v, %v", resp, err)
+	}
+
+	resp, err = SendStop(ctx, paths)
+	if err != nil || resp.Message != "stopping" {
+		t.Fatalf("expected an older daemon to stop, got %+v, %v", resp, err)
+	}
+
+	// The commands added since are not sent to older daemons.
+	for _, send := range []func(context.Context, Paths, []string) (*StatusResponse, error){SendStartTunnels, SendStopTunnels} {
+		_, err = send(ctx, paths, []string{"db"})
+		var versionErr *VersionError
+		if !errors.As(err, &versionErr) || versionErr.Daemon != "" {
+			t.Fatalf("expected a version error, got %v", err)
+		}
+		if got := err.Error(); got != "daemon is an older version, CLI is "+versionErr.CLI+"; restart the daemon" {
+			t.Fatalf("unexpected message %q", got)
+		}
+	}
+}
+
+func TestClientMissingCapability(t *testing.T) {
+	paths := serveFake(t, func(dec *json.Decoder, enc *json.Encoder) {
+		var req StatusRequest
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		_ = enc.Encode(Hello{Protocol: ProtocolVersion, Version: "1.0.0", PID: 9, Capabilities: []string{"status", "stop"}})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := Watch(ctx, paths, func(WatchEvent) error { return nil })
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) || versionErr.Daemon != "1.0.0" {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+	if got := err.Error(); got != "daemon is version 1.0.0, CLI is "+versionErr.CLI+"; restart the daemon" {
+		t.Fatalf("unexpected message %q", got)
+	}
+}
@@ -8,68 +8,241 @@ import (
 	"net"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/logs"
 	"github.com/strandnerd/tunn/status"
+	"github.com/strandnerd/tunn/version"
 )
 
 // StatusRequest represents an IPC command from the CLI.
 type StatusRequest struct {
 	Command string `json:"command"`
+	// Protocol and Version describe the client in the handshake.
+	Protocol int    `json:"protocol,omitempty"`
+	Version  string `json:"version,omitempty"`
+	// Tunnels holds the tunnel or tunnel/port references a command acts on.
+	Tunnels []string `json:"tunnels,omitempty"`
+	// Since and Follow select the output returned by the logs command.
+	Since  time.Time `json:"since,omitzero"`
+	Follow bool      `json:"follow,omitempty"`
 }
 
 // StatusResponse captures the daemon state for CLI consumption.
 type StatusResponse struct {
-	Running bool            `json:"running"`
-	Mode    string          `json:"mode"`
-	PID     int             `json:"pid"`
-	Message string          `json:"message,omitempty"`
+	Running bool   `json:"running"`
+	Mode    string `json:"mode"`
+	PID     int    `json:"pid"`
+	Profile string `json:"profile,omitempty"`
+	// Config is the path of the configuration file the daemon runs.
+	Config  string `json:"config,omitempty"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Code classifies Error, as one of the Code constants.
+	Code    string          `json:"code,omitempty"`
+	Changes *config.Diff    `json:"changes,omitempty"`
 	Tunnels []status.Tunnel `json:"tunnels,omitempty"`
+	// Supervisor reports the restarts of a daemon run with --supervise.
+	Supervisor *Supervision `json:"supervisor,omitempty"`
+}
+
+// Err returns the failure reported in the response, or nil.
+func (r *StatusResponse) Err() error {
+	if r.Error == "" {
+		return nil
+	}
+	return &Error{Code: r.Code, Message: r.Error}
+}
+
+// Watch event types.
+const (
+	WatchSnapshot = "snapshot"
+	WatchPort     = "port"
+)
+
+// watchBuffer bounds how many events a watch client may fall behind before
+// the daemon closes its stream.
+const watchBuffer = 256
+
+// WatchEvent is a line of the stream sent in reply to the watch command: a
+// snapshot of every tunnel first, then one event per port transition.
+type WatchEvent struct {
+	Type    string          `json:"type"`
+	Time    time.Time       `json:"time"`
+	PID     int             `json:"pid,omitempty"`
+	Profile string          `json:"profile,omitempty"`
+	Tunnels []status.Tunnel `json:"tunnels,omitempty"`
+
+	Tunnel   string `json:"tunnel,omitempty"`
+	Port     string `json:"port,omitempty"`
+	State    string `json:"state,omitempty"`
+	Previous string `json:"previous,omitempty"`
+	Local    string `json:"local,omitempty"`
+}
+
+// LogEntry is a line of the stream sent in reply to the logs command. A
+// failure is reported as an entry with only Error set.
+type LogEntry struct {
+	logs.Line
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+}
+
+// Controller performs tunnel lifecycle operations requested over IPC.
+type Controller interface {
+	// Reload re-reads the configuration and applies the resulting changes.
+	Reload() (config.Diff, error)
+	// Start starts tunnels or single ports from the configuration alongside
+	// the running ones.
+	Start(refs []string) (config.Diff, error)
+	// Stop stops running tunnels or single ports, leaving the others alone.
+	Stop(refs []string) (config.Diff, error)
+	// Restart restarts running tunnels.
+	Restart(refs []string) (config.Diff, error)
+}
+
+// Upgrader replaces the running daemon with the binary it was started from,
+// which may have been upgraded since.
+type Upgrader interface {
+	// PrepareUpgrade checks that the new binary runs and returns its version.
+	PrepareUpgrade() (string, error)
+	// Upgrade hands the control socket in listener and the state of the
+	// daemon over to the new binary, which takes the place of the process.
+	// It only returns when that fails.
+	Upgrade(listener *os.File) error
 }
 
 // Server handles IPC communication with CLI clients.
 type Server struct {
-	paths  Paths
-	store  *status.Store
-	pid    int
-	mu     sync.Mutex
-	ln     net.Listener
-	stopFn func()
+	paths   Paths
+	store   *status.Store
+	pid     int
+	profile string
+	config  string
+	control Controller
+	output  *logs.Store
+	upgrade Upgrader
+	ready   func()
+	started time.Time
+	// supervised reports the supervisor state in status responses.
+	supervised bool
+	mu         sync.Mutex
+	ln         net.Listener
+	stopFn     func()
+	quit       chan struct{}
+	closed     sync.Once
 }
 
 // NewServer constructs a server bound to the given socket and status store.
 func NewServer(paths Paths, store *status.Store, pid int, stopFn func()) *Server {
 	return &Server{
-		paths:  paths,
-		store:  store,
-		pid:    pid,
-		stopFn: stopFn,
+		paths:   paths,
+		store:   store,
+		pid:     pid,
+		stopFn:  stopFn,
+		started: time.Now(),
+		quit:    make(chan struct{}),
 	}
 }
 
-// Run starts the IPC server and blocks until the context is cancelled or the listener fails.
-func (s *Server) Run(ctx context.Context) error {
-	if err := os.Remove(s.paths.SocketFile); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove existing socket: %w", err)
-	}
+// SetProfile records the configuration profile reported to clients.
+func (s *Server) SetProfile(profile string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profile = profile
+}
 
-	ln, err := net.Listen("unix", s.paths.SocketFile)
-	if err != nil {
-		return fmt.Errorf("failed to listen on socket: %w", err)
-	}
-	if err := os.Chmod(s.paths.SocketFile, 0o600); err != nil {
-		ln.Close()
-		return fmt.Errorf("failed to secure socket permissions: %w", err)
-	}
+// SetConfigPath records the path of the configuration file reported to
+// clients.
+func (s *Server) SetConfigPath(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = path
+}
+
+// SetController wires the lifecycle operations exposed to IPC clients.
+func (s *Server) SetController(control Controller) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.control = control
+}
+
+// SetLogs wires the captured ssh output served by the logs command.
+func (s *Server) SetLogs(output *logs.Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.output = output
+}
+
+// SetUpgrader wires the upgrade command.
+func (s *Server) SetUpgrader(upgrade Upgrader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upgrade = upgrade
+}
+
+// SetSupervised makes status responses include the state of the supervisor
+// that started the daemon.
+func (s *Server) SetSupervised(supervised bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.supervised = supervised
+}
+
+// SetReady registers fn to be called once Run accepts connections.
+func (s *Server) SetReady(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = fn
+}
 
+// SetListener makes Run serve ln, such as a control socket inherited from the
+// daemon this one replaced, instead of creating the socket.
+func (s *Server) SetListener(ln net.Listener) {
 	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.ln = ln
+}
+
+// Run starts the IPC server and blocks until the context is cancelled or the listener fails.
+func (s *Server) Run(ctx context.Context) error {
+	s.mu.Lock()
+	ln := s.ln
 	s.mu.Unlock()
 
+	if ln == nil {
+		if err := os.Remove(s.paths.SocketFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove existing socket: %w", err)
+		}
+
+		var err error
+		ln, err = net.Listen("unix", s.paths.SocketFile)
+		if err != nil {
+			return fmt.Errorf("failed to listen on socket: %w", err)
+		}
+		if err := os.Chmod(s.paths.SocketFile, 0o600); err != nil {
+			ln.Close()
+			return fmt.Errorf("failed to secure socket permissions: %w", err)
+		}
+
+		s.mu.Lock()
+		s.ln = ln
+		s.mu.Unlock()
+	}
+
 	defer func() {
 		ln.Close()
 		_ = os.Remove(s.paths.SocketFile)
 	}()
 
+	s.mu.Lock()
+	ready := s.ready
+	s.mu.Unlock()
+	if ready != nil {
+		ready()
+	}
+
 	go func() {
 		<-ctx.Done()
 		s.Close()
@@ -92,8 +265,9 @@ func (s *Server) Run(ctx context.Context) error {
 	}
 }
 
-// Close terminates the listener if active.
+// Close terminates the listener if active and ends the watch streams.
 func (s *Server) Close() {
+	s.closed.Do(func() { close(s.quit) })
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.ln != nil {
@@ -109,14 +283,57 @@ func (s *Server) handleConnection(conn net.Conn) {
 	if err := decoder.Decode(&req); err != nil {
 		return
 	}
+	if req.Command == helloCommand {
+		if err := json.NewEncoder(conn).Encode(s.hello()); err != nil {
+			return
+		}
+		client := req
+		req = StatusRequest{}
+		if err := decoder.Decode(&req); err != nil {
+			return
+		}
+		// Every client can stop the daemon, so that a mismatched one can
+		// still be restarted.
+		if client.Protocol != ProtocolVersion && req.Command != "stop" {
+			versionErr := &VersionError{Daemon: version.String(), CLI: client.Version}
+			_ = json.NewEncoder(conn).Encode(StatusResponse{
+				Running: true,
+				Mode:    "daemon",
+				PID:     s.pid,
+				Error:   versionErr.Error(),
+				Code:    CodeVersionMismatch,
+			})
+			return
+		}
+	}
 
 	switch req.Command {
 	case "status":
 		s.handleStatus(conn)
+	case "watch":
+		s.handleWatch(conn, decoder)
+	case "logs":
+		s.handleLogs(conn, decoder, req)
 	case "stop":
 		s.handleStop(conn)
+	case "upgrade":
+		s.handleUpgrade(conn)
+	case "reload":
+		s.handleChange(conn, "reload", Controller.Reload)
+	case "start-tunnels":
+		s.handleChange(conn, "start", func(c Controller) (config.Diff, error) { return c.Start(req.Tunnels) })
+	case "stop-tunnels":
+		s.handleChange(conn, "stop", func(c Controller) (config.Diff, error) { return c.Stop(req.Tunnels) })
+	case "restart-tunnels":
+		s.handleChange(conn, "restart", func(c Controller) (config.Diff, error) { return c.Restart(req.Tunnels) })
 	default:
-		return
+		_ = json.NewEncoder(conn).Encode(StatusResponse{
+			Running: true,
+			Mode:    "daemon",
+			PID:     s.pid,
+			Error:   fmt.Sprintf("unknown command %q", req.Command),
+			Code:    CodeUnknownCommand,
+		})
 	}
 }
 
@@ -127,17 +344,156 @@ func (s *Server) handleStatus(conn net.Conn) {
 		Running: true,
 		Mode:    "daemon",
 		PID:     s.pid,
+		Profile: s.currentProfile(),
 		Tunnels: snapshot,
 	}
+	s.mu.Lock()
+	resp.Config = s.config
+	supervised := s.supervised
+	s.mu.Unlock()
+	if supervised {
+		resp.Supervisor, _ = ReadSupervision(s.paths)
+	}
 	_ = encoder.Encode(resp)
 }
 
+// handleWatch streams a snapshot and then every port transition until the
+// client disconnects, falls behind, or the server closes.
+func (s *Server) handleWatch(conn net.Conn, decoder *json.Decoder) {
+	snapshot, events, cancel := s.store.Subscribe(watchBuffer)
+	defer cancel()
+
+	encoder := json.NewEncoder(conn)
+	err := encoder.Encode(WatchEvent{
+		Type:    WatchSnapshot,
+		Time:    time.Now(),
+		PID:     s.pid,
+		Profile: s.currentProfile(),
+		Tunnels: snapshot,
+	})
+	if err != nil {
+		return
+	}
+
+	gone := clientGone(decoder)
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			err := encoder.Encode(WatchEvent{
+				Type:     WatchPort,
+				Time:     event.Time,
+				Tunnel:   event.Tunnel,
+				Port:     event.Port,
+				State:    event.State,
+				Previous: event.Previous,
+				Local:    event.Local,
+			})
+			if err != nil {
+				return
+			}
+		case <-gone:
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// handleLogs sends the captured output of the requested tunnel, or of every
+// tunnel, and keeps streaming new lines when the client follows.
+func (s *Server) handleLogs(conn net.Conn, decoder *json.Decoder, req StatusRequest) {
+	encoder := json.NewEncoder(conn)
+	s.mu.Lock()
+	output := s.output
+	s.mu.Unlock()
+	if output == nil {
+		_ = encoder.Encode(LogEntry{Error: "logs are not supported by this daemon", Code: CodeUnsupported})
+		return
+	}
+	if len(req.Tunnels) > 1 {
+		_ = encoder.Encode(LogEntry{Error: "logs accepts a single tunnel", Code: CodeBadRequest})
+		return
+	}
+	tunnel := ""
+	if len(req.Tunnels) == 1 {
+		tunnel = req.Tunnels[0]
+	}
+
+	var lines <-chan logs.Line
+	if req.Follow {
+		var cancel func()
+		lines, cancel = output.Subscribe(tunnel, watchBuffer)
+		defer cancel()
+	}
+
+	history, err := output.Read(tunnel, req.Since)
+	if err != nil {
+		code := CodeFailed
+		if errors.Is(err, logs.ErrInvalidTunnel) {
+			code = CodeBadRequest
+		}
+		_ = encoder.Encode(LogEntry{Error: err.Error(), Code: code})
+		return
+	}
+	var last time.Time
+	for _, line := range history {
+		if err := encoder.Encode(LogEntry{Line: line}); err != nil {
+			return
+		}
+		last = line.Time
+	}
+	if !req.Follow {
+		return
+	}
+
+	gone := clientGone(decoder)
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			// Lines recorded while the history was read were sent with it.
+			if !line.Time.After(last) {
+				continue
+			}
+			if err := encoder.Encode(LogEntry{Line: line}); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// clientGone returns a channel closed once the client of a stream hangs up.
+// Clients send nothing after their request, so any read returning means
+// they went away.
+func clientGone(decoder *json.Decoder) <-chan struct{} {
+	gone := make(chan struct{})
+	go func() {
+		var ignored json.RawMessage
+		for decoder.Decode(&ignored) == nil {
+		}
+		close(gone)
+	}()
+	return gone
+}
+
 func (s *Server) handleStop(conn net.Conn) {
 	encoder := json.NewEncoder(conn)
 	resp := StatusResponse{
 		Running: false,
 		Mode:    "daemon",
 		PID:     s.pid,
+		Profile: s.currentProfile(),
 		Message: "stopping",
 		Tunnels: s.store.Snapshot(),
 	}
@@ -146,3 +502,100 @@ func (s *Server) handleStop(conn net.Conn) {
 		s.stopFn()
 	}
 }
+
+// handleUpgrade answers with the version of the new binary, then hands the
+// daemon over to it. The connection is closed first, so the client waits for
+// the new binary to answer on the control socket.
+func (s *Server) handleUpgrade(conn net.Conn) {
+	resp := StatusResponse{
+		Running: true,
+		Mode:    "daemon",
+		PID:     s.pid,
+	}
+
+	s.mu.Lock()
+	upgrade := s.upgrade
+	ln := s.ln
+	s.mu.Unlock()
+
+	var listener *os.File
+	switch {
+	case upgrade == nil:
+		resp.Error = "upgrade is not supported by this daemon"
+		resp.Code = CodeUnsupported
+	default:
+		version, err := upgrade.PrepareUpgrade()
+		if err == nil {
+			listener, err = listenerFile(ln)
+		}
+		if err != nil {
+			resp.Error = err.Error()
+			resp.Code = CodeFailed
+			break
+		}
+		resp.Message = version
+	}
+	_ = json.NewEncoder(conn).Encode(resp)
+	conn.Close()
+	if listener == nil {
+		return
+	}
+	defer listener.Close()
+	_ = upgrade.Upgrade(listener)
+}
+
+// listenerFile duplicates the descriptor of the control socket.
+func listenerFile(ln net.Listener) (*os.File, error) {
+	filer, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, errors.New("the control socket cannot be handed over")
+	}
+	f, err := filer.File()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hand over the control socket: %w", err)
+	}
+	return f, nil
+}
+
+// handleChange runs a controller operation that changes the running tunnels
+// and reports the resulting diff.
+func (s *Server) handleChange(conn net.Conn, action string, apply func(Controller) (config.Diff, error)) {
+	encoder := json.NewEncoder(conn)
+	resp := StatusResponse{
+		Running: true,
+		Mode:    "daemon",
+		PID:     s.pid,
+	}
+
+	control := s.controller()
+	if control == nil {
+		resp.Error = action + " is not supported by this daemon"
+		resp.Code = CodeUnsupported
+		_ = encoder.Encode(resp)
+		return
+	}
+
+	diff, err := apply(control)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Code = CodeFailed
+	} else {
+		resp.Message = diff.String()
+		resp.Changes = &diff
+	}
+	resp.Profile = s.currentProfile()
+	resp.Tunnels = s.store.Snapshot()
+	_ = encoder.Encode(resp)
+}
+
+func (s *Server) controller() Controller {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.control
+}
+
+func (s *Server) currentProfile() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.profile
+}
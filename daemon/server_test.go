@@ -1,11 +1,17 @@
 package daemon
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/logs"
 	"github.com/strandnerd/tunn/status"
 )
 
@@ -15,6 +21,8 @@ func TestServerStatusHandshake(t *testing.T) {
 	store.Update("db", "5432", "active")
 
 	s := NewServer(Paths{}, store, 1234, nil)
+	s.SetProfile("prod")
+	s.SetConfigPath("/home/user/.tunnrc")
 	clientConn, serverConn := net.Pipe()
 	t.Cleanup(func() {
 		clientConn.Close()
@@ -49,6 +57,12 @@ func TestServerStatusHandshake(t *testing.T) {
 	if resp.PID != 1234 {
 		t.Fatalf("expected pid 1234, got %d", resp.PID)
 	}
+	if resp.Profile != "prod" {
+		t.Fatalf("expected profile prod, got %q", resp.Profile)
+	}
+	if resp.Config != "/home/user/.tunnrc" {
+		t.Fatalf("expected config /home/user/.tunnrc, got %q", resp.Config)
+	}
 	if len(resp.Tunnels) != 1 {
 		t.Fatalf("expected 1 tunnel in response, got %d", len(resp.Tunnels))
 	}
@@ -101,3 +115,319 @@ func TestServerStopCommand(t *testing.T) {
 		t.Fatalf("expected stop callback to be invoked")
 	}
 }
+
+type fakeController struct {
+	diff   config.Diff
+	err    error
+	called string
+	refs   []string
+}
+
+func (f *fakeController) Reload() (config.Diff, error) {
+	f.called = "reload"
+	return f.diff, f.err
+}
+
+func (f *fakeController) Start(refs []string) (config.Diff, error) {
+	f.called, f.refs = "start", refs
+	return f.diff, f.err
+}
+
+func (f *fakeController) Stop(refs []string) (config.Diff, error) {
+	f.called, f.refs = "stop", refs
+	return f.diff, f.err
+}
+
+func (f *fakeController) Restart(refs []string) (config.Diff, error) {
+	f.called, f.refs = "restart", refs
+	return f.diff, f.err
+}
+
+func TestServerReloadCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		control     Controller
+		wantMessage string
+		wantError   string
+	}{
+		{"Unsupported", nil, "", "reload is not supported by this daemon"},
+		{"Applied", &fakeController{diff: config.Diff{Added: []string{"db"}, Unchanged: []string{"api"}}}, "started db; 1 unchanged", ""},
+		{"Failed", &fakeController{err: errors.New("2 problems found")}, "", "2 problems found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(Paths{}, status.NewStore(), 7, nil)
+			if tt.control != nil {
+				s.SetController(tt.control)
+			}
+
+			clientConn, serverConn := net.Pipe()
+			t.Cleanup(func() {
+				clientConn.Close()
+			})
+			go s.handleConnection(serverConn)
+
+			if err := json.NewEncoder(clientConn).Encode(StatusRequest{Command: "reload"}); err != nil {
+				t.Fatalf("failed to encode request: %v", err)
+			}
+			var resp StatusResponse
+			if err := json.NewDecoder(clientConn).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if resp.Error != tt.wantError {
+				t.Fatalf("expected error %q, got %q", tt.wantError, resp.Error)
+			}
+			if resp.Message != tt.wantMessage {
+				t.Fatalf("expected message %q, got %q", tt.wantMessage, resp.Message)
+			}
+			if tt.wantError == "" && (resp.Changes == nil || len(resp.Changes.Added) != 1) {
+				t.Fatalf("expected changes in response, got %+v", resp.Changes)
+			}
+		})
+	}
+}
+
+func TestServerTunnelCommands(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"start-tunnels", "start"},
+		{"stop-tunnels", "stop"},
+		{"restart-tunnels", "restart"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			control := &fakeController{diff: config.Diff{Changed: []string{"db"}, Unchanged: []string{"api"}}}
+			s := NewServer(Paths{}, status.NewStore(), 7, nil)
+			s.SetController(control)
+
+			clientConn, serverConn := net.Pipe()
+			t.Cleanup(func() {
+				clientConn.Close()
+			})
+			go s.handleConnection(serverConn)
+
+			req := StatusRequest{Command: tt.command, Tunnels: []string{"db/postgres"}}
+			if err := json.NewEncoder(clientConn).Encode(req); err != nil {
+				t.Fatalf("failed to encode request: %v", err)
+			}
+			var resp StatusResponse
+			if err := json.NewDecoder(clientConn).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if control.called != tt.want || len(control.refs) != 1 || control.refs[0] != "db/postgres" {
+				t.Fatalf("expected %s of db/postgres, got %s of %v", tt.want, control.called, control.refs)
+			}
+			if resp.Error != "" || resp.Message != "restarted db; 1 unchanged" {
+				t.Fatalf("unexpected response %+v", resp)
+			}
+		})
+	}
+}
+
+func TestServerWatch(t *testing.T) {
+	store := status.NewStore()
+	store.EnsureTunnel("db", []string{"5432"})
+	paths := Paths{SocketFile: filepath.Join(t.TempDir(), "tunn.sock")}
+	s := NewServer(paths, store, 42, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	if err := WaitForSocket(paths, time.Second); err != nil {
+		t.Fatalf("socket not ready: %v", err)
+	}
+
+	events := make(chan WatchEvent, 4)
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- Watch(watchCtx, paths, func(event WatchEvent) error {
+			events <- event
+			return nil
+		})
+	}()
+
+	snapshot := <-events
+	if snapshot.Type != WatchSnapshot || snapshot.PID != 42 || len(snapshot.Tunnels) != 1 || snapshot.Tunnels[0].Ports["5432"] != "pending" {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	store.Update("db", "5432", "active")
+	select {
+	case event := <-events:
+		if event.Type != WatchPort || event.Tunnel != "db" || event.Port != "5432" || event.State != "active" || event.Previous != "pending" || event.Time.IsZero() {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a port event")
+	}
+
+	stopWatch()
+	if err := <-watchErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Watch to end with the context, got %v", err)
+	}
+}
+
+func TestServerReady(t *testing.T) {
+	paths := Paths{SocketFile: filepath.Join(t.TempDir(), "tunn.sock")}
+	s := NewServer(paths, status.NewStore(), 42, nil)
+	ready := make(chan struct{})
+	s.SetReady(func() { close(ready) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("expected the server to report it is ready")
+	}
+	if _, err := Handshake(context.Background(), paths); err != nil {
+		t.Fatalf("expected the server to accept connections once ready: %v", err)
+	}
+}
+
+func TestServerLogs(t *testing.T) {
+	output := logs.NewStore(t.TempDir(), logs.DefaultMaxSize)
+	db := output.Writer("db", "5432")
+	if _, err := db.Write([]byte("old line\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := output.Writer("api", "3000").Write([]byte("other tunnel\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	paths := Paths{SocketFile: filepath.Join(t.TempDir(), "tunn.sock")}
+	s := NewServer(paths, status.NewStore(), 42, nil)
+	s.SetLogs(output)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	if err := WaitForSocket(paths, time.Second); err != nil {
+		t.Fatalf("socket not ready: %v", err)
+	}
+
+	var got []string
+	err := Logs(context.Background(), paths, "db", time.Time{}, false, func(line logs.Line) error {
+		got = append(got, line.Port+" "+line.Text)
+		return nil
+	})
+	if err != nil || len(got) != 1 || got[0] != "5432 old line" {
+		t.Fatalf("unexpected logs %q (%v)", got, err)
+	}
+
+	lines := make(chan logs.Line, 4)
+	followCtx, stopFollow := context.WithCancel(context.Background())
+	followErr := make(chan error, 1)
+	go func() {
+		followErr <- Logs(followCtx, paths, "db", time.Now().Add(time.Minute), true, func(line logs.Line) error {
+			lines <- line
+			return nil
+		})
+	}()
+	// Keep writing until the follower has subscribed and sees a line.
+	deadline := time.After(time.Second)
+	for received := false; !received; {
+		if _, err := db.Write([]byte("new line\n")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		select {
+		case line := <-lines:
+			if line.Text != "new line" {
+				t.Fatalf("unexpected followed line %+v", line)
+			}
+			received = true
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("expected a followed line")
+		}
+	}
+
+	stopFollow()
+	if err := <-followErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Logs to end with the context, got %v", err)
+	}
+
+	s.SetLogs(nil)
+	err = Logs(context.Background(), paths, "", time.Time{}, false, func(logs.Line) error { return nil })
+	if err == nil || err.Error() != "logs are not supported by this daemon" {
+		t.Fatalf("expected unsupported error, got %v", err)
+	}
+}
+
+type fakeUpgrader struct {
+	prepareErr error
+	upgraded   chan *os.File
+}
+
+func (f *fakeUpgrader) PrepareUpgrade() (string, error) {
+	return "2.0.0", f.prepareErr
+}
+
+func (f *fakeUpgrader) Upgrade(listener *os.File) error {
+	f.upgraded <- listener
+	return errors.New("exec failed")
+}
+
+func TestServerUpgrade(t *testing.T) {
+	tests := []struct {
+		name      string
+		upgrader  *fakeUpgrader
+		wantError string
+		wantCode  string
+	}{
+		{name: "unsupported", wantError: "upgrade is not supported by this daemon", wantCode: CodeUnsupported},
+		{name: "broken binary", upgrader: &fakeUpgrader{prepareErr: errors.New("new binary does not run")}, wantError: "new binary does not run", wantCode: CodeFailed},
+		{name: "upgrade", upgrader: &fakeUpgrader{upgraded: make(chan *os.File, 1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := Paths{SocketFile: filepath.Join(t.TempDir(), "tunn.sock")}
+			s := NewServer(paths, status.NewStore(), 7, nil)
+			if tt.upgrader != nil {
+				s.SetUpgrader(tt.upgrader)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go s.Run(ctx)
+			if err := WaitForSocket(paths, time.Second); err != nil {
+				t.Fatalf("socket not ready: %v", err)
+			}
+
+			resp, err := SendUpgrade(ctx, paths)
+			if err != nil {
+				t.Fatalf("SendUpgrade failed: %v", err)
+			}
+			if resp.Error != tt.wantError || resp.Code != tt.wantCode {
+				t.Fatalf("expected error %q (%s), got %q (%s)", tt.wantError, tt.wantCode, resp.Error, resp.Code)
+			}
+			if tt.wantError != "" {
+				return
+			}
+			if resp.Message != "2.0.0" {
+				t.Fatalf("expected the new version, got %q", resp.Message)
+			}
+			select {
+			case listener := <-tt.upgrader.upgraded:
+				if listener == nil {
+					t.Fatal("expected the control socket to be handed over")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expected the daemon to upgrade")
+			}
+
+			// A failed upgrade leaves the daemon serving.
+			if _, err := QueryStatus(ctx, paths); err != nil {
+				t.Fatalf("expected the daemon to keep serving, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SupervisorEnv names the environment variable set for a daemon started by
+// a supervisor, holding the supervisor's pid.
+const SupervisorEnv = "TUNN_SUPERVISOR"
+
+// MaxCrashes bounds how many crashes a supervisor remembers.
+const MaxCrashes = 10
+
+// Crash records an abnormal exit of a supervised daemon.
+type Crash struct {
+	Time time.Time `json:"time"`
+	// Reason is how the process ended, such as "exit status 2" or
+	// "signal: killed".
+	Reason string `json:"reason"`
+	// Message is the panic or fatal error the daemon logged, if any.
+	Message string `json:"message,omitempty"`
+}
+
+func (c Crash) String() string {
+	text := c.Time.Local().Format("2006-01-02 15:04:05") + ": " + c.Reason
+	if c.Message != "" {
+		text += " (" + c.Message + ")"
+	}
+	return text
+}
+
+// Supervision is the state a supervisor shares through the runtime
+// directory.
+type Supervision struct {
+	PID int `json:"pid"`
+	// Restarts counts the times the daemon was started again after a crash.
+	Restarts int `json:"restarts"`
+	// Crashes holds the most recent crashes, oldest first.
+	Crashes []Crash `json:"crashes,omitempty"`
+	// NextStart is set while the supervisor waits to restart the daemon.
+	NextStart time.Time `json:"next_start,omitzero"`
+	// GaveUp is set once the supervisor stopped restarting a daemon that
+	// kept crashing. The state outlives the supervisor then, so that tunn
+	// status can report it.
+	GaveUp time.Time `json:"gave_up,omitzero"`
+}
+
+// Record appends a crash, dropping the oldest beyond MaxCrashes.
+func (s *Supervision) Record(crash Crash) {
+	s.Crashes = append(s.Crashes, crash)
+	if len(s.Crashes) > MaxCrashes {
+		s.Crashes = s.Crashes[len(s.Crashes)-MaxCrashes:]
+	}
+}
+
+// CrashesSince counts the recorded crashes at or after t.
+func (s *Supervision) CrashesSince(t time.Time) int {
+	n := 0
+	for _, crash := range s.Crashes {
+		if !crash.Time.Before(t) {
+			n++
+		}
+	}
+	return n
+}
+
+// LastCrash returns the most recent crash, if any.
+func (s *Supervision) LastCrash() (Crash, bool) {
+	if len(s.Crashes) == 0 {
+		return Crash{}, false
+	}
+	return s.Crashes[len(s.Crashes)-1], true
+}
+
+// ReadSupervision loads the supervisor state. It returns nil when no
+// supervisor is running, unless it gave up on the daemon.
+func ReadSupervision(paths Paths) (*Supervision, error) {
+	data, err := os.ReadFile(paths.SupervisorFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read supervisor state: %w", err)
+	}
+	var state Supervision
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid supervisor state: %w", err)
+	}
+	if state.GaveUp.IsZero() && !isProcessRunning(state.PID) {
+		_ = os.Remove(paths.SupervisorFile)
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// WriteSupervision persists the supervisor state.
+func WriteSupervision(paths Paths, state *Supervision) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode supervisor state: %w", err)
+	}
+	tmp := paths.SupervisorFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write supervisor state: %w", err)
+	}
+	if err := os.Rename(tmp, paths.SupervisorFile); err != nil {
+		return fmt.Errorf("failed to write supervisor state: %w", err)
+	}
+	return nil
+}
+
+// RemoveSupervision clears the supervisor state.
+func RemoveSupervision(paths Paths) error {
+	if err := os.Remove(paths.SupervisorFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove supervisor state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+//go:build unix
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSupervisionRecord(t *testing.T) {
+	var state Supervision
+	if _, ok := state.LastCrash(); ok {
+		t.Fatalf("expected no crash before any was recorded")
+	}
+
+	for i := range MaxCrashes + 3 {
+		state.Record(Crash{Reason: "exit status " + strconv.Itoa(i)})
+	}
+	if len(state.Crashes) != MaxCrashes {
+		t.Fatalf("expected %d crashes, got %d", MaxCrashes, len(state.Crashes))
+	}
+	if state.Crashes[0].Reason != "exit status 3" {
+		t.Fatalf("expected the oldest crashes to be dropped, first is %q", state.Crashes[0].Reason)
+	}
+	last, ok := state.LastCrash()
+	if !ok || last.Reason != "exit status 12" {
+		t.Fatalf("unexpected last crash: %+v", last)
+	}
+}
+
+func TestCrashString(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		name  string
+		crash Crash
+		want  string
+	}{
+		{
+			name:  "reason only",
+			crash: Crash{Time: at, Reason: "signal: killed"},
+			want:  "2024-05-01 10:30:00: signal: killed",
+		},
+		{
+			name:  "with message",
+			crash: Crash{Time: at, Reason: "exit status 2", Message: "panic: boom"},
+			want:  "2024-05-01 10:30:00: exit status 2 (panic: boom)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.crash.String(); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSupervisionLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	paths := Paths{
+		RuntimeDir:     dir,
+		SupervisorFile: filepath.Join(dir, "supervisor.json"),
+	}
+
+	if state, err := ReadSupervision(paths); err != nil || state != nil {
+		t.Fatalf("expected no supervisor, got %+v (%v)", state, err)
+	}
+
+	next := time.Now().Add(time.Minute).Truncate(time.Second)
+	state := &Supervision{PID: os.Getpid(), Restarts: 1, NextStart: next}
+	state.Record(Crash{Time: time.Now(), Reason: "signal: killed"})
+	if err := WriteSupervision(paths, state); err != nil {
+		t.Fatalf("WriteSupervision failed: %v", err)
+	}
+
+	got, err := ReadSupervision(paths)
+	if err != nil {
+		t.Fatalf("ReadSupervision failed: %v", err)
+	}
+	if got == nil || got.PID != os.Getpid() || got.Restarts != 1 || len(got.Crashes) != 1 {
+		t.Fatalf("unexpected supervisor state: %+v", got)
+	}
+	if !got.NextStart.Equal(next) {
+		t.Fatalf("expected next start %v, got %v", next, got.NextStart)
+	}
+
+	if err := RemoveSupervision(paths); err != nil {
+		t.Fatalf("RemoveSupervision failed: %v", err)
+	}
+	if err := RemoveSupervision(paths); err != nil {
+		t.Fatalf("RemoveSupervision should ignore a missing file: %v", err)
+	}
+}
+
+func TestReadSupervisionStale(t *testing.T) {
+	dir := t.TempDir()
+	paths := Paths{
+		RuntimeDir:     dir,
+		SupervisorFile: filepath.Join(dir, "supervisor.json"),
+	}
+
+	if err := WriteSupervision(paths, &Supervision{PID: 999999}); err != nil {
+		t.Fatalf("WriteSupervision failed: %v", err)
+	}
+	state, err := ReadSupervision(paths)
+	if err != nil || state != nil {
+		t.Fatalf("expected a stale supervisor to be ignored, got %+v (%v)", state, err)
+	}
+	if _, err := os.Stat(paths.SupervisorFile); !os.IsNotExist(err) {
+		t.Fatalf("expected stale supervisor state to be removed, got %v", err)
+	}
+}
+
+func TestSupervisionGaveUp(t *testing.T) {
+	dir := t.TempDir()
+	paths := Paths{
+		RuntimeDir:     dir,
+		SupervisorFile: filepath.Join(dir, "supervisor.json"),
+	}
+
+	now := time.Now()
+	state := &Supervision{PID: 999999, Restarts: 4, GaveUp: now}
+	for _, ago := range []time.Duration{time.Hour, 3 * time.Minute, 2 * time.Minute, time.Minute} {
+		state.Record(Crash{Time: now.Add(-ago), Reason: "exit status 2"})
+	}
+	if got := state.CrashesSince(now.Add(-10 * time.Minute)); got != 3 {
+		t.Fatalf("expected 3 crashes in the last ten minutes, got %d", got)
+	}
+
+	if err := WriteSupervision(paths, state); err != nil {
+		t.Fatalf("WriteSupervision failed: %v", err)
+	}
+	got, err := ReadSupervision(paths)
+	if err != nil || got == nil || !got.GaveUp.Equal(now) {
+		t.Fatalf("expected the state of a supervisor that gave up to be kept, got %+v (%v)", got, err)
+	}
+}
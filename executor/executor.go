@@ -3,13 +3,17 @@ package executor
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/inherit"
 )
 
 type SSHExecutor interface {
@@ -18,25 +22,62 @@ type SSHExecutor interface {
 
 type RealSSHExecutor struct {
 	OnStatusChange func(tunnelName string, port string, status string)
+	// Output, when set, returns where the stdout and stderr of the ssh
+	// process for a tunnel port go. The writer is closed once ssh exits.
+	Output func(tunnelName string, port string) io.WriteCloser
+
+	mu sync.Mutex
+	// running holds the live ssh processes by tunnel and port mapping, and
+	// adopting the processes handed over by a previous daemon that no
+	// tunnel has claimed yet.
+	running  map[string]*sshProcess
+	adopting map[string]Child
+}
+
+// Child describes a running ssh process handed from a daemon to the binary
+// it re-executes, which inherits the process and its output pipe.
+type Child struct {
+	Tunnel string   `json:"tunnel"`
+	Port   string   `json:"port"`
+	Args   []string `json:"args"`
+	PID    int      `json:"pid"`
+	// Output is the inherited descriptor of the pipe carrying the output of
+	// ssh, or zero.
+	Output int `json:"output,omitempty"`
+}
+
+// sshProcess is a running ssh forward, started by the executor or adopted
+// from a previous daemon.
+type sshProcess struct {
+	process *os.Process
+	args    []string
+	// output is the read end of the pipe ssh writes to, and copied is
+	// closed once it has been drained.
+	output *os.File
+	copied chan struct{}
+	// done is closed once the process exited, with state and err set.
+	done  chan struct{}
+	state *os.ProcessState
+	err   error
 }
 
 func (e *RealSSHExecutor) Execute(ctx context.Context, name string, tunnel config.Tunnel) error {
 	var wg sync.WaitGroup
 
 	// Update all ports to connecting status synchronously
-	for _, portMapping := range tunnel.Ports {
+	for _, port := range tunnel.Ports {
 		if e.OnStatusChange != nil {
-			e.OnStatusChange(name, portMapping, "connecting")
+			e.OnStatusChange(name, port.Mapping(), "connecting")
 		}
 	}
 
 	// Start SSH processes for each port
-	for _, portMapping := range tunnel.Ports {
+	for _, port := range tunnel.Ports {
 		wg.Add(1)
-		go func(port string) {
+		go func(port config.Port) {
 			defer wg.Done()
 			e.executePortSSH(ctx, name, tunnel, port)
-		}(portMapping)
+		}(port)
 	}
 
 	// Wait for context cancellation (tunnels run until cancelled)
@@ -45,13 +86,11 @@ func (e *RealSSHExecutor) Execute(ctx context.Context, name string, tunnel confi
 	return ctx.Err()
 }
 
-func (e *RealSSHExecutor) executePortSSH(ctx context.Context, tunnelName string, tunnel config.Tunnel, portMapping string) error {
-	// Build SSH command for this specific port
+// SSHArgs returns the arguments passed to ssh to establish a single forward
+// of the tunnel.
+func SSHArgs(tunnel config.Tunnel, port config.Port) []string {
 	args := []string{"-N"}
-
-	ports := expandPort(portMapping, ":")
-	local, remote := ports[0], ports[1]
-	args = append(args, "-L", fmt.Sprintf("%s:localhost:%s", local, remote))
+	args = append(args, port.SSHFlag(), port.ForwardSpec())
 
 	if tunnel.IdentityFile != "" {
 		args = append(args, "-i", os.ExpandEnv(tunnel.IdentityFile))
@@ -61,20 +100,54 @@ func (e *RealSSHExecutor) executePortSSH(ctx context.Context, tunnelName string,
 		args = append(args, "-l", tunnel.User)
 	}
 
-	args = append(args, tunnel.Host)
+	return append(args, tunnel.Host)
+}
 
-	cmd := exec.Command("ssh", args...)
+func (e *RealSSHExecutor) executePortSSH(ctx context.Context, tunnelName string, tunnel config.Tunnel, port config.Port) error {
+	portMapping := port.Mapping()
+	key := tunnelName + "/" + portMapping
 
-	// Start the SSH command
-	if err := cmd.Start(); err != nil {
-		if e.OnStatusChange != nil {
-			e.OnStatusChange(tunnelName, portMapping, fmt.Sprintf("error - %s", err.Error()))
+	args := SSHArgs(tunnel, port)
+	var out io.WriteCloser
+	if e.Output != nil {
+		out = e.Output(tunnelName, portMapping)
+		defer out.Close()
+	}
+
+	proc, adopted := e.claim(key, args, out)
+	if adopted {
+		if out != nil {
+			fmt.Fprintf(out, "tunn: adopted ssh (pid %d) from the previous daemon\n", proc.process.Pid)
+		}
+	} else {
+		if out != nil {
+			fmt.Fprintf(out, "tunn: running ssh %s\n", strings.Join(args, " "))
+		}
+		var err error
+		proc, err = startSSH(args, out)
+		if err != nil {
+			if e.OnStatusChange != nil {
+				e.OnStatusChange(tunnelName, portMapping, fmt.Sprintf("error - %s", err.Error()))
+			}
+			return err
 		}
-		return err
 	}
 
+	e.track(key, proc)
+	defer e.untrack(key, proc)
+	defer func() {
+		proc.drain()
+		if out != nil && proc.state != nil {
+			fmt.Fprintf(out, "tunn: ssh exited (%s)\n", proc.state)
+		}
+	}()
+
 	activeTimer := time.NewTimer(500 * time.Millisecond)
 	activeC := activeTimer.C
+	if adopted {
+		// The forward has been up since before the upgrade.
+		activeTimer.Reset(0)
+	}
 
 	stopActiveTimer := func() {
 		if activeC == nil {
@@ -89,11 +162,6 @@ func (e *RealSSHExecutor) executePortSSH(ctx context.Context, tunnelName string,
 		activeC = nil
 	}
 
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
-
 	for {
 		select {
 		case <-activeC:
@@ -101,13 +169,13 @@ func (e *RealSSHExecutor) executePortSSH(ctx context.Context, tunnelName string,
 				e.OnStatusChange(tunnelName, portMapping, "active")
 			}
 			activeC = nil
-		case err := <-done:
+		case <-proc.done:
 			stopActiveTimer()
-			if err != nil {
+			if proc.err != nil {
 				if e.OnStatusChange != nil {
-					e.OnStatusChange(tunnelName, portMapping, fmt.Sprintf("error - %s", err.Error()))
+					e.OnStatusChange(tunnelName, portMapping, fmt.Sprintf("error - %s", proc.err.Error()))
 				}
-				return err
+				return proc.err
 			}
 			if e.OnStatusChange != nil {
 				e.OnStatusChange(tunnelName, portMapping, "stopped")
@@ -118,16 +186,12 @@ func (e *RealSSHExecutor) executePortSSH(ctx context.Context, tunnelName string,
 			if e.OnStatusChange != nil {
 				e.OnStatusChange(tunnelName, portMapping, "stopping")
 			}
-			if cmd.Process != nil {
-				_ = cmd.Process.Signal(os.Interrupt)
-			}
+			_ = proc.process.Signal(os.Interrupt)
 			select {
-			case <-done:
+			case <-proc.done:
 			case <-time.After(2 * time.Second):
-				if cmd.Process != nil {
-					_ = cmd.Process.Kill()
-				}
-				<-done
+				_ = proc.process.Kill()
+				<-proc.done
 			}
 			if e.OnStatusChange != nil {
 				e.OnStatusChange(tunnelName, portMapping, "stopped")
@@ -137,25 +201,231 @@ func (e *RealSSHExecutor) executePortSSH(ctx context.Context, tunnelName string,
 	}
 }
 
-func expandPort(mapping string, sep string) []string {
-	parts := strings.Split(mapping, sep)
-	if len(parts) == 1 {
-		return []string{parts[0], parts[0]}
+// startSSH starts ssh with args. Its output goes to out through a pipe the
+// executor owns, so that the pipe can be handed over on upgrade.
+func startSSH(args []string, out io.Writer) (*sshProcess, error) {
+	cmd := exec.Command("ssh", args...)
+	var output *os.File
+	if out != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output pipe: %w", err)
+		}
+		cmd.Stdout, cmd.Stderr = w, w
+		err = cmd.Start()
+		w.Close()
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		output = r
+	} else if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	proc := &sshProcess{process: cmd.Process, args: args, output: output, done: make(chan struct{})}
+	proc.copy(out)
+	go func() {
+		proc.err = cmd.Wait()
+		proc.state = cmd.ProcessState
+		close(proc.done)
+	}()
+	return proc, nil
+}
+
+// adoptSSH takes over a process handed over by a previous daemon, which is
+// still a child of this process since the daemon re-executed in place.
+func adoptSSH(child Child, out io.Writer) (*sshProcess, error) {
+	process, err := os.FindProcess(child.PID)
+	if err != nil {
+		return nil, err
+	}
+	proc := &sshProcess{process: process, args: child.Args, done: make(chan struct{})}
+	if child.Output > 0 {
+		proc.output = os.NewFile(uintptr(child.Output), "ssh output")
+	}
+	proc.copy(out)
+	go func() {
+		proc.state, proc.err = process.Wait()
+		if proc.err == nil && !proc.state.Success() {
+			proc.err = &exec.ExitError{ProcessState: proc.state}
+		}
+		close(proc.done)
+	}()
+	return proc, nil
+}
+
+// copy forwards the output of the process to out, discarding it when out is
+// nil so that ssh never blocks on a full pipe.
+func (p *sshProcess) copy(out io.Writer) {
+	p.copied = make(chan struct{})
+	if p.output == nil {
+		close(p.copied)
+		return
+	}
+	if out == nil {
+		out = io.Discard
+	}
+	go func() {
+		defer close(p.copied)
+		_, _ = io.Copy(out, p.output)
+	}()
+}
+
+// drain waits for the output of an exited process, but not forever for
+// processes ssh left behind that still hold the pipe.
+func (p *sshProcess) drain() {
+	if p.output == nil {
+		return
+	}
+	select {
+	case <-p.copied:
+	case <-time.After(time.Second):
+	}
+	p.output.Close()
+	<-p.copied
+}
+
+func (e *RealSSHExecutor) track(key string, proc *sshProcess) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running == nil {
+		e.running = make(map[string]*sshProcess)
+	}
+	e.running[key] = proc
+}
+
+func (e *RealSSHExecutor) untrack(key string, proc *sshProcess) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running[key] == proc {
+		delete(e.running, key)
+	}
+}
+
+// Adopt registers the processes handed over by a previous daemon. A tunnel
+// port started with the same ssh arguments takes over its process instead of
+// starting ssh again. Their output pipes are closed on exec right away.
+func (e *RealSSHExecutor) Adopt(children []Child) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.adopting == nil {
+		e.adopting = make(map[string]Child)
+	}
+	for _, child := range children {
+		if child.Output > 0 {
+			inherit.CloseOnExec(child.Output)
+		}
+		e.adopting[child.Tunnel+"/"+child.Port] = child
+	}
+}
+
+// Adopting reports whether pid is a handed over process that no tunnel has
+// claimed yet. Such processes still hold their local ports.
+func (e *RealSSHExecutor) Adopting(pid int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, child := range e.adopting {
+		if child.PID == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// claim returns the handed over process for a tunnel port when it was started
+// with args.
+func (e *RealSSHExecutor) claim(key string, args []string, out io.Writer) (*sshProcess, bool) {
+	e.mu.Lock()
+	child, ok := e.adopting[key]
+	delete(e.adopting, key)
+	e.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	proc, err := adoptSSH(child, out)
+	if err != nil {
+		return nil, false
+	}
+	if !slices.Equal(child.Args, args) {
+		stopAdopted(proc)
+		return nil, false
+	}
+	return proc, true
+}
+
+// ReleaseAdopted stops the handed over processes no tunnel claimed, and
+// returns how many there were.
+func (e *RealSSHExecutor) ReleaseAdopted() int {
+	e.mu.Lock()
+	children := e.adopting
+	e.adopting = nil
+	e.mu.Unlock()
+
+	for _, child := range children {
+		if proc, err := adoptSSH(child, nil); err == nil {
+			stopAdopted(proc)
+		}
+	}
+	return len(children)
+}
+
+// stopAdopted interrupts an adopted process and reaps it.
+func stopAdopted(proc *sshProcess) {
+	_ = proc.process.Signal(os.Interrupt)
+	select {
+	case <-proc.done:
+	case <-time.After(2 * time.Second):
+		_ = proc.process.Kill()
+		<-proc.done
+	}
+	proc.drain()
+}
+
+// Handover lists the running ssh processes for a new binary to adopt, along
+// with the output pipes it needs to inherit.
+func (e *RealSSHExecutor) Handover() ([]Child, []*os.File) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	keys := make([]string, 0, len(e.running))
+	for key := range e.running {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var children []Child
+	var files []*os.File
+	for _, key := range keys {
+		proc := e.running[key]
+		select {
+		case <-proc.done:
+			continue
+		default:
+		}
+		tunnel, port, _ := strings.Cut(key, "/")
+		child := Child{Tunnel: tunnel, Port: port, Args: proc.args, PID: proc.process.Pid}
+		if proc.output != nil {
+			if fd, err := inherit.Descriptor(proc.output); err == nil {
+				child.Output = fd
+				files = append(files, proc.output)
+			}
+		}
+		children = append(children, child)
 	}
-	return parts[:2]
+	return children, files
 }
 
 type MockSSHExecutor struct {
 	Commands       [][]string
 	OnStatusChange func(tunnelName string, port string, status string)
+	mu             sync.Mutex
 }
 
 func (m *MockSSHExecutor) Execute(ctx context.Context, name string, tunnel config.Tunnel) error {
 	args := []string{"ssh", "-N"}
-	for _, portMapping := range tunnel.Ports {
-		ports := expandPort(portMapping, ":")
-		local, remote := ports[0], ports[1]
-		args = append(args, "-L", fmt.Sprintf("%s:localhost:%s", local, remote))
+	for _, port := range tunnel.Ports {
+		args = append(args, port.SSHFlag(), port.ForwardSpec())
 	}
 
 	if tunnel.IdentityFile != "" {
@@ -167,12 +437,14 @@ func (m *MockSSHExecutor) Execute(ctx context.Context, name string, tunnel confi
 	}
 
 	args = append(args, tunnel.Host)
+	m.mu.Lock()
 	m.Commands = append(m.Commands, args)
+	m.mu.Unlock()
 
 	if m.OnStatusChange != nil {
-		for _, portMapping := range tunnel.Ports {
-			m.OnStatusChange(name, portMapping, "connecting")
-			m.OnStatusChange(name, portMapping, "active")
+		for _, port := range tunnel.Ports {
+			m.OnStatusChange(name, port.Mapping(), "connecting")
+			m.OnStatusChange(name, port.Mapping(), "active")
 		}
 	}
 
@@ -14,7 +14,7 @@ func TestMockSSHExecutor(t *testing.T) {
 
 	tunnel := config.Tunnel{
 		Host:  "testserver",
-		Ports: []string{"8080:8080", "9090:9091"},
+		Ports: []config.Port{{Local: "8080", Remote: "8080"}, {Local: "9090", Remote: "9091"}},
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
@@ -54,7 +54,7 @@ func TestMockSSHExecutorWithIdentityFile(t *testing.T) {
 
 	tunnel := config.Tunnel{
 		Host:         "testserver",
-		Ports:        []string{"8080:8080"},
+		Ports:        []config.Port{{Local: "8080", Remote: "8080"}},
 		IdentityFile: "~/.ssh/custom_key",
 	}
 
@@ -108,7 +108,7 @@ func TestMockSSHExecutorStatusCallbacks(t *testing.T) {
 
 	tunnel := config.Tunnel{
 		Host:  "testserver",
-		Ports: []string{"8080:8080", "9090:9091"},
+		Ports: []config.Port{{Local: "8080", Remote: "8080"}, {Local: "9090", Remote: "9091"}},
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
@@ -129,24 +129,20 @@ func TestMockSSHExecutorStatusCallbacks(t *testing.T) {
 	}
 }
 
-func TestExpandPort(t *testing.T) {
+func TestSSHArgs(t *testing.T) {
+	tunnel := config.Tunnel{Host: "bastion", User: "deploy", IdentityFile: "/keys/id"}
 	tests := []struct {
-		input    string
-		expected []string
+		port config.Port
+		want string
 	}{
-		{"8080:8081", []string{"8080", "8081"}},
-		{"3000", []string{"3000", "3000"}},
-		{"5432:5433", []string{"5432", "5433"}},
+		{config.Port{Local: "5432", Remote: "5432"}, "-N -L 5432:localhost:5432 -i /keys/id -l deploy bastion"},
+		{config.Port{Local: "3000", Remote: "8080", Forward: config.ForwardRemote}, "-N -R 8080:localhost:3000 -i /keys/id -l deploy bastion"},
+		{config.Port{Local: "1080", Forward: config.ForwardDynamic}, "-N -D 1080 -i /keys/id -l deploy bastion"},
 	}
 
 	for _, tt := range tests {
-		result := expandPort(tt.input, ":")
-		if len(result) != 2 {
-			t.Errorf("Expected 2 elements, got %d", len(result))
-			continue
-		}
-		if result[0] != tt.expected[0] || result[1] != tt.expected[1] {
-			t.Errorf("For %s: expected %v, got %v", tt.input, tt.expected, result)
+		if got := strings.Join(SSHArgs(tunnel, tt.port), " "); got != tt.want {
+			t.Errorf("got %q want %q", got, tt.want)
 		}
 	}
-}
\ No newline at end of file
+}
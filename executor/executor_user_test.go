@@ -14,7 +14,7 @@ func TestMockSSHExecutorWithUser(t *testing.T) {
 
 	tunnel := config.Tunnel{
 		Host:  "testserver",
-		Ports: []string{"8080:8080"},
+		Ports: []config.Port{{Local: "8080", Remote: "8080"}},
 		User:  "testuser",
 	}
 
@@ -54,7 +54,7 @@ func TestMockSSHExecutorWithUserAndIdentityFile(t *testing.T) {
 
 	tunnel := config.Tunnel{
 		Host:         "testserver",
-		Ports:        []string{"8080:8080"},
+		Ports:        []config.Port{{Local: "8080", Remote: "8080"}},
 		User:         "deployuser",
 		IdentityFile: "~/.ssh/deploy_key",
 	}
@@ -102,4 +102,4 @@ func TestMockSSHExecutorWithUserAndIdentityFile(t *testing.T) {
 	if !foundIdentity {
 		t.Error("Command should contain the identity file parameter")
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,116 @@
+//go:build unix
+
+package executor
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/strandnerd/tunn/config"
+)
+
+// syncBuffer collects the output of the fake ssh.
+type syncBuffer struct {
+	mu *sync.Mutex
+	b  *strings.Builder
+}
+
+func (n syncBuffer) Write(p []byte) (int, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.b.Write(p)
+}
+
+func (n syncBuffer) Close() error { return nil }
+
+func TestRealSSHExecutorHandover(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho forwarding\nexec sleep 30\n"
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var mu sync.Mutex
+	var output strings.Builder
+	active := make(chan struct{}, 1)
+	exec := &RealSSHExecutor{
+		Output: func(string, string) io.WriteCloser { return syncBuffer{&mu, &output} },
+		OnStatusChange: func(_, _, status string) {
+			if status == "active" {
+				active <- struct{}{}
+			}
+		},
+	}
+
+	tunnel := config.Tunnel{Host: "server1", Ports: []config.Port{{Local: "8080", Remote: "80"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- exec.Execute(ctx, "web", tunnel)
+	}()
+	select {
+	case <-active:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ssh did not become active")
+	}
+
+	children, files := exec.Handover()
+	if len(children) != 1 || len(files) != 1 {
+		t.Fatalf("expected one child with its output pipe, got %+v and %d files", children, len(files))
+	}
+	child := children[0]
+	if child.Tunnel != "web" || child.Port != "8080:80" || child.PID <= 0 || child.Output <= 0 {
+		t.Fatalf("unexpected child %+v", child)
+	}
+	if !slices.Equal(child.Args, SSHArgs(tunnel, tunnel.Ports[0])) {
+		t.Fatalf("unexpected args %v", child.Args)
+	}
+
+	// The previous daemon clears the close-on-exec flag to pass the pipe on.
+	setCloseOnExec(t, child.Output, false)
+	next := &RealSSHExecutor{}
+	next.Adopt(children)
+	if !closeOnExec(t, child.Output) {
+		t.Fatal("expected the adopted output pipe to be closed on exec again")
+	}
+	if !next.Adopting(child.PID) || next.Adopting(child.PID+1) {
+		t.Fatal("expected only the handed over process to be adopted")
+	}
+
+	cancel()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.Contains(output.String(), "forwarding") {
+		t.Fatalf("expected the ssh output to be captured, got %q", output.String())
+	}
+}
+
+func closeOnExec(t *testing.T, fd int) bool {
+	t.Helper()
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0)
+	if errno != 0 {
+		t.Fatalf("failed to read the flags of descriptor %d: %v", fd, errno)
+	}
+	return flags&syscall.FD_CLOEXEC != 0
+}
+
+func setCloseOnExec(t *testing.T, fd int, on bool) {
+	t.Helper()
+	flag := uintptr(0)
+	if on {
+		flag = syscall.FD_CLOEXEC
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_SETFD, flag); errno != 0 {
+		t.Fatalf("failed to set the flags of descriptor %d: %v", fd, errno)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/export"
+	"github.com/strandnerd/tunn/sshconfig"
+)
+
+func runExportCommand(opts *cli.Options) error {
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	tunnels, err := selectTunnels(cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	format := opts.ExportFormat
+	if format == "" {
+		format = export.FormatSSHConfig
+	}
+
+	exportOpts := export.Options{
+		Source:  tildePath(cfg.Path),
+		Profile: cfg.Profile,
+	}
+	// Host aliases are resolved on a best-effort basis; a missing or
+	// unreadable ssh config simply leaves the aliases as they are.
+	if sshPath, err := sshconfig.DefaultPath(); err == nil {
+		if sshCfg, err := sshconfig.ParseFile(sshPath); err == nil {
+			exportOpts.SSH = sshCfg
+		}
+	}
+
+	return export.Write(os.Stdout, format, tunnels, exportOpts)
+}
+
+// tildePath abbreviates the home directory in path for display.
+func tildePath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+	if rel, ok := strings.CutPrefix(path, home+string(filepath.Separator)); ok {
+		return "~/" + rel
+	}
+	return path
+}
@@ -0,0 +1,261 @@
+// Package export renders resolved tunnels for environments where tunn itself
+// is not installed.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/executor"
+	"github.com/strandnerd/tunn/sshconfig"
+)
+
+// Supported output formats.
+const (
+	FormatSSHConfig = "ssh-config"
+	FormatShell     = "shell"
+	FormatJSON      = "json"
+)
+
+// Formats lists the accepted values for --format.
+var Formats = []string{FormatSSHConfig, FormatShell, FormatJSON}
+
+// Options carries context that is rendered alongside the tunnels.
+type Options struct {
+	// Source is the configuration file the tunnels were loaded from.
+	Source string
+	// Profile is the applied configuration profile, if any.
+	Profile string
+	// SSH resolves Host aliases so ssh_config output works on machines
+	// without the same aliases. It may be nil.
+	SSH *sshconfig.Config
+}
+
+// Write renders tunnels in the requested format.
+func Write(w io.Writer, format string, tunnels map[string]config.Tunnel, opts Options) error {
+	for _, name := range sortedNames(tunnels) {
+		for _, port := range tunnels[name].Ports {
+			if port.IsAuto() {
+				return fmt.Errorf("cannot export %s port %s: automatic local ports are only assigned by a running tunn", name, port.Mapping())
+			}
+		}
+	}
+	switch format {
+	case FormatSSHConfig:
+		return writeSSHConfig(w, tunnels, opts)
+	case FormatShell:
+		return writeShell(w, tunnels, opts)
+	case FormatJSON:
+		return writeJSON(w, tunnels, opts)
+	default:
+		return fmt.Errorf("unknown export format %q (expected %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+func writeSSHConfig(w io.Writer, tunnels map[string]config.Tunnel, opts Options) error {
+	var b strings.Builder
+	writeHeader(&b, opts)
+	for _, name := range sortedNames(tunnels) {
+		tunnel := tunnels[name]
+		alias := "tunn-" + name
+
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "# Start with: ssh -N %s\n", alias)
+		fmt.Fprintf(&b, "Host %s\n", alias)
+		fmt.Fprintf(&b, "  HostName %s\n", resolveOption(opts.SSH, tunnel.Host, "hostname", tunnel.Host))
+		if port := resolveOption(opts.SSH, tunnel.Host, "port", ""); port != "" {
+			fmt.Fprintf(&b, "  Port %s\n", port)
+		}
+		if user := resolveOption(opts.SSH, tunnel.Host, "user", tunnel.User); user != "" {
+			fmt.Fprintf(&b, "  User %s\n", user)
+		}
+		if identity := resolveOption(opts.SSH, tunnel.Host, "identityfile", tunnel.IdentityFile); identity != "" {
+			fmt.Fprintf(&b, "  IdentityFile %s\n", sshQuote(identity))
+		}
+		if jump := resolveOption(opts.SSH, tunnel.Host, "proxyjump", ""); jump != "" {
+			fmt.Fprintf(&b, "  ProxyJump %s\n", jump)
+		}
+		b.WriteString("  ExitOnForwardFailure yes\n")
+		for _, port := range tunnel.Ports {
+			fmt.Fprintf(&b, "  %s\n", sshConfigForward(port))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// resolveOption prefers the tunnel's own value and falls back to the alias's
+// ssh config. The host name is always taken from ssh config when the alias
+// defines one, since the alias itself may not exist elsewhere.
+func resolveOption(ssh *sshconfig.Config, alias, keyword, explicit string) string {
+	if keyword != "hostname" && explicit != "" {
+		return explicit
+	}
+	if ssh != nil {
+		if host := ssh.Lookup(alias); host != nil {
+			if value := host.Get(keyword); value != "" {
+				return value
+			}
+		}
+	}
+	return explicit
+}
+
+func sshConfigForward(port config.Port) string {
+	listen := port.Local
+	if port.ForwardType() == config.ForwardRemote {
+		listen = port.RemotePort()
+	}
+	if port.Bind != "" {
+		listen = port.Bind + ":" + listen
+	}
+
+	switch port.ForwardType() {
+	case config.ForwardDynamic:
+		return "DynamicForward " + listen
+	case config.ForwardRemote:
+		return fmt.Sprintf("RemoteForward %s %s:%s", listen, port.Target(), port.Local)
+	}
+	return fmt.Sprintf("LocalForward %s %s:%s", listen, port.Target(), port.RemotePort())
+}
+
+// sshQuote double-quotes ssh_config arguments containing whitespace.
+func sshQuote(arg string) string {
+	if strings.ContainsAny(arg, " \t") {
+		return `"` + arg + `"`
+	}
+	return arg
+}
+
+func writeShell(w io.Writer, tunnels map[string]config.Tunnel, opts Options) error {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	writeHeader(&b, opts)
+	b.WriteString("# Each forward runs in its own ssh process, as tunn does.\n")
+	b.WriteString("\n")
+	b.WriteString("trap 'kill $(jobs -p) 2>/dev/null' INT TERM EXIT\n")
+	for _, name := range sortedNames(tunnels) {
+		tunnel := tunnels[name]
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "# %s\n", name)
+		for _, port := range tunnel.Ports {
+			args := append([]string{"ssh"}, executor.SSHArgs(tunnel, port)...)
+			quoted := make([]string, len(args))
+			for i, arg := range args {
+				quoted[i] = shellQuote(arg)
+			}
+			fmt.Fprintf(&b, "%s &\n", strings.Join(quoted, " "))
+		}
+	}
+	b.WriteString("\nwait\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type jsonExport struct {
+	Source  string                `json:"source,omitempty"`
+	Profile string                `json:"profile,omitempty"`
+	Tunnels map[string]jsonTunnel `json:"tunnels"`
+}
+
+type jsonTunnel struct {
+	Host         string     `json:"host"`
+	User         string     `json:"user,omitempty"`
+	IdentityFile string     `json:"identity_file,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	Ports        []jsonPort `json:"ports"`
+}
+
+type jsonPort struct {
+	Mapping    string   `json:"mapping"`
+	Forward    string   `json:"forward"`
+	Local      string   `json:"local"`
+	Remote     string   `json:"remote,omitempty"`
+	TargetHost string   `json:"target_host,omitempty"`
+	Bind       string   `json:"bind,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	Command    []string `json:"command"`
+}
+
+func writeJSON(w io.Writer, tunnels map[string]config.Tunnel, opts Options) error {
+	out := jsonExport{
+		Source:  opts.Source,
+		Profile: opts.Profile,
+		Tunnels: make(map[string]jsonTunnel, len(tunnels)),
+	}
+	for name, tunnel := range tunnels {
+		entry := jsonTunnel{
+			Host:         tunnel.Host,
+			User:         tunnel.User,
+			IdentityFile: tunnel.IdentityFile,
+			Tags:         tunnel.Tags,
+			Ports:        make([]jsonPort, 0, len(tunnel.Ports)),
+		}
+		for _, port := range tunnel.Ports {
+			jp := jsonPort{
+				Mapping:    port.Mapping(),
+				Forward:    port.ForwardType(),
+				Local:      port.Local,
+				TargetHost: port.Target(),
+				Bind:       port.Bind,
+				Name:       port.Name,
+				Command:    append([]string{"ssh"}, executor.SSHArgs(tunnel, port)...),
+			}
+			if port.ForwardType() == config.ForwardDynamic {
+				jp.TargetHost = ""
+			} else {
+				jp.Remote = port.RemotePort()
+			}
+			entry.Ports = append(entry.Ports, jp)
+		}
+		out.Tunnels[name] = entry
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+func writeHeader(b *strings.Builder, opts Options) {
+	source := opts.Source
+	if source == "" {
+		source = "tunn"
+	}
+	fmt.Fprintf(b, "# Generated by tunn from %s", source)
+	if opts.Profile != "" {
+		fmt.Fprintf(b, " (profile %s)", opts.Profile)
+	}
+	b.WriteString("\n")
+}
+
+func sortedNames(tunnels map[string]config.Tunnel) []string {
+	names := make([]string, 0, len(tunnels))
+	for name := range tunnels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// shellQuote wraps arg in single quotes unless it only contains characters
+// that are safe to pass to sh unquoted.
+func shellQuote(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range arg {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:@=,+%", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
@@ -0,0 +1,132 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/sshconfig"
+)
+
+var testTunnels = map[string]config.Tunnel{
+	"api": {
+		Host: "bastion",
+		User: "deploy",
+		Ports: []config.Port{
+			{Local: "3000", Remote: "3000"},
+			{Local: "1080", Forward: config.ForwardDynamic},
+		},
+	},
+	"db": {
+		Host:         "db",
+		IdentityFile: "/keys/my key",
+		Ports: []config.Port{
+			{Local: "15432", Remote: "5432", TargetHost: "db.internal", Bind: "127.0.0.1"},
+			{Local: "3000", Remote: "9000", Forward: config.ForwardRemote},
+		},
+	},
+}
+
+func TestWriteSSHConfig(t *testing.T) {
+	dir := t.TempDir()
+	sshPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(sshPath, []byte("Host bastion\n  HostName bastion.example.com\n  User root\n  ProxyJump gw\n"), 0o600); err != nil {
+		t.Fatalf("failed to write ssh config: %v", err)
+	}
+	sshCfg, err := sshconfig.ParseFile(sshPath)
+	if err != nil {
+		t.Fatalf("failed to parse ssh config: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatSSHConfig, testTunnels, Options{Source: "~/.tunnrc", Profile: "prod", SSH: sshCfg}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `# Generated by tunn from ~/.tunnrc (profile prod)
+
+# Start with: ssh -N tunn-api
+Host tunn-api
+  HostName bastion.example.com
+  User deploy
+  ProxyJump gw
+  ExitOnForwardFailure yes
+  LocalForward 3000 localhost:3000
+  DynamicForward 1080
+
+# Start with: ssh -N tunn-db
+Host tunn-db
+  HostName db
+  IdentityFile "/keys/my key"
+  ExitOnForwardFailure yes
+  LocalForward 127.0.0.1:15432 db.internal:5432
+  RemoteForward 9000 localhost:3000
+`
+	if buf.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteShell(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatShell, testTunnels, Options{Source: "~/.tunnrc"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, line := range []string{
+		"ssh -N -L 3000:localhost:3000 -l deploy bastion &",
+		"ssh -N -D 1080 -l deploy bastion &",
+		"ssh -N -L 127.0.0.1:15432:db.internal:5432 -i '/keys/my key' db &",
+		"ssh -N -R 9000:localhost:3000 -i '/keys/my key' db &",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("expected script to contain %q:\n%s", line, buf.String())
+		}
+	}
+	if !strings.HasPrefix(buf.String(), "#!/bin/sh\n") || !strings.HasSuffix(buf.String(), "\nwait\n") {
+		t.Fatalf("expected a runnable script, got:\n%s", buf.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatJSON, testTunnels, Options{Profile: "prod"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded jsonExport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if decoded.Profile != "prod" || len(decoded.Tunnels) != 2 {
+		t.Fatalf("unexpected export: %+v", decoded)
+	}
+	db := decoded.Tunnels["db"].Ports[0]
+	if db.Mapping != "15432:db.internal:5432" || db.TargetHost != "db.internal" || db.Forward != config.ForwardLocal {
+		t.Fatalf("unexpected port: %+v", db)
+	}
+	if got := strings.Join(db.Command, " "); got != "ssh -N -L 127.0.0.1:15432:db.internal:5432 -i /keys/my key db" {
+		t.Fatalf("unexpected command: %s", got)
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	err := Write(&bytes.Buffer{}, "xml", testTunnels, Options{})
+	if err == nil || !strings.Contains(err.Error(), "ssh-config, shell, json") {
+		t.Fatalf("expected unknown format error, got %v", err)
+	}
+}
+
+func TestWriteAutoPort(t *testing.T) {
+	tunnels := map[string]config.Tunnel{
+		"db": {Host: "db", Ports: []config.Port{{Local: config.AutoPort, Remote: "5432"}}},
+	}
+	err := Write(&bytes.Buffer{}, FormatShell, tunnels, Options{})
+	if err == nil || !strings.Contains(err.Error(), "cannot export db port auto:5432") {
+		t.Fatalf("expected automatic port error, got %v", err)
+	}
+}
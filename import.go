@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/sshconfig"
+)
+
+func runImportCommand(opts *cli.Options) error {
+	switch opts.ImportSource {
+	case "ssh-config":
+		return runImportSSHConfig(opts)
+	default:
+		return fmt.Errorf("unknown import source: %s", opts.ImportSource)
+	}
+}
+
+func runImportSSHConfig(opts *cli.Options) error {
+	sshPath, err := sshconfig.DefaultPath()
+	if err != nil {
+		return err
+	}
+	sshCfg, err := sshconfig.ParseFile(sshPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("~/.ssh/config not found")
+		}
+		return fmt.Errorf("failed to read ssh config: %w", err)
+	}
+
+	configPath, err := config.Path()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := checkEditable(configPath, data); err != nil {
+		return err
+	}
+	existing, err := existingTunnels(configPath, data)
+	if err != nil {
+		return err
+	}
+
+	result := sshCfg.ImportTunnels(opts.HostPattern)
+	var entries []config.TunnelEntry
+	for _, entry := range result.Tunnels {
+		if _, ok := existing[entry.Name]; ok {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("tunnel %q already exists in %s", entry.Name, configPath))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	for _, skipped := range result.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped: %s\n", skipped)
+	}
+
+	if len(entries) == 0 {
+		if opts.HostPattern != "" {
+			fmt.Printf("No new forwards found in %s for hosts matching %q\n", sshPath, opts.HostPattern)
+		} else {
+			fmt.Printf("No new forwards found in %s\n", sshPath)
+		}
+		return nil
+	}
+
+	updated, err := config.AppendTunnels(data, entries)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", configPath, err)
+	}
+	if errs := config.Errors(config.Validate(configPath, updated)); len(errs) > 0 {
+		for _, diag := range errs {
+			fmt.Fprintln(os.Stderr, diag.String())
+		}
+		return fmt.Errorf("imported tunnels conflict with %s; nothing was written", configPath)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+
+	if opts.DryRun {
+		block, err := config.FormatTunnels(entries, 2)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Would add %d tunnel(s) to %s:\n\n%s", len(entries), configPath, block)
+		return nil
+	}
+
+	if err := writeConfigFile(configPath, updated); err != nil {
+		return err
+	}
+	fmt.Printf("Added %d tunnel(s) to %s: %s\n", len(entries), configPath, strings.Join(names, ", "))
+	return nil
+}
+
+// existingTunnels returns the tunnels of the configuration file at path,
+// including the disabled ones, whose names are taken as well. Disabled
+// tunnels are listed without their definition, since their local ports may
+// be reused.
+func existingTunnels(path string, data []byte) (map[string]config.Tunnel, error) {
+	existing := make(map[string]config.Tunnel)
+	if len(data) == 0 {
+		return existing, nil
+	}
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for name, tunnel := range cfg.Tunnels {
+		existing[name] = tunnel
+	}
+	for _, name := range cfg.Disabled {
+		existing[name] = config.Tunnel{}
+	}
+	return existing, nil
+}
+
+// checkEditable rejects configuration files that tunn cannot append to
+// without rewriting them: new tunnels are inserted as YAML text.
+func checkEditable(path string, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if format := config.DetectFormat(path, data); format != config.FormatYAML {
+		return fmt.Errorf("%s is written in %s; tunn can only add tunnels to YAML files, add them by hand", path, strings.ToUpper(string(format)))
+	}
+	return nil
+}
+
+// writeConfigFile replaces path atomically, keeping the permissions of an
+// existing file and following a symlinked dotfile to its target.
+func writeConfigFile(path string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tunnrc-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,3 @@
+// Package inherit hands open descriptors from a daemon over to the binary it
+// re-executes in place, and takes them over on the other side.
+package inherit
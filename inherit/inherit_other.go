@@ -0,0 +1,14 @@
+//go:build !unix
+
+package inherit
+
+import "os"
+
+// Descriptor returns the descriptor number of f.
+func Descriptor(f *os.File) (int, error) {
+	return int(f.Fd()), nil
+}
+
+// CloseOnExec does nothing, since descriptors are never inherited on this
+// platform.
+func CloseOnExec(fd int) {}
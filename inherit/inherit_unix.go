@@ -0,0 +1,30 @@
+//go:build unix
+
+package inherit
+
+import (
+	"os"
+	"syscall"
+)
+
+// Descriptor returns the descriptor number of f. Unlike File.Fd it leaves
+// the descriptor in non-blocking mode, which it shares with the duplicates
+// the daemon still serves.
+func Descriptor(f *os.File) (int, error) {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	fd := -1
+	if err := conn.Control(func(raw uintptr) { fd = int(raw) }); err != nil {
+		return 0, err
+	}
+	return fd, nil
+}
+
+// CloseOnExec closes a descriptor inherited from the previous daemon on
+// exec again. It was passed on without the flag and would otherwise leak
+// into every process started from now on.
+func CloseOnExec(fd int) {
+	syscall.CloseOnExec(fd)
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package inherit
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestCloseOnExec(t *testing.T) {
+	ln, err := net.Listen("unix", t.TempDir()+"/control.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fd, err := Descriptor(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Passed on to the next daemon without the flag.
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_SETFD, 0); errno != 0 {
+		t.Fatal(errno)
+	}
+
+	CloseOnExec(fd)
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0)
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	if flags&syscall.FD_CLOEXEC == 0 {
+		t.Fatal("expected the inherited descriptor to be closed on exec")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/daemon"
+	"github.com/strandnerd/tunn/logs"
+)
+
+// runLogsCommand prints the ssh output captured by the daemon. Without a
+// running daemon the log files left by the last one are read directly.
+func runLogsCommand(paths daemon.Paths, opts *cli.Options) error {
+	var since time.Time
+	if opts.Since > 0 {
+		since = time.Now().Add(-opts.Since)
+	}
+	tunnel := ""
+	if len(opts.TunnelNames) > 0 {
+		tunnel = opts.TunnelNames[0]
+	}
+
+	_, running, err := daemon.CheckRunning(paths)
+	if err != nil {
+		return err
+	}
+	if !running {
+		if opts.Follow {
+			return fmt.Errorf("tunn daemon not running")
+		}
+		lines, err := logs.NewStore(paths.OutputDir, logs.DefaultMaxSize).Read(tunnel, since)
+		if err != nil {
+			return fmt.Errorf("failed to read logs: %w", err)
+		}
+		for _, line := range lines {
+			printLogLine(line)
+		}
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = daemon.Logs(ctx, paths, tunnel, since, opts.Follow, func(line logs.Line) error {
+		printLogLine(line)
+		return nil
+	})
+	switch {
+	case errors.Is(err, context.Canceled):
+		return nil
+	case errors.Is(err, io.EOF):
+		fmt.Fprintln(os.Stderr, "tunn daemon stopped")
+		return nil
+	}
+	return err
+}
+
+func printLogLine(line logs.Line) {
+	fmt.Printf("%s %s %s: %s\n", line.Time.Local().Format("2006-01-02 15:04:05"), line.Tunnel, line.Port, line.Text)
+}
@@ -0,0 +1,302 @@
+// Package logs captures the output of ssh processes in bounded, timestamped
+// log files, one per tunnel port.
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSize is the size at which a port's log file is rotated. One
+// rotated file is kept, so a port never uses more than twice this on disk.
+const DefaultMaxSize = 256 * 1024
+
+const (
+	fileSuffix    = ".log"
+	rotatedSuffix = ".log.1"
+)
+
+// Line is a single timestamped line of output.
+type Line struct {
+	Time   time.Time `json:"time"`
+	Tunnel string    `json:"tunnel"`
+	Port   string    `json:"port"`
+	Text   string    `json:"text"`
+}
+
+// ErrInvalidTunnel reports a tunnel name that cannot be a log directory.
+var ErrInvalidTunnel = errors.New("invalid tunnel name")
+
+// Store writes captured output under a directory, as dir/<tunnel>/<port>.log,
+// and lets readers follow new lines as they are written.
+type Store struct {
+	dir     string
+	maxSize int64
+
+	mu          sync.Mutex
+	subscribers map[chan Line]string
+
+	filesMu sync.Mutex
+	files   map[string]*logFile
+}
+
+// logFile is the open log file of a tunnel port, with the number of bytes
+// it holds so that it rotates without checking its size on disk.
+type logFile struct {
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewStore creates a store keeping logs under dir, rotating each file once
+// it grows past maxSize bytes.
+func NewStore(dir string, maxSize int64) *Store {
+	return &Store{
+		dir:         dir,
+		maxSize:     maxSize,
+		subscribers: make(map[chan Line]string),
+		files:       make(map[string]*logFile),
+	}
+}
+
+// Writer returns a writer that records every line written to it for the
+// given tunnel port. Close flushes a trailing line without a newline and
+// closes the port's log file until the next line.
+func (s *Store) Writer(tunnel, port string) io.WriteCloser {
+	return &lineWriter{store: s, tunnel: tunnel, port: port}
+}
+
+// Read returns the recorded lines of a tunnel, or of every tunnel when
+// tunnel is empty, written at or after since, in time order.
+func (s *Store) Read(tunnel string, since time.Time) ([]Line, error) {
+	if strings.ContainsAny(tunnel, `/\`) || strings.Contains(tunnel, "..") {
+		return nil, fmt.Errorf("%w %q", ErrInvalidTunnel, tunnel)
+	}
+	tunnels := []string{tunnel}
+	if tunnel == "" {
+		entries, err := os.ReadDir(s.dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		tunnels = tunnels[:0]
+		for _, entry := range entries {
+			if entry.IsDir() {
+				tunnels = append(tunnels, entry.Name())
+			}
+		}
+	}
+
+	var lines []Line
+	for _, name := range tunnels {
+		entries, err := os.ReadDir(filepath.Join(s.dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			port, ok := strings.CutSuffix(entry.Name(), fileSuffix)
+			if !ok {
+				continue
+			}
+			for _, file := range []string{port + rotatedSuffix, entry.Name()} {
+				read, err := readFile(filepath.Join(s.dir, name, file), name, port, since)
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, read...)
+			}
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+	return lines, nil
+}
+
+// Subscribe returns a channel receiving every line recorded after the call
+// for a tunnel, or for every tunnel when tunnel is empty. A subscriber that
+// falls more than buffer lines behind has its channel closed, as does
+// calling cancel.
+func (s *Store) Subscribe(tunnel string, buffer int) (<-chan Line, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan Line, buffer)
+	s.subscribers[ch] = tunnel
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// record hands a line to subscribers and appends it to its port's file.
+func (s *Store) record(line Line) error {
+	s.mu.Lock()
+	for ch, tunnel := range s.subscribers {
+		if tunnel != "" && tunnel != line.Tunnel {
+			continue
+		}
+		select {
+		case ch <- line:
+		default:
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+	s.mu.Unlock()
+
+	f := s.file(line.Tunnel, line.Port)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dir := filepath.Join(s.dir, line.Tunnel)
+	path := filepath.Join(dir, line.Port+fileSuffix)
+	if f.file != nil && f.size >= s.maxSize {
+		err := f.file.Close()
+		f.file = nil
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(path, filepath.Join(dir, line.Port+rotatedSuffix)); err != nil {
+			return err
+		}
+	}
+	if f.file == nil {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		f.file, f.size = file, info.Size()
+	}
+	n, err := fmt.Fprintf(f.file, "%s %s\n", line.Time.UTC().Format(time.RFC3339Nano), line.Text)
+	f.size += int64(n)
+	return err
+}
+
+// file returns the log file of a tunnel port, which is opened on the first
+// line written to it.
+func (s *Store) file(tunnel, port string) *logFile {
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+	key := tunnel + "/" + port
+	f, ok := s.files[key]
+	if !ok {
+		f = &logFile{}
+		s.files[key] = f
+	}
+	return f
+}
+
+// closeFile closes the log file of a tunnel port, if open.
+func (s *Store) closeFile(tunnel, port string) error {
+	f := s.file(tunnel, port)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// readFile parses a log file, skipping lines before since.
+func readFile(path, tunnel, port string, since time.Time) ([]Line, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []Line
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		stamp, text, _ := strings.Cut(scanner.Text(), " ")
+		at, err := time.Parse(time.RFC3339Nano, stamp)
+		if err != nil || at.Before(since) {
+			continue
+		}
+		lines = append(lines, Line{Time: at, Tunnel: tunnel, Port: port, Text: text})
+	}
+	return lines, scanner.Err()
+}
+
+// lineWriter splits output into lines and records each with the time it
+// was received.
+type lineWriter struct {
+	store   *Store
+	tunnel  string
+	port    string
+	mu      sync.Mutex
+	pending []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		text := string(bytes.TrimRight(w.pending[:i], "\r"))
+		w.pending = w.pending[i+1:]
+		// Capture is best effort: failing to write the log must not stall
+		// the process whose output is being read.
+		_ = w.emit(text)
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	if len(w.pending) > 0 {
+		text := string(bytes.TrimRight(w.pending, "\r"))
+		w.pending = nil
+		err = w.emit(text)
+	}
+	if closeErr := w.store.closeFile(w.tunnel, w.port); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (w *lineWriter) emit(text string) error {
+	return w.store.record(Line{Time: time.Now(), Tunnel: w.tunnel, Port: w.port, Text: text})
+}
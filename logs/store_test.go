@@ -0,0 +1,134 @@
+package logs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreWriteAndRead(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, DefaultMaxSize)
+
+	db := store.Writer("db", "5432:5432")
+	api := store.Writer("api", "3000:3000")
+	fmt.Fprint(db, "Warning: Permanently added 'bastion'\r\nbind: Address already ")
+	fmt.Fprint(api, "connect failed\n")
+	fmt.Fprint(db, "in use\npartial")
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	lines, err := store.Read("db", time.Time{})
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	var got []string
+	for _, line := range lines {
+		if line.Tunnel != "db" || line.Port != "5432:5432" || line.Time.IsZero() {
+			t.Fatalf("unexpected line %+v", line)
+		}
+		got = append(got, line.Text)
+	}
+	want := "Warning: Permanently added 'bastion'|bind: Address already in use|partial"
+	if strings.Join(got, "|") != want {
+		t.Fatalf("lines = %q, want %q", strings.Join(got, "|"), want)
+	}
+
+	all, err := store.Read("", time.Time{})
+	if err != nil || len(all) != 4 || all[0].Tunnel != "db" || all[1].Tunnel != "api" {
+		t.Fatalf("unexpected lines across tunnels: %+v (%v)", all, err)
+	}
+	if recent, _ := store.Read("", time.Now().Add(time.Minute)); len(recent) != 0 {
+		t.Fatalf("expected no lines in the future, got %+v", recent)
+	}
+	if missing, err := NewStore(filepath.Join(dir, "missing"), DefaultMaxSize).Read("", time.Time{}); err != nil || len(missing) != 0 {
+		t.Fatalf("expected an empty store to read nothing, got %+v (%v)", missing, err)
+	}
+}
+
+func TestStoreRotates(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, 100)
+	w := store.Writer("db", "5432:5432")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(w, "line %02d\n", i)
+	}
+
+	for _, name := range []string{"5432:5432.log", "5432:5432.log.1"} {
+		info, err := os.Stat(filepath.Join(dir, "db", name))
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if info.Size() > 100+64 {
+			t.Fatalf("%s grew to %d bytes", name, info.Size())
+		}
+	}
+	lines, err := store.Read("db", time.Time{})
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(lines) == 0 || len(lines) >= 20 || lines[len(lines)-1].Text != "line 19" {
+		t.Fatalf("expected the most recent lines to be kept, got %+v", lines)
+	}
+}
+
+func TestStoreKeepsFileOpen(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, DefaultMaxSize)
+	w := store.Writer("db", "5432:5432")
+	fmt.Fprint(w, "first\n")
+
+	// Lines keep going to the open file, without looking it up again.
+	path := filepath.Join(dir, "db", "5432:5432.log")
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(w, "second\n")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	data, err := os.ReadFile(path + ".moved")
+	if err != nil || strings.Count(string(data), "\n") != 2 {
+		t.Fatalf("expected both lines in the open file, got %q (%v)", data, err)
+	}
+
+	// Closing the writer closes the file, which the next line opens again.
+	w = store.Writer("db", "5432:5432")
+	fmt.Fprint(w, "third\n")
+	w.Close()
+	lines, err := store.Read("db", time.Time{})
+	if err != nil || len(lines) != 1 || lines[0].Text != "third" {
+		t.Fatalf("expected the file to be opened again, got %+v (%v)", lines, err)
+	}
+}
+
+func TestStoreReadRejectsPaths(t *testing.T) {
+	store := NewStore(t.TempDir(), DefaultMaxSize)
+	for _, tunnel := range []string{"..", "../etc", "db/5432", `db\5432`, "a..b"} {
+		if _, err := store.Read(tunnel, time.Time{}); !errors.Is(err, ErrInvalidTunnel) {
+			t.Errorf("Read(%q) = %v, want ErrInvalidTunnel", tunnel, err)
+		}
+	}
+}
+
+func TestStoreSubscribe(t *testing.T) {
+	store := NewStore(t.TempDir(), DefaultMaxSize)
+	lines, cancel := store.Subscribe("db", 4)
+
+	fmt.Fprint(store.Writer("api", "3000:3000"), "ignored\n")
+	fmt.Fprint(store.Writer("db", "5432:5432"), "hello\n")
+
+	line := <-lines
+	if line.Tunnel != "db" || line.Text != "hello" {
+		t.Fatalf("unexpected line %+v", line)
+	}
+	cancel()
+	if _, ok := <-lines; ok {
+		t.Fatal("expected the channel to be closed after cancel")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -19,13 +20,18 @@ import (
 	"github.com/strandnerd/tunn/config"
 	"github.com/strandnerd/tunn/daemon"
 	"github.com/strandnerd/tunn/executor"
+	"github.com/strandnerd/tunn/logs"
 	"github.com/strandnerd/tunn/output"
 	"github.com/strandnerd/tunn/status"
+	"github.com/strandnerd/tunn/systemd"
 	"github.com/strandnerd/tunn/tunnel"
 	"github.com/strandnerd/tunn/version"
 )
 
-const daemonPreviewDuration = 2 * time.Second
+const (
+	daemonPreviewDuration = 2 * time.Second
+	configWatchInterval   = 2 * time.Second
+)
 
 func main() {
 	if err := run(); err != nil {
@@ -49,17 +55,48 @@ func run() error {
 
 	switch opts.Command {
 	case cli.CommandStatus:
+		if opts.Watch {
+			return runStatusWatch(paths)
+		}
 		return runStatusCommand(paths)
 	case cli.CommandStop:
+		if len(opts.TunnelNames) > 0 {
+			return runTunnelCommand(paths, "stop", opts.TunnelNames)
+		}
 		return runStopCommand(paths)
+	case cli.CommandStartTunnels:
+		return runTunnelCommand(paths, "start", opts.TunnelNames)
+	case cli.CommandRestart:
+		return runTunnelCommand(paths, "restart", opts.TunnelNames)
+	case cli.CommandReload:
+		return runReloadCommand(paths)
+	case cli.CommandPort:
+		return runPortCommand(paths, opts.TunnelNames[0])
+	case cli.CommandLogs:
+		return runLogsCommand(paths, opts)
+	case cli.CommandDaemon:
+		return runDaemonAction(paths, opts)
+	case cli.CommandService:
+		return runServiceAction(paths, opts)
 	case cli.CommandStart:
+		if opts.InternalSupervisor {
+			return runSupervisor(paths, opts)
+		}
 		if opts.InternalDaemon {
-			return runDaemonCommand(paths, opts.TunnelNames)
+			return runDaemonCommand(paths, opts)
 		}
 		return runStartCommand(paths, opts)
 	case cli.CommandVersion:
 		fmt.Println(version.String())
 		return nil
+	case cli.CommandConfig:
+		return runConfigCommand(opts)
+	case cli.CommandImport:
+		return runImportCommand(opts)
+	case cli.CommandExport:
+		return runExportCommand(opts)
+	case cli.CommandInit:
+		return runInitCommand(opts)
 	default:
 		return fmt.Errorf("unknown command")
 	}
@@ -71,27 +108,27 @@ func runStartCommand(paths daemon.Paths, opts *cli.Options) error {
 		return err
 	}
 	if running {
+		if opts.Detach && (len(opts.TunnelNames) > 0 || len(opts.Tags) > 0 || len(opts.Exclude) > 0) {
+			return addToDaemon(paths, pid, opts)
+		}
 		return fmt.Errorf("tunn daemon already running (pid %d); use 'tunn status' to inspect or stop it before launching in the foreground", pid)
 	}
 
-	cfg, err := config.Load()
+	cfg, err := loadConfig(opts)
 	if err != nil {
 		return err
 	}
 
-	selected := cfg.FilterTunnels(opts.TunnelNames)
-	if len(selected) == 0 {
-		if len(opts.TunnelNames) > 0 {
-			return fmt.Errorf("no tunnels found matching: %v", opts.TunnelNames)
-		}
-		return fmt.Errorf("no tunnels defined in configuration")
+	selected, err := selectTunnels(cfg, opts)
+	if err != nil {
+		return err
 	}
 
 	if opts.Detach {
-		return launchDaemon(paths, opts.TunnelNames)
+		return launchDaemon(paths, opts)
 	}
 
-	if err := runForeground(selected); err != nil {
+	if err := runForeground(selected, cfg); err != nil {
 		if errors.Is(err, context.Canceled) {
 			fmt.Println("Exiting...")
 			return nil
@@ -101,7 +138,110 @@ func runStartCommand(paths daemon.Paths, opts *cli.Options) error {
 	return nil
 }
 
-func launchDaemon(paths daemon.Paths, tunnelNames []string) error {
+// addToDaemon hands the tunnels named on the command line to a daemon that is
+// already running, which starts them alongside the ones it runs.
+func addToDaemon(paths daemon.Paths, pid int, opts *cli.Options) error {
+	if len(opts.Tags) > 0 || len(opts.Exclude) > 0 {
+		return fmt.Errorf("tunn daemon already running (pid %d); only tunnel names can be added to it, so stop it to relaunch with --tag or --exclude", pid)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	current, err := daemon.QueryStatus(ctx, paths)
+	if err != nil {
+		return fmt.Errorf("daemon (pid %d) is unreachable: %v", pid, err)
+	}
+	configPath, err := config.Path()
+	if err != nil {
+		return err
+	}
+	if err := checkDaemonMatch(current, pid, opts, configPath); err != nil {
+		return err
+	}
+
+	resp, err := daemon.SendStartTunnels(ctx, paths, opts.TunnelNames)
+	if err != nil {
+		return requestError("failed to add tunnels to the daemon", err)
+	}
+	if err := resp.Err(); err != nil {
+		return fmt.Errorf("failed to add tunnels to the daemon (pid %d): %w", pid, err)
+	}
+
+	encounteredErrors, previewErr := monitorDaemonStartup(paths, daemonPreviewDuration, isTerminal(os.Stdout))
+	if previewErr != nil {
+		return previewErr
+	}
+
+	if resp.Changes == nil || resp.Changes.Empty() {
+		fmt.Printf("tunn daemon (pid %d) already runs %s\n", pid, strings.Join(opts.TunnelNames, ", "))
+		return nil
+	}
+	fmt.Printf("added to tunn daemon (pid %d): %s\n", pid, resp.Message)
+	if encounteredErrors {
+		fmt.Println("Some tunnels reported errors during startup. Run 'tunn status' for details.")
+	}
+	return nil
+}
+
+// checkDaemonMatch refuses to add tunnels to a daemon running another
+// configuration file or profile than the command line resolves to, since the
+// daemon would look the names up in its own.
+func checkDaemonMatch(current *daemon.StatusResponse, pid int, opts *cli.Options, configPath string) error {
+	if current.Config != "" && current.Config != configPath {
+		return fmt.Errorf("tunn daemon already running (pid %d) with %s; stop it to relaunch with %s", pid, current.Config, configPath)
+	}
+	profile := opts.Profile
+	if profile == "" {
+		profile = config.ProfileFromEnv()
+	}
+	if profile != current.Profile {
+		return fmt.Errorf("tunn daemon already running (pid %d) with %s; stop it to relaunch with %s", pid, profileLabel(current.Profile), profileLabel(profile))
+	}
+	return nil
+}
+
+func profileLabel(profile string) string {
+	if profile == "" {
+		return "no profile"
+	}
+	return "profile " + profile
+}
+
+// selectTunnels resolves the tunnels requested on the command line.
+func selectTunnels(cfg *config.Config, opts *cli.Options) (map[string]config.Tunnel, error) {
+	selected, err := cfg.Select(config.Selector{Names: opts.TunnelNames, Tags: opts.Tags, Exclude: opts.Exclude})
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) == 0 {
+		if len(opts.Exclude) > 0 {
+			return nil, fmt.Errorf("every selected tunnel was excluded")
+		}
+		if len(cfg.Tunnels) > 0 {
+			return nil, fmt.Errorf("every tunnel has autostart: false; start them by name")
+		}
+		return nil, fmt.Errorf("no tunnels defined in configuration")
+	}
+	return selected, nil
+}
+
+// daemonArgs rebuilds the selection flags passed to the internal daemon process.
+func daemonArgs(opts *cli.Options) []string {
+	args := []string{"--internal-daemon"}
+	if opts.Profile != "" {
+		args = append(args, "--profile", opts.Profile)
+	}
+	for _, tag := range opts.Tags {
+		args = append(args, "--tag", tag)
+	}
+	for _, pattern := range opts.Exclude {
+		args = append(args, "--exclude", pattern)
+	}
+	return append(args, opts.TunnelNames...)
+}
+
+func launchDaemon(paths daemon.Paths, opts *cli.Options) error {
 	pid, running, err := daemon.CheckRunning(paths)
 	if err != nil {
 		return err
@@ -115,9 +255,11 @@ func launchDaemon(paths daemon.Paths, tunnelNames []string) error {
 		return fmt.Errorf("failed to locate executable: %w", err)
 	}
 
-	args := []string{"--internal-daemon"}
-	args = append(args, tunnelNames...)
-
+	args := daemonArgs(opts)
+	if opts.Supervise {
+		// The supervisor starts the daemon itself, with the same selection.
+		args[0] = "--internal-supervisor"
+	}
 	cmd := exec.Command(executable, args...)
 	cmd.Env = os.Environ()
 
@@ -133,16 +275,26 @@ func launchDaemon(paths daemon.Paths, tunnelNames []string) error {
 		return fmt.Errorf("failed to start daemon: %w", err)
 	}
 
-	childPID := cmd.Process.Pid
-	if err := daemon.WritePID(paths, childPID); err != nil {
-		_ = cmd.Process.Kill()
+	// A supervisor is asked to stop so that it takes its daemon along.
+	abort := func() {
+		if opts.Supervise {
+			_ = cmd.Process.Signal(syscall.SIGTERM)
+		} else {
+			_ = cmd.Process.Kill()
+		}
 		_, _ = cmd.Process.Wait()
-		return err
+	}
+
+	childPID := cmd.Process.Pid
+	if !opts.Supervise {
+		if err := daemon.WritePID(paths, childPID); err != nil {
+			abort()
+			return err
+		}
 	}
 
 	if err := daemon.WaitForSocket(paths, 3*time.Second); err != nil {
-		_ = cmd.Process.Kill()
-		_, _ = cmd.Process.Wait()
+		abort()
 		daemon.Cleanup(paths)
 		return fmt.Errorf("daemon failed to expose control socket: %w", err)
 	}
@@ -151,8 +303,7 @@ func launchDaemon(paths daemon.Paths, tunnelNames []string) error {
 	defer cancelStatus()
 	resp, statusErr := daemon.QueryStatus(statusCtx, paths)
 	if statusErr != nil || resp == nil || !resp.Running {
-		_ = cmd.Process.Kill()
-		_, _ = cmd.Process.Wait()
+		abort()
 		daemon.Cleanup(paths)
 		if statusErr != nil {
 			msg, logErr := tailLogMessage(paths.LogFile)
@@ -173,14 +324,18 @@ func launchDaemon(paths daemon.Paths, tunnelNames []string) error {
 		return previewErr
 	}
 
-	fmt.Printf("tunn daemon started (pid %d)\n", childPID)
+	if opts.Supervise {
+		fmt.Printf("tunn daemon started (pid %d, supervised by pid %d)\n", resp.PID, childPID)
+	} else {
+		fmt.Printf("tunn daemon started (pid %d)\n", childPID)
+	}
 	if encounteredErrors {
 		fmt.Println("Some tunnels reported errors during startup. Run 'tunn status' for details.")
 	}
 	return nil
 }
 
-func runForeground(tunnels map[string]config.Tunnel) error {
+func runForeground(tunnels map[string]config.Tunnel, cfg *config.Config) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	var shutdownOnce sync.Once
 	shutdown := func() {
@@ -198,48 +353,122 @@ func runForeground(tunnels map[string]config.Tunnel) error {
 	}()
 
 	display := output.NewDisplay()
-
-	sshExec := &executor.RealSSHExecutor{
-		OnStatusChange: display.UpdateStatus,
+	display.SetProfile(cfg.Profile)
+	for name, tun := range tunnels {
+		for _, port := range tun.Ports {
+			if port.Name != "" {
+				display.SetPortName(name, port.Mapping(), port.Name)
+			}
+		}
 	}
 
+	sshExec := &executor.RealSSHExecutor{}
 	manager := tunnel.NewManager(sshExec, display, nil)
+	sshExec.OnStatusChange = manager.UpdateStatus
+	manager.SetAutoPortRange(cfg.AutoPortRange())
+	manager.OnPortAssigned(display.SetLocalPort)
 
 	return manager.RunTunnels(ctx, tunnels)
 }
 
-func runDaemonCommand(paths daemon.Paths, tunnelNames []string) error {
-	cfg, err := config.Load()
+func runDaemonCommand(paths daemon.Paths, opts *cli.Options) error {
+	resumed, err := loadHandover()
 	if err != nil {
 		return err
 	}
 
-	selected := cfg.FilterTunnels(tunnelNames)
-	if len(selected) == 0 {
-		if len(tunnelNames) > 0 {
-			return fmt.Errorf("no tunnels found matching: %v", tunnelNames)
+	// 'tunn daemon run' keeps the daemon in the foreground, such as under
+	// systemd, so it claims the pid file itself and logs to stdout.
+	foreground := opts.Command == cli.CommandDaemon
+	if foreground && resumed == nil {
+		pid, running, err := daemon.CheckRunning(paths)
+		if err != nil {
+			return err
+		}
+		if running {
+			return fmt.Errorf("tunn daemon already running (pid %d); stop it before running another one", pid)
 		}
-		return fmt.Errorf("no tunnels defined in configuration")
 	}
 
-	logFile, err := os.OpenFile(paths.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	// A daemon started without a supervisor replaces one given up on.
+	if os.Getenv(daemon.SupervisorEnv) == "" {
+		if supervision, _ := daemon.ReadSupervision(paths); supervision != nil && !supervision.GaveUp.IsZero() {
+			_ = daemon.RemoveSupervision(paths)
+		}
+	}
+
+	cfg, err := loadConfig(opts)
 	if err != nil {
-		return fmt.Errorf("failed to open daemon log: %w", err)
+		if resumed != nil {
+			resumed.abandon()
+		}
+		return err
 	}
-	defer logFile.Close()
 
-	logger := log.New(logFile, "", log.LstdFlags)
-	logger.Printf("tunn daemon starting (pid %d)", os.Getpid())
+	selected, err := selectTunnels(cfg, opts)
+	if err != nil {
+		if resumed != nil {
+			resumed.abandon()
+		}
+		return err
+	}
+	if resumed != nil {
+		// Run what the previous daemon ran, including the tunnels started
+		// and stopped since it was launched.
+		selected = resumed.Tunnels
+	}
+
+	var logger *log.Logger
+	if foreground {
+		logger = log.New(os.Stdout, "", log.LstdFlags)
+		if os.Getenv("JOURNAL_STREAM") != "" {
+			// journald timestamps every line itself.
+			logger.SetFlags(0)
+		}
+		if err := daemon.WritePID(paths, os.Getpid()); err != nil {
+			return err
+		}
+	} else {
+		logFile, err := os.OpenFile(paths.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open daemon log: %w", err)
+		}
+		defer logFile.Close()
+		logger = log.New(logFile, "", log.LstdFlags)
+	}
+	if resumed != nil {
+		logger.Printf("tunn daemon upgraded from %s to %s (pid %d), adopting %d ssh processes", resumed.Version, version.String(), os.Getpid(), len(resumed.Children))
+	} else {
+		logger.Printf("tunn daemon starting (pid %d)", os.Getpid())
+	}
+	if cfg.Profile != "" {
+		logger.Printf("using profile %q", cfg.Profile)
+	}
 
 	store := status.NewStore()
 	for name, tun := range selected {
-		store.EnsureTunnel(name, tun.Ports)
+		registerTunnel(store, name, tun)
+	}
+	if resumed != nil {
+		for name, ports := range resumed.Local {
+			for mapping, local := range ports {
+				store.SetLocalPort(name, mapping, local)
+			}
+		}
+	}
+
+	var notifier *systemd.Notifier
+	if foreground {
+		notifier = systemd.NewNotifier()
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	var shutdownOnce sync.Once
 	shutdown := func() {
-		shutdownOnce.Do(cancel)
+		shutdownOnce.Do(func() {
+			_ = notifier.Stopping()
+			cancel()
+		})
 	}
 	defer shutdown()
 
@@ -253,21 +482,95 @@ func runDaemonCommand(paths daemon.Paths, tunnelNames []string) error {
 		shutdown()
 	}()
 
+	output := logs.NewStore(paths.OutputDir, logs.DefaultMaxSize)
+	sshExec := &executor.RealSSHExecutor{Output: output.Writer}
+	manager := tunnel.NewManager(sshExec, nil, store.Update)
+	sshExec.OnStatusChange = manager.UpdateStatus
+	manager.SetAutoPortRange(cfg.AutoPortRange())
+	manager.OnPortAssigned(store.SetLocalPort)
+	// The daemon outlives its tunnels, which can be started again.
+	manager.KeepRunning()
+	controller := &daemonController{
+		opts:    opts,
+		path:    cfg.Path,
+		manager: manager,
+		store:   store,
+		logger:  logger,
+	}
+	if resumed != nil {
+		sshExec.Adopt(resumed.Children)
+		manager.RestorePorts(resumed.Local)
+		controller.started = resumed.Started
+		if resumed.Stopped != nil || resumed.StoppedPorts != nil {
+			controller.stopped = make(map[string]bool)
+			controller.stoppedPorts = make(map[string]map[string]bool)
+			maps.Copy(controller.stopped, resumed.Stopped)
+			maps.Copy(controller.stoppedPorts, resumed.StoppedPorts)
+		}
+	}
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	defer signal.Stop(hupChan)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupChan:
+				logger.Printf("received SIGHUP, reloading configuration")
+				_, _ = controller.Reload()
+			}
+		}
+	}()
+	go config.Watch(ctx, cfg.Path, configWatchInterval, func() {
+		logger.Printf("configuration file %s changed, reloading", cfg.Path)
+		_, _ = controller.Reload()
+	})
+
 	server := daemon.NewServer(paths, store, os.Getpid(), shutdown)
+	server.SetProfile(cfg.Profile)
+	server.SetConfigPath(cfg.Path)
+	server.SetController(controller)
+	server.SetLogs(output)
+	server.SetSupervised(os.Getenv(daemon.SupervisorEnv) != "")
+	server.SetUpgrader(&daemonUpgrader{paths: paths, controller: controller, exec: sshExec, logger: logger})
+	if notifier != nil {
+		server.SetReady(func() {
+			if err := notifier.Ready(status.Summarize(store.Snapshot())); err != nil {
+				logger.Printf("failed to notify systemd: %v", err)
+			}
+		})
+		go notifySystemd(ctx, notifier, store, daemonAlive(paths, manager), logger)
+	}
+	if resumed != nil {
+		ln, err := resumed.inheritedListener()
+		if err != nil {
+			logger.Printf("%v; creating a new one", err)
+		} else {
+			server.SetListener(ln)
+		}
+	}
 	serverErrCh := make(chan error, 1)
 	go func() {
 		serverErrCh <- server.Run(ctx)
 	}()
 
-	sshExec := &executor.RealSSHExecutor{
-		OnStatusChange: store.Update,
-	}
-
-	manager := tunnel.NewManager(sshExec, nil, store.Update)
 	managerErrCh := make(chan error, 1)
 	go func() {
 		managerErrCh <- manager.RunTunnels(ctx, selected)
 	}()
+	if resumed != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-time.After(adoptionGrace):
+			}
+			if n := sshExec.ReleaseAdopted(); n > 0 {
+				logger.Printf("stopped %d ssh processes no tunnel took over", n)
+			}
+		}()
+	}
 
 	var managerErr error
 	var srvErr error
@@ -310,6 +613,103 @@ func runDaemonCommand(paths daemon.Paths, tunnelNames []string) error {
 	return nil
 }
 
+// loadConfig loads the user configuration, applies the requested profile and
+// surfaces non-fatal diagnostics on stderr.
+func loadConfig(opts *cli.Options) (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range cfg.Warnings {
+		fmt.Fprintln(os.Stderr, warning.String())
+	}
+	if err := applyProfile(cfg, opts); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyProfile activates the profile from --profile, falling back to TUNN_PROFILE.
+func applyProfile(cfg *config.Config, opts *cli.Options) error {
+	profile := opts.Profile
+	if profile == "" {
+		profile = config.ProfileFromEnv()
+	}
+	return cfg.ApplyProfile(profile)
+}
+
+func runConfigCommand(opts *cli.Options) error {
+	switch opts.ConfigAction {
+	case "validate":
+		return runConfigValidate()
+	case "schema":
+		return runConfigSchema()
+	case "show":
+		return runConfigShow(opts)
+	default:
+		return fmt.Errorf("unknown config action: %s", opts.ConfigAction)
+	}
+}
+
+func runConfigValidate() error {
+	path, err := config.Path()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("~/.tunnrc not found. Run 'tunn init' to create one")
+		}
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	diagnostics := config.Validate(path, data)
+	for _, diag := range diagnostics {
+		fmt.Println(diag.String())
+	}
+
+	if errs := config.Errors(diagnostics); len(errs) > 0 {
+		if len(errs) == 1 {
+			return fmt.Errorf("1 problem found in %s", path)
+		}
+		return fmt.Errorf("%d problems found in %s", len(errs), path)
+	}
+	fmt.Printf("%s: configuration is valid\n", path)
+	return nil
+}
+
+// runConfigSchema prints the JSON Schema for the configuration file, for use
+// by editors.
+func runConfigSchema() error {
+	schema, err := config.Schema()
+	if err != nil {
+		return fmt.Errorf("failed to render schema: %w", err)
+	}
+	_, err = os.Stdout.Write(schema)
+	return err
+}
+
+// registerTunnel pre-populates the status store with a tunnel's ports and names.
+func registerTunnel(store *status.Store, name string, tun config.Tunnel) {
+	store.EnsureTunnel(name, portMappings(tun))
+	for _, port := range tun.Ports {
+		if port.Name != "" {
+			store.SetPortName(name, port.Mapping(), port.Name)
+		}
+	}
+}
+
+// portMappings returns the status keys for each port of a tunnel.
+func portMappings(tun config.Tunnel) []string {
+	mappings := make([]string, 0, len(tun.Ports))
+	for _, port := range tun.Ports {
+		mappings = append(mappings, port.Mapping())
+	}
+	return mappings
+}
+
 func runStatusCommand(paths daemon.Paths) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
@@ -320,6 +720,18 @@ func runStatusCommand(paths daemon.Paths) error {
 		if checkErr != nil {
 			return fmt.Errorf("failed to check daemon status: %w", checkErr)
 		}
+		if supervision, _ := daemon.ReadSupervision(paths); supervision != nil && !supervision.GaveUp.IsZero() {
+			for _, line := range supervisionLines(supervision) {
+				fmt.Println(line)
+			}
+			return fmt.Errorf("tunn daemon crashed %d times within %d minutes and was not restarted; start it again with 'tunn --detach --supervise'", crashLimit, int(crashWindow.Minutes()))
+		} else if supervision != nil && !supervision.NextStart.IsZero() {
+			fmt.Printf("tunn daemon crashed; supervisor (pid %d) restarts it at %s\n", supervision.PID, supervision.NextStart.Local().Format("15:04:05"))
+			for _, line := range supervisionLines(supervision) {
+				fmt.Println(line)
+			}
+			return nil
+		}
 		if running {
 			return fmt.Errorf("daemon (pid %d) is unreachable: %v", pid, err)
 		}
@@ -332,8 +744,19 @@ func runStatusCommand(paths daemon.Paths) error {
 		state = "stopped"
 	}
 
+	summary := fmt.Sprintf("Daemon: %s (pid %d, mode %s)", state, resp.PID, resp.Mode)
+	if resp.Profile != "" {
+		summary = fmt.Sprintf("Daemon: %s (pid %d, mode %s, profile %s)", state, resp.PID, resp.Mode, resp.Profile)
+	}
+
 	if !isTerminal(os.Stdout) {
-		fmt.Printf("Daemon: %s (pid %d, mode %s)\n", state, resp.PID, resp.Mode)
+		if resp.Profile != "" {
+			fmt.Printf("Profile: %s\n", resp.Profile)
+		}
+		fmt.Println(summary)
+		for _, line := range supervisionLines(resp.Supervisor) {
+			fmt.Println(line)
+		}
 		if len(resp.Tunnels) == 0 {
 			fmt.Println("No tunnels managed by daemon")
 			return nil
@@ -352,7 +775,15 @@ func runStatusCommand(paths daemon.Paths) error {
 			}
 			sort.Strings(ports)
 			for _, port := range ports {
-				fmt.Printf("    %s - %s\n", port, tun.Ports[port])
+				state := tun.Ports[port]
+				if local := tun.Local[port]; local != "" {
+					state += " [local " + local + "]"
+				}
+				if name := tun.Names[port]; name != "" {
+					fmt.Printf("    %s (%s) - %s\n", port, name, state)
+					continue
+				}
+				fmt.Printf("    %s - %s\n", port, state)
 			}
 		}
 		return nil
@@ -361,14 +792,13 @@ func runStatusCommand(paths daemon.Paths) error {
 	display := output.NewDisplay()
 	cache := make(map[string]string)
 	hasErrors := applySnapshotToDisplay(display, resp, cache)
-	summary := fmt.Sprintf("Daemon: %s (pid %d, mode %s)", state, resp.PID, resp.Mode)
 	if len(resp.Tunnels) == 0 {
 		summary += " — no tunnels managed"
 	}
 	if hasErrors {
 		summary += " — errors detected"
 	}
-	display.SetFooter(summary)
+	display.SetFooter(strings.Join(append([]string{summary}, supervisionLines(resp.Supervisor)...), "\n"))
 	return nil
 }
 
@@ -381,6 +811,9 @@ func runStopCommand(paths daemon.Paths) error {
 		fmt.Println("tunn daemon not running")
 		return nil
 	}
+	if supervision, _ := daemon.ReadSupervision(paths); supervision != nil && !supervision.NextStart.IsZero() {
+		return stopSupervisor(paths, supervision)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
@@ -413,6 +846,92 @@ func runStopCommand(paths daemon.Paths) error {
 	return nil
 }
 
+func runReloadCommand(paths daemon.Paths) error {
+	_, running, err := daemon.CheckRunning(paths)
+	if err != nil {
+		return err
+	}
+	if !running {
+		fmt.Println("tunn daemon not running")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	resp, err := daemon.SendReload(ctx, paths)
+	if err != nil {
+		return requestError("failed to send reload command", err)
+	}
+	if err := resp.Err(); err != nil {
+		return fmt.Errorf("reload failed: %w", err)
+	}
+
+	fmt.Printf("configuration reloaded: %s\n", resp.Message)
+	if resp.Changes != nil {
+		printChanges("started", resp.Changes.Added)
+		printChanges("stopped", resp.Changes.Removed)
+		printChanges("restarted", resp.Changes.Changed)
+	}
+	return nil
+}
+
+// requestError describes a failed daemon request. A daemon from another
+// build is reported as is, since the fix is to restart it rather than to
+// retry.
+func requestError(what string, err error) error {
+	var versionErr *daemon.VersionError
+	if errors.As(err, &versionErr) {
+		return err
+	}
+	return fmt.Errorf("%s: %w", what, err)
+}
+
+// runTunnelCommand asks the daemon to start, stop or restart single tunnels or
+// ports while it keeps running the others, and prints what changed.
+func runTunnelCommand(paths daemon.Paths, action string, refs []string) error {
+	_, running, err := daemon.CheckRunning(paths)
+	if err != nil {
+		return err
+	}
+	if !running {
+		return fmt.Errorf("tunn daemon not running; start it with 'tunn --detach'")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	send := daemon.SendStartTunnels
+	switch action {
+	case "stop":
+		send = daemon.SendStopTunnels
+	case "restart":
+		send = daemon.SendRestartTunnels
+	}
+	resp, err := send(ctx, paths, refs)
+	if err != nil {
+		return requestError(fmt.Sprintf("failed to send %s command", action), err)
+	}
+	if err := resp.Err(); err != nil {
+		return fmt.Errorf("%s failed: %w", action, err)
+	}
+
+	if resp.Changes == nil || resp.Changes.Empty() {
+		fmt.Println("no changes")
+		return nil
+	}
+	printChanges("started", resp.Changes.Added)
+	printChanges("stopped", resp.Changes.Removed)
+	printChanges("restarted", resp.Changes.Changed)
+	return nil
+}
+
+func printChanges(label string, names []string) {
+	for _, name := range names {
+		fmt.Printf("  %-9s %s\n", label, name)
+	}
+}
+
 func monitorDaemonStartup(paths daemon.Paths, duration time.Duration, render bool) (bool, error) {
 	if duration <= 0 {
 		return false, nil
@@ -547,6 +1066,7 @@ func applySnapshotToDisplay(display *output.Display, resp *daemon.StatusResponse
 	if resp == nil {
 		return false
 	}
+	display.SetProfile(resp.Profile)
 
 	tunnels := append([]status.Tunnel(nil), resp.Tunnels...)
 	sort.Slice(tunnels, func(i, j int) bool {
@@ -561,6 +1081,12 @@ func applySnapshotToDisplay(display *output.Display, resp *daemon.StatusResponse
 		}
 		sort.Strings(ports)
 		for _, port := range ports {
+			if name := tun.Names[port]; name != "" {
+				display.SetPortName(tun.Name, port, name)
+			}
+			if local := tun.Local[port]; local != "" {
+				display.SetLocalPort(tun.Name, port, local)
+			}
 			state := tun.Ports[port]
 			key := tun.Name + "|" + port
 			if prev, ok := cache[key]; !ok || prev != state {
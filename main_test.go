@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/daemon"
+)
+
+func TestAddToDaemonRejectsSelectors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *cli.Options
+	}{
+		{"tags", &cli.Options{Tags: []string{"prod"}}},
+		{"exclude", &cli.Options{TunnelNames: []string{"db"}, Exclude: []string{"api"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The daemon is never queried, so the paths need no socket.
+			err := addToDaemon(daemon.Paths{}, 42, tt.opts)
+			want := "tunn daemon already running (pid 42); only tunnel names can be added to it, so stop it to relaunch with --tag or --exclude"
+			if err == nil || err.Error() != want {
+				t.Fatalf("expected %q, got %v", want, err)
+			}
+		})
+	}
+}
+
+func TestCheckDaemonMatch(t *testing.T) {
+	const home = "/home/user/.tunnrc"
+	tests := []struct {
+		name    string
+		current daemon.StatusResponse
+		profile string
+		env     string
+		path    string
+		want    string
+	}{
+		{name: "no profile", current: daemon.StatusResponse{Config: home}, path: home},
+		{name: "matching flag", current: daemon.StatusResponse{Profile: "prod", Config: home}, profile: "prod", path: home},
+		{name: "matching env", current: daemon.StatusResponse{Profile: "prod", Config: home}, env: "prod", path: home},
+		{name: "flag overrides env", current: daemon.StatusResponse{Profile: "prod", Config: home}, profile: "prod", env: "dev", path: home},
+		{name: "daemon without config path", current: daemon.StatusResponse{}, path: home},
+		{
+			name:    "mismatched flag",
+			current: daemon.StatusResponse{Profile: "prod", Config: home},
+			profile: "dev",
+			path:    home,
+			want:    "tunn daemon already running (pid 42) with profile prod; stop it to relaunch with profile dev",
+		},
+		{
+			name:    "mismatched env",
+			current: daemon.StatusResponse{Profile: "prod", Config: home},
+			env:     "dev",
+			path:    home,
+			want:    "tunn daemon already running (pid 42) with profile prod; stop it to relaunch with profile dev",
+		},
+		{
+			name:    "daemon has a profile",
+			current: daemon.StatusResponse{Profile: "prod", Config: home},
+			path:    home,
+			want:    "tunn daemon already running (pid 42) with profile prod; stop it to relaunch with no profile",
+		},
+		{
+			name:    "daemon has no profile",
+			current: daemon.StatusResponse{Config: home},
+			profile: "dev",
+			path:    home,
+			want:    "tunn daemon already running (pid 42) with no profile; stop it to relaunch with profile dev",
+		},
+		{
+			name:    "project config",
+			current: daemon.StatusResponse{Config: home},
+			path:    "/src/app/.tunnrc",
+			want:    "tunn daemon already running (pid 42) with /home/user/.tunnrc; stop it to relaunch with /src/app/.tunnrc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TUNN_PROFILE", tt.env)
+			err := checkDaemonMatch(&tt.current, 42, &cli.Options{Profile: tt.profile, TunnelNames: []string{"db"}}, tt.path)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("expected a match, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
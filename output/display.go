@@ -6,10 +6,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/strandnerd/tunn/config"
 )
 
 const (
 	ColorReset  = "\033[0m"
+	ColorBold   = "\033[1m"
 	ColorRed    = "\033[31m"
 	ColorGreen  = "\033[32m"
 	ColorYellow = "\033[33m"
@@ -31,6 +34,8 @@ var tunnelColors = []string{
 type TunnelStatus struct {
 	Name  string
 	Ports map[string]string
+	Names map[string]string
+	Local map[string]string
 }
 
 type Display struct {
@@ -40,6 +45,7 @@ type Display struct {
 	colorIdx int
 	printed  bool
 	footer   string
+	profile  string
 }
 
 func NewDisplay() *Display {
@@ -67,21 +73,55 @@ func (d *Display) UpdateStatus(tunnelName string, port string, status string) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	if _, exists := d.statuses[tunnelName]; !exists {
-		d.statuses[tunnelName] = &TunnelStatus{
-			Name:  tunnelName,
-			Ports: make(map[string]string),
-		}
-	}
-
-	d.statuses[tunnelName].Ports[port] = status
+	d.tunnelLocked(tunnelName).Ports[port] = status
 	d.printStatuses()
 }
 
+// SetPortName attaches a configured name to a port row. The name is shown
+// the next time the table is rendered.
+func (d *Display) SetPortName(tunnelName string, port string, name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.tunnelLocked(tunnelName).Names[port] = name
+}
+
+// SetLocalPort records the local port picked for an automatic port, shown in
+// place of "auto" the next time the table is rendered.
+func (d *Display) SetLocalPort(tunnelName string, port string, local string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.tunnelLocked(tunnelName).Local[port] = local
+}
+
+// tunnelLocked returns the status entry for a tunnel, creating it if needed.
+// Callers must hold d.mu before invoking this helper.
+func (d *Display) tunnelLocked(tunnelName string) *TunnelStatus {
+	if status, exists := d.statuses[tunnelName]; exists {
+		return status
+	}
+	status := &TunnelStatus{
+		Name:  tunnelName,
+		Ports: make(map[string]string),
+		Names: make(map[string]string),
+		Local: make(map[string]string),
+	}
+	d.statuses[tunnelName] = status
+	return status
+}
+
 func (d *Display) printStatuses() {
 	// Clear screen and reprint
 	fmt.Print("\033[H\033[2J")
 	fmt.Printf("%stunn is listening...%s\n", ColorGray, ColorReset)
+	if d.profile != "" {
+		profileColor := ColorYellow
+		if config.IsProductionProfile(d.profile) {
+			profileColor = ColorRed
+		}
+		fmt.Printf("%s%s▶ PROFILE: %s%s\n", profileColor, ColorBold, d.profile, ColorReset)
+	}
 	fmt.Println()
 
 	names := make([]string, 0, len(d.statuses))
@@ -135,13 +175,22 @@ func (d *Display) printStatuses() {
 				statusColor = ColorGreen
 			case strings.HasPrefix(statusLower, "error"):
 				statusColor = ColorRed
-			case strings.HasPrefix(statusLower, "connecting"), strings.HasPrefix(statusLower, "stopping"):
+			case strings.HasPrefix(statusLower, "idle"):
+				statusColor = ColorBlue
+			case strings.HasPrefix(statusLower, "connecting"), strings.HasPrefix(statusLower, "stopping"), strings.HasPrefix(statusLower, "waiting"):
 				statusColor = ColorYellow
 			}
 
 			local, remote := parsePort(port)
-			fmt.Printf("    %s ➜ %s %s[%s]%s\n",
-				local, remote, statusColor, portStatus, ColorReset)
+			if assigned := status.Local[port]; assigned != "" {
+				local = assigned
+			}
+			label := ""
+			if name := status.Names[port]; name != "" {
+				label = fmt.Sprintf("%s(%s)%s ", ColorGray, name, ColorReset)
+			}
+			fmt.Printf("    %s ➜ %s %s%s[%s]%s\n",
+				local, remote, label, statusColor, portStatus, ColorReset)
 		}
 		fmt.Println()
 	}
@@ -152,6 +201,15 @@ func (d *Display) printStatuses() {
 	}
 }
 
+// SetProfile records the active configuration profile shown in the header.
+// The header is updated the next time the table is rendered.
+func (d *Display) SetProfile(profile string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.profile = strings.TrimSpace(profile)
+}
+
 // SetFooter updates the message rendered beneath the tunnel table.
 func (d *Display) SetFooter(message string) {
 	d.mu.Lock()
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/strandnerd/tunn/daemon"
+	"github.com/strandnerd/tunn/status"
+)
+
+// runPortCommand prints the local port a running tunnel listens on, which is
+// how scripts find the port picked for an automatic forward.
+func runPortCommand(paths daemon.Paths, ref string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := daemon.QueryStatus(ctx, paths)
+	if err != nil {
+		pid, running, checkErr := daemon.CheckRunning(paths)
+		if checkErr != nil {
+			return fmt.Errorf("failed to check daemon status: %w", checkErr)
+		}
+		if running {
+			return fmt.Errorf("daemon (pid %d) is unreachable: %v", pid, err)
+		}
+		return fmt.Errorf("tunn daemon not running")
+	}
+
+	local, err := lookupLocalPort(resp.Tunnels, ref)
+	if err != nil {
+		return err
+	}
+	fmt.Println(local)
+	return nil
+}
+
+// lookupLocalPort finds the local port of a tunnel/port reference. The port
+// part may be a port name, a mapping, or its local port, and can be left out
+// when the tunnel has a single port.
+func lookupLocalPort(tunnels []status.Tunnel, ref string) (string, error) {
+	name, portRef, _ := strings.Cut(ref, "/")
+
+	var tun *status.Tunnel
+	for i := range tunnels {
+		if tunnels[i].Name == name {
+			tun = &tunnels[i]
+			break
+		}
+	}
+	if tun == nil {
+		return "", fmt.Errorf("tunnel %q is not running in the daemon", name)
+	}
+
+	mappings := make([]string, 0, len(tun.Ports))
+	for mapping := range tun.Ports {
+		mappings = append(mappings, mapping)
+	}
+	sort.Strings(mappings)
+
+	var mapping string
+	switch {
+	case portRef == "" && len(mappings) == 1:
+		mapping = mappings[0]
+	case portRef == "":
+		return "", fmt.Errorf("tunnel %q has several ports (%s); use %s/<port>", name, strings.Join(mappings, ", "), name)
+	default:
+		for _, candidate := range mappings {
+			if portRef == candidate || portRef == tun.Names[candidate] || portRef == mappingLocalPort(candidate) || portRef == tun.Local[candidate] {
+				mapping = candidate
+				break
+			}
+		}
+		if mapping == "" {
+			return "", fmt.Errorf("tunnel %q has no port %q", name, portRef)
+		}
+	}
+
+	if local := tun.Local[mapping]; local != "" {
+		return local, nil
+	}
+	local := mappingLocalPort(mapping)
+	if local == "auto" {
+		return "", fmt.Errorf("%s %s has no local port yet (%s)", name, mapping, tun.Ports[mapping])
+	}
+	return local, nil
+}
+
+// mappingLocalPort returns the local side of a port mapping: the first field
+// of a local or dynamic forward, and the last field of a remote forward.
+func mappingLocalPort(mapping string) string {
+	fields := strings.Split(mapping, ":")
+	if strings.HasPrefix(mapping, "R") {
+		return fields[len(fields)-1]
+	}
+	return fields[0]
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/daemon"
+	"github.com/strandnerd/tunn/status"
+	"github.com/strandnerd/tunn/systemd"
+	"github.com/strandnerd/tunn/tunnel"
+)
+
+// watchdogTimeout bounds how long the liveness check before a watchdog ping
+// waits for the daemon to answer.
+const watchdogTimeout = 5 * time.Second
+
+// notifySystemd keeps the status line of the service up to date with the
+// tunnels and pings the watchdog whenever alive reports the daemon answers,
+// so that systemd restarts a daemon that hangs.
+func notifySystemd(ctx context.Context, notifier *systemd.Notifier, store *status.Store, alive func(context.Context) error, logger *log.Logger) {
+	var watchdog <-chan time.Time
+	if interval := notifier.WatchdogInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+
+	last := ""
+	report := func() {
+		summary := status.Summarize(store.Snapshot())
+		if summary == last {
+			return
+		}
+		last = summary
+		if err := notifier.Status(summary); err != nil {
+			logger.Printf("failed to notify systemd: %v", err)
+		}
+	}
+
+	_, events, cancel := store.Subscribe(64)
+	defer func() { cancel() }()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-events:
+			if !ok {
+				// The subscription fell behind; the snapshot catches up.
+				_, events, cancel = store.Subscribe(64)
+			}
+			report()
+		case <-watchdog:
+			report()
+			checkCtx, cancelCheck := context.WithTimeout(ctx, watchdogTimeout)
+			err := alive(checkCtx)
+			cancelCheck()
+			if err != nil {
+				logger.Printf("liveness check failed, not pinging the watchdog: %v", err)
+				continue
+			}
+			_ = notifier.Watchdog()
+		}
+	}
+}
+
+// daemonAlive checks that the tunnel manager and the control socket of the
+// daemon answer.
+func daemonAlive(paths daemon.Paths, manager *tunnel.Manager) func(context.Context) error {
+	return func(ctx context.Context) error {
+		answered := make(chan struct{})
+		go func() {
+			manager.Tunnels()
+			close(answered)
+		}()
+		select {
+		case <-answered:
+		case <-ctx.Done():
+			return errors.New("tunnel manager is not answering")
+		}
+		if _, err := daemon.QueryStatus(ctx, paths); err != nil {
+			return fmt.Errorf("control socket is not answering: %w", err)
+		}
+		return nil
+	}
+}
+
+func runServiceAction(paths daemon.Paths, opts *cli.Options) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("tunn service needs systemd, which is only available on Linux")
+	}
+	unit, err := systemd.UnitFor(opts.Profile)
+	if err != nil {
+		return err
+	}
+	dir, err := systemd.Dir()
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, systemd.FileFor(opts.Profile))
+
+	switch opts.ServiceAction {
+	case "install":
+		return installService(paths, opts, dir, file, unit)
+	case "uninstall":
+		return uninstallService(opts, dir, file, unit)
+	case "status":
+		return serviceStatus(file, unit)
+	default:
+		return fmt.Errorf("unknown service action: %s", opts.ServiceAction)
+	}
+}
+
+// installService writes the unit running the daemon, enables it so that it
+// starts at login and starts it unless a daemon already runs.
+func installService(paths daemon.Paths, opts *cli.Options, dir, file, unit string) error {
+	enabled, err := systemd.Enabled(dir)
+	if err != nil {
+		return err
+	}
+	for _, other := range enabled {
+		if other != unit {
+			return fmt.Errorf("%s is already installed and only one tunn daemon can run at a time; remove it first with 'tunn service uninstall%s'", other, profileFlag(other))
+		}
+	}
+
+	// The daemon would fail at every start with a configuration it cannot
+	// run, so check it now.
+	cfg, err := loadServiceConfig(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := selectTunnels(cfg, opts); err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(file, []byte(systemd.Render(executable, opts.Profile)), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	fmt.Printf("wrote %s\n", file)
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl("enable", unit); err != nil {
+		return err
+	}
+
+	if systemctlState("is-active", unit) == "active" {
+		fmt.Printf("%s is enabled and running; restart it with 'systemctl --user restart %s' to apply the new unit\n", unit, unit)
+		return nil
+	}
+	pid, running, err := daemon.CheckRunning(paths)
+	if err != nil {
+		return err
+	}
+	if running {
+		fmt.Printf("%s is enabled and starts at the next login; tunn daemon (pid %d) already runs outside systemd, so stop it with 'tunn stop' and run 'systemctl --user start %s' to switch now\n", unit, pid, unit)
+		return nil
+	}
+	if err := systemctl("start", unit); err != nil {
+		return err
+	}
+	fmt.Printf("%s is enabled and running; follow it with 'journalctl --user -u %s -f'\n", unit, unit)
+	return nil
+}
+
+// loadServiceConfig loads the configuration the unit runs: the one in the
+// home directory, where systemd starts user services, with no profile but the
+// one passed to the unit.
+func loadServiceConfig(opts *cli.Options) (*config.Config, error) {
+	if env := config.ProfileFromEnv(); env != "" && opts.Profile == "" {
+		return nil, fmt.Errorf("%s=%s does not reach the service; install it for that profile with 'tunn service install --profile %s'", config.ProfileEnv, env, env)
+	}
+	path, err := config.DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("~/.tunnrc not found. Run 'tunn init' to create one")
+		}
+		return nil, err
+	}
+	for _, warning := range cfg.Warnings {
+		fmt.Fprintln(os.Stderr, warning.String())
+	}
+	if err := cfg.ApplyProfile(opts.Profile); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// uninstallService stops and disables the unit and removes its file. The
+// template unit stays while other profiles still use it.
+func uninstallService(opts *cli.Options, dir, file, unit string) error {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return fmt.Errorf("%s is not installed", unit)
+	}
+	if err := systemctl("disable", "--now", unit); err != nil {
+		return err
+	}
+	fmt.Printf("%s stopped and disabled\n", unit)
+
+	enabled, err := systemd.Enabled(dir)
+	if err != nil {
+		return err
+	}
+	for _, other := range enabled {
+		if opts.Profile != "" && strings.HasPrefix(other, "tunn@") {
+			fmt.Printf("kept %s, which %s still uses\n", file, other)
+			return systemctl("daemon-reload")
+		}
+	}
+	if err := os.Remove(file); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", file, err)
+	}
+	fmt.Printf("removed %s\n", file)
+	return systemctl("daemon-reload")
+}
+
+func serviceStatus(file, unit string) error {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		fmt.Printf("%s is not installed; run 'tunn service install%s' to start tunnels at login\n", unit, profileFlag(unit))
+		return nil
+	}
+	fmt.Printf("Unit: %s (%s)\n", unit, file)
+	fmt.Printf("Enabled: %s\n", systemctlState("is-enabled", unit))
+	fmt.Printf("Active: %s\n", systemctlState("is-active", unit))
+	if text := systemctlState("show", "--property=StatusText", "--value", unit); text != "" && text != "unknown" {
+		fmt.Printf("Status: %s\n", text)
+	}
+	fmt.Printf("Logs: journalctl --user -u %s\n", unit)
+	return nil
+}
+
+// profileFlag returns the --profile flag selecting the profile a unit runs.
+func profileFlag(unit string) string {
+	instance, ok := strings.CutPrefix(strings.TrimSuffix(unit, ".service"), "tunn@")
+	if !ok {
+		return ""
+	}
+	return " --profile " + instance
+}
+
+// systemctl runs a command against the user's service manager.
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("systemctl --user %s failed: %s", strings.Join(args, " "), msg)
+		}
+		return fmt.Errorf("systemctl --user %s failed: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// systemctlState returns what a query such as is-active prints, which it
+// also prints when it exits with an error.
+func systemctlState(args ...string) string {
+	out, _ := exec.Command("systemctl", append([]string{"--user"}, args...)...).Output()
+	if state := strings.TrimSpace(string(out)); state != "" {
+		return state
+	}
+	return "unknown"
+}
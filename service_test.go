@@ -0,0 +1,149 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/daemon"
+	"github.com/strandnerd/tunn/status"
+	"github.com/strandnerd/tunn/systemd"
+	"github.com/strandnerd/tunn/tunnel"
+)
+
+func TestNotifySystemdChecksLiveness(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	var healthy atomic.Bool
+	var checks atomic.Int32
+	alive := func(context.Context) error {
+		checks.Add(1)
+		if !healthy.Load() {
+			return errors.New("control socket is not answering")
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifySystemd(ctx, systemd.NewNotifier(), status.NewStore(), alive, log.New(io.Discard, "", 0))
+
+	// pings reads notifications for d and counts the watchdog pings.
+	pings := func(d time.Duration) int {
+		n := 0
+		buf := make([]byte, 1024)
+		deadline := time.Now().Add(d)
+		for {
+			_ = conn.SetReadDeadline(deadline)
+			read, err := conn.Read(buf)
+			if err != nil {
+				return n
+			}
+			if strings.Contains(string(buf[:read]), "WATCHDOG=1") {
+				n++
+			}
+		}
+	}
+
+	if n := pings(300 * time.Millisecond); n != 0 {
+		t.Fatalf("expected no watchdog pings while the daemon does not answer, got %d", n)
+	}
+	if checks.Load() == 0 {
+		t.Fatal("expected the daemon to be checked on every watchdog tick")
+	}
+	healthy.Store(true)
+	if n := pings(300 * time.Millisecond); n == 0 {
+		t.Fatal("expected watchdog pings once the daemon answers")
+	}
+}
+
+func TestDaemonAliveWithoutSocket(t *testing.T) {
+	paths := daemon.Paths{SocketFile: filepath.Join(t.TempDir(), "tunn.sock")}
+	alive := daemonAlive(paths, tunnel.NewManager(nil, nil, nil))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := alive(ctx)
+	if err == nil || !strings.HasPrefix(err.Error(), "control socket is not answering") {
+		t.Fatalf("expected the missing control socket to fail the check, got %v", err)
+	}
+}
+
+func TestLoadServiceConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	homeConfig := `tunnels:
+  db:
+    host: bastion
+    ports:
+      - 5432
+profiles:
+  prod:
+    db:
+      host: prod-db
+`
+	if err := os.WriteFile(filepath.Join(home, ".tunnrc"), []byte(homeConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The unit runs in the home directory, so a project file does not apply.
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, ".tunnrc"), []byte("tunnels:\n  web:\n    host: web\n    ports:\n      - 8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+
+	tests := []struct {
+		name    string
+		profile string
+		env     string
+		host    string
+		wantErr string
+	}{
+		{name: "no profile", host: "bastion"},
+		{name: "profile", profile: "prod", host: "prod-db"},
+		{name: "flag overrides env", profile: "prod", env: "dev", host: "prod-db"},
+		{name: "env only", env: "prod", wantErr: "TUNN_PROFILE=prod does not reach the service; install it for that profile with 'tunn service install --profile prod'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TUNN_PROFILE", tt.env)
+			cfg, err := loadServiceConfig(&cli.Options{Profile: tt.profile})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if cfg.Path != filepath.Join(home, ".tunnrc") {
+				t.Errorf("expected the home config, got %s", cfg.Path)
+			}
+			if _, ok := cfg.Tunnels["web"]; ok {
+				t.Errorf("expected the project config to be ignored, got %v", cfg.Tunnels)
+			}
+			if got := cfg.Tunnels["db"].Host; got != tt.host {
+				t.Errorf("expected db on %s, got %s", tt.host, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/config"
+)
+
+// runConfigShow prints the selected tunnels as they will run, with the file,
+// line and layer every value comes from.
+func runConfigShow(opts *cli.Options) error {
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	selected, err := selectTunnels(cfg, opts)
+	if err != nil {
+		return err
+	}
+	resolution, err := config.Resolve(cfg, selected, opts.Profile == "" && cfg.Profile != "")
+	if err != nil {
+		return err
+	}
+
+	if opts.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(resolution)
+	}
+
+	header := "# " + tildePath(resolution.File)
+	if resolution.Profile != "" {
+		header += ", profile " + resolution.Profile
+		if resolution.ProfileFromEnv {
+			header += " (from " + config.ProfileEnv + ")"
+		}
+	}
+	fmt.Println(header)
+
+	for _, tunnel := range resolution.Tunnels {
+		fmt.Printf("\n%s  %s\n", tunnel.Name, originString(tunnel.Origin))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, field := range tunnel.Fields {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", field.Field, valueString(field.Value), originString(field.Origin))
+		}
+		for _, port := range tunnel.Ports {
+			fmt.Fprintf(w, "  port\t%s\t\n", port.Mapping)
+			for _, field := range port.Fields {
+				fmt.Fprintf(w, "    %s\t%s\t%s\n", field.Field, valueString(field.Value), originString(field.Origin))
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func originString(origin config.Origin) string {
+	origin.File = tildePath(origin.File)
+	return origin.String()
+}
+
+func valueString(value any) string {
+	if list, ok := value.([]string); ok {
+		return strings.Join(list, ", ")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,187 @@
+package sshconfig
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/strandnerd/tunn/config"
+)
+
+// Import is the result of converting forwarding directives into tunnels.
+type Import struct {
+	Tunnels []config.TunnelEntry
+	// Skipped explains directives and blocks that could not be converted.
+	Skipped []string
+}
+
+// ImportTunnels turns LocalForward, RemoteForward and DynamicForward lines
+// into tunnel definitions, one per Host alias matching pattern. The tunnel
+// connects to the alias itself so ssh keeps applying the rest of the block.
+func (c *Config) ImportTunnels(pattern string) Import {
+	var result Import
+	index := make(map[string]int)
+
+	for _, host := range c.Hosts {
+		forwards := forwardOptions(host)
+		if len(forwards) == 0 {
+			continue
+		}
+
+		alias := ""
+		for _, candidate := range host.Aliases() {
+			if MatchAlias(pattern, candidate) {
+				alias = candidate
+				break
+			}
+		}
+		if alias == "" {
+			if len(host.Aliases()) == 0 && pattern == "" {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s:%d: Host %s only has wildcard patterns", displayPath(host.File), host.Line, strings.Join(host.Patterns, " ")))
+			}
+			continue
+		}
+
+		var ports []config.Port
+		for _, opt := range forwards {
+			port, err := ParseForward(opt)
+			if err != nil {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s:%d: %v", displayPath(opt.File), opt.Line, err))
+				continue
+			}
+			ports = append(ports, port)
+		}
+		if len(ports) == 0 {
+			continue
+		}
+
+		if i, ok := index[alias]; ok {
+			existing := &result.Tunnels[i]
+			existing.Tunnel.Ports = append(existing.Tunnel.Ports, ports...)
+			continue
+		}
+		index[alias] = len(result.Tunnels)
+		result.Tunnels = append(result.Tunnels, config.TunnelEntry{
+			Name:    TunnelName(alias),
+			Comment: fmt.Sprintf("imported from %s:%d", displayPath(host.File), host.Line),
+			Tunnel: config.Tunnel{
+				Host:  alias,
+				Ports: ports,
+			},
+		})
+	}
+	return result
+}
+
+// ParseForward converts a single forwarding option into a port entry.
+func ParseForward(opt Option) (config.Port, error) {
+	name := keywordName(opt.Keyword)
+	if len(opt.Args) == 0 {
+		return config.Port{}, fmt.Errorf("%s requires arguments", name)
+	}
+
+	bind, listen, err := splitAddress(opt.Args[0], false)
+	if err != nil {
+		return config.Port{}, fmt.Errorf("%s %s: %w", name, opt.Args[0], err)
+	}
+
+	switch opt.Keyword {
+	case "dynamicforward":
+		return config.Port{Local: listen, Bind: bind, Forward: config.ForwardDynamic}, nil
+	case "localforward", "remoteforward":
+		if len(opt.Args) < 2 {
+			if opt.Keyword == "remoteforward" {
+				return config.Port{}, fmt.Errorf("%s without a destination (reverse SOCKS) is not supported", name)
+			}
+			return config.Port{}, fmt.Errorf("%s requires a destination", name)
+		}
+		host, port, err := splitAddress(opt.Args[1], true)
+		if err != nil {
+			return config.Port{}, fmt.Errorf("%s %s: %w", name, opt.Args[1], err)
+		}
+		if strings.EqualFold(host, "localhost") {
+			host = ""
+		}
+		if opt.Keyword == "remoteforward" {
+			return config.Port{Local: port, Remote: listen, TargetHost: host, Bind: bind, Forward: config.ForwardRemote}, nil
+		}
+		return config.Port{Local: listen, Remote: port, TargetHost: host, Bind: bind}, nil
+	}
+	return config.Port{}, fmt.Errorf("%s is not a forwarding directive", opt.Keyword)
+}
+
+// TunnelName derives a valid tunnel name from a Host alias.
+func TunnelName(alias string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '@', ' ':
+			return '-'
+		}
+		return r
+	}, alias)
+}
+
+func forwardOptions(host *Host) []Option {
+	var forwards []Option
+	for _, opt := range host.Options {
+		switch opt.Keyword {
+		case "localforward", "remoteforward", "dynamicforward":
+			forwards = append(forwards, opt)
+		}
+	}
+	return forwards
+}
+
+// splitAddress parses "[host:]port", also accepting ssh's "host/port" and
+// bracketed IPv6 forms. When hostRequired is set the host part must be present.
+func splitAddress(spec string, hostRequired bool) (string, string, error) {
+	var host, port string
+	switch {
+	case strings.Contains(spec, "/") && !strings.HasPrefix(spec, "/"):
+		i := strings.LastIndex(spec, "/")
+		host, port = spec[:i], spec[i+1:]
+	case strings.HasPrefix(spec, "["):
+		end := strings.Index(spec, "]")
+		if end < 0 || end+1 >= len(spec) || spec[end+1] != ':' {
+			return "", "", fmt.Errorf("malformed address")
+		}
+		host, port = spec[:end+1], spec[end+2:]
+	case strings.Contains(spec, ":"):
+		i := strings.LastIndex(spec, ":")
+		host, port = spec[:i], spec[i+1:]
+	default:
+		port = spec
+	}
+
+	if strings.HasPrefix(port, "/") || strings.HasPrefix(spec, "/") {
+		return "", "", fmt.Errorf("unix socket forwards are not supported")
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return "", "", fmt.Errorf("%q is not a valid port", port)
+	}
+	if hostRequired && host == "" {
+		return "", "", fmt.Errorf("missing destination host")
+	}
+	return host, port, nil
+}
+
+func keywordName(keyword string) string {
+	switch keyword {
+	case "localforward":
+		return "LocalForward"
+	case "remoteforward":
+		return "RemoteForward"
+	case "dynamicforward":
+		return "DynamicForward"
+	}
+	return keyword
+}
+
+func displayPath(p string) string {
+	if home, err := os.UserHomeDir(); err == nil && home != "" && strings.HasPrefix(p, home+string(os.PathSeparator)) {
+		return "~" + strings.TrimPrefix(p, home)
+	}
+	return p
+}
@@ -0,0 +1,91 @@
+package sshconfig
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/strandnerd/tunn/config"
+)
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		keyword   string
+		args      []string
+		want      config.Port
+		wantError string
+	}{
+		{"localforward", []string{"5432", "localhost:5432"}, config.Port{Local: "5432", Remote: "5432"}, ""},
+		{"localforward", []string{"127.0.0.1:15432", "db.internal:5432"}, config.Port{Local: "15432", Remote: "5432", TargetHost: "db.internal", Bind: "127.0.0.1"}, ""},
+		{"localforward", []string{"8080", "[::1]:80"}, config.Port{Local: "8080", Remote: "80", TargetHost: "[::1]"}, ""},
+		{"localforward", []string{"8080", "web/80"}, config.Port{Local: "8080", Remote: "80", TargetHost: "web"}, ""},
+		{"remoteforward", []string{"9000", "localhost:3000"}, config.Port{Local: "3000", Remote: "9000", Forward: config.ForwardRemote}, ""},
+		{"dynamicforward", []string{"*:1080"}, config.Port{Local: "1080", Bind: "*", Forward: config.ForwardDynamic}, ""},
+		{"localforward", []string{"5432"}, config.Port{}, "requires a destination"},
+		{"remoteforward", []string{"9000"}, config.Port{}, "reverse SOCKS"},
+		{"localforward", []string{"/tmp/a.sock", "/tmp/b.sock"}, config.Port{}, "unix socket"},
+		{"localforward", []string{"99999", "localhost:1"}, config.Port{}, "not a valid port"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseForward(Option{Keyword: tt.keyword, Args: tt.args})
+		if tt.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("%s %v: expected error containing %q, got %v", tt.keyword, tt.args, tt.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: unexpected error: %v", tt.keyword, tt.args, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s %v: got %+v want %+v", tt.keyword, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestImportTunnels(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config"), `Host *
+  LocalForward 9999 localhost:9999
+
+Host db-prod db
+  LocalForward 5432 localhost:5432
+
+Host web@edge
+  LocalForward 8080 localhost:80
+  RemoteForward 9000
+
+Host db-prod
+  DynamicForward 1080
+`)
+
+	cfg, err := ParseFile(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result := cfg.ImportTunnels("")
+	if len(result.Tunnels) != 2 {
+		t.Fatalf("expected 2 tunnels, got %+v", result.Tunnels)
+	}
+	db := result.Tunnels[0]
+	if db.Name != "db-prod" || db.Tunnel.Host != "db-prod" || len(db.Tunnel.Ports) != 2 {
+		t.Fatalf("expected forwards for db-prod to be merged, got %+v", db)
+	}
+	if !strings.HasSuffix(db.Comment, "config:4") {
+		t.Fatalf("expected comment to point at the Host line, got %q", db.Comment)
+	}
+	if result.Tunnels[1].Name != "web-edge" {
+		t.Fatalf("expected sanitised tunnel name, got %q", result.Tunnels[1].Name)
+	}
+	if len(result.Skipped) != 2 {
+		t.Fatalf("expected wildcard block and reverse SOCKS forward to be skipped, got %v", result.Skipped)
+	}
+
+	filtered := cfg.ImportTunnels("web*")
+	if len(filtered.Tunnels) != 1 || filtered.Tunnels[0].Tunnel.Host != "web@edge" {
+		t.Fatalf("expected only web@edge, got %+v", filtered.Tunnels)
+	}
+}
@@ -0,0 +1,265 @@
+// Package sshconfig reads OpenSSH client configuration files.
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxIncludeDepth mirrors the nesting limit enforced by ssh itself.
+const maxIncludeDepth = 16
+
+// Option is a single keyword line inside a Host block.
+type Option struct {
+	Keyword string
+	Args    []string
+	File    string
+	Line    int
+}
+
+// Host is a Host block and the options that apply to it.
+type Host struct {
+	Patterns []string
+	Options  []Option
+	File     string
+	Line     int
+}
+
+// Config is a parsed ssh configuration, with Include directives resolved.
+type Config struct {
+	Hosts []*Host
+}
+
+// DefaultPath returns the location of the user's ssh configuration.
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".ssh", "config"), nil
+}
+
+// ParseFile reads the configuration at path. Relative Include paths are
+// resolved against the directory holding path, as ssh does for ~/.ssh/config.
+func ParseFile(path string) (*Config, error) {
+	p := &parser{baseDir: filepath.Dir(path)}
+	if err := p.parseFile(path, nil, 0); err != nil {
+		return nil, err
+	}
+	return &Config{Hosts: p.hosts}, nil
+}
+
+// Get returns the first value of keyword, as ssh uses the first match.
+func (h *Host) Get(keyword string) string {
+	keyword = strings.ToLower(keyword)
+	for _, opt := range h.Options {
+		if opt.Keyword == keyword && len(opt.Args) > 0 {
+			return opt.Args[0]
+		}
+	}
+	return ""
+}
+
+// All returns every occurrence of keyword in the block.
+func (h *Host) All(keyword string) []Option {
+	keyword = strings.ToLower(keyword)
+	var opts []Option
+	for _, opt := range h.Options {
+		if opt.Keyword == keyword {
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
+
+// Aliases returns the patterns of the block that name a concrete host
+// rather than a wildcard or negation.
+func (h *Host) Aliases() []string {
+	var aliases []string
+	for _, pattern := range h.Patterns {
+		if strings.ContainsAny(pattern, "*?!") {
+			continue
+		}
+		aliases = append(aliases, pattern)
+	}
+	return aliases
+}
+
+// Aliases lists every concrete host alias in the order it was defined.
+func (c *Config) Aliases() []string {
+	seen := make(map[string]bool)
+	var aliases []string
+	for _, host := range c.Hosts {
+		for _, alias := range host.Aliases() {
+			if seen[alias] {
+				continue
+			}
+			seen[alias] = true
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// Lookup returns the first block that defines alias explicitly.
+func (c *Config) Lookup(alias string) *Host {
+	for _, host := range c.Hosts {
+		for _, candidate := range host.Aliases() {
+			if candidate == alias {
+				return host
+			}
+		}
+	}
+	return nil
+}
+
+type parser struct {
+	baseDir string
+	hosts   []*Host
+}
+
+func (p *parser) parseFile(filePath string, current *Host, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: Include nested too deeply", filePath)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) && depth > 0 {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		keyword, args, err := splitLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", filePath, lineNo, err)
+		}
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			if len(args) == 0 {
+				return fmt.Errorf("%s:%d: Host requires at least one pattern", filePath, lineNo)
+			}
+			current = &Host{Patterns: args, File: filePath, Line: lineNo}
+			p.hosts = append(p.hosts, current)
+		case "match":
+			// Match conditions cannot be evaluated statically; ignore the
+			// block until the next Host line.
+			current = nil
+		case "include":
+			for _, pattern := range args {
+				if err := p.include(pattern, current, depth); err != nil {
+					return fmt.Errorf("%s:%d: %w", filePath, lineNo, err)
+				}
+			}
+		default:
+			if current == nil {
+				continue
+			}
+			current.Options = append(current.Options, Option{
+				Keyword: keyword,
+				Args:    args,
+				File:    filePath,
+				Line:    lineNo,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	return nil
+}
+
+func (p *parser) include(pattern string, current *Host, depth int) error {
+	pattern = expandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(p.baseDir, pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid Include pattern %q: %w", pattern, err)
+	}
+	sort.Strings(matches)
+	for _, match := range matches {
+		if err := p.parseFile(match, current, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitLine returns the lower-cased keyword and its arguments, accepting both
+// "Keyword value" and "Keyword=value" as well as double-quoted arguments.
+func splitLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+
+	var args []string
+	for rest != "" {
+		if rest[0] == '#' {
+			break
+		}
+		if rest[0] == '"' {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return "", nil, fmt.Errorf("unterminated quote in %s", keyword)
+			}
+			args = append(args, rest[1:closing+1])
+			rest = strings.TrimLeft(rest[closing+2:], " \t")
+			continue
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			args = append(args, rest)
+			break
+		}
+		args = append(args, rest[:end])
+		rest = strings.TrimLeft(rest[end:], " \t")
+	}
+	return keyword, args, nil
+}
+
+// MatchAlias reports whether alias matches the shell-style pattern used by
+// --host filters.
+func MatchAlias(pattern, alias string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(pattern, alias)
+	return err == nil && matched
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(p, "~"))
+		}
+	}
+	return p
+}
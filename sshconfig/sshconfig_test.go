@@ -0,0 +1,98 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config"), `# global settings
+Include conf.d/*.conf
+Host bastion jump
+  HostName bastion.example.com
+  User=deploy
+  IdentityFile "~/.ssh/id key"
+
+Match host *.corp
+  LocalForward 1111 localhost:1111
+
+Host *
+  ServerAliveInterval 30
+`)
+	writeFile(t, filepath.Join(dir, "conf.d", "b.conf"), "Host db\n  HostName db.internal\n")
+	writeFile(t, filepath.Join(dir, "conf.d", "a.conf"), "Host api\n  Port 2222\n")
+
+	cfg, err := ParseFile(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := cfg.Aliases(), []string{"api", "db", "bastion", "jump"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("aliases: got %v want %v", got, want)
+	}
+
+	bastion := cfg.Lookup("jump")
+	if bastion == nil {
+		t.Fatal("expected jump alias to resolve")
+	}
+	if bastion.Get("HostName") != "bastion.example.com" || bastion.Get("user") != "deploy" {
+		t.Fatalf("unexpected options: %+v", bastion.Options)
+	}
+	if bastion.Get("identityfile") != "~/.ssh/id key" {
+		t.Fatalf("expected quoted argument to be kept whole, got %q", bastion.Get("identityfile"))
+	}
+	for _, host := range cfg.Hosts {
+		if len(host.All("localforward")) > 0 {
+			t.Fatalf("expected Match block options to be ignored, found them on %v", host.Patterns)
+		}
+	}
+	if api := cfg.Lookup("api"); api == nil || api.Line != 1 || filepath.Base(api.File) != "a.conf" {
+		t.Fatalf("expected api to be defined at a.conf:1, got %+v", api)
+	}
+}
+
+func TestParseFileIncludeLoop(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config"), "Include config\n")
+
+	if _, err := ParseFile(filepath.Join(dir, "config")); err == nil {
+		t.Fatal("expected recursive Include to fail")
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		keyword string
+		args    []string
+	}{
+		{"  # comment", "", nil},
+		{"LocalForward 5432 db:5432", "localforward", []string{"5432", "db:5432"}},
+		{"LocalForward=5432 db:5432", "localforward", []string{"5432", "db:5432"}},
+		{"Host = a b", "host", []string{"a", "b"}},
+		{`IdentityFile "/path/with space"`, "identityfile", []string{"/path/with space"}},
+	}
+
+	for _, tt := range tests {
+		keyword, args, err := splitLine(tt.line)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.line, err)
+		}
+		if keyword != tt.keyword || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%q: got %q %q want %q %q", tt.line, keyword, args, tt.keyword, tt.args)
+		}
+	}
+}
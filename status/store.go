@@ -1,23 +1,93 @@
 package status
 
-import "sync"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
 
 // Tunnel represents the status of a single tunnel and its ports.
 type Tunnel struct {
 	Name  string
 	Ports map[string]string
+	Names map[string]string `json:",omitempty"`
+	// Local holds the local port picked for each automatic port.
+	Local map[string]string `json:",omitempty"`
+}
+
+// StateRemoved is the state reported in an Event when a port is dropped from
+// the store.
+const StateRemoved = "removed"
+
+// Event describes a transition of a single tunnel port.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Tunnel   string    `json:"tunnel"`
+	Port     string    `json:"port"`
+	State    string    `json:"state"`
+	Previous string    `json:"previous,omitempty"`
+	// Local is the local port picked for an automatic port, when known.
+	Local string `json:"local,omitempty"`
 }
 
 // Store keeps track of tunnel status updates for IPC consumers.
 type Store struct {
-	mu      sync.RWMutex
-	tunnels map[string]*Tunnel
+	mu          sync.RWMutex
+	tunnels     map[string]*Tunnel
+	subscribers map[chan Event]struct{}
 }
 
 // NewStore creates an empty status store ready for updates.
 func NewStore() *Store {
 	return &Store{
-		tunnels: make(map[string]*Tunnel),
+		tunnels:     make(map[string]*Tunnel),
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Subscribe returns a snapshot of the store along with a channel receiving
+// every port transition after it. A subscriber that falls more than buffer
+// events behind has its channel closed, as does calling cancel.
+func (s *Store) Subscribe(buffer int) ([]Tunnel, <-chan Event, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan Event, buffer)
+	s.subscribers[ch] = struct{}{}
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+	return s.snapshotLocked(), ch, cancel
+}
+
+// publishLocked sends a port transition to every subscriber. Callers must
+// hold s.mu for writing.
+func (s *Store) publishLocked(tun *Tunnel, port, previous, state string) {
+	if previous == state || len(s.subscribers) == 0 {
+		return
+	}
+	event := Event{
+		Time:     time.Now(),
+		Tunnel:   tun.Name,
+		Port:     port,
+		State:    state,
+		Previous: previous,
+		Local:    tun.Local[port],
+	}
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(s.subscribers, ch)
+			close(ch)
+		}
 	}
 }
 
@@ -38,6 +108,7 @@ func (s *Store) EnsureTunnel(name string, ports []string) {
 	for _, port := range ports {
 		if _, ok := tun.Ports[port]; !ok {
 			tun.Ports[port] = "pending"
+			s.publishLocked(tun, port, "", "pending")
 		}
 	}
 }
@@ -55,14 +126,103 @@ func (s *Store) Update(name string, port string, state string) {
 		}
 		s.tunnels[name] = tun
 	}
+	previous := tun.Ports[port]
 	tun.Ports[port] = state
+	s.publishLocked(tun, port, previous, state)
+}
+
+// Remove drops a tunnel and all of its ports from the store.
+func (s *Store) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tun, exists := s.tunnels[name]
+	if !exists {
+		return
+	}
+	delete(s.tunnels, name)
+	for port, state := range tun.Ports {
+		s.publishLocked(tun, port, state, StateRemoved)
+	}
+}
+
+// Retain drops every port of a tunnel that is not listed, along with its name
+// and assigned local port.
+func (s *Store) Retain(name string, ports []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tun, exists := s.tunnels[name]
+	if !exists {
+		return
+	}
+	keep := make(map[string]struct{}, len(ports))
+	for _, port := range ports {
+		keep[port] = struct{}{}
+	}
+	for port := range tun.Ports {
+		if _, ok := keep[port]; !ok {
+			s.publishLocked(tun, port, tun.Ports[port], StateRemoved)
+			delete(tun.Ports, port)
+			delete(tun.Names, port)
+			delete(tun.Local, port)
+		}
+	}
+}
+
+// SetPortName records the configured name of a tunnel port.
+func (s *Store) SetPortName(name string, port string, portName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tun, exists := s.tunnels[name]
+	if !exists {
+		tun = &Tunnel{
+			Name:  name,
+			Ports: make(map[string]string),
+		}
+		s.tunnels[name] = tun
+	}
+	if tun.Names == nil {
+		tun.Names = make(map[string]string)
+	}
+	tun.Names[port] = portName
+}
+
+// SetLocalPort records the local port picked for an automatic tunnel port.
+// Subscribers are told with an event repeating the port's current state.
+func (s *Store) SetLocalPort(name string, port string, local string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tun, exists := s.tunnels[name]
+	if !exists {
+		tun = &Tunnel{
+			Name:  name,
+			Ports: make(map[string]string),
+		}
+		s.tunnels[name] = tun
+	}
+	if tun.Local == nil {
+		tun.Local = make(map[string]string)
+	}
+	if tun.Local[port] == local {
+		return
+	}
+	tun.Local[port] = local
+	if state, ok := tun.Ports[port]; ok {
+		s.publishLocked(tun, port, "", state)
+	}
 }
 
 // Snapshot returns a copy of the current tunnel states suitable for external use.
 func (s *Store) Snapshot() []Tunnel {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.snapshotLocked()
+}
 
+func (s *Store) snapshotLocked() []Tunnel {
 	result := make([]Tunnel, 0, len(s.tunnels))
 	for _, tun := range s.tunnels {
 		clone := Tunnel{
@@ -72,7 +232,55 @@ func (s *Store) Snapshot() []Tunnel {
 		for port, state := range tun.Ports {
 			clone.Ports[port] = state
 		}
+		if len(tun.Names) > 0 {
+			clone.Names = make(map[string]string, len(tun.Names))
+			for port, portName := range tun.Names {
+				clone.Names[port] = portName
+			}
+		}
+		if len(tun.Local) > 0 {
+			clone.Local = make(map[string]string, len(tun.Local))
+			for port, local := range tun.Local {
+				clone.Local[port] = local
+			}
+		}
 		result = append(result, clone)
 	}
 	return result
 }
+
+// Summarize describes tunnel states in a single line, such as
+// "2/3 ports active; failing: db/5432:5432".
+func Summarize(tunnels []Tunnel) string {
+	total, active, idle := 0, 0, 0
+	var failing []string
+	for _, tun := range tunnels {
+		for port, state := range tun.Ports {
+			total++
+			switch {
+			case state == "active":
+				active++
+			case strings.HasPrefix(state, "idle"):
+				idle++
+			case strings.HasPrefix(state, "error"):
+				failing = append(failing, tun.Name+"/"+port)
+			}
+		}
+	}
+	if total == 0 {
+		return "no tunnels"
+	}
+	noun := "ports"
+	if total == 1 {
+		noun = "port"
+	}
+	summary := fmt.Sprintf("%d/%d %s active", active, total, noun)
+	if idle > 0 {
+		summary += fmt.Sprintf(", %d idle", idle)
+	}
+	if len(failing) > 0 {
+		sort.Strings(failing)
+		summary += "; failing: " + strings.Join(failing, ", ")
+	}
+	return summary
+}
@@ -38,3 +38,156 @@ func TestStore(t *testing.T) {
 		}
 	}
 }
+
+func TestStorePortNames(t *testing.T) {
+	s := NewStore()
+	s.EnsureTunnel("db", []string{"5432:5432"})
+	s.SetPortName("db", "5432:5432", "postgres")
+
+	snapshot := s.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Names["5432:5432"] != "postgres" {
+		t.Fatalf("expected port name to be recorded, got %+v", snapshot)
+	}
+
+	snapshot[0].Names["5432:5432"] = "mutated"
+	if s.Snapshot()[0].Names["5432:5432"] != "postgres" {
+		t.Fatal("expected snapshot names to be independent copies")
+	}
+}
+
+func TestStoreRemoveAndRetain(t *testing.T) {
+	s := NewStore()
+	s.EnsureTunnel("db", []string{"5432:5432", "6379:6379"})
+	s.SetPortName("db", "6379:6379", "redis")
+	s.EnsureTunnel("api", []string{"3000:3000"})
+
+	s.Retain("db", []string{"5432:5432"})
+	s.Remove("api")
+
+	snapshot := s.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Name != "db" {
+		t.Fatalf("expected only db to remain, got %+v", snapshot)
+	}
+	if _, ok := snapshot[0].Ports["6379:6379"]; ok || len(snapshot[0].Ports) != 1 {
+		t.Fatalf("expected only 5432 to remain, got %+v", snapshot[0].Ports)
+	}
+	if _, ok := snapshot[0].Names["6379:6379"]; ok {
+		t.Fatalf("expected name of dropped port to be removed")
+	}
+}
+
+func TestStoreLocalPorts(t *testing.T) {
+	s := NewStore()
+	s.EnsureTunnel("db", []string{"auto:5432", "auto:6379"})
+	s.SetLocalPort("db", "auto:5432", "20417")
+	s.SetLocalPort("db", "auto:6379", "23011")
+
+	snapshot := s.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Local["auto:5432"] != "20417" {
+		t.Fatalf("expected local port to be recorded, got %+v", snapshot)
+	}
+	snapshot[0].Local["auto:5432"] = "mutated"
+
+	s.Retain("db", []string{"auto:5432"})
+	local := s.Snapshot()[0].Local
+	if local["auto:5432"] != "20417" {
+		t.Fatal("expected snapshot local ports to be independent copies")
+	}
+	if _, ok := local["auto:6379"]; ok {
+		t.Fatal("expected local port of dropped port to be removed")
+	}
+}
+
+func TestStoreSubscribe(t *testing.T) {
+	s := NewStore()
+	s.EnsureTunnel("db", []string{"5432:5432"})
+
+	snapshot, events, cancel := s.Subscribe(8)
+	if len(snapshot) != 1 || snapshot[0].Ports["5432:5432"] != "pending" {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	s.Update("db", "5432:5432", "connecting")
+	s.Update("db", "5432:5432", "connecting")
+	s.SetLocalPort("db", "5432:5432", "20001")
+	s.Remove("db")
+
+	want := []Event{
+		{Tunnel: "db", Port: "5432:5432", State: "connecting", Previous: "pending"},
+		{Tunnel: "db", Port: "5432:5432", State: "connecting", Local: "20001"},
+		{Tunnel: "db", Port: "5432:5432", State: StateRemoved, Previous: "connecting", Local: "20001"},
+	}
+	for i, w := range want {
+		got := <-events
+		if got.Time.IsZero() {
+			t.Fatalf("event %d has no timestamp", i)
+		}
+		got.Time = w.Time
+		if got != w {
+			t.Fatalf("event %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Fatal("expected the channel to be closed after cancel")
+	}
+	cancel()
+}
+
+func TestStoreSubscribeOverflow(t *testing.T) {
+	s := NewStore()
+	_, events, cancel := s.Subscribe(1)
+	defer cancel()
+
+	s.Update("db", "5432", "connecting")
+	s.Update("db", "5432", "active")
+
+	if event := <-events; event.State != "connecting" {
+		t.Fatalf("expected the buffered event, got %+v", event)
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("expected a subscriber that fell behind to be closed")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name    string
+		tunnels []Tunnel
+		want    string
+	}{
+		{
+			name: "empty",
+			want: "no tunnels",
+		},
+		{
+			name:    "single port",
+			tunnels: []Tunnel{{Name: "db", Ports: map[string]string{"5432": "active"}}},
+			want:    "1/1 port active",
+		},
+		{
+			name: "failing ports",
+			tunnels: []Tunnel{
+				{Name: "db", Ports: map[string]string{"5432": "error - exit status 255", "6379": "active"}},
+				{Name: "api", Ports: map[string]string{"3000": "connecting", "4000": "error - bind failed"}},
+			},
+			want: "1/4 ports active; failing: api/4000, db/5432",
+		},
+		{
+			name: "idle ports",
+			tunnels: []Tunnel{
+				{Name: "db", Ports: map[string]string{"5432": "idle (listening)", "6379": "active"}},
+				{Name: "api", Ports: map[string]string{"3000": "idle (listening)"}},
+			},
+			want: "1/3 ports active, 2 idle",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Summarize(tt.tunnels); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
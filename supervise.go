@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/daemon"
+)
+
+const (
+	restartMinDelay = time.Second
+	restartMaxDelay = 2 * time.Minute
+	// stableRun is how long the daemon has to run before its next crash no
+	// longer counts as part of a crash loop.
+	stableRun = time.Minute
+	// crashLimit crashes within crashWindow make the supervisor give up on
+	// the daemon, which then fails on every start.
+	crashLimit  = 5
+	crashWindow = 10 * time.Minute
+)
+
+// runSupervisor starts the daemon with the same selection and configuration
+// and starts it again whenever it exits abnormally, waiting twice as long
+// after every crash in a row. It returns once the daemon exits cleanly, such
+// as after 'tunn stop', when the supervisor is told to stop, or with an
+// error once the daemon crashed crashLimit times within crashWindow.
+func runSupervisor(paths daemon.Paths, opts *cli.Options) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	args := daemonArgs(opts)
+
+	logFile, err := os.OpenFile(paths.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open daemon log: %w", err)
+	}
+	defer logFile.Close()
+	logger := log.New(logFile, "supervisor: ", log.LstdFlags)
+
+	state := &daemon.Supervision{PID: os.Getpid()}
+	if err := daemon.WriteSupervision(paths, state); err != nil {
+		return err
+	}
+	defer func() {
+		if state.GaveUp.IsZero() {
+			_ = daemon.RemoveSupervision(paths)
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	delay := restartMinDelay
+	for {
+		offset := int64(0)
+		if info, err := logFile.Stat(); err == nil {
+			offset = info.Size()
+		}
+
+		cmd := exec.Command(executable, args...)
+		cmd.Env = append(os.Environ(), daemon.SupervisorEnv+"="+strconv.Itoa(os.Getpid()))
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+		// The ssh processes of the daemon join its group, so that they can
+		// be stopped along with it when it crashes.
+		daemon.NewProcessGroup(cmd)
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to start daemon: %w", err)
+		}
+		if err := daemon.WritePID(paths, cmd.Process.Pid); err != nil {
+			logger.Printf("%v", err)
+		}
+		state.NextStart = time.Time{}
+		if err := daemon.WriteSupervision(paths, state); err != nil {
+			logger.Printf("%v", err)
+		}
+
+		started := time.Now()
+		done := make(chan struct{})
+		go func() {
+			_ = cmd.Wait()
+			close(done)
+		}()
+
+		select {
+		case sig := <-sigChan:
+			logger.Printf("received signal %v, stopping daemon (pid %d)", sig, cmd.Process.Pid)
+			_ = cmd.Process.Signal(syscall.SIGTERM)
+			<-done
+			return nil
+		case <-done:
+		}
+
+		if cmd.ProcessState.Success() {
+			return nil
+		}
+		if err := daemon.TerminateProcessGroup(cmd.Process.Pid); err != nil {
+			logger.Printf("failed to stop the processes left by the daemon: %v", err)
+		}
+
+		crash := daemon.Crash{
+			Time:    time.Now(),
+			Reason:  cmd.ProcessState.String(),
+			Message: crashMessage(paths.LogFile, offset),
+		}
+		if time.Since(started) >= stableRun {
+			delay = restartMinDelay
+		}
+		state.Record(crash)
+		if n := state.CrashesSince(time.Now().Add(-crashWindow)); n >= crashLimit {
+			state.NextStart = time.Time{}
+			state.GaveUp = time.Now()
+			if err := daemon.WriteSupervision(paths, state); err != nil {
+				logger.Printf("%v", err)
+			}
+			daemon.Cleanup(paths)
+			err := fmt.Errorf("daemon crashed %d times within %d minutes, last: %s; giving up", n, int(crashWindow.Minutes()), crash)
+			logger.Printf("%v", err)
+			return err
+		}
+		state.Restarts++
+		state.NextStart = time.Now().Add(delay)
+		// The supervisor stands in for the daemon until it is back, so that
+		// no second daemon is launched in the meantime.
+		if err := daemon.WritePID(paths, os.Getpid()); err != nil {
+			logger.Printf("%v", err)
+		}
+		if err := daemon.WriteSupervision(paths, state); err != nil {
+			logger.Printf("%v", err)
+		}
+		if crash.Message != "" {
+			logger.Printf("daemon (pid %d) crashed: %s (%s); restarting in %s", cmd.Process.Pid, crash.Reason, crash.Message, delay)
+		} else {
+			logger.Printf("daemon (pid %d) crashed: %s; restarting in %s", cmd.Process.Pid, crash.Reason, delay)
+		}
+
+		select {
+		case sig := <-sigChan:
+			logger.Printf("received signal %v while waiting to restart the daemon", sig)
+			daemon.Cleanup(paths)
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, restartMaxDelay)
+	}
+}
+
+// crashMessage finds the panic or error a daemon logged before it exited,
+// reading its log from offset.
+func crashMessage(path string, offset int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return ""
+	}
+
+	message := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "panic: "), strings.HasPrefix(line, "fatal error: "):
+			// The first line of a panic names it; the rest is the trace.
+			return line
+		case strings.HasPrefix(line, "Error: "):
+			message = strings.TrimPrefix(line, "Error: ")
+		}
+	}
+	return message
+}
+
+// stopSupervisor stops a supervisor that is waiting to restart a crashed
+// daemon.
+func stopSupervisor(paths daemon.Paths, state *daemon.Supervision) error {
+	process, err := os.FindProcess(state.PID)
+	if err != nil {
+		return err
+	}
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to stop supervisor (pid %d): %w", state.PID, err)
+	}
+	fmt.Printf("stopping supervisor... (pid %d)\n", state.PID)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		if current, _ := daemon.ReadSupervision(paths); current == nil {
+			fmt.Println("tunn daemon stopped")
+			return nil
+		}
+	}
+	return fmt.Errorf("supervisor (pid %d) did not stop in time", state.PID)
+}
+
+// supervisionLines describes the supervisor of a daemon for tunn status.
+func supervisionLines(state *daemon.Supervision) []string {
+	if state == nil {
+		return nil
+	}
+	lines := []string{fmt.Sprintf("Supervisor: pid %d, %s", state.PID, restartCount(state.Restarts))}
+	if !state.GaveUp.IsZero() {
+		lines[0] = fmt.Sprintf("Supervisor: gave up at %s, %s", state.GaveUp.Local().Format("2006-01-02 15:04:05"), restartCount(state.Restarts))
+	}
+	if crash, ok := state.LastCrash(); ok {
+		lines = append(lines, "Last crash: "+crash.String())
+	}
+	return lines
+}
+
+func restartCount(n int) string {
+	switch n {
+	case 0:
+		return "no restarts"
+	case 1:
+		return "restarted once"
+	default:
+		return fmt.Sprintf("restarted %d times", n)
+	}
+}
@@ -0,0 +1,77 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notifier sends sd_notify messages to the service manager that started the
+// process. NewNotifier returns nil outside systemd, and a nil Notifier
+// ignores every message.
+type Notifier struct {
+	addr     *net.UnixAddr
+	watchdog time.Duration
+}
+
+// NewNotifier connects to the socket in NOTIFY_SOCKET, if set.
+func NewNotifier() *Notifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	n := &Notifier{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err == nil && usec > 0 {
+		if pid := os.Getenv("WATCHDOG_PID"); pid == "" || pid == strconv.Itoa(os.Getpid()) {
+			n.watchdog = time.Duration(usec) * time.Microsecond
+		}
+	}
+	return n
+}
+
+// Notify sends the given assignments, such as "READY=1", in one message.
+func (n *Notifier) Notify(assignments ...string) error {
+	if n == nil {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(strings.Join(assignments, "\n")))
+	return err
+}
+
+// Ready tells the service manager that the daemon accepts commands.
+func (n *Notifier) Ready(status string) error {
+	return n.Notify("READY=1", "STATUS="+status)
+}
+
+// Status updates the status line shown by systemctl status.
+func (n *Notifier) Status(status string) error {
+	return n.Notify("STATUS=" + status)
+}
+
+// Stopping tells the service manager that the daemon shuts down.
+func (n *Notifier) Stopping() error {
+	return n.Notify("STOPPING=1")
+}
+
+// Watchdog keeps the service manager's watchdog from restarting the daemon.
+func (n *Notifier) Watchdog() error {
+	return n.Notify("WATCHDOG=1")
+}
+
+// WatchdogInterval returns how often Watchdog must be called, which is half
+// of the timeout configured with WatchdogSec. It is zero when the watchdog is
+// disabled.
+func (n *Notifier) WatchdogInterval() time.Duration {
+	if n == nil {
+		return 0
+	}
+	return n.watchdog / 2
+}
@@ -0,0 +1,82 @@
+//go:build unix
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socket)
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	n := NewNotifier()
+	if n == nil {
+		t.Fatalf("expected a notifier")
+	}
+	if got := n.WatchdogInterval(); got != 15*time.Second {
+		t.Fatalf("expected watchdog interval 15s, got %v", got)
+	}
+
+	read := func() string {
+		t.Helper()
+		buf := make([]byte, 1024)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("failed to read notification: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	if err := n.Ready("1/1 port active"); err != nil {
+		t.Fatalf("Ready failed: %v", err)
+	}
+	if got := read(); got != "READY=1\nSTATUS=1/1 port active" {
+		t.Fatalf("unexpected ready message %q", got)
+	}
+	if err := n.Watchdog(); err != nil {
+		t.Fatalf("Watchdog failed: %v", err)
+	}
+	if got := read(); got != "WATCHDOG=1" {
+		t.Fatalf("unexpected watchdog message %q", got)
+	}
+}
+
+func TestNotifierOutsideSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	n := NewNotifier()
+	if n != nil {
+		t.Fatalf("expected no notifier outside systemd")
+	}
+	if err := n.Ready("ready"); err != nil {
+		t.Fatalf("expected a nil notifier to ignore messages, got %v", err)
+	}
+	if n.WatchdogInterval() != 0 {
+		t.Fatalf("expected the watchdog to be disabled")
+	}
+}
+
+func TestNotifierOtherWatchdogPID(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "/run/user/1000/systemd/notify")
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "1")
+
+	if got := NewNotifier().WatchdogInterval(); got != 0 {
+		t.Fatalf("expected the watchdog of another process to be ignored, got %v", got)
+	}
+}
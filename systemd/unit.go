@@ -0,0 +1,114 @@
+// Package systemd installs tunn as a systemd user service and reports the
+// state of the daemon to the service manager.
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// UnitName is the unit that runs the daemon without a profile.
+	UnitName = "tunn.service"
+	// TemplateName is the template unit that runs the daemon with the
+	// profile named by its instance, such as tunn@work.service.
+	TemplateName = "tunn@.service"
+)
+
+var instancePattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// UnitFor returns the unit that runs the daemon with profile.
+func UnitFor(profile string) (string, error) {
+	if profile == "" {
+		return UnitName, nil
+	}
+	if !instancePattern.MatchString(profile) {
+		return "", fmt.Errorf("profile %q cannot name a systemd unit; use letters, digits, '_', '.', ':' and '-'", profile)
+	}
+	return "tunn@" + profile + ".service", nil
+}
+
+// FileFor returns the unit file that defines the unit running profile: the
+// template for every profile.
+func FileFor(profile string) string {
+	if profile == "" {
+		return UnitName
+	}
+	return TemplateName
+}
+
+// Dir returns the directory holding the units of the user's service
+// manager.
+func Dir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "systemd", "user"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "systemd", "user"), nil
+}
+
+// Render returns the unit file that runs executable as the daemon, in the
+// foreground. A profile renders the template unit instead.
+func Render(executable string, profile string) string {
+	description := "tunn SSH tunnels"
+	command := execArg(executable) + " daemon run"
+	if profile != "" {
+		description += " (profile %i)"
+		command += " --profile %i"
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by tunn service install.\n")
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=" + description + "\n")
+	b.WriteString("Documentation=https://github.com/strandnerd/tunn\n")
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=notify\n")
+	b.WriteString("ExecStart=" + command + "\n")
+	b.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5\n")
+	b.WriteString("WatchdogSec=30\n")
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=default.target\n")
+	return b.String()
+}
+
+// execArg escapes an argument of ExecStart, quoting it when it holds
+// whitespace or quotes.
+func execArg(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// Enabled lists the tunn units enabled in dir, such as tunn.service or
+// tunn@work.service.
+func Enabled(dir string) ([]string, error) {
+	var units []string
+	seen := make(map[string]bool)
+	for _, pattern := range []string{UnitName, "tunn@?*.service"} {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.wants", pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			unit := filepath.Base(match)
+			if !seen[unit] {
+				seen[unit] = true
+				units = append(units, unit)
+			}
+		}
+	}
+	sort.Strings(units)
+	return units, nil
+}
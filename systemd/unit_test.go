@@ -0,0 +1,100 @@
+package systemd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnitFor(t *testing.T) {
+	tests := []struct {
+		profile   string
+		want      string
+		file      string
+		wantError bool
+	}{
+		{profile: "", want: "tunn.service", file: "tunn.service"},
+		{profile: "work", want: "tunn@work.service", file: "tunn@.service"},
+		{profile: "client-a.prod", want: "tunn@client-a.prod.service", file: "tunn@.service"},
+		{profile: "a/b", wantError: true},
+		{profile: "two words", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			got, err := UnitFor(tt.profile)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected an error for profile %q, got %q", tt.profile, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected unit %q, got %q", tt.want, got)
+			}
+			if file := FileFor(tt.profile); file != tt.file {
+				t.Fatalf("expected file %q, got %q", tt.file, file)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	unit := Render("/usr/local/bin/tunn", "")
+	for _, line := range []string{
+		"Type=notify",
+		"ExecStart=/usr/local/bin/tunn daemon run\n",
+		"ExecReload=/bin/kill -HUP $MAINPID",
+		"WatchdogSec=30",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(unit, line) {
+			t.Fatalf("expected unit to contain %q:\n%s", line, unit)
+		}
+	}
+
+	template := Render("/opt/my tools/50%/tunn", "work")
+	for _, line := range []string{
+		"Description=tunn SSH tunnels (profile %i)",
+		`ExecStart="/opt/my tools/50%%/tunn" daemon run --profile %i`,
+	} {
+		if !strings.Contains(template, line) {
+			t.Fatalf("expected template to contain %q:\n%s", line, template)
+		}
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	dir := t.TempDir()
+	wants := filepath.Join(dir, "default.target.wants")
+	if err := os.MkdirAll(wants, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"tunn@work.service", "tunn.service", "other.service", "tunn@.service"} {
+		if err := os.WriteFile(filepath.Join(wants, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	units, err := Enabled(dir)
+	if err != nil {
+		t.Fatalf("Enabled failed: %v", err)
+	}
+	if got := strings.Join(units, ","); got != "tunn.service,tunn@work.service" {
+		t.Fatalf("unexpected enabled units: %s", got)
+	}
+}
+
+func TestDir(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/tmp/config")
+	dir, err := Dir()
+	if err != nil {
+		t.Fatalf("Dir failed: %v", err)
+	}
+	if dir != filepath.Join("/tmp/config", "systemd", "user") {
+		t.Fatalf("unexpected unit directory %q", dir)
+	}
+}
@@ -0,0 +1,332 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strandnerd/tunn/config"
+)
+
+// StateIdle is the status of the ports of a lazy tunnel while tunn listens
+// on them without an ssh connection.
+const StateIdle = "idle (listening)"
+
+// lazyDialTimeout bounds how long a connection to a lazy tunnel waits for
+// ssh to open its forward.
+const lazyDialTimeout = 30 * time.Second
+
+// lazyTunnel listens on the local ports of a tunnel and runs ssh only while
+// connections are open, plus the idle timeout after the last one closed.
+// Each local port is proxied to a relay port on the loopback interface,
+// which ssh forwards instead. Relay ports are picked anew every time ssh
+// starts, so that one taken by another process since is not retried.
+type lazyTunnel struct {
+	manager *Manager
+	name    string
+	tunnel  config.Tunnel
+	idle    time.Duration
+
+	// lifecycle serialises starting and stopping ssh, which stop and done
+	// belong to.
+	lifecycle sync.Mutex
+	stop      context.CancelFunc
+	done      chan struct{}
+
+	mu    sync.Mutex
+	conns int
+	// generation invalidates idle timers that fired while a new connection
+	// was arriving.
+	generation int
+	timer      *time.Timer
+	// relays holds the relay port of each forward of the current ssh, by
+	// mapping.
+	relays map[string]string
+
+	handlers sync.WaitGroup
+}
+
+// runLazy listens on the local ports of tunnel until ctx is cancelled,
+// starting ssh once a connection arrives.
+func (m *Manager) runLazy(ctx context.Context, name string, tunnel config.Tunnel) error {
+	ports := append([]config.Port(nil), tunnel.Ports...)
+	listeners := make([]net.Listener, 0, len(ports))
+	closeListeners := func() {
+		for _, ln := range listeners {
+			_ = ln.Close()
+		}
+	}
+
+	for i := range ports {
+		ln, err := listenLazy(name, ports[i])
+		if err != nil {
+			closeListeners()
+			m.reportPorts(name, tunnel, fmt.Sprintf("error - %s", err.Error()))
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	l := &lazyTunnel{manager: m, name: name, tunnel: tunnel, idle: tunnel.IdleAfter()}
+	m.reportPorts(name, tunnel, StateIdle)
+
+	var serving sync.WaitGroup
+	for i, ln := range listeners {
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			l.serve(ctx, ln, ports[i])
+		}()
+	}
+
+	<-ctx.Done()
+	closeListeners()
+	serving.Wait()
+	l.handlers.Wait()
+
+	l.mu.Lock()
+	l.generation++
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.mu.Unlock()
+	l.lifecycle.Lock()
+	l.stopSSH()
+	l.lifecycle.Unlock()
+
+	m.reportPorts(name, tunnel, "stopped")
+	return ctx.Err()
+}
+
+// listenLazy listens on the local port of a forward.
+func listenLazy(name string, port config.Port) (net.Listener, error) {
+	if !port.ListensLocally() {
+		return nil, fmt.Errorf("lazy tunnel %q cannot have remote forwards", name)
+	}
+	return net.Listen("tcp", listenAddress(port))
+}
+
+// listenAddress returns the address tunn listens on for a local port,
+// following the bind address rules of ssh.
+func listenAddress(port config.Port) string {
+	host := port.Bind
+	switch host {
+	case "", "localhost":
+		host = "127.0.0.1"
+	case "*":
+		host = ""
+	}
+	return net.JoinHostPort(host, port.LocalPort())
+}
+
+// freeRelayPort returns a loopback port that is free for ssh to listen on.
+func freeRelayPort() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a relay port: %w", err)
+	}
+	defer ln.Close()
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port), nil
+}
+
+func (l *lazyTunnel) serve(ctx context.Context, ln net.Listener, port config.Port) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		l.handlers.Add(1)
+		go func() {
+			defer l.handlers.Done()
+			l.handle(ctx, conn, port)
+		}()
+	}
+}
+
+// handle proxies a connection to the relay port of its forward, starting
+// ssh first when it is not running.
+func (l *lazyTunnel) handle(ctx context.Context, conn net.Conn, port config.Port) {
+	defer conn.Close()
+	l.acquire(ctx)
+	defer l.release()
+
+	upstream, err := l.dial(ctx, port)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+		_ = upstream.Close()
+	})
+	defer stop()
+
+	proxy(conn, upstream)
+}
+
+// dial connects to the relay port, waiting for ssh to open it.
+func (l *lazyTunnel) dial(ctx context.Context, port config.Port) (net.Conn, error) {
+	deadline := time.Now().Add(lazyDialTimeout)
+	for {
+		l.mu.Lock()
+		relay := l.relays[port.Mapping()]
+		l.mu.Unlock()
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", relay), time.Second)
+		if err == nil {
+			return conn, nil
+		}
+		if strings.HasPrefix(l.manager.portState(l.name, port.Mapping()), "error") || time.Now().After(deadline) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// proxy copies between two connections until both directions are closed.
+func proxy(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		if tcp, ok := dst.(*net.TCPConn); ok {
+			_ = tcp.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go pipe(a, b)
+	go pipe(b, a)
+	<-done
+	<-done
+}
+
+// acquire counts a new connection and makes sure ssh runs, starting it
+// again when it failed since the last connection.
+func (l *lazyTunnel) acquire(ctx context.Context) {
+	l.lifecycle.Lock()
+	defer l.lifecycle.Unlock()
+
+	l.mu.Lock()
+	l.conns++
+	l.generation++
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.mu.Unlock()
+
+	if l.done != nil && l.failed() {
+		l.stopSSH()
+	}
+	if l.done == nil && ctx.Err() == nil {
+		l.startSSH(ctx)
+	}
+}
+
+// release counts a closed connection and arms the idle timer after the
+// last one.
+func (l *lazyTunnel) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.conns--
+	if l.conns > 0 {
+		return
+	}
+	generation := l.generation
+	l.timer = time.AfterFunc(l.idle, func() { l.expire(generation) })
+}
+
+// expire stops ssh once the tunnel has been idle for the idle timeout.
+func (l *lazyTunnel) expire(generation int) {
+	l.lifecycle.Lock()
+	defer l.lifecycle.Unlock()
+
+	l.mu.Lock()
+	current := l.generation == generation && l.conns == 0
+	l.mu.Unlock()
+	if !current || l.done == nil {
+		return
+	}
+	l.stopSSH()
+	for _, port := range l.tunnel.Ports {
+		if l.manager.portState(l.name, port.Mapping()) == "stopped" {
+			l.manager.UpdateStatus(l.name, port.Mapping(), StateIdle)
+		}
+	}
+}
+
+// startSSH runs the forwards of the tunnel until stopSSH is called. Callers
+// must hold l.lifecycle.
+func (l *lazyTunnel) startSSH(ctx context.Context) {
+	tunnel, err := l.pickRelays()
+	if err != nil {
+		l.manager.reportPorts(l.name, l.tunnel, fmt.Sprintf("error - %s", err.Error()))
+		return
+	}
+	// Reported here rather than left to the executor, so that connections
+	// arriving meanwhile do not see the error of a previous attempt.
+	l.manager.reportPorts(l.name, l.tunnel, "connecting")
+
+	sshCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	l.stop, l.done = cancel, done
+	go func() {
+		defer close(done)
+		_ = l.manager.executor.Execute(sshCtx, l.name, tunnel)
+	}()
+}
+
+// pickRelays picks a free relay port for every forward and returns the
+// tunnel ssh runs with them.
+func (l *lazyTunnel) pickRelays() (config.Tunnel, error) {
+	tunnel := l.tunnel
+	tunnel.Ports = append([]config.Port(nil), l.tunnel.Ports...)
+	relays := make(map[string]string, len(tunnel.Ports))
+	for i := range tunnel.Ports {
+		relay, err := freeRelayPort()
+		if err != nil {
+			return config.Tunnel{}, err
+		}
+		tunnel.Ports[i].Relay = relay
+		relays[tunnel.Ports[i].Mapping()] = relay
+	}
+	l.mu.Lock()
+	l.relays = relays
+	l.mu.Unlock()
+	return tunnel, nil
+}
+
+// stopSSH stops ssh and waits for it to exit. Callers must hold l.lifecycle.
+func (l *lazyTunnel) stopSSH() {
+	if l.done == nil {
+		return
+	}
+	l.stop()
+	<-l.done
+	l.stop, l.done = nil, nil
+}
+
+// failed reports whether a forward of the running ssh gave up.
+func (l *lazyTunnel) failed() bool {
+	for _, port := range l.tunnel.Ports {
+		state := l.manager.portState(l.name, port.Mapping())
+		if strings.HasPrefix(state, "error") || state == "stopped" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/strandnerd/tunn/config"
+)
+
+// relayExecutor stands in for ssh by echoing connections on the relay ports
+// of a lazy tunnel.
+type relayExecutor struct {
+	manager *Manager
+	mu      sync.Mutex
+	starts  int
+	stops   int
+	// taken makes the first starts fail as if another process took their
+	// relay ports, which stay taken.
+	taken  int
+	relays []string
+}
+
+func (r *relayExecutor) Execute(ctx context.Context, name string, tunnel config.Tunnel) error {
+	r.mu.Lock()
+	r.starts++
+	for _, port := range tunnel.Ports {
+		r.relays = append(r.relays, port.Relay)
+	}
+	taken := r.taken > 0
+	r.taken--
+	r.mu.Unlock()
+
+	for _, port := range tunnel.Ports {
+		ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", port.Relay))
+		if err != nil {
+			return err
+		}
+		if taken {
+			r.manager.UpdateStatus(name, port.Mapping(), "error - bind: Address already in use")
+			return errors.New("address already in use")
+		}
+		defer ln.Close()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					_, _ = io.Copy(conn, conn)
+				}()
+			}
+		}()
+		r.manager.UpdateStatus(name, port.Mapping(), "active")
+	}
+
+	<-ctx.Done()
+	for _, port := range tunnel.Ports {
+		r.manager.UpdateStatus(name, port.Mapping(), "stopped")
+	}
+	r.mu.Lock()
+	r.stops++
+	r.mu.Unlock()
+	return ctx.Err()
+}
+
+func (r *relayExecutor) counts() (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.starts, r.stops
+}
+
+func TestManagerLazyTunnel(t *testing.T) {
+	rec := &relayExecutor{}
+	manager := NewManager(rec, nil, nil)
+	manager.checker = &stubPortChecker{}
+	rec.manager = manager
+
+	local, err := freeRelayPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := config.Port{Local: local, Remote: "5432"}
+	tunnels := map[string]config.Tunnel{
+		"db": {Host: "server1", Lazy: true, IdleTimeout: "100ms", Ports: []config.Port{port}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.RunTunnels(ctx, tunnels)
+	}()
+
+	state := func() string { return manager.portState("db", port.Mapping()) }
+	waitFor(t, func() bool { return state() == StateIdle })
+	if starts, _ := rec.counts(); starts != 0 {
+		t.Fatalf("expected ssh not to start before a connection, got %d starts", starts)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", local))
+	if err != nil {
+		t.Fatalf("failed to connect to the lazy tunnel: %v", err)
+	}
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || reply != "ping\n" {
+		t.Fatalf("expected the connection to be proxied, got %q, %v", reply, err)
+	}
+	waitFor(t, func() bool { return state() == "active" })
+
+	// The idle timeout only starts once the last connection closed.
+	time.Sleep(200 * time.Millisecond)
+	if _, stops := rec.counts(); stops != 0 {
+		t.Fatalf("expected ssh to keep running while connected, got %d stops", stops)
+	}
+	conn.Close()
+	waitFor(t, func() bool {
+		_, stops := rec.counts()
+		return stops == 1 && state() == StateIdle
+	})
+
+	conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", local))
+	if err != nil {
+		t.Fatalf("failed to reconnect to the lazy tunnel: %v", err)
+	}
+	waitFor(t, func() bool {
+		starts, _ := rec.counts()
+		return starts == 2 && state() == "active"
+	})
+
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	conn.Close()
+	if starts, stops := rec.counts(); starts != stops {
+		t.Fatalf("expected every ssh start to be stopped, got %d starts and %d stops", starts, stops)
+	}
+	if got := state(); got != "stopped" {
+		t.Fatalf("expected the port to be stopped, got %q", got)
+	}
+}
+
+func TestManagerLazyTunnelRelayTaken(t *testing.T) {
+	rec := &relayExecutor{taken: 1}
+	manager := NewManager(rec, nil, nil)
+	manager.checker = &stubPortChecker{}
+	rec.manager = manager
+
+	local, err := freeRelayPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := config.Port{Local: local, Remote: "5432"}
+	tunnels := map[string]config.Tunnel{
+		"db": {Host: "server1", Lazy: true, Ports: []config.Port{port}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.RunTunnels(ctx, tunnels)
+	}()
+	state := func() string { return manager.portState("db", port.Mapping()) }
+	waitFor(t, func() bool { return state() == StateIdle })
+
+	// The first connection finds ssh failed to listen on its relay port.
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+		t.Fatal("expected the connection to close while ssh failed")
+	}
+	conn.Close()
+
+	conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || reply != "ping\n" {
+		t.Fatalf("expected ssh to be restarted on another relay port, got %q, %v", reply, err)
+	}
+
+	rec.mu.Lock()
+	relays := append([]string(nil), rec.relays...)
+	rec.mu.Unlock()
+	if len(relays) != 2 || relays[0] == relays[1] {
+		t.Fatalf("expected a fresh relay port for the second ssh, got %v", relays)
+	}
+
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		port config.Port
+		want string
+	}{
+		{config.Port{Local: "5432"}, "127.0.0.1:5432"},
+		{config.Port{Local: "5432", Bind: "localhost"}, "127.0.0.1:5432"},
+		{config.Port{Local: "5432", Bind: "*"}, ":5432"},
+		{config.Port{Local: "5432", Bind: "0.0.0.0"}, "0.0.0.0:5432"},
+		{config.Port{Local: "5432", Bind: "::1"}, "[::1]:5432"},
+		{config.Port{Local: config.AutoPort, Assigned: "20001"}, "127.0.0.1:20001"},
+	}
+	for _, tt := range tests {
+		if got := listenAddress(tt.port); got != tt.want {
+			t.Errorf("listenAddress(%+v) = %q, want %q", tt.port, got, tt.want)
+		}
+	}
+}
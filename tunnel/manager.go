@@ -3,6 +3,9 @@ package tunnel
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -16,56 +19,882 @@ type Manager struct {
 	display  *output.Display
 	checker  portChecker
 	notify   func(string, string, string)
+
+	applyMu  sync.Mutex
+	mu       sync.Mutex
+	ctx      context.Context
+	desired  map[string]config.Tunnel
+	running  map[string]*runningTunnel
+	active   int
+	applying bool
+	err      error
+	wg       sync.WaitGroup
+	changed  chan struct{}
+	// keepRunning makes RunTunnels wait for its context even with no
+	// tunnel left running.
+	keepRunning bool
+	// states holds the last status reported for every port, and
+	// stateChanged is closed and replaced whenever one changes.
+	states       map[string]map[string]string
+	stateChanged chan struct{}
+
+	// assignMu serialises picking automatic local ports. assigned holds the
+	// ports picked for each tunnel, by mapping, so restarts reuse them.
+	assignMu  sync.Mutex
+	autoFirst int
+	autoLast  int
+	assigned  map[string]map[string]string
+	onAssign  func(string, string, string)
+}
+
+// adopter is implemented by executors that take over the ssh processes of a
+// previous daemon. Until a tunnel claims them, those processes still hold
+// their local ports, which must not be reported as conflicts.
+type adopter interface {
+	Adopting(pid int) bool
+}
+
+// runningTunnel tracks the lifecycle of a single tunnel started by the manager.
+type runningTunnel struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// mu guards the fields below. tunnel is the definition the forwards run
+	// with, which single port changes update even before the tunnel
+	// connects. ctx is set once the forwards run, each in ports with its own
+	// context derived from it.
+	mu     sync.Mutex
+	tunnel config.Tunnel
+	ctx    context.Context
+	ports  map[string]*runningPort
+	wg     sync.WaitGroup
+	err    error
+	// ended is closed once a forward failed or none is left.
+	ended chan struct{}
+}
+
+// runningPort tracks a single forward of a running tunnel.
+type runningPort struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	// replaced is set while the forward is restarted, so that its exit
+	// does not count as the tunnel running out of forwards.
+	replaced bool
+}
+
+func newRunningTunnel(tunnel config.Tunnel, cancel context.CancelFunc) *runningTunnel {
+	return &runningTunnel{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		tunnel: tunnel,
+		ports:  make(map[string]*runningPort),
+		ended:  make(chan struct{}),
+	}
+}
+
+// endLocked wakes runTunnel to stop the tunnel. Callers must hold rt.mu.
+func (rt *runningTunnel) endLocked() {
+	select {
+	case <-rt.ended:
+	default:
+		close(rt.ended)
+	}
 }
 
+// NewManager creates a manager running tunnels through exec. The executor's
+// status callback should be wired to UpdateStatus, which forwards to the
+// display and notifier, so that tunnels with depends_on can tell when their
+// dependencies are active.
 func NewManager(exec executor.SSHExecutor, display *output.Display, notifier func(string, string, string)) *Manager {
 	return &Manager{
-		executor: exec,
-		display:  display,
-		checker:  newSystemPortChecker(),
-		notify:   notifier,
+		executor:     exec,
+		display:      display,
+		checker:      newSystemPortChecker(),
+		notify:       notifier,
+		desired:      make(map[string]config.Tunnel),
+		running:      make(map[string]*runningTunnel),
+		changed:      make(chan struct{}, 1),
+		states:       make(map[string]map[string]string),
+		stateChanged: make(chan struct{}),
+		autoFirst:    config.DefaultAutoPortFirst,
+		autoLast:     config.DefaultAutoPortLast,
+		assigned:     make(map[string]map[string]string),
 	}
 }
 
+// SetAutoPortRange sets the range automatic local ports are picked from.
+func (m *Manager) SetAutoPortRange(first, last int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.autoFirst, m.autoLast = first, last
+}
+
+// KeepRunning makes RunTunnels block until its context is cancelled, even
+// once no tunnel is left running, so that tunnels can be started again
+// later, as the daemon does.
+func (m *Manager) KeepRunning() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keepRunning = true
+}
+
+// OnPortAssigned registers a callback told about every automatic local port
+// the manager picks, with the tunnel name, port mapping and local port.
+func (m *Manager) OnPortAssigned(fn func(string, string, string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onAssign = fn
+}
+
+// RestorePorts records the automatic local ports picked by a previous daemon,
+// by tunnel and mapping, so that they are picked again.
+func (m *Manager) RestorePorts(assigned map[string]map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, ports := range assigned {
+		m.assigned[name] = ports
+	}
+}
+
+// RunTunnels starts every tunnel with its own context derived from ctx and
+// blocks until ctx is cancelled or, unless KeepRunning was called, no tunnel
+// is left running. Tunnels are
+// started in dependency order, and a tunnel with depends_on waits for its
+// dependencies to become active before connecting. It returns the first
+// tunnel error, or the context error once cancelled.
 func (m *Manager) RunTunnels(ctx context.Context, tunnels map[string]config.Tunnel) error {
-	var wg sync.WaitGroup
-	errCh := make(chan error, len(tunnels))
-
-	for name, tunnel := range tunnels {
-		wg.Add(1)
-		go func(n string, t config.Tunnel) {
-			defer wg.Done()
-			if err := m.runTunnel(ctx, n, t); err != nil {
-				select {
-				case errCh <- err:
-				default:
-				}
-			}
-		}(name, tunnel)
+	m.mu.Lock()
+	m.ctx = ctx
+	for _, name := range config.StartOrder(tunnels) {
+		m.desired[name] = tunnels[name]
+		m.startLocked(name, tunnels[name])
+	}
+	m.mu.Unlock()
+
+	for {
+		m.mu.Lock()
+		idle := m.active == 0 && !m.applying && !m.keepRunning
+		m.mu.Unlock()
+		if idle {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-m.changed:
+			continue
+		}
+		break
 	}
 
 	// Wait for all tunnels to complete (they will block until context is cancelled)
-	wg.Wait()
+	m.applyMu.Lock()
+	m.wg.Wait()
+	m.applyMu.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ctx = nil
+	if m.err != nil {
+		return m.err
+	}
+	return ctx.Err()
+}
+
+// Apply reconciles the running tunnels with a new desired set: added tunnels
+// are started, removed ones stopped and changed ones restarted. Tunnels that
+// depend on a stopped or restarted tunnel are restarted too and reported as
+// changed; the others are left alone.
+func (m *Manager) Apply(tunnels map[string]config.Tunnel) (config.Diff, error) {
+	return m.reconcile(func(map[string]config.Tunnel) (map[string]config.Tunnel, []string, error) {
+		return tunnels, nil, nil
+	})
+}
+
+// Start adds tunnels to the running set, restarting managed tunnels whose
+// definition differs. Managed tunnels with the same definition that are no
+// longer running, such as after a failure, are started again. Tunnels not in
+// tunnels are left alone.
+func (m *Manager) Start(tunnels map[string]config.Tunnel) (config.Diff, error) {
+	return m.reconcile(func(current map[string]config.Tunnel) (map[string]config.Tunnel, []string, error) {
+		next := make(map[string]config.Tunnel, len(current)+len(tunnels))
+		for name, tunnel := range current {
+			next[name] = tunnel
+		}
+		var restart []string
+		for name, tunnel := range tunnels {
+			next[name] = tunnel
+			if _, running := m.running[name]; !running {
+				restart = append(restart, name)
+			}
+		}
+		return next, restart, nil
+	})
+}
+
+// Restart stops and starts the named tunnels, along with the tunnels that
+// depend on them, whether or not they are still running.
+func (m *Manager) Restart(names ...string) (config.Diff, error) {
+	return m.reconcile(func(current map[string]config.Tunnel) (map[string]config.Tunnel, []string, error) {
+		for _, name := range names {
+			if _, ok := current[name]; !ok {
+				return nil, nil, fmt.Errorf("tunnel %q is not managed by the daemon", name)
+			}
+		}
+		return current, names, nil
+	})
+}
+
+// reconcile moves the manager to the desired set returned by next, which is
+// called with the current set while the manager is locked. The tunnels it
+// lists for restart are restarted even when their definition is unchanged.
+func (m *Manager) reconcile(next func(map[string]config.Tunnel) (map[string]config.Tunnel, []string, error)) (config.Diff, error) {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+
+	m.mu.Lock()
+	if m.ctx == nil || m.ctx.Err() != nil {
+		m.mu.Unlock()
+		return config.Diff{}, fmt.Errorf("tunnel manager is not running")
+	}
+	tunnels, restart, err := next(m.desired)
+	if err != nil {
+		m.mu.Unlock()
+		return config.Diff{}, err
+	}
+	diff := config.DiffTunnels(m.desired, tunnels)
+	forceRestarts(&diff, restart)
+	cascadeRestarts(&diff, tunnels)
+	previous := make(map[string]config.Tunnel, len(m.desired))
+	for name, tunnel := range m.desired {
+		previous[name] = tunnel
+	}
+	m.applying = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		m.applying = false
+		m.mu.Unlock()
+		m.signalChange()
+	}()
+
+	stopping := make(map[string]bool)
+	for _, name := range append(append([]string(nil), diff.Removed...), diff.Changed...) {
+		stopping[name] = true
+	}
+	order := config.StartOrder(previous)
+	for i := len(order) - 1; i >= 0; i-- {
+		if stopping[order[i]] {
+			m.stop(order[i])
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range diff.Removed {
+		delete(m.desired, name)
+		delete(m.states, name)
+		delete(m.assigned, name)
+	}
+	starting := make(map[string]bool)
+	for _, name := range append(append([]string(nil), diff.Changed...), diff.Added...) {
+		m.desired[name] = tunnels[name]
+		starting[name] = true
+	}
+	for _, name := range config.StartOrder(tunnels) {
+		if starting[name] {
+			m.startLocked(name, tunnels[name])
+		}
+	}
+	return diff, nil
+}
+
+// forceRestarts moves the named tunnels from diff.Unchanged to diff.Changed.
+func forceRestarts(diff *config.Diff, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	restart := make(map[string]bool, len(names))
+	for _, name := range names {
+		restart[name] = true
+	}
+
+	unchanged := diff.Unchanged[:0]
+	for _, name := range diff.Unchanged {
+		if restart[name] {
+			diff.Changed = append(diff.Changed, name)
+			continue
+		}
+		unchanged = append(unchanged, name)
+	}
+	diff.Unchanged = unchanged
+	sort.Strings(diff.Changed)
+}
+
+// cascadeRestarts moves the unchanged tunnels that depend on a removed or
+// changed tunnel from diff.Unchanged to diff.Changed.
+func cascadeRestarts(diff *config.Diff, tunnels map[string]config.Tunnel) {
+	stopped := append(append([]string(nil), diff.Removed...), diff.Changed...)
+	cascade := make(map[string]bool)
+	for _, name := range config.Dependents(tunnels, stopped...) {
+		cascade[name] = true
+	}
+
+	unchanged := diff.Unchanged[:0]
+	for _, name := range diff.Unchanged {
+		if cascade[name] {
+			diff.Changed = append(diff.Changed, name)
+			continue
+		}
+		unchanged = append(unchanged, name)
+	}
+	diff.Unchanged = unchanged
+	sort.Strings(diff.Changed)
+}
+
+// Tunnels returns a copy of the tunnels the manager is currently responsible for.
+func (m *Manager) Tunnels() map[string]config.Tunnel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tunnels := make(map[string]config.Tunnel, len(m.desired))
+	for name, tunnel := range m.desired {
+		tunnels[name] = tunnel
+	}
+	return tunnels
+}
+
+// startLocked launches a tunnel goroutine. Callers must hold m.mu.
+func (m *Manager) startLocked(name string, tunnel config.Tunnel) {
+	delete(m.states, name)
+	ctx, cancel := context.WithCancel(m.ctx)
+	rt := newRunningTunnel(tunnel, cancel)
+	m.running[name] = rt
+	m.active++
+	m.wg.Add(1)
+
+	go func() {
+		defer m.wg.Done()
+		defer close(rt.done)
+		defer cancel()
+
+		err := m.runTunnel(ctx, name, rt)
+
+		m.mu.Lock()
+		if err != nil && ctx.Err() == nil && m.err == nil {
+			m.err = err
+		}
+		if m.running[name] == rt {
+			delete(m.running, name)
+		}
+		m.active--
+		m.mu.Unlock()
+
+		m.signalChange()
+	}()
+}
+
+// signalChange wakes RunTunnels so it can re-evaluate whether work remains.
+func (m *Manager) signalChange() {
 	select {
-	case err := <-errCh:
-		return err
+	case m.changed <- struct{}{}:
 	default:
 	}
+}
+
+// stop cancels a running tunnel and waits for its processes to exit.
+func (m *Manager) stop(name string) {
+	m.mu.Lock()
+	rt, ok := m.running[name]
+	if ok {
+		delete(m.running, name)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	rt.cancel()
+	<-rt.done
+}
+
+// runTunnel waits for the dependencies of a tunnel, then runs each of its
+// forwards with its own context until ctx is cancelled, a forward fails or
+// none is left. It returns the error of the first forward that failed.
+func (m *Manager) runTunnel(ctx context.Context, name string, rt *runningTunnel) error {
+	rt.mu.Lock()
+	tunnel := rt.tunnel
+	rt.mu.Unlock()
+	if err := m.waitForDependencies(ctx, name, tunnel); err != nil {
+		return err
+	}
+
+	// Ports started or stopped while the tunnel waited are in rt.tunnel.
+	rt.mu.Lock()
+	tunnel, err := m.assignPorts(name, rt.tunnel)
+	if err == nil {
+		err = m.ensurePortsAvailable(name, tunnel)
+	}
+	if err != nil {
+		rt.mu.Unlock()
+		return err
+	}
+	portsCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rt.tunnel, rt.ctx = tunnel, portsCtx
+	for _, port := range tunnel.Ports {
+		m.startPortLocked(name, rt, port)
+	}
+	rt.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+	case <-rt.ended:
+	}
+	// Cancelling under the lock keeps forwards from being started once the
+	// tunnel waits for them to exit.
+	rt.mu.Lock()
+	cancel()
+	rt.mu.Unlock()
+	rt.wg.Wait()
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.err != nil {
+		return rt.err
+	}
 	return ctx.Err()
 }
 
-func (m *Manager) runTunnel(ctx context.Context, name string, tunnel config.Tunnel) error {
-	if err := m.ensurePortsAvailable(name, tunnel); err != nil {
+// startPortLocked runs a single forward of a tunnel in its own context.
+// Callers must hold rt.mu.
+func (m *Manager) startPortLocked(name string, rt *runningTunnel, port config.Port) {
+	mapping := port.Mapping()
+	if rt.ctx.Err() != nil {
+		delete(rt.ports, mapping)
+		return
+	}
+	ctx, cancel := context.WithCancel(rt.ctx)
+	rp := &runningPort{cancel: cancel, done: make(chan struct{})}
+	rt.ports[mapping] = rp
+	rt.wg.Add(1)
+
+	forward := rt.tunnel
+	forward.Ports = []config.Port{port}
+	go func() {
+		defer rt.wg.Done()
+		defer close(rp.done)
+		defer cancel()
+
+		var err error
+		if forward.Lazy {
+			err = m.runLazy(ctx, name, forward)
+		} else {
+			err = m.executor.Execute(ctx, name, forward)
+		}
+
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		if rp.replaced {
+			return
+		}
+		if rt.ports[mapping] == rp {
+			delete(rt.ports, mapping)
+		}
+		failed := err != nil && ctx.Err() == nil
+		if failed && rt.err == nil {
+			rt.err = err
+		}
+		if failed || len(rt.ports) == 0 {
+			rt.endLocked()
+		}
+	}()
+}
+
+// StartPort starts a single forward of a running tunnel, whose definition
+// becomes next. The other forwards of the tunnel and the tunnels depending
+// on it are left alone.
+func (m *Manager) StartPort(name string, next config.Tunnel, mapping string) error {
+	port, ok := findPort(next, mapping)
+	if !ok {
+		return fmt.Errorf("tunnel %q has no port %q", name, mapping)
+	}
+	rt, err := m.runningTunnel(name)
+	if err != nil {
 		return err
 	}
-	return m.executor.Execute(ctx, name, tunnel)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if _, running := findPort(rt.tunnel, mapping); running {
+		return nil
+	}
+	if rt.ctx == nil {
+		// The tunnel has not connected yet and starts with the port.
+		rt.tunnel = withAssigned(next, rt.tunnel)
+		m.setDesired(name, next)
+		return nil
+	}
+
+	m.setDesired(name, next)
+	forward := rt.tunnel
+	forward.Ports = []config.Port{port}
+	forward, err = m.assignPorts(name, forward)
+	if err == nil {
+		err = m.ensurePortsAvailable(name, forward)
+	}
+	if err != nil {
+		m.setDesired(name, withoutPort(next, mapping))
+		return err
+	}
+	rt.tunnel = withAssigned(next, rt.tunnel, forward.Ports[0])
+	m.startPortLocked(name, rt, forward.Ports[0])
+	return nil
+}
+
+// StopPort stops a single forward of a running tunnel. The other forwards
+// of the tunnel and the tunnels depending on it are left alone.
+func (m *Manager) StopPort(name, mapping string) error {
+	rt, err := m.runningTunnel(name)
+	if err != nil {
+		return err
+	}
+
+	rt.mu.Lock()
+	if _, ok := findPort(rt.tunnel, mapping); !ok {
+		rt.mu.Unlock()
+		return fmt.Errorf("tunnel %q has no running port %q", name, mapping)
+	}
+	if len(rt.tunnel.Ports) == 1 {
+		rt.mu.Unlock()
+		return fmt.Errorf("port %q is the last port of tunnel %q; stop the tunnel instead", mapping, name)
+	}
+	rt.tunnel = withoutPort(rt.tunnel, mapping)
+	rp := rt.ports[mapping]
+	delete(rt.ports, mapping)
+	rt.mu.Unlock()
+
+	m.mu.Lock()
+	if desired, ok := m.desired[name]; ok {
+		m.desired[name] = withoutPort(desired, mapping)
+	}
+	delete(m.assigned[name], mapping)
+	m.mu.Unlock()
+
+	if rp != nil {
+		rp.cancel()
+		<-rp.done
+	}
+	m.mu.Lock()
+	delete(m.states[name], mapping)
+	m.mu.Unlock()
+	return nil
+}
+
+// RestartPort stops and starts a single forward of a running tunnel. The
+// other forwards of the tunnel and the tunnels depending on it are left
+// alone.
+func (m *Manager) RestartPort(name, mapping string) error {
+	rt, err := m.runningTunnel(name)
+	if err != nil {
+		return err
+	}
+
+	rt.mu.Lock()
+	port, ok := findPort(rt.tunnel, mapping)
+	if !ok {
+		rt.mu.Unlock()
+		return fmt.Errorf("tunnel %q has no running port %q", name, mapping)
+	}
+	rp := rt.ports[mapping]
+	if rp == nil {
+		// The forward has not started yet, or already gave up; in both
+		// cases there is nothing to stop first.
+		if rt.ctx != nil {
+			m.startPortLocked(name, rt, port)
+		}
+		rt.mu.Unlock()
+		return nil
+	}
+	rp.replaced = true
+	rt.mu.Unlock()
+
+	rp.cancel()
+	<-rp.done
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	m.startPortLocked(name, rt, port)
+	if _, ok := rt.ports[mapping]; !ok {
+		return fmt.Errorf("tunnel %q stopped while restarting port %q", name, mapping)
+	}
+	return nil
+}
+
+// Running reports whether the tunnel called name runs, as opposed to having
+// stopped after a failure.
+func (m *Manager) Running(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.running[name]
+	return ok
+}
+
+// runningTunnel returns the running tunnel called name.
+func (m *Manager) runningTunnel(name string) (*runningTunnel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx == nil || m.ctx.Err() != nil {
+		return nil, fmt.Errorf("tunnel manager is not running")
+	}
+	rt, ok := m.running[name]
+	if !ok {
+		return nil, fmt.Errorf("tunnel %q is not running", name)
+	}
+	return rt, nil
+}
+
+func (m *Manager) setDesired(name string, tunnel config.Tunnel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.desired[name] = tunnel
+}
+
+// findPort returns the port of tunnel with the given mapping.
+func findPort(tunnel config.Tunnel, mapping string) (config.Port, bool) {
+	for _, port := range tunnel.Ports {
+		if port.Mapping() == mapping {
+			return port, true
+		}
+	}
+	return config.Port{}, false
+}
+
+// withoutPort returns tunnel without the port with the given mapping.
+func withoutPort(tunnel config.Tunnel, mapping string) config.Tunnel {
+	ports := make([]config.Port, 0, len(tunnel.Ports))
+	for _, port := range tunnel.Ports {
+		if port.Mapping() != mapping {
+			ports = append(ports, port)
+		}
+	}
+	tunnel.Ports = ports
+	return tunnel
+}
+
+// withAssigned returns next with the local ports already assigned in
+// current, or in assigned, filled in.
+func withAssigned(next, current config.Tunnel, assigned ...config.Port) config.Tunnel {
+	known := make(map[string]config.Port)
+	for _, port := range append(append([]config.Port(nil), current.Ports...), assigned...) {
+		known[port.Mapping()] = port
+	}
+	ports := make([]config.Port, len(next.Ports))
+	for i, port := range next.Ports {
+		if prev, ok := known[port.Mapping()]; ok {
+			port.Assigned = prev.Assigned
+		}
+		ports[i] = port
+	}
+	next.Ports = ports
+	return next
+}
+
+// maxPortProbes bounds how many candidates are checked when picking an
+// automatic local port, since every check runs lsof.
+const maxPortProbes = 100
+
+// assignPorts picks a free local port for every automatic port of tunnel and
+// returns the tunnel with the ports assigned. A port keeps the local port it
+// had before when that is still free; otherwise probing starts at a position
+// derived from the tunnel and mapping, so the same port tends to be chosen
+// again after the daemon restarts.
+func (m *Manager) assignPorts(name string, tunnel config.Tunnel) (config.Tunnel, error) {
+	auto := false
+	for _, port := range tunnel.Ports {
+		auto = auto || port.IsAuto()
+	}
+	if !auto {
+		return tunnel, nil
+	}
+
+	m.assignMu.Lock()
+	defer m.assignMu.Unlock()
+
+	m.mu.Lock()
+	first, last := m.autoFirst, m.autoLast
+	previous := m.assigned[name]
+	taken := m.takenPortsLocked(name)
+	onAssign := m.onAssign
+	m.mu.Unlock()
+
+	ports := append([]config.Port(nil), tunnel.Ports...)
+	picked := make(map[string]string)
+	for i, port := range ports {
+		if !port.IsAuto() {
+			continue
+		}
+		mapping := port.Mapping()
+		local, err := m.pickPort(name+"/"+mapping, previous[mapping], first, last, taken)
+		if err != nil {
+			m.UpdateStatus(name, mapping, fmt.Sprintf("error - %s", err.Error()))
+			return tunnel, err
+		}
+		taken[local] = true
+		ports[i].Assigned = local
+		picked[mapping] = local
+	}
+
+	// Ports assigned before for the other forwards of the tunnel are kept,
+	// since a single forward may be started on its own.
+	m.mu.Lock()
+	for _, port := range m.desired[name].Ports {
+		mapping := port.Mapping()
+		if _, ok := picked[mapping]; !ok && previous[mapping] != "" {
+			picked[mapping] = previous[mapping]
+		}
+	}
+	m.assigned[name] = picked
+	m.mu.Unlock()
+	if onAssign != nil {
+		for _, port := range ports {
+			if port.IsAuto() {
+				onAssign(name, port.Mapping(), port.Assigned)
+			}
+		}
+	}
+	tunnel.Ports = ports
+	return tunnel, nil
+}
+
+// takenPortsLocked collects the local ports configured or assigned for every
+// tunnel other than name. Callers must hold m.mu.
+func (m *Manager) takenPortsLocked(name string) map[string]bool {
+	taken := make(map[string]bool)
+	for other, tunnel := range m.desired {
+		if other == name {
+			continue
+		}
+		for _, port := range tunnel.Ports {
+			if port.ListensLocally() && !port.IsAuto() {
+				taken[port.Local] = true
+			}
+		}
+		for _, local := range m.assigned[other] {
+			taken[local] = true
+		}
+	}
+	return taken
+}
+
+// pickPort returns previous when it is still free, or the first free port of
+// the range starting from a position derived from key.
+func (m *Manager) pickPort(key, previous string, first, last int, taken map[string]bool) (string, error) {
+	free := func(port string) (bool, error) {
+		if taken[port] {
+			return false, nil
+		}
+		process, err := m.checker.findListener(port)
+		return process == nil || m.adopting(process), err
+	}
+
+	if previous != "" {
+		if ok, err := free(previous); err != nil || ok {
+			return previous, err
+		}
+	}
+
+	size := last - first + 1
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	start := int(hash.Sum32() % uint32(size))
+	for i := 0; i < size && i < maxPortProbes; i++ {
+		port := strconv.Itoa(first + (start+i)%size)
+		ok, err := free(port)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return port, nil
+		}
+	}
+	return "", fmt.Errorf("no free local port found in %d-%d", first, last)
+}
+
+// waitForDependencies blocks until every tunnel in depends_on has all of its
+// ports active. It fails when a dependency stops or reports an error.
+func (m *Manager) waitForDependencies(ctx context.Context, name string, tunnel config.Tunnel) error {
+	if len(tunnel.DependsOn) == 0 {
+		return nil
+	}
+
+	reported := ""
+	for {
+		m.mu.Lock()
+		pending, err := m.pendingDependenciesLocked(tunnel)
+		changed := m.stateChanged
+		m.mu.Unlock()
+
+		if err != nil {
+			m.reportPorts(name, tunnel, fmt.Sprintf("error - %s", err.Error()))
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if waiting := "waiting for " + strings.Join(pending, ", "); waiting != reported {
+			m.reportPorts(name, tunnel, waiting)
+			reported = waiting
+		}
+
+		select {
+		case <-ctx.Done():
+			m.reportPorts(name, tunnel, "stopped")
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// pendingDependenciesLocked lists the dependencies of tunnel that are not
+// active yet. Callers must hold m.mu.
+func (m *Manager) pendingDependenciesLocked(tunnel config.Tunnel) ([]string, error) {
+	var pending []string
+	for _, dep := range tunnel.DependsOn {
+		want, desired := m.desired[dep]
+		if _, running := m.running[dep]; !desired || !running {
+			return nil, fmt.Errorf("dependency %q is not running", dep)
+		}
+		for _, port := range want.Ports {
+			state := m.states[dep][port.Mapping()]
+			if strings.HasPrefix(state, "error") {
+				return nil, fmt.Errorf("dependency %q failed", dep)
+			}
+			if state != "active" {
+				pending = append(pending, dep)
+				break
+			}
+		}
+	}
+	return pending, nil
+}
+
+// reportPorts sets the same status on every port of a tunnel.
+func (m *Manager) reportPorts(name string, tunnel config.Tunnel, status string) {
+	for _, port := range tunnel.Ports {
+		m.UpdateStatus(name, port.Mapping(), status)
+	}
 }
 
 func (m *Manager) ensurePortsAvailable(tunnelName string, tunnel config.Tunnel) error {
 	conflicts := make(map[string]string)
 	var conflictMessages []string
 
-	for _, mapping := range tunnel.Ports {
+	for _, port := range tunnel.Ports {
+		// Automatic ports were checked when they were picked.
+		if !port.ListensLocally() || port.IsAuto() {
+			continue
+		}
+		mapping := port.Mapping()
 		localPort, err := extractLocalPort(mapping)
 		if err != nil {
 			return fmt.Errorf("invalid port mapping %q: %w", mapping, err)
@@ -75,20 +904,21 @@ func (m *Manager) ensurePortsAvailable(tunnelName string, tunnel config.Tunnel)
 		if err != nil {
 			return err
 		}
-		if process != nil {
-			message := fmt.Sprintf("port %s is being used by \"%s\" (pid: %d)", localPort, process.command, process.pid)
+		if process != nil && !m.adopting(process) {
+			message := conflictMessage(localPort, process)
 			conflicts[mapping] = message
 			conflictMessages = append(conflictMessages, message)
 		}
 	}
 
 	if len(conflicts) > 0 {
-		for _, mapping := range tunnel.Ports {
+		for _, port := range tunnel.Ports {
+			mapping := port.Mapping()
 			status := "stopped"
 			if msg, ok := conflicts[mapping]; ok {
 				status = fmt.Sprintf("error - %s", msg)
 			}
-			m.reportStatus(tunnelName, mapping, status)
+			m.UpdateStatus(tunnelName, mapping, status)
 		}
 		return fmt.Errorf("%s", strings.Join(conflictMessages, "; "))
 	}
@@ -96,7 +926,34 @@ func (m *Manager) ensurePortsAvailable(tunnelName string, tunnel config.Tunnel)
 	return nil
 }
 
-func (m *Manager) reportStatus(tunnelName, mapping, status string) {
+// adopting reports whether process is an ssh process the executor is taking
+// over from a previous daemon.
+func (m *Manager) adopting(process *processInfo) bool {
+	a, ok := m.executor.(adopter)
+	return ok && a.Adopting(process.pid)
+}
+
+// portState returns the last status reported for a port of a tunnel.
+func (m *Manager) portState(tunnelName, mapping string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[tunnelName][mapping]
+}
+
+// UpdateStatus records the status of a tunnel port and forwards it to the
+// display and notifier.
+func (m *Manager) UpdateStatus(tunnelName, mapping, status string) {
+	m.mu.Lock()
+	ports, ok := m.states[tunnelName]
+	if !ok {
+		ports = make(map[string]string)
+		m.states[tunnelName] = ports
+	}
+	ports[mapping] = status
+	close(m.stateChanged)
+	m.stateChanged = make(chan struct{})
+	m.mu.Unlock()
+
 	if m.display != nil {
 		m.display.UpdateStatus(tunnelName, mapping, status)
 	}
@@ -2,6 +2,13 @@ package tunnel
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,11 +41,11 @@ func TestManagerRunTunnels(t *testing.T) {
 	tunnels := map[string]config.Tunnel{
 		"api": {
 			Host:  "server1",
-			Ports: []string{"3000:3000"},
+			Ports: []config.Port{{Local: "3000", Remote: "3000"}},
 		},
 		"db": {
 			Host:  "server2",
-			Ports: []string{"5432:5432"},
+			Ports: []config.Port{{Local: "5432", Remote: "5432"}},
 		},
 	}
 
@@ -77,7 +84,7 @@ func TestManagerRunSingleTunnel(t *testing.T) {
 	tunnels := map[string]config.Tunnel{
 		"api": {
 			Host:  "server1",
-			Ports: []string{"3000:3000", "4000:4000"},
+			Ports: []config.Port{{Local: "3000", Remote: "3000"}, {Local: "4000", Remote: "4000"}},
 		},
 	}
 
@@ -89,23 +96,22 @@ func TestManagerRunSingleTunnel(t *testing.T) {
 		t.Errorf("Expected context deadline exceeded, got %v", err)
 	}
 
-	if len(mock.Commands) != 1 {
-		t.Fatalf("Expected 1 command for tunnel, got %d", len(mock.Commands))
+	// Every forward runs in its own ssh process, so that it can be stopped
+	// and restarted on its own.
+	if len(mock.Commands) != 2 {
+		t.Fatalf("Expected 1 command per port, got %d", len(mock.Commands))
 	}
 
-	cmd := mock.Commands[0]
-	found3000 := false
-	found4000 := false
-	for i := 0; i < len(cmd)-1; i++ {
-		if cmd[i] == "-L" && cmd[i+1] == "3000:localhost:3000" {
-			found3000 = true
-		}
-		if cmd[i] == "-L" && cmd[i+1] == "4000:localhost:4000" {
-			found4000 = true
+	found := make(map[string]bool)
+	for _, cmd := range mock.Commands {
+		for i := 0; i < len(cmd)-1; i++ {
+			if cmd[i] == "-L" {
+				found[cmd[i+1]] = true
+			}
 		}
 	}
-	if !found3000 || !found4000 {
-		t.Fatalf("expected aggregated command to include both port mappings, got %v", cmd)
+	if !found["3000:localhost:3000"] || !found["4000:localhost:4000"] || len(found) != 2 {
+		t.Fatalf("expected one command for each port mapping, got %v", mock.Commands)
 	}
 }
 
@@ -118,7 +124,7 @@ func TestManagerCancellation(t *testing.T) {
 	tunnels := map[string]config.Tunnel{
 		"api": {
 			Host:  "server1",
-			Ports: []string{"3000:3000"},
+			Ports: []config.Port{{Local: "3000", Remote: "3000"}},
 		},
 	}
 
@@ -150,10 +156,10 @@ func TestManagerRunTunnelPortInUse(t *testing.T) {
 
 	tunnelCfg := config.Tunnel{
 		Host:  "server1",
-		Ports: []string{"3000:3000"},
+		Ports: []config.Port{{Local: "3000", Remote: "3000"}},
 	}
 
-	err := manager.runTunnel(context.Background(), "api", tunnelCfg)
+	err := manager.runTunnel(context.Background(), "api", newRunningTunnel(tunnelCfg, nil))
 	if err == nil {
 		t.Fatal("expected error when port is in use, got nil")
 	}
@@ -167,3 +173,568 @@ func TestManagerRunTunnelPortInUse(t *testing.T) {
 		t.Fatalf("expected executor not to run, but got %d commands", len(mock.Commands))
 	}
 }
+
+// recordingExecutor counts how often each tunnel forward is started and
+// stopped. The manager runs every forward on its own, so a tunnel with a
+// single port is started once per run.
+type recordingExecutor struct {
+	mu      sync.Mutex
+	starts  map[string]int
+	stops   map[string]int
+	running map[string]config.Tunnel
+	// specs holds the forward specs running for each tunnel.
+	specs map[string]map[string]string
+}
+
+func newRecordingExecutor() *recordingExecutor {
+	return &recordingExecutor{
+		starts:  make(map[string]int),
+		stops:   make(map[string]int),
+		running: make(map[string]config.Tunnel),
+		specs:   make(map[string]map[string]string),
+	}
+}
+
+func (r *recordingExecutor) Execute(ctx context.Context, name string, tunnel config.Tunnel) error {
+	r.mu.Lock()
+	r.starts[name]++
+	r.running[name] = tunnel
+	if r.specs[name] == nil {
+		r.specs[name] = make(map[string]string)
+	}
+	for _, port := range tunnel.Ports {
+		r.starts[name+"/"+port.Mapping()]++
+		r.specs[name][port.Mapping()] = port.ForwardSpec()
+	}
+	r.mu.Unlock()
+
+	<-ctx.Done()
+
+	r.mu.Lock()
+	r.stops[name]++
+	for _, port := range tunnel.Ports {
+		r.stops[name+"/"+port.Mapping()]++
+		delete(r.specs[name], port.Mapping())
+	}
+	if len(r.specs[name]) == 0 {
+		delete(r.running, name)
+	}
+	r.mu.Unlock()
+	return ctx.Err()
+}
+
+// forwards returns the forward specs running for a tunnel, sorted.
+func (r *recordingExecutor) forwards(name string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var specs []string
+	for _, spec := range r.specs[name] {
+		specs = append(specs, spec)
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+func (r *recordingExecutor) counts(name string) (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.starts[name], r.stops[name]
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManagerApply(t *testing.T) {
+	rec := newRecordingExecutor()
+	manager := NewManager(rec, nil, nil)
+	manager.checker = &stubPortChecker{}
+
+	initial := map[string]config.Tunnel{
+		"api":   {Host: "server1", Ports: []config.Port{{Local: "3000"}}},
+		"db":    {Host: "server2", Ports: []config.Port{{Local: "5432"}}},
+		"cache": {Host: "server3", Ports: []config.Port{{Local: "6379"}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.RunTunnels(ctx, initial)
+	}()
+	waitFor(t, func() bool {
+		a, _ := rec.counts("api")
+		d, _ := rec.counts("db")
+		c, _ := rec.counts("cache")
+		return a == 1 && d == 1 && c == 1
+	})
+
+	next := map[string]config.Tunnel{
+		"api":    initial["api"],
+		"db":     {Host: "server2-new", Ports: []config.Port{{Local: "5432"}}},
+		"search": {Host: "server4", Ports: []config.Port{{Local: "9200"}}},
+	}
+	diff, err := manager.Apply(next)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if strings.Join(diff.Added, ",") != "search" || strings.Join(diff.Removed, ",") != "cache" ||
+		strings.Join(diff.Changed, ",") != "db" || strings.Join(diff.Unchanged, ",") != "api" {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+
+	waitFor(t, func() bool {
+		s, _ := rec.counts("search")
+		d, _ := rec.counts("db")
+		return s == 1 && d == 2
+	})
+	if starts, stops := rec.counts("api"); starts != 1 || stops != 0 {
+		t.Fatalf("expected unchanged tunnel to be left alone, got %d starts %d stops", starts, stops)
+	}
+	if _, stops := rec.counts("cache"); stops != 1 {
+		t.Fatalf("expected removed tunnel to be stopped, got %d stops", stops)
+	}
+	if _, stops := rec.counts("db"); stops != 1 {
+		t.Fatalf("expected changed tunnel to be stopped once, got %d stops", stops)
+	}
+	rec.mu.Lock()
+	host := rec.running["db"].Host
+	rec.mu.Unlock()
+	if host != "server2-new" {
+		t.Fatalf("expected db to restart with new config, got host %s", host)
+	}
+
+	if got := manager.Tunnels(); len(got) != 3 {
+		t.Fatalf("expected manager to track 3 tunnels, got %d", len(got))
+	}
+
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if _, err := manager.Apply(next); err == nil {
+		t.Fatal("expected Apply to fail once the manager stopped")
+	}
+}
+
+// failingExecutor fails the first run of the tunnels in fail and records the
+// others like recordingExecutor.
+type failingExecutor struct {
+	*recordingExecutor
+	fail map[string]bool
+}
+
+func (f *failingExecutor) Execute(ctx context.Context, name string, tunnel config.Tunnel) error {
+	f.mu.Lock()
+	fail := f.fail[name]
+	delete(f.fail, name)
+	f.mu.Unlock()
+	if fail {
+		return errors.New("connection refused")
+	}
+	return f.recordingExecutor.Execute(ctx, name, tunnel)
+}
+
+func TestManagerStartAndRestart(t *testing.T) {
+	exec := &failingExecutor{recordingExecutor: newRecordingExecutor(), fail: map[string]bool{"db": true}}
+	manager := NewManager(exec, nil, nil)
+	manager.checker = &stubPortChecker{}
+
+	initial := map[string]config.Tunnel{
+		"api": {Host: "server1", Ports: []config.Port{{Local: "3000"}}},
+		"db":  {Host: "server2", Ports: []config.Port{{Local: "5432"}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.RunTunnels(ctx, initial)
+	}()
+	waitFor(t, func() bool {
+		a, _ := exec.counts("api")
+		manager.mu.Lock()
+		_, dbRunning := manager.running["db"]
+		manager.mu.Unlock()
+		return a == 1 && !dbRunning
+	})
+
+	cache := config.Tunnel{Host: "server3", Ports: []config.Port{{Local: "6379"}}}
+	diff, err := manager.Start(map[string]config.Tunnel{"db": initial["db"], "cache": cache})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if strings.Join(diff.Added, ",") != "cache" || strings.Join(diff.Changed, ",") != "db" || strings.Join(diff.Unchanged, ",") != "api" {
+		t.Fatalf("unexpected start diff: %+v", diff)
+	}
+	waitFor(t, func() bool {
+		d, _ := exec.counts("db")
+		c, _ := exec.counts("cache")
+		return d == 1 && c == 1
+	})
+
+	diff, err = manager.Start(map[string]config.Tunnel{"cache": cache})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if !diff.Empty() {
+		t.Fatalf("expected running tunnel to be left alone, got %+v", diff)
+	}
+
+	diff, err = manager.Restart("db")
+	if err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	if strings.Join(diff.Changed, ",") != "db" {
+		t.Fatalf("unexpected restart diff: %+v", diff)
+	}
+	waitFor(t, func() bool {
+		d, _ := exec.counts("db")
+		return d == 2
+	})
+	if starts, stops := exec.counts("api"); starts != 1 || stops != 0 {
+		t.Fatalf("expected other tunnels to be left alone, got %d starts %d stops", starts, stops)
+	}
+	if starts, stops := exec.counts("cache"); starts != 1 || stops != 0 {
+		t.Fatalf("expected other tunnels to be left alone, got %d starts %d stops", starts, stops)
+	}
+
+	if _, err := manager.Restart("search"); err == nil || err.Error() != `tunnel "search" is not managed by the daemon` {
+		t.Fatalf("expected unknown tunnel error, got %v", err)
+	}
+
+	cancel()
+	<-errCh
+}
+
+// gatedExecutor reports a tunnel's ports active once the test releases it,
+// recording the order in which tunnels start and stop.
+type gatedExecutor struct {
+	report  func(string, string, string)
+	mu      sync.Mutex
+	events  []string
+	release map[string]chan struct{}
+}
+
+func newGatedExecutor(names ...string) *gatedExecutor {
+	g := &gatedExecutor{release: make(map[string]chan struct{})}
+	for _, name := range names {
+		g.release[name] = make(chan struct{})
+	}
+	return g
+}
+
+func (g *gatedExecutor) Execute(ctx context.Context, name string, tunnel config.Tunnel) error {
+	g.record("start " + name)
+	select {
+	case <-g.release[name]:
+		for _, port := range tunnel.Ports {
+			g.report(name, port.Mapping(), "active")
+		}
+	case <-ctx.Done():
+	}
+	<-ctx.Done()
+	g.record("stop " + name)
+	return ctx.Err()
+}
+
+func (g *gatedExecutor) record(event string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.events = append(g.events, event)
+}
+
+func (g *gatedExecutor) log() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return strings.Join(g.events, ",")
+}
+
+func TestManagerDependencies(t *testing.T) {
+	gate := newGatedExecutor("hop1", "hop2", "app")
+	var statusMu sync.Mutex
+	statuses := make(map[string]string)
+	manager := NewManager(gate, nil, func(name, port, state string) {
+		statusMu.Lock()
+		defer statusMu.Unlock()
+		statuses[name+" "+port] = state
+	})
+	manager.checker = &stubPortChecker{}
+	gate.report = manager.UpdateStatus
+
+	tunnels := map[string]config.Tunnel{
+		"app":  {Host: "app", Ports: []config.Port{{Local: "3000"}}, DependsOn: []string{"hop2"}},
+		"hop2": {Host: "inner", Ports: []config.Port{{Local: "2223"}}, DependsOn: []string{"hop1"}},
+		"hop1": {Host: "bastion", Ports: []config.Port{{Local: "2222"}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.RunTunnels(ctx, tunnels)
+	}()
+
+	waitFor(t, func() bool {
+		statusMu.Lock()
+		defer statusMu.Unlock()
+		return gate.log() == "start hop1" && statuses["hop2 2223:2223"] == "waiting for hop1" && statuses["app 3000:3000"] == "waiting for hop2"
+	})
+	close(gate.release["hop1"])
+	waitFor(t, func() bool { return gate.log() == "start hop1,start hop2" })
+	close(gate.release["hop2"])
+	waitFor(t, func() bool { return gate.log() == "start hop1,start hop2,start app" })
+	close(gate.release["app"])
+
+	next := map[string]config.Tunnel{
+		"app":  tunnels["app"],
+		"hop2": tunnels["hop2"],
+		"hop1": {Host: "bastion-new", Ports: []config.Port{{Local: "2222"}}},
+	}
+	diff, err := manager.Apply(next)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := strings.Join(diff.Changed, ","); got != "app,hop1,hop2" || len(diff.Unchanged) != 0 {
+		t.Fatalf("expected dependents to restart with hop1, got %+v", diff)
+	}
+	want := "start hop1,start hop2,start app,stop app,stop hop2,stop hop1,start hop1,start hop2,start app"
+	waitFor(t, func() bool { return gate.log() == want })
+
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
+
+func TestManagerDependencyFailure(t *testing.T) {
+	rec := newRecordingExecutor()
+	manager := NewManager(rec, nil, nil)
+	manager.checker = &stubPortChecker{
+		listeners: map[string]*processInfo{"2222": {command: "sshd", pid: 7}},
+	}
+
+	tunnels := map[string]config.Tunnel{
+		"hop1": {Host: "bastion", Ports: []config.Port{{Local: "2222"}}},
+		"hop2": {Host: "inner", Ports: []config.Port{{Local: "5432"}}, DependsOn: []string{"hop1"}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := manager.RunTunnels(ctx, tunnels); err == nil || err == context.DeadlineExceeded {
+		t.Fatalf("expected the dependency failure to stop the manager, got %v", err)
+	}
+	if starts, _ := rec.counts("hop2"); starts != 0 {
+		t.Fatalf("expected hop2 never to connect, got %d starts", starts)
+	}
+}
+
+func TestManagerAssignsAutoPorts(t *testing.T) {
+	rec := newRecordingExecutor()
+	manager := NewManager(rec, nil, nil)
+	manager.checker = &stubPortChecker{
+		listeners: map[string]*processInfo{"30000": {command: "postgres", pid: 11}},
+	}
+	manager.SetAutoPortRange(30000, 30002)
+	var assignedMu sync.Mutex
+	assigned := make(map[string]string)
+	manager.OnPortAssigned(func(name, mapping, local string) {
+		assignedMu.Lock()
+		defer assignedMu.Unlock()
+		assigned[name+" "+mapping] = local
+	})
+
+	tunnels := map[string]config.Tunnel{
+		"db":  {Host: "server1", Ports: []config.Port{{Local: config.AutoPort, Remote: "5432"}}},
+		"api": {Host: "server2", Ports: []config.Port{{Local: "30001"}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.RunTunnels(ctx, tunnels)
+	}()
+
+	runningPort := func() string {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		if db, ok := rec.running["db"]; ok {
+			return db.Ports[0].ForwardSpec()
+		}
+		return ""
+	}
+	waitFor(t, func() bool { return runningPort() == "30002:localhost:5432" })
+	assignedMu.Lock()
+	if got := assigned["db auto:5432"]; got != "30002" {
+		t.Fatalf("expected the assigned port to be reported, got %q", got)
+	}
+	assignedMu.Unlock()
+
+	if _, err := manager.Apply(map[string]config.Tunnel{
+		"db": {Host: "server1-new", Ports: tunnels["db"].Ports},
+	}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	waitFor(t, func() bool {
+		starts, _ := rec.counts("db")
+		return starts == 2 && runningPort() == "30002:localhost:5432"
+	})
+
+	cancel()
+	<-errCh
+}
+
+func TestManagerAutoPortsExhausted(t *testing.T) {
+	rec := newRecordingExecutor()
+	manager := NewManager(rec, nil, nil)
+	manager.checker = &stubPortChecker{
+		listeners: map[string]*processInfo{"30000": {command: "postgres", pid: 11}},
+	}
+	manager.SetAutoPortRange(30000, 30000)
+
+	err := manager.runTunnel(context.Background(), "db", newRunningTunnel(config.Tunnel{
+		Host:  "server1",
+		Ports: []config.Port{{Local: config.AutoPort, Remote: "5432"}},
+	}, nil))
+	if err == nil || err.Error() != "no free local port found in 30000-30000" {
+		t.Fatalf("expected exhausted range error, got %v", err)
+	}
+}
+
+// adoptingExecutor reports a set of processes as handed over by a previous
+// daemon.
+type adoptingExecutor struct {
+	*recordingExecutor
+	pids map[int]bool
+}
+
+func (a *adoptingExecutor) Adopting(pid int) bool {
+	return a.pids[pid]
+}
+
+func TestManagerAdoptedPorts(t *testing.T) {
+	exec := &adoptingExecutor{recordingExecutor: newRecordingExecutor(), pids: map[int]bool{77: true, 78: true}}
+	manager := NewManager(exec, nil, nil)
+	manager.checker = &stubPortChecker{
+		listeners: map[string]*processInfo{
+			"3000":  {command: "ssh", pid: 77},
+			"30001": {command: "ssh", pid: 78},
+		},
+	}
+	manager.SetAutoPortRange(30000, 30002)
+	manager.RestorePorts(map[string]map[string]string{"api": {"auto:8080": "30001"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- manager.runTunnel(ctx, "api", newRunningTunnel(config.Tunnel{
+			Host:  "server1",
+			Ports: []config.Port{{Local: "3000", Remote: "3000"}, {Local: config.AutoPort, Remote: "8080"}},
+		}, nil))
+	}()
+
+	waitFor(t, func() bool {
+		forwards := exec.forwards("api")
+		return len(forwards) == 2 && slices.Contains(forwards, "30001:localhost:8080")
+	})
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the tunnel to run until cancelled, got %v", err)
+	}
+}
+
+func TestManagerPortOperations(t *testing.T) {
+	rec := newRecordingExecutor()
+	manager := NewManager(rec, nil, nil)
+	manager.checker = &stubPortChecker{}
+
+	pg, redis := config.Port{Local: "5432"}, config.Port{Local: "6379"}
+	tunnels := map[string]config.Tunnel{
+		"db":  {Host: "server1", Ports: []config.Port{pg, redis}},
+		"app": {Host: "server2", Ports: []config.Port{{Local: "3000"}}, DependsOn: []string{"db"}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.RunTunnels(ctx, tunnels)
+	}()
+	// The recording executor never reports ports active, so app keeps
+	// waiting for db and is never started.
+	waitFor(t, func() bool { return len(rec.forwards("db")) == 2 })
+
+	counts := func(forward string) string {
+		starts, stops := rec.counts(forward)
+		return fmt.Sprintf("%d/%d", starts, stops)
+	}
+	expect := func(want map[string]string) {
+		t.Helper()
+		waitFor(t, func() bool {
+			for forward, count := range want {
+				if counts(forward) != count {
+					return false
+				}
+			}
+			return true
+		})
+	}
+
+	if err := manager.RestartPort("db", "5432:5432"); err != nil {
+		t.Fatalf("RestartPort failed: %v", err)
+	}
+	expect(map[string]string{"db/5432:5432": "2/1", "db/6379:6379": "1/0"})
+
+	if err := manager.StopPort("db", "6379:6379"); err != nil {
+		t.Fatalf("StopPort failed: %v", err)
+	}
+	expect(map[string]string{"db/5432:5432": "2/1", "db/6379:6379": "1/1"})
+	if got := manager.Tunnels()["db"].Ports; !reflect.DeepEqual(got, []config.Port{pg}) {
+		t.Fatalf("expected db to keep only 5432, got %v", got)
+	}
+	if err := manager.StopPort("db", "5432:5432"); err == nil {
+		t.Fatal("expected stopping the last port to be refused")
+	}
+
+	if err := manager.StartPort("db", tunnels["db"], "6379:6379"); err != nil {
+		t.Fatalf("StartPort failed: %v", err)
+	}
+	expect(map[string]string{"db/5432:5432": "2/1", "db/6379:6379": "2/1"})
+	if got := manager.Tunnels()["db"]; !reflect.DeepEqual(got, tunnels["db"]) {
+		t.Fatalf("expected db to run both ports again, got %v", got)
+	}
+
+	manager.mu.Lock()
+	_, appRunning := manager.running["app"]
+	manager.mu.Unlock()
+	if !appRunning {
+		t.Fatal("expected the dependent tunnel to be left alone")
+	}
+	if starts, _ := rec.counts("app"); starts != 0 {
+		t.Fatalf("expected the dependent tunnel not to be restarted, got %d starts", starts)
+	}
+
+	if err := manager.RestartPort("db", "8080:8080"); err == nil || err.Error() != `tunnel "db" has no running port "8080:8080"` {
+		t.Fatalf("expected unknown port error, got %v", err)
+	}
+	if err := manager.StopPort("cache", "6379:6379"); err == nil || err.Error() != `tunnel "cache" is not running` {
+		t.Fatalf("expected unknown tunnel error, got %v", err)
+	}
+
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if counts("db/5432:5432") != "2/2" || counts("db/6379:6379") != "2/2" {
+		t.Fatalf("expected every forward to be stopped, got %s and %s", counts("db/5432:5432"), counts("db/6379:6379"))
+	}
+}
@@ -76,6 +76,20 @@ func (c *systemPortChecker) findListener(port string) (*processInfo, error) {
 	return nil, nil
 }
 
+// LocalPortConflict describes the process already listening on the local TCP
+// port, or returns an empty string when the port is free.
+func LocalPortConflict(port string) (string, error) {
+	process, err := newSystemPortChecker().findListener(port)
+	if err != nil || process == nil {
+		return "", err
+	}
+	return conflictMessage(port, process), nil
+}
+
+func conflictMessage(port string, process *processInfo) string {
+	return fmt.Sprintf("port %s is being used by \"%s\" (pid: %d)", port, process.command, process.pid)
+}
+
 func extractLocalPort(mapping string) (string, error) {
 	mapping = strings.TrimSpace(mapping)
 	if mapping == "" {
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/daemon"
+	"github.com/strandnerd/tunn/executor"
+	"github.com/strandnerd/tunn/inherit"
+	"github.com/strandnerd/tunn/status"
+	"github.com/strandnerd/tunn/version"
+)
+
+// adoptionGrace bounds how long handed over ssh processes wait for their
+// tunnel to claim them before they are stopped.
+const adoptionGrace = 10 * time.Second
+
+// handover is the state a daemon passes to the binary it upgrades to, which
+// inherits its control socket and ssh processes.
+type handover struct {
+	Version  string                       `json:"version"`
+	Listener int                          `json:"listener"`
+	Tunnels  map[string]config.Tunnel     `json:"tunnels"`
+	Local    map[string]map[string]string `json:"local,omitempty"`
+	Children []executor.Child             `json:"children,omitempty"`
+
+	Started      []string                   `json:"started,omitempty"`
+	Stopped      map[string]bool            `json:"stopped,omitempty"`
+	StoppedPorts map[string]map[string]bool `json:"stopped_ports,omitempty"`
+}
+
+// daemonUpgrader implements daemon.Upgrader by re-executing the daemon's
+// binary in place, so the pid and the ssh children stay the same.
+type daemonUpgrader struct {
+	paths      daemon.Paths
+	controller *daemonController
+	exec       *executor.RealSSHExecutor
+	logger     *log.Logger
+	mu         sync.Mutex
+}
+
+// PrepareUpgrade runs the binary the daemon was started from to learn its
+// version, which also checks that it still works.
+func (u *daemonUpgrader) PrepareUpgrade() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate executable: %w", err)
+	}
+	out, err := exec.Command(executable, "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("new binary %s does not run: %w", executable, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Upgrade writes the handover state and re-executes the binary with the
+// daemon's arguments. The controller stays locked so that no tunnel changes
+// while its state is captured.
+func (u *daemonUpgrader) Upgrade(listener *os.File) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	c := u.controller
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := u.upgrade(listener)
+	_ = os.Remove(u.paths.HandoverFile)
+	u.logger.Printf("upgrade failed: %v", err)
+	return err
+}
+
+func (u *daemonUpgrader) upgrade(listener *os.File) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	fd, err := inherit.Descriptor(listener)
+	if err != nil {
+		return fmt.Errorf("failed to hand over the control socket: %w", err)
+	}
+
+	c := u.controller
+	children, files := u.exec.Handover()
+	state := handover{
+		Version:      version.String(),
+		Listener:     fd,
+		Tunnels:      c.manager.Tunnels(),
+		Local:        localPorts(c.store.Snapshot()),
+		Children:     children,
+		Started:      c.started,
+		Stopped:      c.stopped,
+		StoppedPorts: c.stoppedPorts,
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode handover state: %w", err)
+	}
+	if err := os.WriteFile(u.paths.HandoverFile, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write handover state: %w", err)
+	}
+
+	u.logger.Printf("upgrading to %s, handing over %d ssh processes", executable, len(children))
+	env := append(os.Environ(), daemon.HandoverEnv+"="+u.paths.HandoverFile)
+	return daemon.Exec(executable, os.Args, env, append(files, listener))
+}
+
+// localPorts collects the automatic local ports from a status snapshot.
+func localPorts(tunnels []status.Tunnel) map[string]map[string]string {
+	local := make(map[string]map[string]string)
+	for _, tun := range tunnels {
+		if len(tun.Local) > 0 {
+			local[tun.Name] = tun.Local
+		}
+	}
+	return local
+}
+
+// loadHandover reads the state left by the daemon this process replaced, if
+// it was started by an upgrade. The file is removed once read.
+func loadHandover() (*handover, error) {
+	path := os.Getenv(daemon.HandoverEnv)
+	if path == "" {
+		return nil, nil
+	}
+	os.Unsetenv(daemon.HandoverEnv)
+
+	data, err := os.ReadFile(path)
+	_ = os.Remove(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read handover state: %w", err)
+	}
+	var state handover
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode handover state: %w", err)
+	}
+	if state.Listener > 0 {
+		inherit.CloseOnExec(state.Listener)
+	}
+	return &state, nil
+}
+
+// inheritedListener returns the control socket handed over by the previous
+// daemon.
+func (h *handover) inheritedListener() (net.Listener, error) {
+	f := os.NewFile(uintptr(h.Listener), "control socket")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inherit the control socket: %w", err)
+	}
+	return ln, nil
+}
+
+// abandon stops the handed over ssh processes when the daemon cannot take
+// them over.
+func (h *handover) abandon() {
+	sshExec := &executor.RealSSHExecutor{}
+	sshExec.Adopt(h.Children)
+	sshExec.ReleaseAdopted()
+}
+
+func runDaemonAction(paths daemon.Paths, opts *cli.Options) error {
+	switch opts.DaemonAction {
+	case "run":
+		return runDaemonCommand(paths, opts)
+	case "upgrade":
+		return runUpgradeCommand(paths)
+	default:
+		return fmt.Errorf("unknown daemon action: %s", opts.DaemonAction)
+	}
+}
+
+// runUpgradeCommand asks the daemon to re-execute its binary and waits for
+// the new binary to answer on the control socket.
+func runUpgradeCommand(paths daemon.Paths) error {
+	pid, running, err := daemon.CheckRunning(paths)
+	if err != nil {
+		return err
+	}
+	if !running {
+		return fmt.Errorf("tunn daemon not running")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	before, err := daemon.Handshake(ctx, paths)
+	if err != nil {
+		return requestError("failed to contact the daemon", err)
+	}
+	resp, err := daemon.SendUpgrade(ctx, paths)
+	if err != nil {
+		return requestError("failed to send upgrade command", err)
+	}
+	if err := resp.Err(); err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	fmt.Printf("upgrading tunn daemon (pid %d) from %s to %s...\n", pid, before.Version, resp.Message)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		if _, stillRunning, _ := daemon.CheckRunning(paths); !stillRunning {
+			if msg, logErr := tailLogMessage(paths.LogFile); logErr == nil && msg != "" {
+				return fmt.Errorf("daemon exited during the upgrade: %s", msg)
+			}
+			return fmt.Errorf("daemon exited during the upgrade")
+		}
+		after, err := daemon.Handshake(ctx, paths)
+		if err == nil && after.Started.After(before.Started) {
+			fmt.Printf("tunn daemon (pid %d) upgraded to %s\n", after.PID, after.Version)
+			return nil
+		}
+	}
+	return fmt.Errorf("daemon did not come back after the upgrade; see %s", paths.LogFile)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/strandnerd/tunn/daemon"
+	"github.com/strandnerd/tunn/output"
+	"github.com/strandnerd/tunn/status"
+)
+
+// runStatusWatch follows the daemon's status as it changes. On a terminal it
+// keeps the tunnel display up to date; otherwise it prints the watch events
+// as newline-delimited JSON for scripts.
+func runStatusWatch(paths daemon.Paths) error {
+	_, running, err := daemon.CheckRunning(paths)
+	if err != nil {
+		return err
+	}
+	if !running {
+		return fmt.Errorf("tunn daemon not running")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	handle := printWatchEvent(json.NewEncoder(os.Stdout))
+	if isTerminal(os.Stdout) {
+		handle = newWatchDisplay().apply
+	}
+
+	err = daemon.Watch(ctx, paths, handle)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return nil
+	case errors.Is(err, io.EOF):
+		fmt.Fprintln(os.Stderr, "tunn daemon stopped")
+		return nil
+	}
+	return err
+}
+
+func printWatchEvent(encoder *json.Encoder) func(daemon.WatchEvent) error {
+	return func(event daemon.WatchEvent) error {
+		return encoder.Encode(event)
+	}
+}
+
+// watchDisplay renders watch events with the same display as tunn status.
+type watchDisplay struct {
+	display *output.Display
+	cache   map[string]string
+	profile string
+	pid     int
+	tunnels map[string]status.Tunnel
+}
+
+func newWatchDisplay() *watchDisplay {
+	return &watchDisplay{tunnels: make(map[string]status.Tunnel)}
+}
+
+func (w *watchDisplay) apply(event daemon.WatchEvent) error {
+	switch event.Type {
+	case daemon.WatchSnapshot:
+		w.profile, w.pid = event.Profile, event.PID
+		w.tunnels = make(map[string]status.Tunnel, len(event.Tunnels))
+		for _, tun := range event.Tunnels {
+			w.tunnels[tun.Name] = tun
+		}
+		w.redraw()
+	case daemon.WatchPort:
+		tun, ok := w.tunnels[event.Tunnel]
+		if !ok {
+			tun = status.Tunnel{Name: event.Tunnel, Ports: make(map[string]string)}
+			w.tunnels[event.Tunnel] = tun
+		}
+		if event.State == status.StateRemoved {
+			delete(tun.Ports, event.Port)
+			if len(tun.Ports) == 0 {
+				delete(w.tunnels, event.Tunnel)
+			}
+			// The display cannot drop ports, so start over without it.
+			w.redraw()
+			return nil
+		}
+		tun.Ports[event.Port] = event.State
+		if event.Local != "" {
+			if tun.Local == nil {
+				tun.Local = make(map[string]string)
+				w.tunnels[event.Tunnel] = tun
+			}
+			tun.Local[event.Port] = event.Local
+			w.display.SetLocalPort(event.Tunnel, event.Port, event.Local)
+		}
+		w.cache[event.Tunnel+"|"+event.Port] = event.State
+		w.display.UpdateStatus(event.Tunnel, event.Port, event.State)
+	}
+	return nil
+}
+
+func (w *watchDisplay) redraw() {
+	resp := &daemon.StatusResponse{Running: true, Mode: "daemon", PID: w.pid, Profile: w.profile}
+	for _, tun := range w.tunnels {
+		resp.Tunnels = append(resp.Tunnels, tun)
+	}
+	w.display = output.NewDisplay()
+	w.cache = make(map[string]string)
+	applySnapshotToDisplay(w.display, resp, w.cache)
+	w.display.SetFooter(fmt.Sprintf("Watching daemon (pid %d) — press Ctrl+C to stop", w.pid))
+}
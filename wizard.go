@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/strandnerd/tunn/cli"
+	"github.com/strandnerd/tunn/config"
+	"github.com/strandnerd/tunn/sshconfig"
+	"github.com/strandnerd/tunn/tunnel"
+)
+
+func runInitCommand(opts *cli.Options) error {
+	interactive := opts.Host == ""
+	if interactive && (opts.Name != "" || len(opts.Ports) > 0) {
+		return fmt.Errorf("--name and --port require --host")
+	}
+	if !interactive && len(opts.Ports) == 0 {
+		return fmt.Errorf("--host requires at least one --port")
+	}
+	if interactive && !isTerminal(os.Stdin) {
+		return fmt.Errorf("stdin is not a terminal; use --host and --port to create a configuration non-interactively")
+	}
+
+	prompter := cli.NewPrompter(os.Stdin, os.Stdout)
+	path, err := initTargetPath(opts, prompter, interactive)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := checkEditable(path, data); err != nil {
+		return err
+	}
+	existing, err := existingTunnels(path, data)
+	if err != nil {
+		return err
+	}
+
+	var entries []config.TunnelEntry
+	if interactive {
+		entries, err = runInitWizard(prompter, existing)
+		if err != nil {
+			return err
+		}
+	} else {
+		entry, err := initEntryFromFlags(opts, existing)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+
+	var content []byte
+	if len(data) == 0 {
+		content, err = config.NewFile(entries)
+	} else {
+		content, err = config.AppendTunnels(data, entries)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	if errs := config.Errors(config.Validate(path, content)); len(errs) > 0 {
+		for _, diag := range errs {
+			fmt.Fprintln(os.Stderr, diag.String())
+		}
+		return fmt.Errorf("the new tunnels conflict with %s; nothing was written", path)
+	}
+
+	if err := writeConfigFile(path, content); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d tunnel(s) to %s. Start them with 'tunn'.\n", len(entries), path)
+	return nil
+}
+
+// initTargetPath picks the global file or, with --project or when chosen at
+// the prompt, a .tunnrc in the working directory.
+func initTargetPath(opts *cli.Options, prompter *cli.Prompter, interactive bool) (string, error) {
+	global, err := config.DefaultPath()
+	if err != nil {
+		return "", err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine working directory: %w", err)
+	}
+	project := filepath.Join(wd, config.FileName)
+	if project == global {
+		return global, nil
+	}
+
+	if opts.Project {
+		return project, nil
+	}
+	if !interactive {
+		return global, nil
+	}
+
+	useProject, err := prompter.Confirm(fmt.Sprintf("Create a project-local %s instead of %s?", project, tildePath(global)), false)
+	if err != nil {
+		return "", err
+	}
+	if useProject {
+		return project, nil
+	}
+	return global, nil
+}
+
+func initEntryFromFlags(opts *cli.Options, existing map[string]config.Tunnel) (config.TunnelEntry, error) {
+	name := opts.Name
+	if name == "" {
+		name = sshconfig.TunnelName(opts.Host)
+	}
+	if err := checkNewTunnelName(name, existing); err != nil {
+		return config.TunnelEntry{}, err
+	}
+
+	ports, conflicts, err := parsePortAnswer(strings.Join(opts.Ports, ","))
+	if err != nil {
+		return config.TunnelEntry{}, err
+	}
+	if len(conflicts) > 0 {
+		return config.TunnelEntry{}, fmt.Errorf("%s", strings.Join(conflicts, "; "))
+	}
+	return config.TunnelEntry{Name: name, Tunnel: config.Tunnel{Host: opts.Host, Ports: ports}}, nil
+}
+
+func runInitWizard(prompter *cli.Prompter, existing map[string]config.Tunnel) ([]config.TunnelEntry, error) {
+	var aliases []string
+	if sshPath, err := sshconfig.DefaultPath(); err == nil {
+		if sshCfg, err := sshconfig.ParseFile(sshPath); err == nil {
+			aliases = sshCfg.Aliases()
+		}
+	}
+
+	taken := make(map[string]config.Tunnel, len(existing))
+	for name, tun := range existing {
+		taken[name] = tun
+	}
+
+	var entries []config.TunnelEntry
+	for {
+		if len(aliases) > 0 {
+			fmt.Println("\nHosts from ~/.ssh/config:")
+			for i, alias := range aliases {
+				fmt.Printf("  %2d) %s\n", i+1, alias)
+			}
+		}
+
+		host, err := askHost(prompter, aliases)
+		if err != nil {
+			return nil, err
+		}
+
+		var name string
+		for {
+			name, err = prompter.Ask("Tunnel name", sshconfig.TunnelName(host))
+			if err != nil {
+				return nil, err
+			}
+			if err := checkNewTunnelName(name, taken); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			break
+		}
+
+		ports, err := askPorts(prompter)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := config.TunnelEntry{Name: name, Tunnel: config.Tunnel{Host: host, Ports: ports}}
+		entries = append(entries, entry)
+		taken[name] = entry.Tunnel
+
+		another, err := prompter.Confirm("Add another tunnel?", false)
+		if err != nil {
+			return nil, err
+		}
+		if !another {
+			return entries, nil
+		}
+	}
+}
+
+func askHost(prompter *cli.Prompter, aliases []string) (string, error) {
+	question := "SSH host"
+	if len(aliases) > 0 {
+		question = "SSH host (number or alias)"
+	}
+	for {
+		answer, err := prompter.Ask(question, "")
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			continue
+		}
+		if index, err := strconv.Atoi(answer); err == nil && len(aliases) > 0 {
+			if index < 1 || index > len(aliases) {
+				fmt.Printf("Pick a number between 1 and %d.\n", len(aliases))
+				continue
+			}
+			return aliases[index-1], nil
+		}
+		if strings.ContainsAny(answer, " /") {
+			fmt.Println("Host must be an ssh alias or host name.")
+			continue
+		}
+		return answer, nil
+	}
+}
+
+func askPorts(prompter *cli.Prompter) ([]config.Port, error) {
+	for {
+		answer, err := prompter.Ask("Ports to forward (e.g. 5432, 15432:5432, 9092-9094)", "")
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			continue
+		}
+		ports, conflicts, err := parsePortAnswer(answer)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if len(conflicts) == 0 {
+			return ports, nil
+		}
+		for _, conflict := range conflicts {
+			fmt.Printf("warning: %s\n", conflict)
+		}
+		keep, err := prompter.Confirm("Keep these ports anyway?", false)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			return ports, nil
+		}
+	}
+}
+
+// parsePortAnswer parses comma or space separated port entries and checks
+// each local port against the processes already listening on this machine.
+func parsePortAnswer(answer string) ([]config.Port, []string, error) {
+	var ports []config.Port
+	var conflicts []string
+	for _, spec := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ' ' }) {
+		mappings, err := config.ParsePortMappings(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, mapping := range mappings {
+			conflict, err := tunnel.LocalPortConflict(strconv.Itoa(mapping.Local))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+				continue
+			}
+			if conflict != "" {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+		ports = append(ports, config.ParsePort(spec))
+	}
+	if len(ports) == 0 {
+		return nil, nil, fmt.Errorf("no ports given")
+	}
+	return ports, conflicts, nil
+}
+
+func checkNewTunnelName(name string, existing map[string]config.Tunnel) error {
+	if strings.TrimSpace(name) == "" || strings.ContainsAny(name, "/@ ") {
+		return fmt.Errorf("tunnel name %q must be non-empty and must not contain '/', '@' or spaces", name)
+	}
+	if _, ok := existing[name]; ok {
+		return fmt.Errorf("tunnel %q already exists", name)
+	}
+	return nil
+}